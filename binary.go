@@ -0,0 +1,931 @@
+package rulesengine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/schematichq/rulesengine/typeconvert"
+)
+
+// The binary encoding is a compact alternative to JSON for the wire models,
+// intended for hot paths such as sidecars that decode large companies on
+// every request. It round-trips losslessly with the JSON form and
+// additionally preserves the distinction between nil and empty slices and
+// maps, which JSON cannot represent for JSONSlice fields.
+//
+// Each payload starts with a short header: the magic bytes "RE", a format
+// version, and a byte identifying the model, so decoding a payload into the
+// wrong type fails instead of producing garbage. Integers are varints,
+// strings are length-prefixed, and optional values carry a presence byte.
+
+const binaryFormatVersion byte = 1
+
+var binaryMagic = [2]byte{'R', 'E'}
+
+type binaryModel byte
+
+const (
+	binaryModelCompany binaryModel = iota + 1
+	binaryModelUser
+	binaryModelFlag
+	binaryModelCheckFlagResult
+)
+
+// ErrInvalidBinary is returned when a payload is truncated, corrupt, or was
+// encoded for a different model or format version.
+var ErrInvalidBinary = errors.New("invalid binary encoding")
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (c *Company) MarshalBinary() ([]byte, error) {
+	e := newBinaryEncoder(binaryModelCompany)
+	e.company(c)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (c *Company) UnmarshalBinary(data []byte) error {
+	d, err := newBinaryDecoder(data, binaryModelCompany)
+	if err != nil {
+		return err
+	}
+	d.company(c)
+	return d.finish()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (u *User) MarshalBinary() ([]byte, error) {
+	e := newBinaryEncoder(binaryModelUser)
+	e.user(u)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (u *User) UnmarshalBinary(data []byte) error {
+	d, err := newBinaryDecoder(data, binaryModelUser)
+	if err != nil {
+		return err
+	}
+	d.user(u)
+	return d.finish()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (f *Flag) MarshalBinary() ([]byte, error) {
+	e := newBinaryEncoder(binaryModelFlag)
+	e.flag(f)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (f *Flag) UnmarshalBinary(data []byte) error {
+	d, err := newBinaryDecoder(data, binaryModelFlag)
+	if err != nil {
+		return err
+	}
+	d.flag(f)
+	return d.finish()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. Err is encoded as its
+// ErrorDetail and decodes as ErrorDetail.Err does.
+func (r *CheckFlagResult) MarshalBinary() ([]byte, error) {
+	e := newBinaryEncoder(binaryModelCheckFlagResult)
+	e.checkFlagResult(r)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (r *CheckFlagResult) UnmarshalBinary(data []byte) error {
+	d, err := newBinaryDecoder(data, binaryModelCheckFlagResult)
+	if err != nil {
+		return err
+	}
+	d.checkFlagResult(r)
+	return d.finish()
+}
+
+// Encoding
+
+type binaryEncoder struct {
+	buf []byte
+}
+
+func newBinaryEncoder(model binaryModel) *binaryEncoder {
+	e := &binaryEncoder{buf: make([]byte, 0, 256)}
+	e.buf = append(e.buf, binaryMagic[0], binaryMagic[1], binaryFormatVersion, byte(model))
+	return e
+}
+
+func (e *binaryEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *binaryEncoder) int(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *binaryEncoder) uint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *binaryEncoder) float(v float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *binaryEncoder) string(v string) {
+	e.uint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// time encodes wall time and zone offset, which is everything the JSON form
+// (RFC 3339) carries. Monotonic clock readings are dropped.
+func (e *binaryEncoder) time(v time.Time) {
+	_, offset := v.Zone()
+	e.int(v.Unix())
+	e.int(int64(v.Nanosecond()))
+	e.int(int64(offset))
+}
+
+// present writes the presence byte for an optional value and reports
+// whether the value itself should follow.
+func (e *binaryEncoder) present(ok bool) bool {
+	e.bool(ok)
+	return ok
+}
+
+// length writes the length of a slice or map, using 0 for nil and n+1
+// otherwise so nil and empty collections stay distinct.
+func (e *binaryEncoder) length(isNil bool, n int) {
+	if isNil {
+		e.uint(0)
+		return
+	}
+	e.uint(uint64(n) + 1)
+}
+
+func (e *binaryEncoder) optionalString(v *string) {
+	if e.present(v != nil) {
+		e.string(*v)
+	}
+}
+
+func (e *binaryEncoder) optionalInt(v *int64) {
+	if e.present(v != nil) {
+		e.int(*v)
+	}
+}
+
+func (e *binaryEncoder) optionalFloat(v *float64) {
+	if e.present(v != nil) {
+		e.float(*v)
+	}
+}
+
+func (e *binaryEncoder) optionalTime(v *time.Time) {
+	if e.present(v != nil) {
+		e.time(*v)
+	}
+}
+
+func (e *binaryEncoder) strings(v []string) {
+	e.length(v == nil, len(v))
+	for _, s := range v {
+		e.string(s)
+	}
+}
+
+// stringMap writes entries in key order so encoding is deterministic.
+func (e *binaryEncoder) stringMap(v map[string]string) {
+	e.length(v == nil, len(v))
+	for _, key := range sortedKeys(v) {
+		e.string(key)
+		e.string(v[key])
+	}
+}
+
+func (e *binaryEncoder) floatMap(v map[string]float64) {
+	e.length(v == nil, len(v))
+	for _, key := range sortedKeys(v) {
+		e.string(key)
+		e.float(v[key])
+	}
+}
+
+func (e *binaryEncoder) company(c *Company) {
+	e.string(c.ID)
+	e.string(c.AccountID)
+	e.string(c.EnvironmentID)
+	e.optionalString(c.BasePlanID)
+	e.strings(c.BillingProductIDs)
+	e.floatMap(c.CreditBalances)
+
+	e.length(c.Entitlements == nil, len(c.Entitlements))
+	for _, entitlement := range c.Entitlements {
+		if e.present(entitlement != nil) {
+			e.featureEntitlement(entitlement)
+		}
+	}
+
+	e.stringMap(c.Keys)
+
+	e.length(c.Metrics == nil, len(c.Metrics))
+	for _, metric := range c.Metrics {
+		if e.present(metric != nil) {
+			e.companyMetric(metric)
+		}
+	}
+
+	e.strings(c.PlanIDs)
+	e.strings(c.PlanVersionIDs)
+	e.rules(c.Rules)
+
+	if e.present(c.Subscription != nil) {
+		e.string(c.Subscription.ID)
+		e.time(c.Subscription.PeriodStart)
+		e.time(c.Subscription.PeriodEnd)
+	}
+
+	e.traits(c.Traits)
+}
+
+func (e *binaryEncoder) user(u *User) {
+	e.string(u.ID)
+	e.string(u.AccountID)
+	e.string(u.EnvironmentID)
+	e.stringMap(u.Keys)
+	e.traits(u.Traits)
+	e.rules(u.Rules)
+}
+
+func (e *binaryEncoder) flag(f *Flag) {
+	e.string(f.ID)
+	e.string(f.AccountID)
+	e.string(f.EnvironmentID)
+	e.string(f.Key)
+	e.rules(f.Rules)
+	e.bool(f.DefaultValue)
+	e.optionalTime(f.StartsAt)
+	e.optionalTime(f.EndsAt)
+}
+
+func (e *binaryEncoder) errorDetail(d *ErrorDetail) {
+	e.string(string(d.Code))
+	e.string(d.Message)
+	e.string(d.FlagID)
+	e.string(d.RuleID)
+	e.string(d.ConditionID)
+	e.length(d.Fields == nil, len(d.Fields))
+	for _, field := range d.Fields {
+		e.string(field.Field)
+		e.string(field.Message)
+		e.string(field.Value)
+	}
+}
+
+func (e *binaryEncoder) checkFlagResult(r *CheckFlagResult) {
+	e.optionalString(r.CompanyID)
+	if detail := NewErrorDetail(r.Err); e.present(detail != nil) {
+		e.errorDetail(detail)
+	}
+	if e.present(r.Entitlement != nil) {
+		e.featureEntitlement(r.Entitlement)
+	}
+	e.optionalInt(r.FeatureAllocation)
+	e.optionalInt(r.FeatureUsage)
+	e.optionalString(r.FeatureUsageEvent)
+	e.optionalString((*string)(r.FeatureUsagePeriod))
+	e.optionalTime(r.FeatureUsageResetAt)
+	e.optionalString(r.FlagID)
+	e.string(r.FlagKey)
+	e.string(r.Reason)
+	e.optionalString(r.RuleID)
+	e.optionalString((*string)(r.RuleType))
+	e.length(r.SkippedErrors == nil, len(r.SkippedErrors))
+	for _, detail := range r.SkippedErrors {
+		if e.present(detail != nil) {
+			e.errorDetail(detail)
+		}
+	}
+	e.optionalString(r.UserID)
+	e.bool(r.Value)
+}
+
+func (e *binaryEncoder) rules(rules []*Rule) {
+	e.length(rules == nil, len(rules))
+	for _, rule := range rules {
+		if e.present(rule != nil) {
+			e.rule(rule)
+		}
+	}
+}
+
+func (e *binaryEncoder) rule(r *Rule) {
+	e.string(r.ID)
+	e.optionalString(r.FlagID)
+	e.string(r.AccountID)
+	e.string(r.EnvironmentID)
+	e.string(string(r.RuleType))
+	e.string(r.Name)
+	e.int(r.Priority)
+	e.conditions(r.Conditions)
+
+	e.length(r.ConditionGroups == nil, len(r.ConditionGroups))
+	for _, group := range r.ConditionGroups {
+		if e.present(group != nil) {
+			e.conditions(group.Conditions)
+		}
+	}
+
+	e.bool(r.Value)
+	e.optionalTime(r.StartsAt)
+	e.optionalTime(r.EndsAt)
+}
+
+func (e *binaryEncoder) conditions(conditions []*Condition) {
+	e.length(conditions == nil, len(conditions))
+	for _, condition := range conditions {
+		if e.present(condition != nil) {
+			e.condition(condition)
+		}
+	}
+}
+
+func (e *binaryEncoder) condition(c *Condition) {
+	e.string(c.ID)
+	e.string(c.AccountID)
+	e.string(c.EnvironmentID)
+	e.string(string(c.ConditionType))
+	e.string(string(c.Operator))
+	e.strings(c.ResourceIDs)
+	e.optionalString(c.EventSubtype)
+	e.optionalInt(c.MetricValue)
+	e.optionalString((*string)(c.MetricPeriod))
+	e.optionalString((*string)(c.MetricPeriodMonthReset))
+	e.optionalString(c.CreditID)
+	e.optionalFloat(c.ConsumptionRate)
+	e.optionalTraitDefinition(c.TraitDefinition)
+	e.string(c.TraitValue)
+	e.optionalTraitDefinition(c.ComparisonTraitDefinition)
+}
+
+func (e *binaryEncoder) optionalTraitDefinition(d *TraitDefinition) {
+	if e.present(d != nil) {
+		e.string(d.ID)
+		e.string(string(d.ComparableType))
+		e.string(string(d.EntityType))
+	}
+}
+
+func (e *binaryEncoder) traits(traits []*Trait) {
+	e.length(traits == nil, len(traits))
+	for _, trait := range traits {
+		if e.present(trait != nil) {
+			e.optionalTraitDefinition(trait.TraitDefinition)
+			e.string(trait.Value)
+		}
+	}
+}
+
+func (e *binaryEncoder) companyMetric(m *CompanyMetric) {
+	e.string(m.AccountID)
+	e.string(m.EnvironmentID)
+	e.string(m.CompanyID)
+	e.string(m.EventSubtype)
+	e.string(string(m.Period))
+	e.string(string(m.MonthReset))
+	e.int(m.Value)
+	e.time(m.CreatedAt)
+	e.optionalTime(m.ValidUntil)
+}
+
+func (e *binaryEncoder) featureEntitlement(f *FeatureEntitlement) {
+	e.optionalInt(f.Allocation)
+	e.optionalFloat(f.ConsumptionRate)
+	e.optionalString(f.CreditID)
+	e.optionalFloat(f.CreditRemaining)
+	e.optionalFloat(f.CreditReserved)
+	e.optionalFloat(f.CreditSettled)
+	e.optionalFloat(f.CreditTotal)
+	e.optionalFloat(f.CreditUsed)
+	e.optionalString(f.EventName)
+	e.optionalString(f.EventSubtype)
+	e.string(f.FeatureID)
+	e.string(f.FeatureKey)
+	e.optionalString((*string)(f.MetricPeriod))
+	e.optionalTime(f.MetricResetAt)
+	e.optionalString((*string)(f.MonthReset))
+	e.optionalInt(f.SoftLimit)
+	e.optionalInt(f.Usage)
+	e.string(string(f.ValueType))
+}
+
+// Decoding
+
+// binaryDecoder reads a payload written by binaryEncoder. The first error is
+// sticky: once a read fails every later read returns a zero value, and
+// finish reports the failure.
+type binaryDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newBinaryDecoder(data []byte, model binaryModel) (*binaryDecoder, error) {
+	if len(data) < 4 || data[0] != binaryMagic[0] || data[1] != binaryMagic[1] {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidBinary)
+	}
+	if data[2] != binaryFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidBinary, data[2])
+	}
+	if binaryModel(data[3]) != model {
+		return nil, fmt.Errorf("%w: payload is for a different model", ErrInvalidBinary)
+	}
+
+	return &binaryDecoder{data: data, pos: 4}, nil
+}
+
+func (d *binaryDecoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: "+format+" at offset %d", append([]any{ErrInvalidBinary}, append(args, d.pos)...)...)
+	}
+}
+
+func (d *binaryDecoder) finish() error {
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("%d trailing bytes", len(d.data)-d.pos)
+	}
+	return d.err
+}
+
+func (d *binaryDecoder) bool() bool {
+	if d.err != nil {
+		return false
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of data")
+		return false
+	}
+
+	b := d.data[d.pos]
+	d.pos++
+	switch b {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		d.fail("invalid bool %d", b)
+		return false
+	}
+}
+
+func (d *binaryDecoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *binaryDecoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid uvarint")
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *binaryDecoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data)-d.pos < 8 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.data[d.pos:]))
+	d.pos += 8
+	return v
+}
+
+func (d *binaryDecoder) string() string {
+	n := d.uint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.data)-d.pos) {
+		d.fail("string length %d exceeds remaining data", n)
+		return ""
+	}
+
+	s := string(d.data[d.pos : d.pos+int(n)])
+	d.pos += int(n)
+	return s
+}
+
+func (d *binaryDecoder) time() time.Time {
+	sec := d.int()
+	nsec := d.int()
+	offset := d.int()
+	if d.err != nil {
+		return time.Time{}
+	}
+
+	// Resolve the zone the same way time.Parse does for RFC 3339, so a
+	// decoded time is identical to one decoded from JSON.
+	t := time.Unix(sec, nsec)
+	if offset == 0 {
+		return t.UTC()
+	}
+	if _, localOffset := t.Zone(); localOffset == int(offset) {
+		return t
+	}
+	return t.In(time.FixedZone("", int(offset)))
+}
+
+// length reads a collection length written by binaryEncoder.length. It
+// returns isNil for nil collections and bounds n by the remaining data so
+// corrupt payloads cannot trigger huge allocations.
+func (d *binaryDecoder) length() (n int, isNil bool) {
+	v := d.uint()
+	if d.err != nil || v == 0 {
+		return 0, true
+	}
+
+	n64 := v - 1
+	if n64 > uint64(len(d.data)-d.pos) {
+		d.fail("collection length %d exceeds remaining data", n64)
+		return 0, true
+	}
+	return int(n64), false
+}
+
+func (d *binaryDecoder) optionalString() *string {
+	if !d.bool() {
+		return nil
+	}
+	v := d.string()
+	return &v
+}
+
+func (d *binaryDecoder) optionalInt() *int64 {
+	if !d.bool() {
+		return nil
+	}
+	v := d.int()
+	return &v
+}
+
+func (d *binaryDecoder) optionalFloat() *float64 {
+	if !d.bool() {
+		return nil
+	}
+	v := d.float()
+	return &v
+}
+
+func (d *binaryDecoder) optionalTime() *time.Time {
+	if !d.bool() {
+		return nil
+	}
+	v := d.time()
+	return &v
+}
+
+func optionalEnum[T ~string](v *string) *T {
+	if v == nil {
+		return nil
+	}
+	t := T(*v)
+	return &t
+}
+
+func (d *binaryDecoder) strings() JSONSlice[string] {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+
+	v := make(JSONSlice[string], n)
+	for i := range v {
+		v[i] = d.string()
+	}
+	return v
+}
+
+func (d *binaryDecoder) stringMap() map[string]string {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+
+	v := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := d.string()
+		v[key] = d.string()
+	}
+	return v
+}
+
+func (d *binaryDecoder) floatMap() map[string]float64 {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+
+	v := make(map[string]float64, n)
+	for i := 0; i < n; i++ {
+		key := d.string()
+		v[key] = d.float()
+	}
+	return v
+}
+
+func (d *binaryDecoder) company(c *Company) {
+	c.ID = d.string()
+	c.AccountID = d.string()
+	c.EnvironmentID = d.string()
+	c.BasePlanID = d.optionalString()
+	c.BillingProductIDs = d.strings()
+	c.CreditBalances = d.floatMap()
+
+	c.Entitlements = nil
+	if n, isNil := d.length(); !isNil {
+		c.Entitlements = make(JSONSlice[*FeatureEntitlement], n)
+		for i := range c.Entitlements {
+			if d.bool() {
+				c.Entitlements[i] = d.featureEntitlement()
+			}
+		}
+	}
+
+	c.Keys = d.stringMap()
+
+	c.Metrics = nil
+	if n, isNil := d.length(); !isNil {
+		c.Metrics = make(CompanyMetricCollection, n)
+		for i := range c.Metrics {
+			if d.bool() {
+				c.Metrics[i] = d.companyMetric()
+			}
+		}
+	}
+
+	c.PlanIDs = d.strings()
+	c.PlanVersionIDs = d.strings()
+	c.Rules = d.rules()
+
+	c.Subscription = nil
+	if d.bool() {
+		c.Subscription = &Subscription{
+			ID:          d.string(),
+			PeriodStart: d.time(),
+			PeriodEnd:   d.time(),
+		}
+	}
+
+	c.Traits = d.traits()
+}
+
+func (d *binaryDecoder) user(u *User) {
+	u.ID = d.string()
+	u.AccountID = d.string()
+	u.EnvironmentID = d.string()
+	u.Keys = d.stringMap()
+	u.Traits = d.traits()
+	u.Rules = d.rules()
+}
+
+func (d *binaryDecoder) flag(f *Flag) {
+	f.ID = d.string()
+	f.AccountID = d.string()
+	f.EnvironmentID = d.string()
+	f.Key = d.string()
+	f.Rules = d.rules()
+	f.DefaultValue = d.bool()
+	f.StartsAt = d.optionalTime()
+	f.EndsAt = d.optionalTime()
+}
+
+func (d *binaryDecoder) errorDetail() *ErrorDetail {
+	detail := &ErrorDetail{
+		Code:        ErrorCode(d.string()),
+		Message:     d.string(),
+		FlagID:      d.string(),
+		RuleID:      d.string(),
+		ConditionID: d.string(),
+	}
+	if n, isNil := d.length(); !isNil {
+		detail.Fields = make(ValidationErrors, n)
+		for i := range detail.Fields {
+			detail.Fields[i] = &FieldError{Field: d.string(), Message: d.string(), Value: d.string()}
+		}
+	}
+	return detail
+}
+
+func (d *binaryDecoder) checkFlagResult(r *CheckFlagResult) {
+	r.CompanyID = d.optionalString()
+	r.Err = nil
+	if d.bool() {
+		r.Err = d.errorDetail().Err()
+	}
+	r.Entitlement = nil
+	if d.bool() {
+		r.Entitlement = d.featureEntitlement()
+	}
+	r.FeatureAllocation = d.optionalInt()
+	r.FeatureUsage = d.optionalInt()
+	r.FeatureUsageEvent = d.optionalString()
+	r.FeatureUsagePeriod = optionalEnum[MetricPeriod](d.optionalString())
+	r.FeatureUsageResetAt = d.optionalTime()
+	r.FlagID = d.optionalString()
+	r.FlagKey = d.string()
+	r.Reason = d.string()
+	r.RuleID = d.optionalString()
+	r.RuleType = optionalEnum[RuleType](d.optionalString())
+	r.SkippedErrors = nil
+	if n, isNil := d.length(); !isNil {
+		r.SkippedErrors = make([]*ErrorDetail, n)
+		for i := range r.SkippedErrors {
+			if d.bool() {
+				r.SkippedErrors[i] = d.errorDetail()
+			}
+		}
+	}
+	r.UserID = d.optionalString()
+	r.Value = d.bool()
+}
+
+func (d *binaryDecoder) rules() JSONSlice[*Rule] {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+
+	rules := make(JSONSlice[*Rule], n)
+	for i := range rules {
+		if d.bool() {
+			rules[i] = d.rule()
+		}
+	}
+	return rules
+}
+
+func (d *binaryDecoder) rule() *Rule {
+	r := &Rule{
+		ID:            d.string(),
+		FlagID:        d.optionalString(),
+		AccountID:     d.string(),
+		EnvironmentID: d.string(),
+		RuleType:      RuleType(d.string()),
+		Name:          d.string(),
+		Priority:      d.int(),
+		Conditions:    d.conditions(),
+	}
+
+	if n, isNil := d.length(); !isNil {
+		r.ConditionGroups = make(JSONSlice[*ConditionGroup], n)
+		for i := range r.ConditionGroups {
+			if d.bool() {
+				r.ConditionGroups[i] = &ConditionGroup{Conditions: d.conditions()}
+			}
+		}
+	}
+
+	r.Value = d.bool()
+	r.StartsAt = d.optionalTime()
+	r.EndsAt = d.optionalTime()
+	return r
+}
+
+func (d *binaryDecoder) conditions() JSONSlice[*Condition] {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+
+	conditions := make(JSONSlice[*Condition], n)
+	for i := range conditions {
+		if d.bool() {
+			conditions[i] = d.condition()
+		}
+	}
+	return conditions
+}
+
+func (d *binaryDecoder) condition() *Condition {
+	return &Condition{
+		ID:                        d.string(),
+		AccountID:                 d.string(),
+		EnvironmentID:             d.string(),
+		ConditionType:             ConditionType(d.string()),
+		Operator:                  typeconvert.ComparableOperator(d.string()),
+		ResourceIDs:               d.strings(),
+		EventSubtype:              d.optionalString(),
+		MetricValue:               d.optionalInt(),
+		MetricPeriod:              optionalEnum[MetricPeriod](d.optionalString()),
+		MetricPeriodMonthReset:    optionalEnum[MetricPeriodMonthReset](d.optionalString()),
+		CreditID:                  d.optionalString(),
+		ConsumptionRate:           d.optionalFloat(),
+		TraitDefinition:           d.optionalTraitDefinition(),
+		TraitValue:                d.string(),
+		ComparisonTraitDefinition: d.optionalTraitDefinition(),
+	}
+}
+
+func (d *binaryDecoder) optionalTraitDefinition() *TraitDefinition {
+	if !d.bool() {
+		return nil
+	}
+	return &TraitDefinition{
+		ID:             d.string(),
+		ComparableType: typeconvert.ComparableType(d.string()),
+		EntityType:     EntityType(d.string()),
+	}
+}
+
+func (d *binaryDecoder) traits() JSONSlice[*Trait] {
+	n, isNil := d.length()
+	if isNil {
+		return nil
+	}
+
+	traits := make(JSONSlice[*Trait], n)
+	for i := range traits {
+		if d.bool() {
+			traits[i] = &Trait{
+				TraitDefinition: d.optionalTraitDefinition(),
+				Value:           d.string(),
+			}
+		}
+	}
+	return traits
+}
+
+func (d *binaryDecoder) companyMetric() *CompanyMetric {
+	return &CompanyMetric{
+		AccountID:     d.string(),
+		EnvironmentID: d.string(),
+		CompanyID:     d.string(),
+		EventSubtype:  d.string(),
+		Period:        MetricPeriod(d.string()),
+		MonthReset:    MetricPeriodMonthReset(d.string()),
+		Value:         d.int(),
+		CreatedAt:     d.time(),
+		ValidUntil:    d.optionalTime(),
+	}
+}
+
+func (d *binaryDecoder) featureEntitlement() *FeatureEntitlement {
+	return &FeatureEntitlement{
+		Allocation:      d.optionalInt(),
+		ConsumptionRate: d.optionalFloat(),
+		CreditID:        d.optionalString(),
+		CreditRemaining: d.optionalFloat(),
+		CreditReserved:  d.optionalFloat(),
+		CreditSettled:   d.optionalFloat(),
+		CreditTotal:     d.optionalFloat(),
+		CreditUsed:      d.optionalFloat(),
+		EventName:       d.optionalString(),
+		EventSubtype:    d.optionalString(),
+		FeatureID:       d.string(),
+		FeatureKey:      d.string(),
+		MetricPeriod:    optionalEnum[MetricPeriod](d.optionalString()),
+		MetricResetAt:   d.optionalTime(),
+		MonthReset:      optionalEnum[MetricPeriodMonthReset](d.optionalString()),
+		SoftLimit:       d.optionalInt(),
+		Usage:           d.optionalInt(),
+		ValueType:       EntitlementValueType(d.string()),
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,332 @@
+package rulesengine_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/null"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createBinaryTestCompany() *rulesengine.Company {
+	company := createTestCompany()
+	company.CreditBalances = map[string]float64{"credits": 12.5, "tokens": 0}
+	company.Keys = map[string]string{"domain": "example.com", "slug": "example"}
+	company.AddMetric(createTestMetric(company, "api-calls", rulesengine.MetricPeriodCurrentMonth, 42))
+	validUntil := time.Now().Add(time.Hour)
+	company.Metrics[0].ValidUntil = &validUntil
+	company.Traits = append(company.Traits, createTestTrait("enterprise", createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)))
+	company.Entitlements = rulesengine.JSONSlice[*rulesengine.FeatureEntitlement]{
+		{
+			Allocation:   null.Nullable(int64(100)),
+			CreditTotal:  null.Nullable(1.5),
+			FeatureID:    generateTestID("feat"),
+			FeatureKey:   "feature",
+			MetricPeriod: null.Nullable(rulesengine.MetricPeriodCurrentDay),
+			ValueType:    rulesengine.EntitlementValueTypeNumeric,
+		},
+	}
+
+	rule := createTestRule()
+	condition := createTestCondition(rulesengine.ConditionTypeMetric)
+	rule.Conditions = []*rulesengine.Condition{condition}
+	rule.ConditionGroups = []*rulesengine.ConditionGroup{
+		{Conditions: []*rulesengine.Condition{createTestCondition(rulesengine.ConditionTypeTrait)}},
+	}
+	company.Rules = []*rulesengine.Rule{rule}
+
+	return company
+}
+
+type binaryModel interface {
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary([]byte) error
+}
+
+// assertBinaryRoundTrip checks that src survives a binary round trip with
+// the same JSON form, and that a model decoded from JSON survives one
+// unchanged.
+func assertBinaryRoundTrip[T any, PT interface {
+	*T
+	binaryModel
+}](t *testing.T, src PT) {
+	t.Helper()
+
+	data, err := src.MarshalBinary()
+	require.NoError(t, err)
+	var decoded T
+	require.NoError(t, PT(&decoded).UnmarshalBinary(data))
+
+	want, err := json.Marshal(src)
+	require.NoError(t, err)
+	got, err := json.Marshal(&decoded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got))
+
+	var fromJSON T
+	require.NoError(t, json.Unmarshal(want, &fromJSON))
+	data, err = PT(&fromJSON).MarshalBinary()
+	require.NoError(t, err)
+	var fromBinary T
+	require.NoError(t, PT(&fromBinary).UnmarshalBinary(data))
+	assert.Equal(t, &fromJSON, &fromBinary)
+}
+
+func TestBinaryEncoding(t *testing.T) {
+	t.Run("Company round-trips", func(t *testing.T) {
+		company := createBinaryTestCompany()
+
+		assertBinaryRoundTrip(t, company)
+	})
+
+	t.Run("User round-trips", func(t *testing.T) {
+		user := createTestUser()
+		user.Keys = map[string]string{"email": "user@example.com"}
+		user.Traits = append(user.Traits, createTestTrait("5", createTestTraitDefinition(typeconvert.ComparableTypeInt, rulesengine.EntityTypeUser)))
+		user.Rules = []*rulesengine.Rule{createTestRule()}
+
+		assertBinaryRoundTrip(t, user)
+	})
+
+	t.Run("Flag round-trips", func(t *testing.T) {
+		flag := createTestFlag()
+		rule := createTestRule()
+		rule.FlagID = &flag.ID
+		rule.Conditions = []*rulesengine.Condition{createTestCondition(rulesengine.ConditionTypeCredit)}
+		rule.StartsAt = null.Nullable(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+		flag.Rules = []*rulesengine.Rule{rule}
+		flag.EndsAt = null.Nullable(time.Date(2026, 4, 1, 0, 0, 0, 0, time.FixedZone("", -5*60*60)))
+
+		assertBinaryRoundTrip(t, flag)
+	})
+
+	t.Run("CheckFlagResult round-trips", func(t *testing.T) {
+		resetAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		result := &rulesengine.CheckFlagResult{
+			CompanyID:           null.Nullable("comp_1"),
+			Entitlement:         &rulesengine.FeatureEntitlement{FeatureKey: "feature", ValueType: rulesengine.EntitlementValueTypeBoolean},
+			FeatureUsage:        null.Nullable(int64(3)),
+			FeatureUsagePeriod:  null.Nullable(rulesengine.MetricPeriodCurrentMonth),
+			FeatureUsageResetAt: &resetAt,
+			FlagKey:             "feature",
+			Reason:              rulesengine.ReasonNoRulesMatched,
+			RuleType:            null.Nullable(rulesengine.RuleTypeDefault),
+			Value:               true,
+		}
+
+		data, err := result.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded rulesengine.CheckFlagResult
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		assert.Equal(t, result, &decoded)
+	})
+
+	t.Run("CheckFlagResult errors keep their message", func(t *testing.T) {
+		result := &rulesengine.CheckFlagResult{Err: rulesengine.ErrorFlagNotFound}
+
+		data, err := result.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded rulesengine.CheckFlagResult
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		require.Error(t, decoded.Err)
+		assert.Equal(t, rulesengine.ErrorFlagNotFound.Error(), decoded.Err.Error())
+		assert.ErrorIs(t, decoded.Err, rulesengine.ErrorFlagNotFound)
+	})
+
+	t.Run("CheckFlagResult errors keep their code and location", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		condition.MetricValue = nil
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+		result, _ := rulesengine.CheckFlag(context.Background(), company, nil, flag)
+
+		data, err := result.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded rulesengine.CheckFlagResult
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		assert.ErrorIs(t, decoded.Err, rulesengine.ErrorMissingMetricValue)
+		assert.Equal(t, result.Err.Error(), decoded.Err.Error())
+	})
+
+	t.Run("Nil and empty collections stay distinct", func(t *testing.T) {
+		company := &rulesengine.Company{
+			ID:             "comp",
+			PlanIDs:        rulesengine.JSONSlice[string]{},
+			Metrics:        rulesengine.CompanyMetricCollection{},
+			Keys:           map[string]string{},
+			CreditBalances: nil,
+		}
+
+		data, err := company.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded rulesengine.Company
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		assert.NotNil(t, decoded.PlanIDs)
+		assert.Empty(t, decoded.PlanIDs)
+		assert.NotNil(t, decoded.Metrics)
+		assert.NotNil(t, decoded.Keys)
+		assert.Nil(t, decoded.BillingProductIDs)
+		assert.Nil(t, decoded.Traits)
+		assert.Nil(t, decoded.CreditBalances)
+		assert.Nil(t, decoded.Subscription)
+		assert.Nil(t, decoded.BasePlanID)
+
+		// Both still serialize to the same JSON.
+		want, err := json.Marshal(company)
+		require.NoError(t, err)
+		got, err := json.Marshal(&decoded)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(want), string(got))
+	})
+
+	t.Run("Nil elements and optional pointers are preserved", func(t *testing.T) {
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeTrait)
+		condition.ComparisonTraitDefinition = nil
+		condition.MetricValue = null.Nullable(int64(0))
+		rule.Conditions = []*rulesengine.Condition{condition, nil}
+		flag := &rulesengine.Flag{ID: "flag", Rules: []*rulesengine.Rule{nil, rule}}
+
+		data, err := flag.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded rulesengine.Flag
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		require.Len(t, decoded.Rules, 2)
+		assert.Nil(t, decoded.Rules[0])
+		require.Len(t, decoded.Rules[1].Conditions, 2)
+		assert.Nil(t, decoded.Rules[1].Conditions[1])
+		assert.Nil(t, decoded.Rules[1].Conditions[0].ComparisonTraitDefinition)
+		require.NotNil(t, decoded.Rules[1].Conditions[0].MetricValue)
+		assert.Equal(t, int64(0), *decoded.Rules[1].Conditions[0].MetricValue)
+	})
+
+	t.Run("Times keep their zone offset", func(t *testing.T) {
+		zone := time.FixedZone("", -5*60*60)
+		company := &rulesengine.Company{Subscription: &rulesengine.Subscription{
+			PeriodStart: time.Date(2026, 3, 1, 9, 30, 0, 123, zone),
+			PeriodEnd:   time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		}}
+
+		data, err := company.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded rulesengine.Company
+		require.NoError(t, decoded.UnmarshalBinary(data))
+
+		assert.True(t, company.Subscription.PeriodStart.Equal(decoded.Subscription.PeriodStart))
+		_, offset := decoded.Subscription.PeriodStart.Zone()
+		assert.Equal(t, -5*60*60, offset)
+		assert.Equal(t, time.UTC, decoded.Subscription.PeriodEnd.Location())
+	})
+
+	t.Run("Rejects payloads for another model", func(t *testing.T) {
+		data, err := createTestUser().MarshalBinary()
+		require.NoError(t, err)
+
+		var company rulesengine.Company
+		err = company.UnmarshalBinary(data)
+
+		assert.True(t, errors.Is(err, rulesengine.ErrInvalidBinary))
+	})
+
+	t.Run("Payloads are version 1 of the format", func(t *testing.T) {
+		data, err := createBinaryTestCompany().MarshalBinary()
+		require.NoError(t, err)
+		require.Greater(t, len(data), 3)
+		assert.Equal(t, []byte{'R', 'E', 1}, data[:3])
+
+		data[2] = 2
+		var company rulesengine.Company
+		err = company.UnmarshalBinary(data)
+
+		assert.True(t, errors.Is(err, rulesengine.ErrInvalidBinary))
+		assert.ErrorContains(t, err, "unsupported format version 2")
+	})
+
+	t.Run("Rejects truncated and padded payloads", func(t *testing.T) {
+		data, err := createBinaryTestCompany().MarshalBinary()
+		require.NoError(t, err)
+
+		for _, payload := range [][]byte{nil, data[:2], data[:len(data)/2], data[:len(data)-1], append(data, 0)} {
+			var company rulesengine.Company
+			err := company.UnmarshalBinary(payload)
+			assert.True(t, errors.Is(err, rulesengine.ErrInvalidBinary), "payload of %d bytes: %v", len(payload), err)
+		}
+	})
+
+	t.Run("Encoding is deterministic", func(t *testing.T) {
+		company := createBinaryTestCompany()
+
+		first, err := company.MarshalBinary()
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			again, err := company.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, first, again)
+		}
+	})
+}
+
+func createLargeTestCompany(traits, metrics int) *rulesengine.Company {
+	company := createTestCompany()
+	for i := 0; i < traits; i++ {
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		company.Traits = append(company.Traits, createTestTrait(fmt.Sprintf("value-%d", i), def))
+	}
+	for i := 0; i < metrics; i++ {
+		company.Metrics = append(company.Metrics, createTestMetric(company, fmt.Sprintf("event-%d", i), rulesengine.MetricPeriodCurrentMonth, int64(i)))
+	}
+	return company
+}
+
+func BenchmarkCompanyDecode(b *testing.B) {
+	company := createLargeTestCompany(5000, 5000)
+
+	b.Run("JSON", func(b *testing.B) {
+		data, err := json.Marshal(company)
+		require.NoError(b, err)
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			var decoded rulesengine.Company
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Binary", func(b *testing.B) {
+		data, err := company.MarshalBinary()
+		require.NoError(b, err)
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			var decoded rulesengine.Company
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
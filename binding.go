@@ -0,0 +1,61 @@
+package rulesengine
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/schematichq/rulesengine/set"
+)
+
+// bindingOneOfCache memoizes parsed `binding:"oneof=..."` tags keyed by
+// struct type and field name.
+var bindingOneOfCache sync.Map
+
+type bindingFieldKey struct {
+	structType reflect.Type
+	field      string
+}
+
+// parseBindingOneOf returns the values listed in a `binding:"oneof=a b c"`
+// tag, or nil if the tag has no oneof rule.
+func parseBindingOneOf(tag reflect.StructTag) []string {
+	for _, rule := range strings.Split(tag.Get("binding"), ",") {
+		if values, ok := strings.CutPrefix(rule, "oneof="); ok {
+			return strings.Fields(values)
+		}
+	}
+
+	return nil
+}
+
+// bindingOneOf returns the set of allowed values declared by the binding tag
+// on the named field of the struct type of v. The binding tags are the source
+// of truth for enum values accepted on the wire.
+func bindingOneOf(v any, field string) set.Set[string] {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return bindingOneOfForType(t, field)
+}
+
+// bindingOneOfForType is bindingOneOf for a struct type. It returns nil if
+// the field has no oneof rule.
+func bindingOneOfForType(t reflect.Type, field string) set.Set[string] {
+	key := bindingFieldKey{structType: t, field: field}
+	if cached, ok := bindingOneOfCache.Load(key); ok {
+		return cached.(set.Set[string])
+	}
+
+	var allowed set.Set[string]
+	if f, ok := t.FieldByName(field); ok {
+		if values := parseBindingOneOf(f.Tag); values != nil {
+			allowed = set.NewSet(values...)
+		}
+	}
+
+	bindingOneOfCache.Store(key, allowed)
+	return allowed
+}
@@ -0,0 +1,333 @@
+package rulesengine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The bridge is the JSON API the WebAssembly builds expose to their hosts.
+// Every call takes a method name and a JSON payload and returns a JSON
+// BridgeResponse, so the same API can be served over syscall/js and over
+// linear memory without either host needing Go-specific types.
+
+// BridgeAPIVersion is incremented on breaking changes to bridge methods or
+// payloads. Hosts should check it before calling anything else.
+const BridgeAPIVersion = 1
+
+// Bridge method names.
+const (
+	BridgeMethodAPIVersion                     = "apiVersion"
+	BridgeMethodCheckFlag                      = "checkFlag"
+	BridgeMethodCheckFlags                     = "checkFlags"
+	BridgeMethodIsAllocationMoreGenerous       = "isAllocationMoreGenerous"
+	BridgeMethodMetricPeriodStart              = "metricPeriodStart"
+	BridgeMethodNextMetricPeriodStartCondition = "nextMetricPeriodStartFromCondition"
+	BridgeMethodNormalizeAllocation            = "normalizeAllocationToDailyRate"
+	BridgeMethodShouldBooleanOverrideWin       = "shouldBooleanOverrideWin"
+	BridgeMethodShouldBooleanPlanLose          = "shouldBooleanPlanLose"
+	BridgeMethodVersionKey                     = "versionKey"
+)
+
+// Bridge error codes.
+const (
+	BridgeErrorEvaluation    = "evaluation_error"
+	BridgeErrorInternal      = "internal_error"
+	BridgeErrorInvalidInput  = "invalid_input"
+	BridgeErrorInvalidJSON   = "invalid_json"
+	BridgeErrorUnknownMethod = "unknown_method"
+)
+
+// BridgeResponse is the envelope returned by every bridge call. Error is set
+// when the call itself fails; evaluation errors from CheckFlag are reported
+// per flag in BridgeCheckFlagResponse, alongside the result describing the
+// default value.
+type BridgeResponse struct {
+	APIVersion int          `json:"api_version"`
+	Result     any          `json:"result,omitempty"`
+	Error      *BridgeError `json:"error,omitempty"`
+}
+
+// BridgeError is a structured error. Status is the HTTP status the error
+// corresponds to, as reported by StatusCode on the engine's errors.
+type BridgeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+func (e *BridgeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// BridgeCheckFlagRequest is the payload for checkFlag.
+type BridgeCheckFlagRequest struct {
+	Company *Company          `json:"company"`
+	User    *User             `json:"user"`
+	Flag    *Flag             `json:"flag"`
+	Options *PreflightOptions `json:"options,omitempty"`
+}
+
+// BridgeCheckFlagsRequest is the payload for checkFlags: several flags
+// evaluated for the same company and user.
+type BridgeCheckFlagsRequest struct {
+	Company *Company          `json:"company"`
+	User    *User             `json:"user"`
+	Flags   []*Flag           `json:"flags"`
+	Options *PreflightOptions `json:"options,omitempty"`
+}
+
+// BridgeCheckFlagResponse is the result of one evaluation. It is the result
+// of checkFlag and each element of the result of checkFlags.
+type BridgeCheckFlagResponse struct {
+	Result *CheckFlagResult `json:"result"`
+	Error  *BridgeError     `json:"error,omitempty"`
+}
+
+// BridgeMetricPeriodRequest is the payload for metricPeriodStart.
+type BridgeMetricPeriodRequest struct {
+	Company      *Company                `json:"company"`
+	MetricPeriod MetricPeriod            `json:"metric_period"`
+	MonthReset   *MetricPeriodMonthReset `json:"month_reset"`
+}
+
+// BridgeMetricPeriodResponse gives the bounds of the current metric period.
+// Both are null for all-time periods.
+type BridgeMetricPeriodResponse struct {
+	CurrentStart *time.Time `json:"current_start"`
+	NextStart    *time.Time `json:"next_start"`
+}
+
+// BridgeConditionResetRequest is the payload for
+// nextMetricPeriodStartFromCondition.
+type BridgeConditionResetRequest struct {
+	Company   *Company   `json:"company"`
+	Condition *Condition `json:"condition"`
+}
+
+// BridgeAllocationRequest is the payload for normalizeAllocationToDailyRate.
+type BridgeAllocationRequest struct {
+	Allocation *int64        `json:"allocation"`
+	Period     *MetricPeriod `json:"period"`
+}
+
+// BridgeAllocationComparisonRequest is the payload for
+// isAllocationMoreGenerous.
+type BridgeAllocationComparisonRequest struct {
+	Allocation1 *int64        `json:"allocation1"`
+	Period1     *MetricPeriod `json:"period1"`
+	Allocation2 *int64        `json:"allocation2"`
+	Period2     *MetricPeriod `json:"period2"`
+}
+
+// BridgeEntitlementTypesRequest is the payload for shouldBooleanOverrideWin
+// and shouldBooleanPlanLose.
+type BridgeEntitlementTypesRequest struct {
+	NewType      EntitlementType `json:"new_type"`
+	ExistingType EntitlementType `json:"existing_type"`
+}
+
+type bridgeHandler func(ctx context.Context, payload []byte) (any, *BridgeError)
+
+var bridgeHandlers = map[string]bridgeHandler{
+	BridgeMethodAPIVersion: func(context.Context, []byte) (any, *BridgeError) {
+		return BridgeAPIVersion, nil
+	},
+	BridgeMethodCheckFlag:  bridgeCheckFlag,
+	BridgeMethodCheckFlags: bridgeCheckFlags,
+	BridgeMethodIsAllocationMoreGenerous: func(_ context.Context, payload []byte) (any, *BridgeError) {
+		var req BridgeAllocationComparisonRequest
+		if err := decodeBridgePayload(payload, &req); err != nil {
+			return nil, err
+		}
+		return IsAllocationMoreGenerous(req.Allocation1, req.Period1, req.Allocation2, req.Period2), nil
+	},
+	BridgeMethodMetricPeriodStart: bridgeMetricPeriodStart,
+	BridgeMethodNextMetricPeriodStartCondition: func(_ context.Context, payload []byte) (any, *BridgeError) {
+		var req BridgeConditionResetRequest
+		if err := decodeBridgePayload(payload, &req); err != nil {
+			return nil, err
+		}
+		if req.Condition == nil {
+			return nil, newBridgeInputError("condition is required")
+		}
+		return GetNextMetricPeriodStartFromCondition(req.Condition, req.Company), nil
+	},
+	BridgeMethodNormalizeAllocation: func(_ context.Context, payload []byte) (any, *BridgeError) {
+		var req BridgeAllocationRequest
+		if err := decodeBridgePayload(payload, &req); err != nil {
+			return nil, err
+		}
+		return NormalizeAllocationToDailyRate(req.Allocation, req.Period), nil
+	},
+	BridgeMethodShouldBooleanOverrideWin: func(_ context.Context, payload []byte) (any, *BridgeError) {
+		var req BridgeEntitlementTypesRequest
+		if err := decodeBridgePayload(payload, &req); err != nil {
+			return nil, err
+		}
+		return ShouldBooleanOverrideWin(req.NewType, req.ExistingType), nil
+	},
+	BridgeMethodShouldBooleanPlanLose: func(_ context.Context, payload []byte) (any, *BridgeError) {
+		var req BridgeEntitlementTypesRequest
+		if err := decodeBridgePayload(payload, &req); err != nil {
+			return nil, err
+		}
+		return ShouldBooleanPlanLose(req.NewType, req.ExistingType), nil
+	},
+	BridgeMethodVersionKey: func(context.Context, []byte) (any, *BridgeError) {
+		return VersionKey, nil
+	},
+}
+
+// BridgeCall invokes a bridge method and returns the JSON-encoded
+// BridgeResponse. It never panics; failures, including panics in the engine,
+// are reported as a BridgeError.
+func BridgeCall(ctx context.Context, method string, payload []byte) []byte {
+	resp := callBridge(ctx, method, payload)
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(&BridgeResponse{
+			APIVersion: BridgeAPIVersion,
+			Error:      newBridgeError(BridgeErrorInternal, http.StatusInternalServerError, "encoding response: %v", err),
+		})
+	}
+	return data
+}
+
+func callBridge(ctx context.Context, method string, payload []byte) (resp *BridgeResponse) {
+	resp = &BridgeResponse{APIVersion: BridgeAPIVersion}
+
+	defer func() {
+		if r := recover(); r != nil {
+			resp.Result = nil
+			resp.Error = newBridgeError(BridgeErrorInternal, http.StatusInternalServerError, "panic: %v", r)
+		}
+	}()
+
+	handler, ok := bridgeHandlers[method]
+	if !ok {
+		resp.Error = newBridgeError(BridgeErrorUnknownMethod, http.StatusNotFound, "unknown method %q", method)
+		return resp
+	}
+
+	resp.Result, resp.Error = handler(ctx, payload)
+	return resp
+}
+
+func bridgeCheckFlag(ctx context.Context, payload []byte) (any, *BridgeError) {
+	var req BridgeCheckFlagRequest
+	if err := decodeBridgePayload(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.Flag == nil {
+		return nil, newBridgeInputError("flag is required")
+	}
+
+	result, err := CheckFlag(ctx, req.Company, req.User, req.Flag, req.Options.CheckFlagOptions()...)
+	return newBridgeCheckFlagResponse(result, err), nil
+}
+
+func bridgeCheckFlags(ctx context.Context, payload []byte) (any, *BridgeError) {
+	var req BridgeCheckFlagsRequest
+	if err := decodeBridgePayload(payload, &req); err != nil {
+		return nil, err
+	}
+	for i, flag := range req.Flags {
+		if flag == nil {
+			return nil, newBridgeInputError("flags[%d] is null", i)
+		}
+	}
+
+	opts := req.Options.CheckFlagOptions()
+	results := make([]*BridgeCheckFlagResponse, len(req.Flags))
+	for i, flag := range req.Flags {
+		result, err := CheckFlag(ctx, req.Company, req.User, flag, opts...)
+		results[i] = newBridgeCheckFlagResponse(result, err)
+	}
+
+	return results, nil
+}
+
+// newBridgeCheckFlagResponse moves the evaluation error, whether returned or
+// set on the result, into the structured error field. Err is cleared on a
+// copy of the result so the error is only reported once.
+func newBridgeCheckFlagResponse(result *CheckFlagResult, err error) *BridgeCheckFlagResponse {
+	if err == nil && result != nil {
+		err = result.Err
+	}
+	if result != nil && result.Err != nil {
+		copied := *result
+		copied.Err = nil
+		result = &copied
+	}
+
+	return &BridgeCheckFlagResponse{Result: result, Error: newBridgeEvaluationError(err)}
+}
+
+func bridgeMetricPeriodStart(_ context.Context, payload []byte) (any, *BridgeError) {
+	var req BridgeMetricPeriodRequest
+	if err := decodeBridgePayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	if req.MetricPeriod == MetricPeriodCurrentMonth && req.MonthReset != nil && *req.MonthReset == MetricPeriodMonthResetBilling {
+		return &BridgeMetricPeriodResponse{
+			CurrentStart: GetCurrentMetricPeriodStartForCompanyBillingSubscription(req.Company),
+			NextStart:    GetNextMetricPeriodStartForCompanyBillingSubscription(req.Company),
+		}, nil
+	}
+
+	return &BridgeMetricPeriodResponse{
+		CurrentStart: GetCurrentMetricPeriodStartForCalendarMetricPeriod(req.MetricPeriod),
+		NextStart:    GetNextMetricPeriodStartForCalendarMetricPeriod(req.MetricPeriod),
+	}, nil
+}
+
+// decodeBridgePayload decodes a JSON object into v, rejecting malformed
+// JSON, non-object payloads and trailing data rather than evaluating
+// zero-valued models.
+func decodeBridgePayload(payload []byte, v any) *BridgeError {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return newBridgeError(BridgeErrorInvalidJSON, http.StatusBadRequest, "payload must be a JSON object")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	if err := decoder.Decode(v); err != nil {
+		return newBridgeError(BridgeErrorInvalidJSON, http.StatusBadRequest, "%v", err)
+	}
+	if decoder.More() {
+		return newBridgeError(BridgeErrorInvalidJSON, http.StatusBadRequest, "unexpected data after JSON object")
+	}
+
+	return nil
+}
+
+func newBridgeError(code string, status int, format string, args ...any) *BridgeError {
+	return &BridgeError{Code: code, Message: fmt.Sprintf(format, args...), Status: status}
+}
+
+func newBridgeInputError(format string, args ...any) *BridgeError {
+	return newBridgeError(BridgeErrorInvalidInput, http.StatusBadRequest, format, args...)
+}
+
+// newBridgeEvaluationError wraps an error returned by CheckFlag, keeping the
+// status it reports.
+func newBridgeEvaluationError(err error) *BridgeError {
+	if err == nil {
+		return nil
+	}
+
+	status := http.StatusInternalServerError
+	var coder interface{ StatusCode() int }
+	if errors.As(err, &coder) {
+		status = coder.StatusCode()
+	}
+
+	return &BridgeError{Code: BridgeErrorEvaluation, Message: err.Error(), Status: status}
+}
@@ -0,0 +1,258 @@
+package rulesengine_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bridgeResponse struct {
+	APIVersion int                      `json:"api_version"`
+	Result     json.RawMessage          `json:"result"`
+	Error      *rulesengine.BridgeError `json:"error"`
+}
+
+func callBridge(t *testing.T, method string, payload any) *bridgeResponse {
+	t.Helper()
+
+	var data []byte
+	switch p := payload.(type) {
+	case nil:
+	case string:
+		data = []byte(p)
+	default:
+		var err error
+		data, err = json.Marshal(p)
+		require.NoError(t, err)
+	}
+
+	var resp bridgeResponse
+	require.NoError(t, json.Unmarshal(rulesengine.BridgeCall(context.Background(), method, data), &resp))
+	assert.Equal(t, rulesengine.BridgeAPIVersion, resp.APIVersion)
+	return &resp
+}
+
+func TestBridgeCall(t *testing.T) {
+	t.Run("checkFlag evaluates like CheckFlag", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		rule := createTestRule()
+		rule.Value = true
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+		condition.ResourceIDs = []string{company.ID}
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		resp := callBridge(t, rulesengine.BridgeMethodCheckFlag, &rulesengine.BridgeCheckFlagRequest{Company: company, Flag: flag})
+
+		require.Nil(t, resp.Error)
+		var result rulesengine.BridgeCheckFlagResponse
+		require.NoError(t, json.Unmarshal(resp.Result, &result))
+		assert.Nil(t, result.Error)
+		assert.True(t, result.Result.Value)
+		assert.Equal(t, rule.ID, *result.Result.RuleID)
+	})
+
+	t.Run("checkFlag applies preflight options", func(t *testing.T) {
+		company := createTestCompany()
+		company.AddMetric(createTestMetric(company, "api-calls", rulesengine.MetricPeriodAllTime, 8))
+		flag := createTestFlag()
+		flag.DefaultValue = false
+		rule := createTestRule()
+		rule.Value = true
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		condition.EventSubtype = &company.Metrics[0].EventSubtype
+		metricValue := int64(10)
+		condition.MetricValue = &metricValue
+		condition.Operator = "lte"
+		condition.MetricPeriod = nil
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		check := func(options *rulesengine.PreflightOptions) bool {
+			resp := callBridge(t, rulesengine.BridgeMethodCheckFlag, &rulesengine.BridgeCheckFlagRequest{Company: company, Flag: flag, Options: options})
+			require.Nil(t, resp.Error)
+			var result rulesengine.BridgeCheckFlagResponse
+			require.NoError(t, json.Unmarshal(resp.Result, &result))
+			return result.Result.Value
+		}
+
+		usage := int64(5)
+		assert.True(t, check(nil))
+		assert.False(t, check(&rulesengine.PreflightOptions{Usage: &usage}))
+		assert.False(t, check(&rulesengine.PreflightOptions{EventUsage: &rulesengine.PreflightEventUsage{EventSubtype: "api-calls", Quantity: 5}}))
+		assert.True(t, check(&rulesengine.PreflightOptions{EventUsage: &rulesengine.PreflightEventUsage{EventSubtype: "other", Quantity: 5}}))
+	})
+
+	t.Run("checkFlag reports evaluation errors with their status", func(t *testing.T) {
+		usage := int64(-1)
+
+		resp := callBridge(t, rulesengine.BridgeMethodCheckFlag, &rulesengine.BridgeCheckFlagRequest{
+			Company: createTestCompany(),
+			Flag:    createTestFlag(),
+			Options: &rulesengine.PreflightOptions{Usage: &usage},
+		})
+
+		require.Nil(t, resp.Error)
+		var result rulesengine.BridgeCheckFlagResponse
+		require.NoError(t, json.Unmarshal(resp.Result, &result))
+		require.NotNil(t, result.Error)
+		assert.Equal(t, rulesengine.BridgeErrorEvaluation, result.Error.Code)
+		assert.Equal(t, http.StatusBadRequest, result.Error.Status)
+		require.NotNil(t, result.Result)
+		assert.Nil(t, result.Result.Err)
+	})
+
+	t.Run("checkFlags evaluates each flag in order", func(t *testing.T) {
+		on := createTestFlag()
+		on.DefaultValue = true
+		off := createTestFlag()
+		off.DefaultValue = false
+
+		resp := callBridge(t, rulesengine.BridgeMethodCheckFlags, &rulesengine.BridgeCheckFlagsRequest{
+			Company: createTestCompany(),
+			Flags:   []*rulesengine.Flag{on, off},
+		})
+
+		require.Nil(t, resp.Error)
+		var results []*rulesengine.BridgeCheckFlagResponse
+		require.NoError(t, json.Unmarshal(resp.Result, &results))
+		require.Len(t, results, 2)
+		assert.Equal(t, on.Key, results[0].Result.FlagKey)
+		assert.True(t, results[0].Result.Value)
+		assert.Equal(t, off.Key, results[1].Result.FlagKey)
+		assert.False(t, results[1].Result.Value)
+	})
+
+	t.Run("Malformed input is rejected", func(t *testing.T) {
+		for name, payload := range map[string]string{
+			"Empty":          "",
+			"Not an object":  `[1, 2]`,
+			"Syntax error":   `{"flag": {`,
+			"Wrong type":     `{"flag": {"rules": "none"}}`,
+			"Trailing value": `{"flag": {}} {}`,
+		} {
+			t.Run(name, func(t *testing.T) {
+				resp := callBridge(t, rulesengine.BridgeMethodCheckFlag, payload)
+
+				require.NotNil(t, resp.Error)
+				assert.Equal(t, rulesengine.BridgeErrorInvalidJSON, resp.Error.Code)
+				assert.Equal(t, http.StatusBadRequest, resp.Error.Status)
+			})
+		}
+	})
+
+	t.Run("Missing flags are rejected instead of evaluated as zero values", func(t *testing.T) {
+		resp := callBridge(t, rulesengine.BridgeMethodCheckFlag, `{"company": {"id": "comp_1"}}`)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rulesengine.BridgeErrorInvalidInput, resp.Error.Code)
+
+		resp = callBridge(t, rulesengine.BridgeMethodCheckFlags, `{"flags": [null]}`)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, "flags[0] is null", resp.Error.Message)
+	})
+
+	t.Run("Unknown methods are rejected", func(t *testing.T) {
+		resp := callBridge(t, "evaluate", nil)
+
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rulesengine.BridgeErrorUnknownMethod, resp.Error.Code)
+		assert.Equal(t, http.StatusNotFound, resp.Error.Status)
+	})
+
+	t.Run("Version information", func(t *testing.T) {
+		var version int
+		require.NoError(t, json.Unmarshal(callBridge(t, rulesengine.BridgeMethodAPIVersion, nil).Result, &version))
+		assert.Equal(t, rulesengine.BridgeAPIVersion, version)
+
+		var key string
+		require.NoError(t, json.Unmarshal(callBridge(t, rulesengine.BridgeMethodVersionKey, nil).Result, &key))
+		assert.Equal(t, rulesengine.VersionKey, key)
+	})
+
+	t.Run("metricPeriodStart", func(t *testing.T) {
+		resp := callBridge(t, rulesengine.BridgeMethodMetricPeriodStart, `{"metric_period": "current_day"}`)
+		require.Nil(t, resp.Error)
+		var period rulesengine.BridgeMetricPeriodResponse
+		require.NoError(t, json.Unmarshal(resp.Result, &period))
+		require.NotNil(t, period.CurrentStart)
+		require.NotNil(t, period.NextStart)
+		assert.Equal(t, *rulesengine.GetCurrentMetricPeriodStartForCalendarMetricPeriod(rulesengine.MetricPeriodCurrentDay), period.CurrentStart.UTC())
+
+		company := createTestCompany()
+		resp = callBridge(t, rulesengine.BridgeMethodMetricPeriodStart, map[string]any{
+			"company":       company,
+			"metric_period": rulesengine.MetricPeriodCurrentMonth,
+			"month_reset":   rulesengine.MetricPeriodMonthResetBilling,
+		})
+		require.Nil(t, resp.Error)
+		require.NoError(t, json.Unmarshal(resp.Result, &period))
+		assert.True(t, rulesengine.GetNextMetricPeriodStartForCompanyBillingSubscription(company).Equal(*period.NextStart))
+
+		resp = callBridge(t, rulesengine.BridgeMethodMetricPeriodStart, `{"metric_period": "all_time"}`)
+		require.NoError(t, json.Unmarshal(resp.Result, &period))
+		assert.Nil(t, period.CurrentStart)
+		assert.Nil(t, period.NextStart)
+	})
+
+	t.Run("nextMetricPeriodStartFromCondition", func(t *testing.T) {
+		resp := callBridge(t, rulesengine.BridgeMethodNextMetricPeriodStartCondition, `{}`)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rulesengine.BridgeErrorInvalidInput, resp.Error.Code)
+
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		period := rulesengine.MetricPeriodCurrentMonth
+		condition.MetricPeriod = &period
+		resp = callBridge(t, rulesengine.BridgeMethodNextMetricPeriodStartCondition, &rulesengine.BridgeConditionResetRequest{Condition: condition})
+		require.Nil(t, resp.Error)
+		var next *string
+		require.NoError(t, json.Unmarshal(resp.Result, &next))
+		assert.NotNil(t, next)
+	})
+
+	t.Run("Entitlement helpers", func(t *testing.T) {
+		var rate float64
+		resp := callBridge(t, rulesengine.BridgeMethodNormalizeAllocation, `{"allocation": 70, "period": "current_week"}`)
+		require.NoError(t, json.Unmarshal(resp.Result, &rate))
+		assert.Equal(t, 10.0, rate)
+
+		resp = callBridge(t, rulesengine.BridgeMethodNormalizeAllocation, `{"allocation": null}`)
+		assert.Equal(t, "null", string(resp.Result))
+
+		var generous bool
+		resp = callBridge(t, rulesengine.BridgeMethodIsAllocationMoreGenerous, `{"allocation1": 10, "period1": "current_day", "allocation2": 100, "period2": "current_month"}`)
+		require.NoError(t, json.Unmarshal(resp.Result, &generous))
+		assert.True(t, generous)
+
+		var wins bool
+		resp = callBridge(t, rulesengine.BridgeMethodShouldBooleanOverrideWin, `{"new_type": "company_override", "existing_type": "plan_entitlement"}`)
+		require.NoError(t, json.Unmarshal(resp.Result, &wins))
+		assert.True(t, wins)
+
+		var loses bool
+		resp = callBridge(t, rulesengine.BridgeMethodShouldBooleanPlanLose, `{"new_type": "company_override", "existing_type": "plan_entitlement"}`)
+		require.NoError(t, json.Unmarshal(resp.Result, &loses))
+		assert.False(t, loses)
+	})
+}
+
+func TestPreflightOptions(t *testing.T) {
+	t.Run("Nil options are empty", func(t *testing.T) {
+		var options *rulesengine.PreflightOptions
+
+		assert.Empty(t, options.CheckFlagOptions())
+	})
+
+	t.Run("Negative values are rejected by CheckFlag", func(t *testing.T) {
+		options := &rulesengine.PreflightOptions{CreditCosts: map[string]float64{"credit": -1}}
+
+		_, err := rulesengine.CheckFlag(context.Background(), createTestCompany(), nil, createTestFlag(), options.CheckFlagOptions()...)
+
+		assert.ErrorIs(t, err, rulesengine.ErrorNegativePreflightCreditCost)
+	})
+}
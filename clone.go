@@ -0,0 +1,373 @@
+package rulesengine
+
+import (
+	"maps"
+	"time"
+)
+
+// Clone and Equal work on the exported, serialized fields of the models.
+// Clones share nothing with the original, so either can be changed without
+// affecting the other; they get their own mutex and lookup indexes. Equal
+// compares the same fields, treating nil and empty slices and maps alike
+// since they serialize the same, and times by instant.
+
+// Clone returns a deep copy of the company.
+func (c *Company) Clone() *Company {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &Company{
+		ID:                c.ID,
+		AccountID:         c.AccountID,
+		EnvironmentID:     c.EnvironmentID,
+		BasePlanID:        clonePtr(c.BasePlanID),
+		BillingProductIDs: cloneSlice(c.BillingProductIDs, identity),
+		CreditBalances:    maps.Clone(c.CreditBalances),
+		Entitlements:      cloneSlice(c.Entitlements, (*FeatureEntitlement).Clone),
+		Keys:              maps.Clone(c.Keys),
+		Metrics:           cloneSlice(c.Metrics, cloneCompanyMetric),
+		PlanIDs:           cloneSlice(c.PlanIDs, identity),
+		PlanVersionIDs:    cloneSlice(c.PlanVersionIDs, identity),
+		Rules:             cloneSlice(c.Rules, (*Rule).Clone),
+		Subscription:      clonePtr(c.Subscription),
+		Traits:            cloneSlice(c.Traits, cloneTrait),
+	}
+}
+
+// Equal reports whether the companies have the same fields.
+func (c *Company) Equal(other *Company) bool {
+	if c == nil || other == nil || c == other {
+		return c == other
+	}
+
+	// Compare snapshots rather than holding both locks, which could
+	// deadlock against a concurrent other.Equal(c).
+	c, other = c.Snapshot(), other.Snapshot()
+	return c.ID == other.ID &&
+		c.AccountID == other.AccountID &&
+		c.EnvironmentID == other.EnvironmentID &&
+		equalPtr(c.BasePlanID, other.BasePlanID) &&
+		equalSlice(c.BillingProductIDs, other.BillingProductIDs, equalComparable) &&
+		maps.Equal(c.CreditBalances, other.CreditBalances) &&
+		equalSlice(c.Entitlements, other.Entitlements, (*FeatureEntitlement).Equal) &&
+		maps.Equal(c.Keys, other.Keys) &&
+		equalSlice(c.Metrics, other.Metrics, equalCompanyMetric) &&
+		equalSlice(c.PlanIDs, other.PlanIDs, equalComparable) &&
+		equalSlice(c.PlanVersionIDs, other.PlanVersionIDs, equalComparable) &&
+		equalSlice(c.Rules, other.Rules, (*Rule).Equal) &&
+		equalSubscription(c.Subscription, other.Subscription) &&
+		equalSlice(c.Traits, other.Traits, equalTrait)
+}
+
+// Clone returns a deep copy of the user.
+func (u *User) Clone() *User {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return &User{
+		ID:            u.ID,
+		AccountID:     u.AccountID,
+		EnvironmentID: u.EnvironmentID,
+		Keys:          maps.Clone(u.Keys),
+		Traits:        cloneSlice(u.Traits, cloneTrait),
+		Rules:         cloneSlice(u.Rules, (*Rule).Clone),
+	}
+}
+
+// Equal reports whether the users have the same fields.
+func (u *User) Equal(other *User) bool {
+	if u == nil || other == nil || u == other {
+		return u == other
+	}
+
+	u, other = u.Snapshot(), other.Snapshot()
+	return u.ID == other.ID &&
+		u.AccountID == other.AccountID &&
+		u.EnvironmentID == other.EnvironmentID &&
+		maps.Equal(u.Keys, other.Keys) &&
+		equalSlice(u.Traits, other.Traits, equalTrait) &&
+		equalSlice(u.Rules, other.Rules, (*Rule).Equal)
+}
+
+// Clone returns a deep copy of the flag.
+func (f *Flag) Clone() *Flag {
+	if f == nil {
+		return nil
+	}
+
+	clone := *f
+	clone.Rules = cloneSlice(f.Rules, (*Rule).Clone)
+	clone.StartsAt = clonePtr(f.StartsAt)
+	clone.EndsAt = clonePtr(f.EndsAt)
+	return &clone
+}
+
+// Equal reports whether the flags have the same fields.
+func (f *Flag) Equal(other *Flag) bool {
+	if f == nil || other == nil || f == other {
+		return f == other
+	}
+
+	return f.ID == other.ID &&
+		f.AccountID == other.AccountID &&
+		f.EnvironmentID == other.EnvironmentID &&
+		f.Key == other.Key &&
+		equalSlice(f.Rules, other.Rules, (*Rule).Equal) &&
+		f.DefaultValue == other.DefaultValue &&
+		equalTime(f.StartsAt, other.StartsAt) &&
+		equalTime(f.EndsAt, other.EndsAt)
+}
+
+// Clone returns a deep copy of the rule.
+func (r *Rule) Clone() *Rule {
+	if r == nil {
+		return nil
+	}
+
+	clone := *r
+	clone.FlagID = clonePtr(r.FlagID)
+	clone.Conditions = cloneSlice(r.Conditions, (*Condition).Clone)
+	clone.ConditionGroups = cloneSlice(r.ConditionGroups, cloneConditionGroup)
+	clone.StartsAt = clonePtr(r.StartsAt)
+	clone.EndsAt = clonePtr(r.EndsAt)
+	return &clone
+}
+
+// Equal reports whether the rules have the same fields.
+func (r *Rule) Equal(other *Rule) bool {
+	if r == nil || other == nil || r == other {
+		return r == other
+	}
+
+	return r.ID == other.ID &&
+		equalPtr(r.FlagID, other.FlagID) &&
+		r.AccountID == other.AccountID &&
+		r.EnvironmentID == other.EnvironmentID &&
+		r.RuleType == other.RuleType &&
+		r.Name == other.Name &&
+		r.Priority == other.Priority &&
+		equalSlice(r.Conditions, other.Conditions, (*Condition).Equal) &&
+		equalSlice(r.ConditionGroups, other.ConditionGroups, equalConditionGroup) &&
+		r.Value == other.Value &&
+		equalTime(r.StartsAt, other.StartsAt) &&
+		equalTime(r.EndsAt, other.EndsAt)
+}
+
+// Clone returns a deep copy of the condition.
+func (c *Condition) Clone() *Condition {
+	if c == nil {
+		return nil
+	}
+
+	clone := *c
+	clone.ResourceIDs = cloneSlice(c.ResourceIDs, identity)
+	clone.EventSubtype = clonePtr(c.EventSubtype)
+	clone.MetricValue = clonePtr(c.MetricValue)
+	clone.MetricPeriod = clonePtr(c.MetricPeriod)
+	clone.MetricPeriodMonthReset = clonePtr(c.MetricPeriodMonthReset)
+	clone.CreditID = clonePtr(c.CreditID)
+	clone.ConsumptionRate = clonePtr(c.ConsumptionRate)
+	clone.TraitDefinition = clonePtr(c.TraitDefinition)
+	clone.ComparisonTraitDefinition = clonePtr(c.ComparisonTraitDefinition)
+	return &clone
+}
+
+// Equal reports whether the conditions have the same fields.
+func (c *Condition) Equal(other *Condition) bool {
+	if c == nil || other == nil || c == other {
+		return c == other
+	}
+
+	return c.ID == other.ID &&
+		c.AccountID == other.AccountID &&
+		c.EnvironmentID == other.EnvironmentID &&
+		c.ConditionType == other.ConditionType &&
+		c.Operator == other.Operator &&
+		equalSlice(c.ResourceIDs, other.ResourceIDs, equalComparable) &&
+		equalPtr(c.EventSubtype, other.EventSubtype) &&
+		equalPtr(c.MetricValue, other.MetricValue) &&
+		equalPtr(c.MetricPeriod, other.MetricPeriod) &&
+		equalPtr(c.MetricPeriodMonthReset, other.MetricPeriodMonthReset) &&
+		equalPtr(c.CreditID, other.CreditID) &&
+		equalPtr(c.ConsumptionRate, other.ConsumptionRate) &&
+		equalPtr(c.TraitDefinition, other.TraitDefinition) &&
+		c.TraitValue == other.TraitValue &&
+		equalPtr(c.ComparisonTraitDefinition, other.ComparisonTraitDefinition)
+}
+
+// Clone returns a deep copy of the entitlement.
+func (e *FeatureEntitlement) Clone() *FeatureEntitlement {
+	if e == nil {
+		return nil
+	}
+
+	clone := *e
+	clone.Allocation = clonePtr(e.Allocation)
+	clone.ConsumptionRate = clonePtr(e.ConsumptionRate)
+	clone.CreditID = clonePtr(e.CreditID)
+	clone.CreditRemaining = clonePtr(e.CreditRemaining)
+	clone.CreditReserved = clonePtr(e.CreditReserved)
+	clone.CreditSettled = clonePtr(e.CreditSettled)
+	clone.CreditTotal = clonePtr(e.CreditTotal)
+	clone.CreditUsed = clonePtr(e.CreditUsed)
+	clone.EventName = clonePtr(e.EventName)
+	clone.EventSubtype = clonePtr(e.EventSubtype)
+	clone.MetricPeriod = clonePtr(e.MetricPeriod)
+	clone.MetricResetAt = clonePtr(e.MetricResetAt)
+	clone.MonthReset = clonePtr(e.MonthReset)
+	clone.SoftLimit = clonePtr(e.SoftLimit)
+	clone.Usage = clonePtr(e.Usage)
+	return &clone
+}
+
+// Equal reports whether the entitlements have the same fields.
+func (e *FeatureEntitlement) Equal(other *FeatureEntitlement) bool {
+	if e == nil || other == nil || e == other {
+		return e == other
+	}
+
+	return equalPtr(e.Allocation, other.Allocation) &&
+		equalPtr(e.ConsumptionRate, other.ConsumptionRate) &&
+		equalPtr(e.CreditID, other.CreditID) &&
+		equalPtr(e.CreditRemaining, other.CreditRemaining) &&
+		equalPtr(e.CreditReserved, other.CreditReserved) &&
+		equalPtr(e.CreditSettled, other.CreditSettled) &&
+		equalPtr(e.CreditTotal, other.CreditTotal) &&
+		equalPtr(e.CreditUsed, other.CreditUsed) &&
+		equalPtr(e.EventName, other.EventName) &&
+		equalPtr(e.EventSubtype, other.EventSubtype) &&
+		e.FeatureID == other.FeatureID &&
+		e.FeatureKey == other.FeatureKey &&
+		equalPtr(e.MetricPeriod, other.MetricPeriod) &&
+		equalTime(e.MetricResetAt, other.MetricResetAt) &&
+		equalPtr(e.MonthReset, other.MonthReset) &&
+		equalPtr(e.SoftLimit, other.SoftLimit) &&
+		equalPtr(e.Usage, other.Usage) &&
+		e.ValueType == other.ValueType
+}
+
+func cloneConditionGroup(g *ConditionGroup) *ConditionGroup {
+	if g == nil {
+		return nil
+	}
+	return &ConditionGroup{Conditions: cloneSlice(g.Conditions, (*Condition).Clone)}
+}
+
+func equalConditionGroup(a, b *ConditionGroup) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return equalSlice(a.Conditions, b.Conditions, (*Condition).Equal)
+}
+
+func cloneTrait(t *Trait) *Trait {
+	if t == nil {
+		return nil
+	}
+	return &Trait{TraitDefinition: clonePtr(t.TraitDefinition), Value: t.Value}
+}
+
+func equalTrait(a, b *Trait) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return equalPtr(a.TraitDefinition, b.TraitDefinition) && a.Value == b.Value
+}
+
+func cloneCompanyMetric(m *CompanyMetric) *CompanyMetric {
+	if m == nil {
+		return nil
+	}
+
+	clone := *m
+	clone.ValidUntil = clonePtr(m.ValidUntil)
+	return &clone
+}
+
+func equalCompanyMetric(a, b *CompanyMetric) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.AccountID == b.AccountID &&
+		a.EnvironmentID == b.EnvironmentID &&
+		a.CompanyID == b.CompanyID &&
+		a.EventSubtype == b.EventSubtype &&
+		a.Period == b.Period &&
+		a.MonthReset == b.MonthReset &&
+		a.Value == b.Value &&
+		a.CreatedAt.Equal(b.CreatedAt) &&
+		equalTime(a.ValidUntil, b.ValidUntil)
+}
+
+func equalSubscription(a, b *Subscription) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID && a.PeriodStart.Equal(b.PeriodStart) && a.PeriodEnd.Equal(b.PeriodEnd)
+}
+
+func identity[T any](v T) T {
+	return v
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// cloneSlice copies s, cloning each element. Nil slices stay nil.
+func cloneSlice[S ~[]E, E any](s S, clone func(E) E) S {
+	if s == nil {
+		return nil
+	}
+
+	cloned := make(S, len(s))
+	for i, e := range s {
+		cloned[i] = clone(e)
+	}
+	return cloned
+}
+
+func equalComparable[T comparable](a, b T) bool {
+	return a == b
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// equalSlice reports whether a and b have equal elements, treating nil and
+// empty slices alike.
+func equalSlice[S ~[]E, E any](a, b S, equal func(E, E) bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package rulesengine_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cloneable is a model with Clone and Equal methods.
+type cloneable[T any] interface {
+	*T
+	Clone() *T
+	Equal(*T) bool
+}
+
+// fakeModel returns a model with every exported field, however deeply
+// nested, set to a non-zero value.
+func fakeModel[T any](t *testing.T) *T {
+	var model T
+	fill(t, reflect.ValueOf(&model).Elem())
+	return &model
+}
+
+func fill(t *testing.T, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(t, v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			fill(t, v.Index(i))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(t, key)
+		fill(t, elem)
+		v.SetMapIndex(key, elem)
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(gofakeit.Date()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(t, v.Field(i))
+			}
+		}
+	case reflect.String:
+		v.SetString(gofakeit.UUID())
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(gofakeit.Int64()&0xffff + 1)
+	case reflect.Float64:
+		v.SetFloat(gofakeit.Float64Range(1, 100))
+	default:
+		t.Fatalf("can't fill %s", v.Type())
+	}
+}
+
+// assertNothingShared fails if a and b share any pointer, slice or map.
+func assertNothingShared(t *testing.T, path string, a, b reflect.Value) {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return
+		}
+		assert.NotEqual(t, a.Pointer(), b.Pointer(), "%s is shared", path)
+		assertNothingShared(t, path, a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() == 0 || b.Len() == 0 {
+			return
+		}
+		assert.NotEqual(t, a.Pointer(), b.Pointer(), "%s is shared", path)
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			assertNothingShared(t, path+"[]", a.Index(i), b.Index(i))
+		}
+	case reflect.Map:
+		if a.IsNil() || b.IsNil() {
+			return
+		}
+		assert.NotEqual(t, a.Pointer(), b.Pointer(), "%s is shared", path)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if field := a.Type().Field(i); field.IsExported() {
+				assertNothingShared(t, path+"."+field.Name, a.Field(i), b.Field(i))
+			}
+		}
+	}
+}
+
+func testCloneAndEqual[T any, P cloneable[T]](t *testing.T) {
+	t.Run("Clones are equal and share nothing", func(t *testing.T) {
+		original := P(fakeModel[T](t))
+
+		clone := original.Clone()
+
+		assert.True(t, original.Equal(clone))
+		assert.True(t, P(clone).Equal(original))
+		assertNothingShared(t, reflect.TypeOf(clone).Elem().Name(), reflect.ValueOf(original), reflect.ValueOf(clone))
+
+		want, err := json.Marshal(original)
+		require.NoError(t, err)
+		got, err := json.Marshal(clone)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(want), string(got))
+	})
+
+	t.Run("Equal notices a change to any field", func(t *testing.T) {
+		original := P(fakeModel[T](t))
+		fields := reflect.TypeOf(original).Elem()
+
+		for i := 0; i < fields.NumField(); i++ {
+			if !fields.Field(i).IsExported() {
+				continue
+			}
+			clone := original.Clone()
+			field := reflect.ValueOf(clone).Elem().Field(i)
+			field.Set(reflect.Zero(field.Type()))
+
+			assert.False(t, original.Equal(clone), fields.Field(i).Name)
+		}
+	})
+
+	t.Run("Nil models", func(t *testing.T) {
+		var model P
+		assert.Nil(t, model.Clone())
+		assert.True(t, model.Equal(nil))
+		assert.False(t, model.Equal(fakeModel[T](t)))
+		assert.False(t, P(fakeModel[T](t)).Equal(nil))
+	})
+}
+
+func TestCloneAndEqual(t *testing.T) {
+	t.Run("Company", testCloneAndEqual[rulesengine.Company])
+	t.Run("User", testCloneAndEqual[rulesengine.User])
+	t.Run("Flag", testCloneAndEqual[rulesengine.Flag])
+	t.Run("Rule", testCloneAndEqual[rulesengine.Rule])
+	t.Run("Condition", testCloneAndEqual[rulesengine.Condition])
+	t.Run("FeatureEntitlement", testCloneAndEqual[rulesengine.FeatureEntitlement])
+
+	t.Run("Changing a clone leaves the original alone", func(t *testing.T) {
+		company := createTestCompany()
+		company.Keys = map[string]string{"tier": "free"}
+		company.AddPlanID("plan_1")
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		company.SetTrait(createTestTrait("before", def))
+
+		upgraded := company.Clone()
+		upgraded.RemovePlanID("plan_1")
+		upgraded.AddPlanID("plan_2")
+		upgraded.FindTrait(def.ID).Value = "after"
+		upgraded.Keys["tier"] = "pro"
+
+		assert.Contains(t, upgraded.PlanIDs, "plan_2")
+		assert.NotContains(t, upgraded.PlanIDs, "plan_1")
+		assert.NotContains(t, company.PlanIDs, "plan_2")
+		assert.Contains(t, company.PlanIDs, "plan_1")
+		assert.Equal(t, "before", company.FindTrait(def.ID).Value)
+		assert.Equal(t, "free", company.Keys["tier"])
+		assert.False(t, company.Equal(upgraded))
+	})
+
+	t.Run("Nil and empty collections are equal", func(t *testing.T) {
+		company := &rulesengine.Company{ID: "company"}
+		empty := &rulesengine.Company{
+			ID:             "company",
+			CreditBalances: map[string]float64{},
+			PlanIDs:        rulesengine.JSONSlice[string]{},
+			Traits:         rulesengine.JSONSlice[*rulesengine.Trait]{},
+		}
+
+		assert.True(t, company.Equal(empty))
+	})
+
+	t.Run("Times are compared by instant", func(t *testing.T) {
+		startsAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		inLocal := startsAt.In(time.FixedZone("EST", -5*60*60))
+		flag := createTestFlag()
+		flag.StartsAt = &startsAt
+		clone := flag.Clone()
+		clone.StartsAt = &inLocal
+
+		assert.True(t, flag.Equal(clone))
+	})
+}
@@ -0,0 +1,115 @@
+// Command replay re-evaluates recorded flag checks with the current engine and
+// reports every record whose result differs from the recording:
+//
+//	replay [-ignore field,...] [-v] [recording.jsonl ...]
+//
+// Recordings are JSON Lines files of replay.Record values, read from the
+// named files in order or from standard input when none are given. -ignore
+// excludes result fields from comparison by their JSON path, such as
+// feature_usage_reset_at for recordings captured without evaluated_at; -v
+// also lists the records that matched.
+//
+// The exit status is 0 when every record matched, 1 when any record differed
+// or could not be decoded and 2 when the recordings could not be read.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/schematichq/rulesengine/replay"
+)
+
+const (
+	exitOK = iota
+	exitMismatch
+	exitUsageError
+)
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// fieldList collects comma-separated, repeatable -ignore values.
+type fieldList []string
+
+func (l *fieldList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *fieldList) Set(s string) error {
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			*l = append(*l, field)
+		}
+	}
+	return nil
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var ignore fieldList
+	var verbose bool
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Var(&ignore, "ignore", "comma-separated result `fields` to leave out of the comparison; repeatable")
+	fs.BoolVar(&verbose, "v", false, "also list records that matched")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsageError
+	}
+
+	replayer := replay.New(replay.IgnoreFields(ignore...))
+	report := func(name string) func(*replay.Outcome) error {
+		return func(outcome *replay.Outcome) error {
+			if verbose || !outcome.Matched() {
+				fmt.Fprintf(stdout, "%s:%s\n", name, outcome)
+			}
+			return nil
+		}
+	}
+
+	total := &replay.Summary{}
+	add := func(summary *replay.Summary) {
+		total.Total += summary.Total
+		total.Matched += summary.Matched
+		total.Mismatched += summary.Mismatched
+		total.Failed += summary.Failed
+	}
+
+	if fs.NArg() == 0 {
+		summary, err := replayer.Replay(ctx, stdin, report("stdin"))
+		add(summary)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return exitUsageError
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return exitUsageError
+		}
+		summary, err := replayer.Replay(ctx, f, report(path))
+		f.Close()
+		add(summary)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %s: %v\n", path, err)
+			return exitUsageError
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d records: %d matched, %d mismatched, %d failed\n", total.Total, total.Matched, total.Mismatched, total.Failed)
+	if !total.OK() {
+		return exitMismatch
+	}
+	return exitOK
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/replay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecording(t *testing.T, expected bool) string {
+	t.Helper()
+
+	flag := &rulesengine.Flag{ID: "flag_1", Key: "feature", DefaultValue: true}
+	result, err := rulesengine.CheckFlag(context.Background(), nil, nil, flag)
+	require.NoError(t, err)
+	result.Value = expected
+
+	data, err := json.Marshal(&replay.Record{ID: "rec_1", Flag: flag, Expected: result})
+	require.NoError(t, err)
+	return string(data) + "\n"
+}
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Reports a clean replay from standard input", func(t *testing.T) {
+		code, output := runCommand(t, testRecording(t, true))
+
+		assert.Equal(t, exitOK, code)
+		assert.Equal(t, "1 records: 1 matched, 0 mismatched, 0 failed\n", output)
+	})
+
+	t.Run("Lists matched records when verbose", func(t *testing.T) {
+		_, output := runCommand(t, testRecording(t, true), "-v")
+
+		assert.Contains(t, output, "stdin:line 1 (rec_1): matched")
+	})
+
+	t.Run("Reports mismatches across files", func(t *testing.T) {
+		dir := t.TempDir()
+		good := filepath.Join(dir, "good.jsonl")
+		bad := filepath.Join(dir, "bad.jsonl")
+		require.NoError(t, os.WriteFile(good, []byte(testRecording(t, true)), 0o600))
+		require.NoError(t, os.WriteFile(bad, []byte(testRecording(t, false)), 0o600))
+
+		code, output := runCommand(t, "", good, bad)
+
+		assert.Equal(t, exitMismatch, code)
+		assert.Contains(t, output, bad+":line 1 (rec_1): mismatch\n  value: expected false, got true")
+		assert.NotContains(t, output, good+":")
+		assert.Contains(t, output, "2 records: 1 matched, 1 mismatched, 0 failed")
+	})
+
+	t.Run("Ignores fields", func(t *testing.T) {
+		code, _ := runCommand(t, testRecording(t, false), "-ignore", "reason,value")
+
+		assert.Equal(t, exitOK, code)
+	})
+
+	t.Run("Unreadable files exit with status 2", func(t *testing.T) {
+		code, output := runCommand(t, "", filepath.Join(t.TempDir(), "missing.jsonl"))
+
+		assert.Equal(t, exitUsageError, code)
+		assert.Contains(t, output, "missing.jsonl")
+	})
+}
@@ -0,0 +1,544 @@
+// Command rulesengine evaluates a flag for a company and user from the command
+// line and prints the decision, the reason for it and every rule that was
+// checked along the way. It is meant for answering "why is this flag off for
+// this company?" from the same JSON the engine is given in production.
+//
+// Inputs are read either from separate files or from a snapshot file holding
+// all of them; a path of "-" reads from standard input:
+//
+//	rulesengine -flag flag.json -company company.json [-user user.json]
+//	rulesengine -snapshot snapshot.json [-key flag-key]
+//
+// A snapshot is a JSON object with optional "company", "user", "flag",
+// "flags" and "options" members, where "options" uses the PreflightOptions
+// wire format. When a snapshot holds several flags, -key selects one. Files
+// passed alongside a snapshot replace the matching member.
+//
+// Preflight options simulate pending usage, as with the WithUsage,
+// WithEventUsage and WithCreditCost options of CheckFlag:
+//
+//	-usage 5
+//	-event-usage api-calls=5
+//	-credit-cost credit_123=2.5 (repeatable)
+//
+// -as-of evaluates the flag at an RFC 3339 time instead of now, and
+// -format json prints a machine-readable result instead of a table.
+//
+// The exit status is 0 when the flag was evaluated, 1 when evaluation
+// returned an error and 2 when the command line or inputs are invalid.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+)
+
+const (
+	exitOK = iota
+	exitEvaluationError
+	exitUsageError
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// snapshot is the on-disk form of everything needed to reproduce a decision.
+type snapshot struct {
+	Company *rulesengine.Company          `json:"company"`
+	User    *rulesengine.User             `json:"user"`
+	Flag    *rulesengine.Flag             `json:"flag"`
+	Flags   []*rulesengine.Flag           `json:"flags"`
+	Options *rulesengine.PreflightOptions `json:"options"`
+}
+
+// config is the parsed command line.
+type config struct {
+	snapshotPath string
+	flagPath     string
+	companyPath  string
+	userPath     string
+	flagKey      string
+	format       string
+	asOf         time.Time
+	usage        optionalInt64
+	eventUsage   eventUsageValue
+	creditCosts  creditCostsValue
+}
+
+// optionalInt64 is an int64 flag that records whether it was set.
+type optionalInt64 struct {
+	value *int64
+}
+
+func (v *optionalInt64) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v.value, 10)
+}
+
+func (v *optionalInt64) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return errors.New("must be an integer")
+	}
+	v.value = &n
+	return nil
+}
+
+// eventUsageValue parses "subtype=quantity".
+type eventUsageValue struct {
+	value *rulesengine.PreflightEventUsage
+}
+
+func (v *eventUsageValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s=%d", v.value.EventSubtype, v.value.Quantity)
+}
+
+func (v *eventUsageValue) Set(s string) error {
+	subtype, quantity, err := splitAssignment(s)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseInt(quantity, 10, 64)
+	if err != nil {
+		return errors.New("quantity must be an integer")
+	}
+	v.value = &rulesengine.PreflightEventUsage{EventSubtype: subtype, Quantity: n}
+	return nil
+}
+
+// creditCostsValue parses repeated "credit_id=cost" flags.
+type creditCostsValue map[string]float64
+
+func (v creditCostsValue) String() string {
+	var parts []string
+	for creditID, cost := range v {
+		parts = append(parts, fmt.Sprintf("%s=%g", creditID, cost))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (v creditCostsValue) Set(s string) error {
+	creditID, cost, err := splitAssignment(s)
+	if err != nil {
+		return err
+	}
+	f, err := strconv.ParseFloat(cost, 64)
+	if err != nil {
+		return errors.New("cost must be a number")
+	}
+	v[creditID] = f
+	return nil
+}
+
+// splitAssignment splits "key=value" at the last "=", so keys may contain
+// "=" themselves.
+func splitAssignment(s string) (string, string, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return "", "", errors.New("expected key=value")
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// timeValue parses an RFC 3339 time.
+type timeValue struct {
+	value *time.Time
+}
+
+func (v timeValue) String() string {
+	if v.value == nil || v.value.IsZero() {
+		return ""
+	}
+	return v.value.Format(time.RFC3339)
+}
+
+func (v timeValue) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return errors.New("must be an RFC 3339 time, such as 2024-01-02T15:04:05Z")
+	}
+	*v.value = t
+	return nil
+}
+
+func parseArgs(args []string, stderr io.Writer) (*config, error) {
+	cfg := &config{creditCosts: make(creditCostsValue)}
+
+	fs := flag.NewFlagSet("rulesengine", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cfg.snapshotPath, "snapshot", "", "`path` to a snapshot holding the company, user, flag(s) and options")
+	fs.StringVar(&cfg.flagPath, "flag", "", "`path` to the flag JSON")
+	fs.StringVar(&cfg.companyPath, "company", "", "`path` to the company JSON")
+	fs.StringVar(&cfg.userPath, "user", "", "`path` to the user JSON")
+	fs.StringVar(&cfg.flagKey, "key", "", "`key` of the flag to evaluate when the snapshot holds several")
+	fs.StringVar(&cfg.format, "format", formatTable, "output `format`: table or json")
+	fs.Var(timeValue{&cfg.asOf}, "as-of", "evaluate as of this RFC 3339 `time` instead of now")
+	fs.Var(&cfg.usage, "usage", "simulate a generic usage `quantity`")
+	fs.Var(&cfg.eventUsage, "event-usage", "simulate usage of an event subtype, as `subtype=quantity`")
+	fs.Var(cfg.creditCosts, "credit-cost", "per-call credit cost, as `credit_id=cost`; repeatable")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if cfg.format != formatTable && cfg.format != formatJSON {
+		return nil, fmt.Errorf("unknown format %q", cfg.format)
+	}
+	if cfg.snapshotPath == "" && cfg.flagPath == "" {
+		return nil, errors.New("either -snapshot or -flag is required")
+	}
+
+	stdinReaders := 0
+	for _, path := range []string{cfg.snapshotPath, cfg.flagPath, cfg.companyPath, cfg.userPath} {
+		if path == "-" {
+			stdinReaders++
+		}
+	}
+	if stdinReaders > 1 {
+		return nil, errors.New("only one input can be read from standard input")
+	}
+
+	return cfg, nil
+}
+
+// readJSON decodes the file at path, or standard input for "-", into v.
+func readJSON(path string, stdin io.Reader, v any) error {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadInputs assembles the evaluation inputs from the snapshot and the
+// individual files, which take precedence.
+func loadInputs(cfg *config, stdin io.Reader) (*snapshot, *rulesengine.Flag, error) {
+	snap := &snapshot{}
+	if cfg.snapshotPath != "" {
+		if err := readJSON(cfg.snapshotPath, stdin, snap); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.flagPath != "" {
+		snap.Flag = nil
+		snap.Flags = nil
+		if err := readJSON(cfg.flagPath, stdin, &snap.Flag); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.companyPath != "" {
+		if err := readJSON(cfg.companyPath, stdin, &snap.Company); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.userPath != "" {
+		if err := readJSON(cfg.userPath, stdin, &snap.User); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	flag, err := selectFlag(snap, cfg.flagKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snap, flag, nil
+}
+
+func selectFlag(snap *snapshot, key string) (*rulesengine.Flag, error) {
+	candidates := snap.Flags
+	if snap.Flag != nil {
+		candidates = append([]*rulesengine.Flag{snap.Flag}, candidates...)
+	}
+
+	if key == "" {
+		switch len(candidates) {
+		case 0:
+			return nil, errors.New("no flag to evaluate")
+		case 1:
+			return candidates[0], nil
+		default:
+			return nil, fmt.Errorf("%d flags in input; select one with -key", len(candidates))
+		}
+	}
+
+	for _, flag := range candidates {
+		if flag != nil && flag.Key == key {
+			return flag, nil
+		}
+	}
+	return nil, fmt.Errorf("flag %q not found", key)
+}
+
+// preflightOptions overlays the command-line preflight options on the
+// snapshot's.
+func preflightOptions(cfg *config, base *rulesengine.PreflightOptions) *rulesengine.PreflightOptions {
+	options := &rulesengine.PreflightOptions{CreditCosts: make(map[string]float64)}
+	if base != nil {
+		for creditID, cost := range base.CreditCosts {
+			options.CreditCosts[creditID] = cost
+		}
+		options.EventUsage = base.EventUsage
+		options.Usage = base.Usage
+	}
+
+	for creditID, cost := range cfg.creditCosts {
+		options.CreditCosts[creditID] = cost
+	}
+	if cfg.eventUsage.value != nil {
+		options.EventUsage = cfg.eventUsage.value
+	}
+	if cfg.usage.value != nil {
+		options.Usage = cfg.usage.value
+	}
+
+	return options
+}
+
+// ruleCheck records the outcome of one rule check.
+type ruleCheck struct {
+	RuleID   string               `json:"rule_id"`
+	Name     string               `json:"name"`
+	RuleType rulesengine.RuleType `json:"rule_type"`
+	Matched  bool                 `json:"matched"`
+}
+
+// ruleRecorder is a hook collecting every rule check of an evaluation.
+type ruleRecorder struct {
+	rulesengine.NoopHook
+	checks []*ruleCheck
+}
+
+func (r *ruleRecorder) AfterRule(ctx context.Context, eval *rulesengine.HookEvaluation, rule *rulesengine.Rule, matched bool) {
+	r.checks = append(r.checks, &ruleCheck{
+		RuleID:   rule.ID,
+		Name:     rule.Name,
+		RuleType: rule.RuleType,
+		Matched:  matched,
+	})
+}
+
+// report is the outcome of an evaluation, as printed by -format json.
+type report struct {
+	EvaluatedAt time.Time                     `json:"evaluated_at"`
+	Options     *rulesengine.PreflightOptions `json:"options,omitempty"`
+	Result      *rulesengine.CheckFlagResult  `json:"result"`
+	Error       string                        `json:"error,omitempty"`
+	Rules       []*ruleCheck                  `json:"rules"`
+}
+
+func evaluate(ctx context.Context, cfg *config, snap *snapshot, flag *rulesengine.Flag) *report {
+	evaluatedAt := cfg.asOf
+	if evaluatedAt.IsZero() {
+		evaluatedAt = time.Now()
+	}
+
+	options := preflightOptions(cfg, snap.Options)
+	recorder := &ruleRecorder{checks: []*ruleCheck{}}
+	opts := append(options.CheckFlagOptions(),
+		rulesengine.WithEvaluationTime(evaluatedAt),
+		rulesengine.WithHooks(recorder),
+	)
+
+	result, err := rulesengine.CheckFlag(ctx, snap.Company, snap.User, flag, opts...)
+	if err == nil && result != nil {
+		err = result.Err
+	}
+
+	rep := &report{
+		EvaluatedAt: evaluatedAt.UTC(),
+		Result:      result,
+		Rules:       recorder.checks,
+	}
+	if len(options.CreditCosts) > 0 || options.EventUsage != nil || options.Usage != nil {
+		rep.Options = options
+	}
+	if result != nil {
+		// Err is reported once, as Error.
+		copied := *result
+		copied.Err = nil
+		rep.Result = &copied
+	}
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	return rep
+}
+
+func printJSON(w io.Writer, rep *report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func printTable(w io.Writer, rep *report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	row := func(label, value string) {
+		fmt.Fprintf(tw, "%s\t%s\n", label, value)
+	}
+
+	result := rep.Result
+	if result == nil {
+		result = &rulesengine.CheckFlagResult{}
+	}
+
+	flag := result.FlagKey
+	if result.FlagID != nil {
+		flag = fmt.Sprintf("%s (%s)", flag, *result.FlagID)
+	}
+	row("Flag", orDash(flag))
+	row("Company", orDash(stringValue(result.CompanyID)))
+	row("User", orDash(stringValue(result.UserID)))
+	row("Evaluated at", rep.EvaluatedAt.Format(time.RFC3339))
+	row("Value", strconv.FormatBool(result.Value))
+	row("Reason", result.Reason)
+	if result.RuleID != nil {
+		rule := *result.RuleID
+		if result.RuleType != nil {
+			rule = fmt.Sprintf("%s (%s)", rule, *result.RuleType)
+		}
+		row("Rule", rule)
+	}
+	if result.FeatureUsage != nil || result.FeatureAllocation != nil {
+		usage := fmt.Sprintf("%s / %s", int64String(result.FeatureUsage), int64String(result.FeatureAllocation))
+		if result.FeatureUsageEvent != nil {
+			usage = fmt.Sprintf("%s (%s)", usage, *result.FeatureUsageEvent)
+		}
+		row("Usage", usage)
+	}
+	if result.FeatureUsagePeriod != nil {
+		row("Period", string(*result.FeatureUsagePeriod))
+	}
+	if result.FeatureUsageResetAt != nil {
+		row("Resets at", result.FeatureUsageResetAt.UTC().Format(time.RFC3339))
+	}
+	if rep.Options != nil {
+		row("Preflight", describeOptions(rep.Options))
+	}
+	if rep.Error != "" {
+		row("Error", rep.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(rep.Rules) == 0 {
+		_, err := fmt.Fprintln(w, "\nNo rules checked")
+		return err
+	}
+
+	fmt.Fprintln(w, "\nRules checked")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tNAME\tTYPE\tMATCHED")
+	for _, check := range rep.Rules {
+		matched := "no"
+		if check.Matched {
+			matched = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", check.RuleID, orDash(check.Name), check.RuleType, matched)
+	}
+	return tw.Flush()
+}
+
+func describeOptions(options *rulesengine.PreflightOptions) string {
+	var parts []string
+	if options.Usage != nil {
+		parts = append(parts, fmt.Sprintf("usage=%d", *options.Usage))
+	}
+	if options.EventUsage != nil {
+		parts = append(parts, fmt.Sprintf("event-usage %s=%d", options.EventUsage.EventSubtype, options.EventUsage.Quantity))
+	}
+	creditCosts := make([]string, 0, len(options.CreditCosts))
+	for creditID, cost := range options.CreditCosts {
+		creditCosts = append(creditCosts, fmt.Sprintf("credit-cost %s=%g", creditID, cost))
+	}
+	sort.Strings(creditCosts)
+	return strings.Join(append(parts, creditCosts...), ", ")
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func int64String(n *int64) string {
+	if n == nil {
+		return "-"
+	}
+	return strconv.FormatInt(*n, 10)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg, err := parseArgs(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintf(stderr, "rulesengine: %v\n", err)
+		return exitUsageError
+	}
+
+	snap, target, err := loadInputs(cfg, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "rulesengine: %v\n", err)
+		return exitUsageError
+	}
+
+	rep := evaluate(ctx, cfg, snap, target)
+
+	printReport := printTable
+	if cfg.format == formatJSON {
+		printReport = printJSON
+	}
+	if err := printReport(stdout, rep); err != nil {
+		fmt.Fprintf(stderr, "rulesengine: %v\n", err)
+		return exitUsageError
+	}
+
+	if rep.Error != "" {
+		return exitEvaluationError
+	}
+	return exitOK
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSnapshot() *snapshot {
+	subtype := "api-calls"
+	period := rulesengine.MetricPeriodCurrentMonth
+	limit := int64(10)
+
+	company := &rulesengine.Company{
+		ID:      "comp_1",
+		PlanIDs: []string{"plan_1"},
+		Metrics: rulesengine.CompanyMetricCollection{{
+			CompanyID:    "comp_1",
+			EventSubtype: subtype,
+			Period:       period,
+			MonthReset:   rulesengine.MetricPeriodMonthResetFirst,
+			Value:        8,
+		}},
+	}
+
+	metered := &rulesengine.Flag{ID: "flag_metered", Key: "metered", Rules: []*rulesengine.Rule{{
+		ID:       "rule_metered",
+		Name:     "Pro plan",
+		RuleType: rulesengine.RuleTypePlanEntitlement,
+		Value:    true,
+		Conditions: []*rulesengine.Condition{{
+			ID:            "cond_metric",
+			ConditionType: rulesengine.ConditionTypeMetric,
+			Operator:      "lte",
+			EventSubtype:  &subtype,
+			MetricValue:   &limit,
+			MetricPeriod:  &period,
+		}},
+	}}}
+
+	beta := &rulesengine.Flag{ID: "flag_beta", Key: "beta", Rules: []*rulesengine.Rule{{
+		ID:       "rule_beta",
+		Name:     "Beta companies",
+		RuleType: rulesengine.RuleTypeStandard,
+		Value:    true,
+		Conditions: []*rulesengine.Condition{{
+			ID:            "cond_company",
+			ConditionType: rulesengine.ConditionTypeCompany,
+			Operator:      "eq",
+			ResourceIDs:   []string{"comp_2"},
+		}},
+	}}}
+
+	return &snapshot{Company: company, Flags: []*rulesengine.Flag{metered, beta}}
+}
+
+func writeJSON(t *testing.T, name string, v any) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func runJSON(t *testing.T, args ...string) (int, *report) {
+	t.Helper()
+
+	code, stdout, stderr := runCommand(t, "", append(args, "-format", "json")...)
+	var rep report
+	require.NoError(t, json.Unmarshal([]byte(stdout), &rep), stderr)
+	return code, &rep
+}
+
+func TestRun(t *testing.T) {
+	snapshotPath := writeJSON(t, "snapshot.json", testSnapshot())
+
+	t.Run("Prints the decision and rules checked as a table", func(t *testing.T) {
+		code, stdout, _ := runCommand(t, "", "-snapshot", snapshotPath, "-key", "beta")
+
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, "beta (flag_beta)")
+		assert.Contains(t, stdout, "comp_1")
+		assert.Contains(t, stdout, rulesengine.ReasonNoRulesMatched)
+		assert.Regexp(t, `rule_beta\s+Beta companies\s+standard\s+no`, stdout)
+	})
+
+	t.Run("Prints the decision as JSON", func(t *testing.T) {
+		code, rep := runJSON(t, "-snapshot", snapshotPath, "-key", "metered")
+
+		assert.Equal(t, exitOK, code)
+		require.NotNil(t, rep.Result)
+		assert.True(t, rep.Result.Value)
+		assert.Equal(t, "rule_metered", *rep.Result.RuleID)
+		assert.Equal(t, int64(8), *rep.Result.FeatureUsage)
+		require.Len(t, rep.Rules, 1)
+		assert.True(t, rep.Rules[0].Matched)
+		assert.Nil(t, rep.Options)
+	})
+
+	t.Run("Applies preflight options", func(t *testing.T) {
+		_, rep := runJSON(t, "-snapshot", snapshotPath, "-key", "metered", "-usage", "5")
+		assert.False(t, rep.Result.Value)
+		assert.Equal(t, int64(5), *rep.Options.Usage)
+
+		_, rep = runJSON(t, "-snapshot", snapshotPath, "-key", "metered", "-event-usage", "api-calls=5")
+		assert.False(t, rep.Result.Value)
+
+		_, rep = runJSON(t, "-snapshot", snapshotPath, "-key", "metered", "-event-usage", "other=5")
+		assert.True(t, rep.Result.Value)
+	})
+
+	t.Run("Command-line options override the snapshot's", func(t *testing.T) {
+		snap := testSnapshot()
+		usage := int64(5)
+		snap.Options = &rulesengine.PreflightOptions{Usage: &usage, CreditCosts: map[string]float64{"credit_1": 1}}
+		path := writeJSON(t, "snapshot.json", snap)
+
+		_, rep := runJSON(t, "-snapshot", path, "-key", "metered")
+		assert.False(t, rep.Result.Value)
+
+		_, rep = runJSON(t, "-snapshot", path, "-key", "metered", "-usage", "0", "-credit-cost", "credit_2=2.5")
+		assert.True(t, rep.Result.Value)
+		assert.Equal(t, map[string]float64{"credit_1": 1, "credit_2": 2.5}, rep.Options.CreditCosts)
+	})
+
+	t.Run("Evaluates as of the given time", func(t *testing.T) {
+		_, rep := runJSON(t, "-snapshot", snapshotPath, "-key", "metered", "-as-of", "2024-02-10T12:00:00Z")
+
+		assert.Equal(t, time.Date(2024, time.February, 10, 12, 0, 0, 0, time.UTC), rep.EvaluatedAt)
+		require.NotNil(t, rep.Result.FeatureUsageResetAt)
+		assert.Equal(t, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), rep.Result.FeatureUsageResetAt.UTC())
+	})
+
+	t.Run("Reads separate files and standard input", func(t *testing.T) {
+		snap := testSnapshot()
+		companyPath := writeJSON(t, "company.json", snap.Company)
+		flagData, err := json.Marshal(snap.Flags[0])
+		require.NoError(t, err)
+
+		code, stdout, _ := runCommand(t, string(flagData), "-flag", "-", "-company", companyPath)
+
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, `Matched plan entitlement rule "Pro plan" (rule_metered)`)
+		assert.Contains(t, stdout, "8 / 10 (api-calls)")
+	})
+
+	t.Run("Evaluation errors exit with status 1", func(t *testing.T) {
+		code, rep := runJSON(t, "-snapshot", snapshotPath, "-key", "metered", "-usage", "-1")
+
+		assert.Equal(t, exitEvaluationError, code)
+		assert.Equal(t, rulesengine.ErrorNegativePreflightUsage.Error(), rep.Error)
+	})
+
+	t.Run("Invalid input exits with status 2", func(t *testing.T) {
+		for name, args := range map[string][]string{
+			"No inputs":           {},
+			"Ambiguous flag":      {"-snapshot", snapshotPath},
+			"Unknown flag key":    {"-snapshot", snapshotPath, "-key", "missing"},
+			"Bad event usage":     {"-snapshot", snapshotPath, "-event-usage", "api-calls"},
+			"Bad credit cost":     {"-snapshot", snapshotPath, "-credit-cost", "credit_1=lots"},
+			"Bad as-of time":      {"-snapshot", snapshotPath, "-as-of", "yesterday"},
+			"Unknown format":      {"-snapshot", snapshotPath, "-format", "yaml"},
+			"Missing file":        {"-flag", filepath.Join(t.TempDir(), "missing.json")},
+			"Two stdin inputs":    {"-flag", "-", "-company", "-"},
+			"Positional argument": {"-snapshot", snapshotPath, "extra"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				code, _, stderr := runCommand(t, "", args...)
+
+				assert.Equal(t, exitUsageError, code)
+				assert.NotEmpty(t, stderr)
+			})
+		}
+	})
+}
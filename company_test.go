@@ -1,6 +1,8 @@
 package rulesengine_test
 
 import (
+	"context"
+	"slices"
 	"strconv"
 	"sync"
 	"testing"
@@ -8,6 +10,7 @@ import (
 
 	"github.com/schematichq/rulesengine"
 	"github.com/schematichq/rulesengine/null"
+	"github.com/schematichq/rulesengine/typeconvert"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,6 +53,19 @@ func TestCompanyAddMetric(t *testing.T) {
 		assert.Equal(t, int64(10), foundMetric.Value)
 	})
 
+	t.Run("replaces a metric that was replaced in place", func(t *testing.T) {
+		company := createTestCompany()
+		company.Metrics = rulesengine.CompanyMetricCollection{createTestMetric(company, "seats", rulesengine.MetricPeriodAllTime, 1)}
+		assert.Nil(t, company.FindMetric("api_calls", nil, nil))
+
+		company.Metrics[0] = createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 1)
+		updated := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 2)
+		company.AddMetric(updated)
+
+		assert.Len(t, company.Metrics, 1)
+		assert.Same(t, updated, company.Metrics[0])
+	})
+
 	t.Run("handles concurrent updates safely", func(t *testing.T) {
 		company := createTestCompany()
 
@@ -116,3 +132,442 @@ func TestCompanyAddMetric(t *testing.T) {
 		company.AddMetric(metric)
 	})
 }
+
+func TestCompanyFindMetric(t *testing.T) {
+	currentMonth := rulesengine.MetricPeriodCurrentMonth
+	billingCycle := rulesengine.MetricPeriodMonthResetBilling
+
+	t.Run("finds metrics by subtype, period and month reset", func(t *testing.T) {
+		company := createTestCompany()
+		allTime := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 1)
+		monthly := createTestMetric(company, "api_calls", rulesengine.MetricPeriodCurrentMonth, 2)
+		cycle := createTestMetric(company, "api_calls", rulesengine.MetricPeriodCurrentMonth, 3)
+		cycle.MonthReset = billingCycle
+		company.Metrics = rulesengine.CompanyMetricCollection{allTime, monthly, cycle}
+
+		assert.Same(t, allTime, company.FindMetric("api_calls", nil, nil))
+		assert.Same(t, monthly, company.FindMetric("api_calls", &currentMonth, nil))
+		assert.Same(t, cycle, company.FindMetric("api_calls", &currentMonth, &billingCycle))
+		assert.Nil(t, company.FindMetric("seats", nil, nil))
+	})
+
+	t.Run("sees metrics appended after the first lookup", func(t *testing.T) {
+		company := createTestCompany()
+		assert.Nil(t, company.FindMetric("api_calls", nil, nil))
+
+		metric := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 1)
+		company.Metrics = append(company.Metrics, metric)
+		assert.Same(t, metric, company.FindMetric("api_calls", nil, nil))
+
+		added := createTestMetric(company, "seats", rulesengine.MetricPeriodAllTime, 1)
+		company.AddMetric(added)
+		assert.Same(t, added, company.FindMetric("seats", nil, nil))
+	})
+
+	t.Run("sees reassigned and replaced metrics", func(t *testing.T) {
+		company := createTestCompany()
+		metric := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 1)
+		company.Metrics = rulesengine.CompanyMetricCollection{metric}
+		assert.Same(t, metric, company.FindMetric("api_calls", nil, nil))
+
+		replacement := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 2)
+		company.Metrics[0] = replacement
+		assert.Same(t, replacement, company.FindMetric("api_calls", nil, nil))
+
+		company.Metrics[0] = createTestMetric(company, "seats", rulesengine.MetricPeriodAllTime, 3)
+		assert.Nil(t, company.FindMetric("api_calls", nil, nil))
+
+		company.Metrics = nil
+		assert.Nil(t, company.FindMetric("seats", nil, nil))
+	})
+
+	t.Run("sees metrics replaced in place once the slice changes", func(t *testing.T) {
+		company := createTestCompany()
+		company.Metrics = rulesengine.CompanyMetricCollection{createTestMetric(company, "seats", rulesengine.MetricPeriodAllTime, 1)}
+		assert.Nil(t, company.FindMetric("api_calls", nil, nil))
+
+		// Misses trust the index, which only notices a new slice.
+		replacement := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 10)
+		company.Metrics[0] = replacement
+		assert.Nil(t, company.FindMetric("api_calls", nil, nil))
+
+		company.Metrics = slices.Clone(company.Metrics)
+		assert.Same(t, replacement, company.FindMetric("api_calls", nil, nil))
+		assert.Nil(t, company.FindMetric("seats", nil, nil))
+	})
+
+	t.Run("never returns metrics under a key they no longer have", func(t *testing.T) {
+		company := createTestCompany()
+		metric := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 1)
+		company.Metrics = rulesengine.CompanyMetricCollection{metric}
+		assert.Same(t, metric, company.FindMetric("api_calls", nil, nil))
+
+		metric.EventSubtype = "seats"
+		assert.Nil(t, company.FindMetric("api_calls", nil, nil))
+		assert.Same(t, company.Metrics.Find("seats", nil, nil), company.FindMetric("seats", nil, nil))
+	})
+
+	t.Run("evaluations see metrics added after the first lookup", func(t *testing.T) {
+		company := createTestCompany()
+		company.Metrics = rulesengine.CompanyMetricCollection{createTestMetric(company, "seats", rulesengine.MetricPeriodAllTime, 1)}
+
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		condition.EventSubtype = null.Nullable("api_calls")
+		condition.MetricPeriod = nil
+		condition.MetricPeriodMonthReset = nil
+		condition.MetricValue = null.Nullable(int64(3))
+		condition.Operator = typeconvert.ComparableOperatorGte
+		rule := createTestRule()
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag := createTestFlag()
+		flag.DefaultValue = false
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		result, err := rulesengine.CheckFlag(context.Background(), company, nil, flag)
+		assert.NoError(t, err)
+		assert.False(t, result.Value)
+
+		company.AddMetric(createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 10))
+		result, err = rulesengine.CheckFlag(context.Background(), company, nil, flag)
+		assert.NoError(t, err)
+		assert.True(t, result.Value)
+	})
+
+	t.Run("agrees with Find on duplicate and nil metrics", func(t *testing.T) {
+		company := createTestCompany()
+		first := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 1)
+		second := createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 2)
+		company.Metrics = rulesengine.CompanyMetricCollection{first, second, nil}
+
+		assert.Same(t, company.Metrics.Find("api_calls", nil, nil), company.FindMetric("api_calls", nil, nil))
+	})
+
+	t.Run("nil company has no metrics", func(t *testing.T) {
+		var company *rulesengine.Company
+		assert.Nil(t, company.FindMetric("api_calls", nil, nil))
+	})
+
+	t.Run("handles concurrent lookups safely", func(t *testing.T) {
+		company := createLargeTestCompany(100, 100)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				subtype := "event-" + strconv.Itoa(index)
+				assert.Equal(t, subtype, company.FindMetric(subtype, &currentMonth, nil).EventSubtype)
+				assert.NotNil(t, company.FindTrait(company.Traits[index].TraitDefinition.ID))
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+func TestFindTrait(t *testing.T) {
+	t.Run("finds company traits by definition ID", func(t *testing.T) {
+		company := createTestCompany()
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		assert.Nil(t, company.FindTrait(def.ID))
+
+		trait := createTestTrait("value", def)
+		company.Traits = append(company.Traits, trait)
+		assert.Same(t, trait, company.FindTrait(def.ID))
+
+		replacement := createTestTrait("other", def)
+		company.Traits[len(company.Traits)-1] = replacement
+		assert.Same(t, replacement, company.FindTrait(def.ID))
+	})
+
+	t.Run("finds traits set after a miss", func(t *testing.T) {
+		company := createTestCompany()
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		other := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		company.Traits = []*rulesengine.Trait{createTestTrait("value", other)}
+		assert.Nil(t, company.FindTrait(def.ID))
+
+		trait := createTestTrait("value", def)
+		company.SetTrait(trait)
+		assert.Same(t, trait, company.FindTrait(def.ID))
+
+		// A trait changed in place is not returned under its old definition.
+		trait.TraitDefinition = other
+		assert.Nil(t, company.FindTrait(def.ID))
+
+		company.RemoveTrait(other.ID)
+		assert.Nil(t, company.FindTrait(other.ID))
+		assert.Empty(t, company.Traits)
+	})
+
+	t.Run("finds user traits by definition ID", func(t *testing.T) {
+		user := createTestUser()
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)
+		trait := createTestTrait("value", def)
+		user.Traits = []*rulesengine.Trait{{Value: "no definition"}, trait}
+
+		assert.Same(t, trait, user.FindTrait(def.ID))
+		assert.Nil(t, user.FindTrait("missing"))
+
+		var nilUser *rulesengine.User
+		assert.Nil(t, nilUser.FindTrait(def.ID))
+	})
+}
+
+func BenchmarkCheckFlagLargeCompany(b *testing.B) {
+	ctx := context.Background()
+	company := createLargeTestCompany(500, 500)
+	currentMonth := rulesengine.MetricPeriodCurrentMonth
+
+	// Every rule but the last references rows near the end of the company's
+	// traits and metrics, and none match.
+	var rules []*rulesengine.Rule
+	for i := 0; i < 20; i++ {
+		metric := createTestCondition(rulesengine.ConditionTypeMetric)
+		metric.EventSubtype = null.Nullable("event-" + strconv.Itoa(499-i))
+		metric.MetricPeriod = &currentMonth
+		metric.MetricValue = null.Nullable(int64(0))
+		metric.Operator = typeconvert.ComparableOperatorLt
+
+		trait := createTestCondition(rulesengine.ConditionTypeTrait)
+		trait.TraitDefinition = company.Traits[499-i].TraitDefinition
+		trait.TraitValue = "value-" + strconv.Itoa(499-i)
+		trait.Operator = typeconvert.ComparableOperatorEquals
+
+		rule := createTestRule()
+		rule.Priority = int64(i)
+		rule.Conditions = []*rulesengine.Condition{trait, metric}
+		rules = append(rules, rule)
+	}
+	flag := createTestFlag()
+	flag.Rules = rules
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rulesengine.CheckFlag(ctx, company, nil, flag); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompanyFindMetric(b *testing.B) {
+	company := createLargeTestCompany(0, 500)
+	currentMonth := rulesengine.MetricPeriodCurrentMonth
+
+	b.Run("Indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if company.FindMetric("event-499", &currentMonth, nil) == nil {
+				b.Fatal("metric not found")
+			}
+		}
+	})
+
+	b.Run("Linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if company.Metrics.Find("event-499", &currentMonth, nil) == nil {
+				b.Fatal("metric not found")
+			}
+		}
+	})
+}
+
+func TestCompanyMutators(t *testing.T) {
+	t.Run("sets and removes traits by definition", func(t *testing.T) {
+		company := createTestCompany()
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		initialLen := len(company.Traits)
+
+		company.SetTrait(createTestTrait("first", def))
+		company.SetTrait(createTestTrait("second", def))
+		assert.Len(t, company.Traits, initialLen+1)
+		assert.Equal(t, "second", company.FindTrait(def.ID).Value)
+
+		company.RemoveTrait(def.ID)
+		assert.Len(t, company.Traits, initialLen)
+		assert.Nil(t, company.FindTrait(def.ID))
+
+		company.SetTrait(&rulesengine.Trait{Value: "no definition"})
+		assert.Len(t, company.Traits, initialLen)
+	})
+
+	t.Run("sets credit balances", func(t *testing.T) {
+		company := &rulesengine.Company{}
+
+		company.SetCreditBalance("credit_1", 10)
+		company.SetCreditBalance("credit_2", 5)
+		company.SetCreditBalance("credit_1", 7.5)
+
+		assert.Equal(t, map[string]float64{"credit_1": 7.5, "credit_2": 5}, company.CreditBalances)
+	})
+
+	t.Run("adds and removes plans once", func(t *testing.T) {
+		company := &rulesengine.Company{}
+
+		company.AddPlanID("plan_1")
+		company.AddPlanID("plan_2")
+		company.AddPlanID("plan_1")
+		assert.Equal(t, []string{"plan_1", "plan_2"}, []string(company.PlanIDs))
+
+		company.RemovePlanID("plan_1")
+		company.RemovePlanID("plan_3")
+		assert.Equal(t, []string{"plan_2"}, []string(company.PlanIDs))
+	})
+
+	t.Run("sets rules", func(t *testing.T) {
+		company := createTestCompany()
+		rules := []*rulesengine.Rule{createTestRule()}
+
+		company.SetRules(rules)
+
+		assert.Equal(t, rules, []*rulesengine.Rule(company.Rules))
+	})
+
+	t.Run("nil company does not panic", func(t *testing.T) {
+		var company *rulesengine.Company
+
+		company.SetTrait(createTestTrait("value", createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)))
+		company.RemoveTrait("trait")
+		company.SetCreditBalance("credit", 1)
+		company.AddPlanID("plan")
+		company.RemovePlanID("plan")
+		company.SetRules(nil)
+		assert.Nil(t, company.Snapshot())
+	})
+}
+
+func TestUserMutators(t *testing.T) {
+	t.Run("sets and removes traits by definition", func(t *testing.T) {
+		user := createTestUser()
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)
+
+		user.SetTrait(createTestTrait("first", def))
+		user.SetTrait(createTestTrait("second", def))
+		assert.Equal(t, "second", user.FindTrait(def.ID).Value)
+
+		user.RemoveTrait(def.ID)
+		assert.Nil(t, user.FindTrait(def.ID))
+	})
+
+	t.Run("sets rules", func(t *testing.T) {
+		user := createTestUser()
+		rules := []*rulesengine.Rule{createTestRule()}
+
+		user.SetRules(rules)
+
+		assert.Equal(t, rules, []*rulesengine.Rule(user.Rules))
+	})
+
+	t.Run("nil user does not panic", func(t *testing.T) {
+		var user *rulesengine.User
+
+		user.SetTrait(createTestTrait("value", createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)))
+		user.RemoveTrait("trait")
+		user.SetRules(nil)
+		assert.Nil(t, user.Snapshot())
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("company snapshots are unaffected by later updates", func(t *testing.T) {
+		company := createTestCompany()
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		company.SetTrait(createTestTrait("before", def))
+		company.AddMetric(createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 1))
+		company.SetCreditBalance("credit", 10)
+		company.AddPlanID("plan_1")
+
+		snapshot := company.Snapshot()
+		company.SetTrait(createTestTrait("after", def))
+		company.AddMetric(createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, 2))
+		company.SetCreditBalance("credit", 0)
+		company.RemovePlanID("plan_1")
+
+		assert.Equal(t, company.ID, snapshot.ID)
+		assert.Equal(t, "before", snapshot.FindTrait(def.ID).Value)
+		assert.Equal(t, int64(1), snapshot.FindMetric("api_calls", nil, nil).Value)
+		assert.Equal(t, 10.0, snapshot.CreditBalances["credit"])
+		assert.Contains(t, snapshot.PlanIDs, "plan_1")
+
+		assert.Equal(t, "after", company.FindTrait(def.ID).Value)
+		assert.Equal(t, int64(2), company.FindMetric("api_calls", nil, nil).Value)
+	})
+
+	t.Run("user snapshots are unaffected by later updates", func(t *testing.T) {
+		user := createTestUser()
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)
+		user.SetTrait(createTestTrait("before", def))
+
+		snapshot := user.Snapshot()
+		user.SetTrait(createTestTrait("after", def))
+
+		assert.Equal(t, "before", snapshot.FindTrait(def.ID).Value)
+		assert.Equal(t, "after", user.FindTrait(def.ID).Value)
+	})
+
+	t.Run("checks run concurrently with updates", func(t *testing.T) {
+		ctx := context.Background()
+		company, user := createTestCompany(), createTestUser()
+		companyDef := createTestTraitDefinition(typeconvert.ComparableTypeInt, rulesengine.EntityTypeCompany)
+		userDef := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)
+
+		metric := createTestCondition(rulesengine.ConditionTypeMetric)
+		metric.EventSubtype = null.Nullable("api_calls")
+		metric.MetricValue = null.Nullable(int64(1000))
+		metric.Operator = typeconvert.ComparableOperatorLt
+		trait := createTestCondition(rulesengine.ConditionTypeTrait)
+		trait.TraitDefinition = companyDef
+		trait.TraitValue = "0"
+		trait.Operator = typeconvert.ComparableOperatorGte
+		credit := createTestCondition(rulesengine.ConditionTypeCredit)
+		credit.CreditID = null.Nullable("credit")
+		credit.ConsumptionRate = null.Nullable(1.0)
+		plan := createTestCondition(rulesengine.ConditionTypePlan)
+		plan.ResourceIDs = []string{"plan_1"}
+		userTrait := createTestCondition(rulesengine.ConditionTypeTrait)
+		userTrait.TraitDefinition = userDef
+		userTrait.TraitValue = "admin"
+		userTrait.Operator = typeconvert.ComparableOperatorNotEquals
+
+		rule := createTestRule()
+		rule.Value = true
+		rule.Conditions = []*rulesengine.Condition{metric, trait, credit, plan, userTrait}
+		flag := createTestFlag()
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		const updates = 100
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				company.AddMetric(createTestMetric(company, "api_calls", rulesengine.MetricPeriodAllTime, int64(i)))
+				company.SetTrait(createTestTrait(strconv.Itoa(i), companyDef))
+				company.SetCreditBalance("credit", float64(i))
+				if i%2 == 0 {
+					company.AddPlanID("plan_1")
+				} else {
+					company.RemovePlanID("plan_1")
+				}
+				company.SetRules([]*rulesengine.Rule{createTestRule()})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				user.SetTrait(createTestTrait(strconv.Itoa(i), userDef))
+				user.SetRules([]*rulesengine.Rule{createTestRule()})
+			}
+		}()
+
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < updates; j++ {
+					_, err := rulesengine.CheckFlag(ctx, company, user, flag)
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,133 @@
+package rulesengine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ConditionEvaluator decides whether a condition matches in a scope. The
+// built-in condition types are evaluators too, so a custom evaluator sees
+// exactly what they do, reading traits, metrics and preflight options
+// through the scope's methods. Errors without a code of their own are reported as
+// ErrorInvalidCondition.
+type ConditionEvaluator interface {
+	EvaluateCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error)
+}
+
+// ConditionEvaluatorFunc adapts a function to a ConditionEvaluator.
+type ConditionEvaluatorFunc func(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error)
+
+func (f ConditionEvaluatorFunc) EvaluateCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+	return f(ctx, scope, condition)
+}
+
+// ConditionRegistry maps condition types to their evaluators. It is safe for
+// concurrent use. Conditions of types without an evaluator never match.
+type ConditionRegistry struct {
+	mu         sync.RWMutex
+	evaluators map[ConditionType]ConditionEvaluator
+	// custom holds the types added with Register, as opposed to the
+	// built-in ones.
+	custom map[ConditionType]bool
+}
+
+// NewConditionRegistry returns a registry holding the built-in condition
+// types.
+func NewConditionRegistry() *ConditionRegistry {
+	var s RuleCheckService
+	return &ConditionRegistry{
+		evaluators: map[ConditionType]ConditionEvaluator{
+			ConditionTypeBasePlan:       ConditionEvaluatorFunc(s.checkBasePlanCondition),
+			ConditionTypeBillingProduct: ConditionEvaluatorFunc(s.checkBillingProductCondition),
+			ConditionTypeCompany:        ConditionEvaluatorFunc(s.checkCompanyCondition),
+			ConditionTypeCredit:         ConditionEvaluatorFunc(s.checkCreditBalanceCondition),
+			ConditionTypeMetric:         ConditionEvaluatorFunc(s.checkMetricCondition),
+			ConditionTypePlan:           ConditionEvaluatorFunc(s.checkPlanCondition),
+			ConditionTypePlanVersion:    ConditionEvaluatorFunc(s.checkPlanVersionCondition),
+			ConditionTypeTrait:          ConditionEvaluatorFunc(s.checkTraitCondition),
+			ConditionTypeUser:           ConditionEvaluatorFunc(s.checkUserCondition),
+		},
+		custom: map[ConditionType]bool{},
+	}
+}
+
+// DefaultConditions is the registry CheckFlag evaluates conditions with
+// unless WithConditionRegistry picks another. Host applications register
+// their own condition types here, typically from an init function.
+var DefaultConditions = NewConditionRegistry()
+
+// Register adds an evaluator for conditionType. Each type may only be
+// registered once, so the built-in types can't be replaced. A panic in a
+// registered evaluator fails its condition with ErrorInvalidCondition.
+func (r *ConditionRegistry) Register(conditionType ConditionType, evaluator ConditionEvaluator) error {
+	if conditionType == "" {
+		return fmt.Errorf("condition type is empty")
+	}
+	if evaluator == nil {
+		return fmt.Errorf("condition type %s has no evaluator", conditionType)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.evaluators[conditionType]; ok {
+		return fmt.Errorf("condition type %s already registered", conditionType)
+	}
+
+	r.evaluators[conditionType] = evaluator
+	r.custom[conditionType] = true
+	return nil
+}
+
+// MustRegister is Register for package-level registration; it panics on
+// conflicting registrations.
+func (r *ConditionRegistry) MustRegister(conditionType ConditionType, evaluator ConditionEvaluator) {
+	if err := r.Register(conditionType, evaluator); err != nil {
+		panic(err)
+	}
+}
+
+// Evaluator returns the evaluator registered for conditionType.
+func (r *ConditionRegistry) Evaluator(conditionType ConditionType) (ConditionEvaluator, bool) {
+	evaluator, _, ok := r.lookup(conditionType)
+	return evaluator, ok
+}
+
+// lookup returns the evaluator for conditionType and whether it was added
+// with Register rather than being built in.
+func (r *ConditionRegistry) lookup(conditionType ConditionType) (evaluator ConditionEvaluator, custom, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	evaluator, ok = r.evaluators[conditionType]
+	return evaluator, r.custom[conditionType], ok
+}
+
+// Types returns the registered condition types in sorted order.
+func (r *ConditionRegistry) Types() []ConditionType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]ConditionType, 0, len(r.evaluators))
+	for conditionType := range r.evaluators {
+		types = append(types, conditionType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// WithConditionRegistry evaluates conditions with registry rather than
+// DefaultConditions, and WithValidation accepts the condition types
+// registered on it. A nil registry means DefaultConditions. Outside CheckFlag,
+// lint and validate such flags with WithLintConditionRegistry and
+// ValidateWithConditions.
+func WithConditionRegistry(registry *ConditionRegistry) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		if registry == nil {
+			registry = DefaultConditions
+		}
+		o.conditions = registry
+	}
+}
@@ -0,0 +1,308 @@
+package rulesengine_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/rulesenginetest"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const conditionTypeAllowlist rulesengine.ConditionType = "ip_allowlist"
+
+// allowlistEvaluator matches companies whose "ip" key is one of the
+// condition's resource IDs.
+var allowlistEvaluator = rulesengine.ConditionEvaluatorFunc(func(ctx context.Context, scope *rulesengine.CheckScope, condition *rulesengine.Condition) (bool, error) {
+	if scope.Company == nil {
+		return false, nil
+	}
+	return slices.Contains(condition.ResourceIDs, scope.Company.Keys["ip"]), nil
+})
+
+func init() {
+	rulesengine.DefaultConditions.MustRegister("test_default_registry", rulesengine.ConditionEvaluatorFunc(
+		func(ctx context.Context, scope *rulesengine.CheckScope, condition *rulesengine.Condition) (bool, error) {
+			return true, nil
+		},
+	))
+}
+
+// customConditionFlag returns a flag whose only rule has a single condition
+// of conditionType.
+func customConditionFlag(conditionType rulesengine.ConditionType, resourceIDs ...string) (*rulesengine.Flag, *rulesengine.Rule, *rulesengine.Condition) {
+	flag := createTestFlag()
+	flag.DefaultValue = false
+	rule := createTestRule()
+	rule.Value = true
+	condition := createTestCondition(conditionType)
+	condition.ResourceIDs = resourceIDs
+	rule.Conditions = []*rulesengine.Condition{condition}
+	flag.Rules = []*rulesengine.Rule{rule}
+	return flag, rule, condition
+}
+
+func TestConditionRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Evaluates registered condition types", func(t *testing.T) {
+		registry := rulesengine.NewConditionRegistry()
+		require.NoError(t, registry.Register(conditionTypeAllowlist, allowlistEvaluator))
+		flag, rule, _ := customConditionFlag(conditionTypeAllowlist, "10.0.0.1")
+		company := createTestCompany()
+
+		company.Keys = map[string]string{"ip": "10.0.0.1"}
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithConditionRegistry(registry))
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+		assert.Equal(t, &rule.ID, result.RuleID)
+
+		company.Keys = map[string]string{"ip": "10.0.0.2"}
+		result, err = rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithConditionRegistry(registry))
+		require.NoError(t, err)
+		assert.False(t, result.Value)
+	})
+
+	t.Run("Evaluators receive the scope and condition", func(t *testing.T) {
+		flag, rule, condition := customConditionFlag(conditionTypeAllowlist)
+		company, user := createTestCompany(), createTestUser()
+
+		var gotScope *rulesengine.CheckScope
+		var gotCondition *rulesengine.Condition
+		registry := rulesengine.NewConditionRegistry()
+		registry.MustRegister(conditionTypeAllowlist, rulesengine.ConditionEvaluatorFunc(
+			func(ctx context.Context, scope *rulesengine.CheckScope, condition *rulesengine.Condition) (bool, error) {
+				gotScope, gotCondition = scope, condition
+				return true, nil
+			},
+		))
+
+		hook := &afterOnlyHook{}
+		_, err := rulesengine.CheckFlag(ctx, company, user, flag, rulesengine.WithConditionRegistry(registry), rulesengine.WithHooks(hook))
+
+		require.NoError(t, err)
+		require.NotNil(t, gotScope)
+		require.NotNil(t, hook.eval)
+		// Evaluators see snapshots of the company and user rather than the
+		// models passed in, the same snapshots hooks see.
+		assert.True(t, company.Equal(gotScope.Company))
+		assert.True(t, user.Equal(gotScope.User))
+		assert.Same(t, hook.eval.Company, gotScope.Company)
+		assert.Same(t, hook.eval.User, gotScope.User)
+		assert.Same(t, rule, gotScope.Rule)
+		assert.Same(t, condition, gotCondition)
+	})
+
+	t.Run("Evaluators read the evaluation's data through the scope", func(t *testing.T) {
+		flag, _, _ := customConditionFlag(conditionTypeAllowlist)
+		tierDef := rulesenginetest.NewTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		roleDef := rulesenginetest.NewTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)
+		company := rulesenginetest.NewCompany().
+			Trait(tierDef, "gold").
+			Metric("api_calls", rulesengine.MetricPeriodCurrentMonth, 5).
+			Build()
+		user := createTestUser()
+		currentMonth := rulesengine.MetricPeriodCurrentMonth
+		traitResolver := rulesengine.TraitResolverFunc(func(ctx context.Context, entityType rulesengine.EntityType, entityID string, definition *rulesengine.TraitDefinition) (*rulesengine.Trait, error) {
+			return &rulesengine.Trait{TraitDefinition: definition, Value: "admin"}, nil
+		})
+		metricResolver := rulesengine.MetricResolverFunc(func(ctx context.Context, companyID string, eventSubtype string, period rulesengine.MetricPeriod, monthReset rulesengine.MetricPeriodMonthReset) (*rulesengine.CompanyMetric, error) {
+			return &rulesengine.CompanyMetric{CompanyID: companyID, EventSubtype: eventSubtype, Period: period, MonthReset: monthReset, Value: 7}, nil
+		})
+
+		var tier, role *rulesengine.Trait
+		var stored, resolved *rulesengine.CompanyMetric
+		var cost float64
+		var costSet, budgetSet bool
+		var usage, eventUsage, otherEventUsage int64
+		var remaining int
+		registry := rulesengine.NewConditionRegistry()
+		registry.MustRegister(conditionTypeAllowlist, rulesengine.ConditionEvaluatorFunc(
+			func(ctx context.Context, scope *rulesengine.CheckScope, condition *rulesengine.Condition) (bool, error) {
+				var err error
+				if tier, err = scope.Trait(ctx, tierDef); err != nil {
+					return false, err
+				}
+				if role, err = scope.Trait(ctx, roleDef); err != nil {
+					return false, err
+				}
+				if stored, err = scope.Metric(ctx, "api_calls", &currentMonth, nil); err != nil {
+					return false, err
+				}
+				if resolved, err = scope.Metric(ctx, "seats", nil, nil); err != nil {
+					return false, err
+				}
+				cost, costSet = scope.CreditCost("credits")
+				usage = scope.Usage()
+				eventUsage, otherEventUsage = scope.EventUsage("api_calls"), scope.EventUsage("seats")
+				remaining, budgetSet = scope.RemainingConditions()
+				return true, nil
+			},
+		))
+
+		result, err := rulesengine.CheckFlag(ctx, company, user, flag,
+			rulesengine.WithConditionRegistry(registry),
+			rulesengine.WithTraitResolver(traitResolver),
+			rulesengine.WithMetricResolver(metricResolver),
+			rulesengine.WithCreditCost("credits", 1.5),
+			rulesengine.WithUsage(2),
+			rulesengine.WithEventUsage("api_calls", 3),
+			rulesengine.WithEvaluationBudget(10),
+		)
+
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+		require.NotNil(t, tier)
+		assert.Equal(t, "gold", tier.Value)
+		require.NotNil(t, role)
+		assert.Equal(t, "admin", role.Value)
+		require.NotNil(t, stored)
+		assert.Equal(t, int64(5), stored.Value)
+		require.NotNil(t, resolved)
+		assert.Equal(t, int64(7), resolved.Value)
+		assert.True(t, costSet)
+		assert.Equal(t, 1.5, cost)
+		assert.Equal(t, int64(2), usage)
+		assert.Equal(t, int64(3), eventUsage)
+		assert.Zero(t, otherEventUsage)
+		assert.True(t, budgetSet)
+		assert.Equal(t, 9, remaining)
+	})
+
+	t.Run("Scopes without the evaluation's data read as empty", func(t *testing.T) {
+		scope := &rulesengine.CheckScope{}
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+
+		trait, err := scope.Trait(ctx, def)
+		require.NoError(t, err)
+		assert.Nil(t, trait)
+		metric, err := scope.Metric(ctx, "api_calls", nil, nil)
+		require.NoError(t, err)
+		assert.Nil(t, metric)
+		_, ok := scope.CreditCost("credits")
+		assert.False(t, ok)
+		assert.Zero(t, scope.Usage())
+		assert.Zero(t, scope.EventUsage("api_calls"))
+		_, ok = scope.RemainingConditions()
+		assert.False(t, ok)
+	})
+
+	t.Run("Types registered on the default registry need no option", func(t *testing.T) {
+		flag, _, _ := customConditionFlag("test_default_registry")
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag)
+
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+	})
+
+	t.Run("Unregistered condition types never match", func(t *testing.T) {
+		flag, _, _ := customConditionFlag(conditionTypeAllowlist)
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag)
+
+		require.NoError(t, err)
+		assert.False(t, result.Value)
+		assert.Nil(t, result.RuleID)
+	})
+
+	t.Run("Evaluator errors are located and coded", func(t *testing.T) {
+		flag, rule, condition := customConditionFlag(conditionTypeAllowlist)
+		lookupErr := errors.New("allowlist unavailable")
+		registry := rulesengine.NewConditionRegistry()
+		registry.MustRegister(conditionTypeAllowlist, rulesengine.ConditionEvaluatorFunc(
+			func(ctx context.Context, scope *rulesengine.CheckScope, condition *rulesengine.Condition) (bool, error) {
+				return false, lookupErr
+			},
+		))
+
+		_, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithConditionRegistry(registry))
+
+		require.ErrorIs(t, err, lookupErr)
+		assert.ErrorIs(t, err, rulesengine.ErrorInvalidCondition)
+		assert.Equal(t, rulesengine.ErrorCodeInvalidCondition, rulesengine.ErrorCodeOf(err))
+		var evalErr *rulesengine.EvaluationError
+		require.ErrorAs(t, err, &evalErr)
+		assert.Equal(t, rule.ID, evalErr.RuleID)
+		assert.Equal(t, condition.ID, evalErr.ConditionID)
+	})
+
+	t.Run("Panicking evaluators fail the condition", func(t *testing.T) {
+		flag, _, _ := customConditionFlag(conditionTypeAllowlist)
+		registry := rulesengine.NewConditionRegistry()
+		registry.MustRegister(conditionTypeAllowlist, rulesengine.ConditionEvaluatorFunc(
+			func(ctx context.Context, scope *rulesengine.CheckScope, condition *rulesengine.Condition) (bool, error) {
+				panic("boom")
+			},
+		))
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithConditionRegistry(registry))
+
+		require.ErrorIs(t, err, rulesengine.ErrorInvalidCondition)
+		assert.ErrorContains(t, err, "condition evaluator panicked: boom")
+		assert.False(t, result.Value)
+	})
+
+	t.Run("Rejects conflicting registrations", func(t *testing.T) {
+		registry := rulesengine.NewConditionRegistry()
+		require.NoError(t, registry.Register(conditionTypeAllowlist, allowlistEvaluator))
+
+		assert.Error(t, registry.Register(conditionTypeAllowlist, allowlistEvaluator))
+		assert.Error(t, registry.Register(rulesengine.ConditionTypePlan, allowlistEvaluator))
+		assert.Error(t, registry.Register("", allowlistEvaluator))
+		assert.Error(t, registry.Register("geo", nil))
+		assert.Panics(t, func() {
+			registry.MustRegister(rulesengine.ConditionTypeMetric, allowlistEvaluator)
+		})
+	})
+
+	t.Run("Registries start with the built-in types", func(t *testing.T) {
+		registry := rulesengine.NewConditionRegistry()
+		builtins := registry.Types()
+		require.NoError(t, registry.Register(conditionTypeAllowlist, allowlistEvaluator))
+
+		assert.Equal(t, []rulesengine.ConditionType{
+			rulesengine.ConditionTypeBasePlan,
+			rulesengine.ConditionTypeBillingProduct,
+			rulesengine.ConditionTypeCompany,
+			rulesengine.ConditionTypeCredit,
+			rulesengine.ConditionTypeMetric,
+			rulesengine.ConditionTypePlan,
+			rulesengine.ConditionTypePlanVersion,
+			rulesengine.ConditionTypeTrait,
+			rulesengine.ConditionTypeUser,
+		}, builtins)
+		assert.Contains(t, registry.Types(), conditionTypeAllowlist)
+
+		evaluator, ok := registry.Evaluator(rulesengine.ConditionTypeCompany)
+		require.True(t, ok)
+		company := createTestCompany()
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+		condition.ResourceIDs = []string{company.ID}
+		match, err := evaluator.EvaluateCondition(ctx, &rulesengine.CheckScope{Company: company}, condition)
+		require.NoError(t, err)
+		assert.True(t, match)
+	})
+
+	t.Run("Validation accepts registered condition types", func(t *testing.T) {
+		registry := rulesengine.NewConditionRegistry()
+		registry.MustRegister(conditionTypeAllowlist, allowlistEvaluator)
+		flag, _, condition := customConditionFlag(conditionTypeAllowlist)
+
+		_, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithValidation(), rulesengine.WithConditionRegistry(registry))
+		require.NoError(t, err)
+
+		_, err = rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithValidation())
+		errs := fieldErrors(t, err)
+		require.Len(t, errs, 1)
+		assert.Equal(t, "flag.rules[0].conditions[0].condition_type", errs[0].Field)
+
+		condition.ConditionType = "test_default_registry"
+		assert.NoError(t, condition.Validate())
+		assert.Empty(t, rulesengine.LintFlag(flag))
+	})
+}
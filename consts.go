@@ -52,7 +52,7 @@ func (t RuleType) DisplayName() string {
 }
 
 func (t *RuleType) isEntitlement() bool {
-	return t != nil && *t == RuleTypePlanEntitlement || *t == RuleTypePlanEntitlementUsageExceeded || *t == RuleTypeCompanyOverride || *t == RuleTypeCompanyOverrideUsageExceeded
+	return t != nil && (*t == RuleTypePlanEntitlement || *t == RuleTypePlanEntitlementUsageExceeded || *t == RuleTypeCompanyOverride || *t == RuleTypeCompanyOverrideUsageExceeded)
 }
 
 const (
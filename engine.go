@@ -0,0 +1,39 @@
+package rulesengine
+
+import (
+	"context"
+	"slices"
+)
+
+// Engine binds a set of CheckFlagOptions (hooks, most commonly) that apply to
+// every evaluation it performs. It is safe for concurrent use; the package
+// level CheckFlag is equivalent to an Engine with no options.
+type Engine struct {
+	opts []CheckFlagOption
+}
+
+// NewEngine returns an Engine that applies opts to every CheckFlag call,
+// before any options passed to the call itself.
+func NewEngine(opts ...CheckFlagOption) *Engine {
+	return &Engine{opts: slices.Clone(opts)}
+}
+
+// CheckFlag evaluates flag for the given company and user, applying the
+// engine's options followed by opts.
+func (e *Engine) CheckFlag(
+	ctx context.Context,
+	company *Company,
+	user *User,
+	flag *Flag,
+	opts ...CheckFlagOption,
+) (*CheckFlagResult, error) {
+	if e == nil {
+		return CheckFlag(ctx, company, user, flag, opts...)
+	}
+
+	allOpts := make([]CheckFlagOption, 0, len(e.opts)+len(opts))
+	allOpts = append(allOpts, e.opts...)
+	allOpts = append(allOpts, opts...)
+
+	return CheckFlag(ctx, company, user, flag, allOpts...)
+}
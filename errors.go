@@ -1,30 +1,277 @@
 package rulesengine
 
 import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
+// ErrorCode classifies an error returned by the engine, so callers can tell
+// bad input from bad configuration without matching on messages.
+type ErrorCode string
+
+const (
+	// ErrorCodeUnexpected covers errors the engine cannot classify,
+	// including errors returned by hooks.
+	ErrorCodeUnexpected ErrorCode = "unexpected"
+
+	// Input errors: the caller asked for something the engine can't
+	// evaluate.
+	ErrorCodeFlagNotFound     ErrorCode = "flag_not_found"
+	ErrorCodeInvalidInput     ErrorCode = "invalid_input"
+	ErrorCodeInvalidPreflight ErrorCode = "invalid_preflight"
+
+	// Configuration errors: a rule or condition of the flag can't be
+	// evaluated as configured.
+	ErrorCodeInvalidCondition   ErrorCode = "invalid_condition"
+	ErrorCodeMissingMetricValue ErrorCode = "missing_metric_value"
+
+	// Limit errors: the evaluation was stopped before it finished, because
+	// its context ended or it ran out of budget.
+	ErrorCodeCanceled       ErrorCode = "canceled"
+	ErrorCodeBudgetExceeded ErrorCode = "budget_exceeded"
+
+	// ErrorCodeResolverFailed covers errors returned by a TraitResolver or
+	// MetricResolver.
+	ErrorCodeResolverFailed ErrorCode = "resolver_failed"
+)
+
+var errorCodeStatus = map[ErrorCode]int{
+	ErrorCodeUnexpected:         http.StatusInternalServerError,
+	ErrorCodeFlagNotFound:       http.StatusNotFound,
+	ErrorCodeInvalidInput:       http.StatusBadRequest,
+	ErrorCodeInvalidPreflight:   http.StatusBadRequest,
+	ErrorCodeInvalidCondition:   http.StatusUnprocessableEntity,
+	ErrorCodeMissingMetricValue: http.StatusUnprocessableEntity,
+	ErrorCodeCanceled:           http.StatusRequestTimeout,
+	ErrorCodeBudgetExceeded:     http.StatusUnprocessableEntity,
+	ErrorCodeResolverFailed:     http.StatusBadGateway,
+}
+
+// StatusCode returns the HTTP status errors with the code correspond to.
+func (c ErrorCode) StatusCode() int {
+	if status, ok := errorCodeStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// IsConfigurationError reports whether the code describes a flag that
+// can't be evaluated as configured, rather than bad input.
+func (c ErrorCode) IsConfigurationError() bool {
+	return c == ErrorCodeInvalidCondition || c == ErrorCodeMissingMetricValue
+}
+
+// IsLimitError reports whether the code describes an evaluation that was
+// stopped before it finished, rather than a problem with what was evaluated.
+func (c ErrorCode) IsLimitError() bool {
+	return c == ErrorCodeCanceled || c == ErrorCodeBudgetExceeded
+}
+
+// ErrorCodeOf returns the code of the first error in err's chain that has
+// one, ErrorCodeUnexpected if none does, and an empty code for a nil error.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+
+	var coder interface{ Code() ErrorCode }
+	if errors.As(err, &coder) {
+		return coder.Code()
+	}
+	return ErrorCodeUnexpected
+}
+
+// RulesEngineError is an error with a code. The package's Error* variables
+// are RulesEngineErrors; match them with errors.Is.
 type RulesEngineError struct {
-	err    string
-	status int
+	code ErrorCode
+	err  string
 }
 
 func (m RulesEngineError) Error() string {
 	return m.err
 }
 
+func (m RulesEngineError) Code() ErrorCode {
+	if m.code == "" {
+		return ErrorCodeUnexpected
+	}
+	return m.code
+}
+
 func (m RulesEngineError) StatusCode() int {
-	if m.status == 0 {
-		return http.StatusInternalServerError
+	return m.Code().StatusCode()
+}
+
+func newRulesEngineError(code ErrorCode, err string) error {
+	return RulesEngineError{code: code, err: err}
+}
+
+var ErrorUnexpected = newRulesEngineError(ErrorCodeUnexpected, "unexpected error")
+var ErrorFlagNotFound = newRulesEngineError(ErrorCodeFlagNotFound, "flag not found")
+var ErrorNegativePreflightUsage = newRulesEngineError(ErrorCodeInvalidPreflight, "preflight usage cannot be negative")
+var ErrorNegativePreflightCreditCost = newRulesEngineError(ErrorCodeInvalidPreflight, "preflight credit cost cannot be negative")
+var ErrorUnknownErrorPolicy = newRulesEngineError(ErrorCodeInvalidInput, "unknown error policy")
+var ErrorInvalidCondition = newRulesEngineError(ErrorCodeInvalidCondition, "invalid condition")
+var ErrorMissingMetricValue = newRulesEngineError(ErrorCodeMissingMetricValue, "metric condition has no metric value")
+var ErrorNegativeEvaluationBudget = newRulesEngineError(ErrorCodeInvalidInput, "evaluation budget cannot be negative")
+var ErrorEvaluationCanceled = newRulesEngineError(ErrorCodeCanceled, "evaluation canceled")
+var ErrorEvaluationBudgetExceeded = newRulesEngineError(ErrorCodeBudgetExceeded, "evaluation budget exceeded")
+var ErrorResolverFailed = newRulesEngineError(ErrorCodeResolverFailed, "resolver failed")
+
+// EvaluationError is an error raised while evaluating a flag, annotated with
+// the IDs of the flag, rule and condition being evaluated; IDs that don't
+// apply are empty. It wraps the underlying error, so errors.Is matches the
+// package's Error* variables through it, and errors.As recovers the IDs.
+type EvaluationError struct {
+	FlagID      string
+	RuleID      string
+	ConditionID string
+	Err         error
+}
+
+func (e *EvaluationError) Error() string {
+	var b strings.Builder
+	for _, part := range []struct{ name, id string }{
+		{"flag", e.FlagID},
+		{"rule", e.RuleID},
+		{"condition", e.ConditionID},
+	} {
+		if part.id != "" {
+			fmt.Fprintf(&b, "%s %s: ", part.name, part.id)
+		}
+	}
+	b.WriteString(e.errorMessage())
+	return b.String()
+}
+
+func (e *EvaluationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *EvaluationError) Code() ErrorCode {
+	return ErrorCodeOf(e.Err)
+}
+
+func (e *EvaluationError) StatusCode() int {
+	return e.Code().StatusCode()
+}
+
+func (e *EvaluationError) errorMessage() string {
+	if e.Err == nil {
+		return ErrorUnexpected.Error()
+	}
+	return e.Err.Error()
+}
+
+// withEvaluationIDs annotates err with the IDs of what was being evaluated.
+// IDs already recorded by an inner EvaluationError are kept, so annotating
+// at each level of the evaluation builds up the full location.
+func withEvaluationIDs(err error, flagID, ruleID, conditionID string) error {
+	if err == nil {
+		return nil
+	}
+
+	var evalErr *EvaluationError
+	if !errors.As(err, &evalErr) {
+		return &EvaluationError{FlagID: flagID, RuleID: ruleID, ConditionID: conditionID, Err: err}
+	}
+
+	annotated := *evalErr
+	annotated.FlagID = cmp.Or(annotated.FlagID, flagID)
+	annotated.RuleID = cmp.Or(annotated.RuleID, ruleID)
+	annotated.ConditionID = cmp.Or(annotated.ConditionID, conditionID)
+	return &annotated
+}
+
+// ErrorDetail is the wire form of CheckFlagResult.Err.
+type ErrorDetail struct {
+	Code        ErrorCode        `json:"code" binding:"oneof=unexpected flag_not_found invalid_input invalid_preflight invalid_condition missing_metric_value canceled budget_exceeded resolver_failed"`
+	Message     string           `json:"message"`
+	FlagID      string           `json:"flag_id,omitempty"`
+	RuleID      string           `json:"rule_id,omitempty"`
+	ConditionID string           `json:"condition_id,omitempty"`
+	Fields      ValidationErrors `json:"fields,omitempty"`
+}
+
+// NewErrorDetail describes err for serialization. It returns nil for a nil
+// error.
+func NewErrorDetail(err error) *ErrorDetail {
+	if err == nil {
+		return nil
 	}
-	return m.status
+
+	detail := &ErrorDetail{Code: ErrorCodeOf(err), Message: err.Error()}
+
+	var evalErr *EvaluationError
+	if errors.As(err, &evalErr) {
+		detail.FlagID = evalErr.FlagID
+		detail.RuleID = evalErr.RuleID
+		detail.ConditionID = evalErr.ConditionID
+		detail.Message = evalErr.errorMessage()
+	}
+
+	var validationErrs ValidationErrors
+	if errors.As(err, &validationErrs) {
+		detail.Fields = validationErrs
+	}
+
+	return detail
 }
 
-func newRulesEngineError(err string, status int) error {
-	return RulesEngineError{err: err, status: status}
+// Err rebuilds the error the detail describes. Errors matching one of the
+// package's Error* variables compare equal to it again, so errors.Is works
+// on decoded results.
+func (d *ErrorDetail) Err() error {
+	if d == nil {
+		return nil
+	}
+
+	var err error
+	if len(d.Fields) > 0 {
+		err = d.Fields
+	} else {
+		code := d.Code
+		if code == "" {
+			code = ErrorCodeUnexpected
+		}
+		err = RulesEngineError{code: code, err: d.Message}
+	}
+
+	if d.FlagID == "" && d.RuleID == "" && d.ConditionID == "" {
+		return err
+	}
+	return &EvaluationError{FlagID: d.FlagID, RuleID: d.RuleID, ConditionID: d.ConditionID, Err: err}
+}
+
+// checkFlagResultJSON is CheckFlagResult without its JSON methods.
+type checkFlagResultJSON CheckFlagResult
+
+// MarshalJSON encodes Err as an ErrorDetail.
+func (r CheckFlagResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		*checkFlagResultJSON
+		Err *ErrorDetail `json:"err,omitempty"`
+	}{
+		checkFlagResultJSON: (*checkFlagResultJSON)(&r),
+		Err:                 NewErrorDetail(r.Err),
+	})
 }
 
-var ErrorUnexpected = newRulesEngineError("unexpected error", http.StatusInternalServerError)
-var ErrorFlagNotFound = newRulesEngineError("flag not found", http.StatusNotFound)
-var ErrorNegativePreflightUsage = newRulesEngineError("preflight usage cannot be negative", http.StatusBadRequest)
-var ErrorNegativePreflightCreditCost = newRulesEngineError("preflight credit cost cannot be negative", http.StatusBadRequest)
+// UnmarshalJSON decodes Err from an ErrorDetail.
+func (r *CheckFlagResult) UnmarshalJSON(data []byte) error {
+	decoded := struct {
+		*checkFlagResultJSON
+		Err *ErrorDetail `json:"err,omitempty"`
+	}{checkFlagResultJSON: (*checkFlagResultJSON)(r)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	r.Err = decoded.Err.Err()
+	return nil
+}
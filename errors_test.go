@@ -0,0 +1,176 @@
+package rulesengine_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// missingMetricValueFlag returns a flag whose only rule has a metric
+// condition without a value, along with the rule and condition.
+func missingMetricValueFlag() (*rulesengine.Flag, *rulesengine.Rule, *rulesengine.Condition) {
+	flag := createTestFlag()
+	rule := createTestRule()
+	condition := createTestCondition(rulesengine.ConditionTypeMetric)
+	condition.MetricValue = nil
+	rule.Conditions = []*rulesengine.Condition{condition}
+	flag.Rules = []*rulesengine.Rule{rule}
+	return flag, rule, condition
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Errors carry codes and statuses", func(t *testing.T) {
+		for _, test := range []struct {
+			err    error
+			code   rulesengine.ErrorCode
+			status int
+		}{
+			{rulesengine.ErrorFlagNotFound, rulesengine.ErrorCodeFlagNotFound, http.StatusNotFound},
+			{rulesengine.ErrorNegativePreflightUsage, rulesengine.ErrorCodeInvalidPreflight, http.StatusBadRequest},
+			{rulesengine.ErrorMissingMetricValue, rulesengine.ErrorCodeMissingMetricValue, http.StatusUnprocessableEntity},
+			{rulesengine.ErrorEvaluationCanceled, rulesengine.ErrorCodeCanceled, http.StatusRequestTimeout},
+			{rulesengine.ErrorEvaluationBudgetExceeded, rulesengine.ErrorCodeBudgetExceeded, http.StatusUnprocessableEntity},
+			{rulesengine.ValidationErrors{}, rulesengine.ErrorCodeInvalidInput, http.StatusBadRequest},
+			{errors.New("boom"), rulesengine.ErrorCodeUnexpected, http.StatusInternalServerError},
+		} {
+			assert.Equal(t, test.code, rulesengine.ErrorCodeOf(test.err), test.err.Error())
+			assert.Equal(t, test.status, test.code.StatusCode(), test.err.Error())
+		}
+		assert.Empty(t, rulesengine.ErrorCodeOf(nil))
+	})
+
+	t.Run("Configuration errors are told apart from bad input", func(t *testing.T) {
+		assert.True(t, rulesengine.ErrorCodeMissingMetricValue.IsConfigurationError())
+		assert.True(t, rulesengine.ErrorCodeInvalidCondition.IsConfigurationError())
+		assert.False(t, rulesengine.ErrorCodeInvalidPreflight.IsConfigurationError())
+		assert.False(t, rulesengine.ErrorCodeFlagNotFound.IsConfigurationError())
+		assert.False(t, rulesengine.ErrorCodeBudgetExceeded.IsConfigurationError())
+	})
+
+	t.Run("Limit errors are told apart from evaluation failures", func(t *testing.T) {
+		assert.True(t, rulesengine.ErrorCodeCanceled.IsLimitError())
+		assert.True(t, rulesengine.ErrorCodeBudgetExceeded.IsLimitError())
+		assert.False(t, rulesengine.ErrorCodeInvalidCondition.IsLimitError())
+		assert.False(t, rulesengine.ErrorCodeUnexpected.IsLimitError())
+	})
+
+	t.Run("Evaluation errors record where they happened", func(t *testing.T) {
+		flag, rule, condition := missingMetricValueFlag()
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag)
+
+		require.Error(t, err)
+		assert.Same(t, err, result.Err)
+		assert.ErrorIs(t, err, rulesengine.ErrorMissingMetricValue)
+		assert.Equal(t, rulesengine.ErrorCodeMissingMetricValue, rulesengine.ErrorCodeOf(err))
+
+		var evalErr *rulesengine.EvaluationError
+		require.ErrorAs(t, err, &evalErr)
+		assert.Equal(t, flag.ID, evalErr.FlagID)
+		assert.Equal(t, rule.ID, evalErr.RuleID)
+		assert.Equal(t, condition.ID, evalErr.ConditionID)
+		assert.Equal(t, "flag "+flag.ID+": rule "+rule.ID+": condition "+condition.ID+": metric condition has no metric value", err.Error())
+
+		var coded rulesengine.RulesEngineError
+		require.ErrorAs(t, err, &coded)
+		assert.Equal(t, http.StatusUnprocessableEntity, coded.StatusCode())
+	})
+
+	t.Run("Errors in condition groups record the condition", func(t *testing.T) {
+		flag, rule, condition := missingMetricValueFlag()
+		rule.Conditions = nil
+		rule.ConditionGroups = []*rulesengine.ConditionGroup{{Conditions: []*rulesengine.Condition{condition}}}
+
+		_, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag)
+
+		var evalErr *rulesengine.EvaluationError
+		require.ErrorAs(t, err, &evalErr)
+		assert.Equal(t, condition.ID, evalErr.ConditionID)
+	})
+
+	t.Run("Errors without a code are reported as-is", func(t *testing.T) {
+		err := &rulesengine.EvaluationError{FlagID: "flag_1", Err: errors.New("boom")}
+
+		assert.Equal(t, rulesengine.ErrorCodeUnexpected, rulesengine.ErrorCodeOf(err))
+		assert.Equal(t, "flag flag_1: boom", err.Error())
+	})
+}
+
+func TestCheckFlagResultJSON(t *testing.T) {
+	ctx := context.Background()
+
+	roundTrip := func(t *testing.T, result *rulesengine.CheckFlagResult) (string, *rulesengine.CheckFlagResult) {
+		t.Helper()
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+
+		var decoded rulesengine.CheckFlagResult
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		return string(data), &decoded
+	}
+
+	t.Run("Results without errors omit err", func(t *testing.T) {
+		data, decoded := roundTrip(t, &rulesengine.CheckFlagResult{FlagKey: "feature", Value: true})
+
+		assert.NotContains(t, data, `"err"`)
+		assert.NoError(t, decoded.Err)
+		assert.True(t, decoded.Value)
+	})
+
+	t.Run("Errors serialize with their code", func(t *testing.T) {
+		result, _ := rulesengine.CheckFlag(ctx, nil, nil, nil)
+
+		data, decoded := roundTrip(t, result)
+
+		assert.Contains(t, data, `"err":{"code":"flag_not_found","message":"flag not found"}`)
+		assert.ErrorIs(t, decoded.Err, rulesengine.ErrorFlagNotFound)
+		assert.Equal(t, result.Reason, decoded.Reason)
+	})
+
+	t.Run("Evaluation errors keep their location", func(t *testing.T) {
+		flag, rule, condition := missingMetricValueFlag()
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag)
+		require.Error(t, err)
+
+		data, decoded := roundTrip(t, result)
+
+		assert.Contains(t, data, `"code":"missing_metric_value"`)
+		assert.Contains(t, data, `"condition_id":"`+condition.ID+`"`)
+		assert.ErrorIs(t, decoded.Err, rulesengine.ErrorMissingMetricValue)
+		assert.Equal(t, err.Error(), decoded.Err.Error())
+
+		var evalErr *rulesengine.EvaluationError
+		require.ErrorAs(t, decoded.Err, &evalErr)
+		assert.Equal(t, rule.ID, evalErr.RuleID)
+	})
+
+	t.Run("Validation errors keep their fields", func(t *testing.T) {
+		flag := createTestFlag()
+		rule := createTestRule()
+		rule.RuleType = "bogus"
+		flag.Rules = []*rulesengine.Rule{rule}
+		result, err := rulesengine.CheckFlag(ctx, nil, nil, flag, rulesengine.WithValidation())
+		require.Error(t, err)
+
+		_, decoded := roundTrip(t, result)
+
+		var errs rulesengine.ValidationErrors
+		require.ErrorAs(t, decoded.Err, &errs)
+		assert.Equal(t, err, errs)
+	})
+
+	t.Run("Other errors decode as unexpected", func(t *testing.T) {
+		_, decoded := roundTrip(t, &rulesengine.CheckFlagResult{Err: errors.New("kill switch engaged")})
+
+		assert.EqualError(t, decoded.Err, "kill switch engaged")
+		assert.Equal(t, rulesengine.ErrorCodeUnexpected, rulesengine.ErrorCodeOf(decoded.Err))
+	})
+}
@@ -0,0 +1,377 @@
+package rulesengine
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvaluationEvent records that a flag was evaluated for a company and/or
+// user, and what the outcome was. These are the impressions used for
+// experiment analysis and stale-flag detection.
+type EvaluationEvent struct {
+	CompanyID *string   `json:"company_id,omitempty"`
+	FlagID    string    `json:"flag_id"`
+	FlagKey   string    `json:"flag_key"`
+	RuleID    *string   `json:"rule_id,omitempty"`
+	RuleType  *RuleType `json:"rule_type,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	UserID    *string   `json:"user_id,omitempty"`
+	Value     bool      `json:"value"`
+}
+
+// NewEvaluationEvent builds an event from a CheckFlag result. It returns nil
+// for results that don't describe an evaluated flag (e.g. flag not found).
+func NewEvaluationEvent(result *CheckFlagResult, timestamp time.Time) *EvaluationEvent {
+	if result == nil || result.FlagID == nil {
+		return nil
+	}
+
+	return &EvaluationEvent{
+		CompanyID: result.CompanyID,
+		FlagID:    *result.FlagID,
+		FlagKey:   result.FlagKey,
+		RuleID:    result.RuleID,
+		RuleType:  result.RuleType,
+		Timestamp: timestamp,
+		UserID:    result.UserID,
+		Value:     result.Value,
+	}
+}
+
+// dedupeKey identifies events that are considered the same impression.
+type dedupeKey struct {
+	companyID string
+	flagID    string
+	ruleID    string
+	userID    string
+	value     bool
+}
+
+func (e *EvaluationEvent) dedupeKey() dedupeKey {
+	key := dedupeKey{flagID: e.FlagID, value: e.Value}
+	if e.CompanyID != nil {
+		key.companyID = *e.CompanyID
+	}
+	if e.RuleID != nil {
+		key.ruleID = *e.RuleID
+	}
+	if e.UserID != nil {
+		key.userID = *e.UserID
+	}
+	return key
+}
+
+// dedupeShards is the number of independently locked parts of a dedupeSet,
+// so that concurrent evaluations rarely wait on each other.
+const dedupeShards = 64
+
+// dedupeSet remembers when each impression was last emitted. Entries are kept
+// in two generations per shard: once a window has passed since the last
+// rotation, the current generation becomes the previous one and the old
+// previous generation is dropped wholesale. Anything emitted within the
+// window is therefore still in one of the two generations, and forgetting
+// expired entries never requires walking them.
+type dedupeSet struct {
+	window time.Duration
+	seed   maphash.Seed
+	shards [dedupeShards]dedupeShard
+}
+
+type dedupeShard struct {
+	mu        sync.Mutex
+	rotatedAt time.Time
+	current   map[dedupeKey]time.Time
+	previous  map[dedupeKey]time.Time
+}
+
+func newDedupeSet(window time.Duration) *dedupeSet {
+	return &dedupeSet{window: window, seed: maphash.MakeSeed()}
+}
+
+func (d *dedupeSet) shard(key dedupeKey) *dedupeShard {
+	return &d.shards[maphash.Comparable(d.seed, key)%dedupeShards]
+}
+
+// claim records key as emitted at ts. It returns false, recording nothing, if
+// key was already emitted within the window before ts.
+func (d *dedupeSet) claim(key dedupeKey, ts time.Time) bool {
+	shard := d.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.rotate(ts, d.window)
+	if last, ok := shard.current[key]; ok && ts.Sub(last) < d.window {
+		return false
+	}
+	if last, ok := shard.previous[key]; ok && ts.Sub(last) < d.window {
+		return false
+	}
+
+	if shard.current == nil {
+		shard.current = make(map[dedupeKey]time.Time)
+	}
+	shard.current[key] = ts
+	return true
+}
+
+// release undoes a claim of key at ts, for events that were claimed but could
+// not be queued.
+func (d *dedupeSet) release(key dedupeKey, ts time.Time) {
+	shard := d.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if last, ok := shard.current[key]; ok && last.Equal(ts) {
+		delete(shard.current, key)
+	}
+}
+
+// expire rotates every shard whose window has elapsed, so entries for
+// companies that are no longer evaluated don't accumulate.
+func (d *dedupeSet) expire(now time.Time) {
+	for i := range d.shards {
+		shard := &d.shards[i]
+		shard.mu.Lock()
+		shard.rotate(now, d.window)
+		shard.mu.Unlock()
+	}
+}
+
+func (s *dedupeShard) rotate(now time.Time, window time.Duration) {
+	elapsed := now.Sub(s.rotatedAt)
+	if elapsed < window {
+		return
+	}
+
+	if elapsed >= 2*window {
+		s.previous = nil
+	} else {
+		s.previous = s.current
+	}
+	s.current = nil
+	s.rotatedAt = now
+}
+
+// EventSink receives batches of evaluation events from an EventEmitter. Send
+// is only ever called from the emitter's background goroutine, one batch at a
+// time; its context is canceled once the context passed to Close is done.
+type EventSink interface {
+	Send(ctx context.Context, events []*EvaluationEvent) error
+}
+
+// EventSinkFunc adapts a function to the EventSink interface.
+type EventSinkFunc func(ctx context.Context, events []*EvaluationEvent) error
+
+func (f EventSinkFunc) Send(ctx context.Context, events []*EvaluationEvent) error {
+	return f(ctx, events)
+}
+
+// EventEmitterConfig tunes an EventEmitter. Zero values fall back to the
+// defaults below.
+type EventEmitterConfig struct {
+	// BufferSize is the number of events that can be queued for the
+	// background goroutine. When the buffer is full, new events are dropped
+	// rather than blocking the caller.
+	BufferSize int
+
+	// BatchSize is the maximum number of events delivered to the sink in a
+	// single Send.
+	BatchSize int
+
+	// FlushInterval is the longest an event will wait in a partial batch
+	// before being delivered.
+	FlushInterval time.Duration
+
+	// DedupeWindow suppresses repeat events with the same flag, company,
+	// user, rule and value within the window. Zero uses the default;
+	// a negative window disables deduplication.
+	DedupeWindow time.Duration
+
+	// OnError is called with errors returned by the sink. The batch that
+	// failed is discarded.
+	OnError func(err error)
+
+	// Now returns the current time; used for event timestamps and the dedupe
+	// window. Defaults to time.Now.
+	Now func() time.Time
+}
+
+const (
+	defaultEventBufferSize    = 10000
+	defaultEventBatchSize     = 100
+	defaultEventFlushInterval = 5 * time.Second
+	defaultEventDedupeWindow  = time.Minute
+)
+
+// EventEmitter produces EvaluationEvents from CheckFlag results and delivers
+// them to an EventSink in batches from a background goroutine. It implements
+// EvaluationHook, so it can be attached to evaluations with WithHooks:
+//
+//	emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{})
+//	defer emitter.Close(ctx)
+//	engine := rulesengine.NewEngine(rulesengine.WithHooks(emitter))
+//
+// Emitting never blocks: events that arrive while the buffer is full are
+// dropped and counted in Dropped.
+type EventEmitter struct {
+	NoopHook
+
+	sink   EventSink
+	config EventEmitterConfig
+	events chan *EvaluationEvent
+	done   chan struct{}
+	dedupe *dedupeSet
+
+	// sendCtx is passed to the sink and canceled by Close when its context
+	// is done, so that a slow sink can't outlive Close.
+	sendCtx     context.Context
+	cancelSends context.CancelFunc
+
+	// mu guards closing the events channel; Emit only takes it for reading.
+	mu        sync.RWMutex
+	closed    bool
+	dropped   atomic.Uint64
+	closeOnce sync.Once
+}
+
+// NewEventEmitter starts an EventEmitter delivering to sink. Callers must
+// call Close to flush pending events and stop the background goroutine.
+func NewEventEmitter(sink EventSink, config EventEmitterConfig) *EventEmitter {
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultEventBufferSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultEventBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultEventFlushInterval
+	}
+	if config.DedupeWindow == 0 {
+		config.DedupeWindow = defaultEventDedupeWindow
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	e := &EventEmitter{
+		sink:   sink,
+		config: config,
+		events: make(chan *EvaluationEvent, config.BufferSize),
+		done:   make(chan struct{}),
+	}
+	if config.DedupeWindow > 0 {
+		e.dedupe = newDedupeSet(config.DedupeWindow)
+	}
+	e.sendCtx, e.cancelSends = context.WithCancel(context.Background())
+	go e.run()
+
+	return e
+}
+
+// AfterEvaluation emits an event for every evaluated flag.
+func (e *EventEmitter) AfterEvaluation(ctx context.Context, eval *HookEvaluation, result *CheckFlagResult) {
+	e.Emit(NewEvaluationEvent(result, e.config.Now()))
+}
+
+// Emit queues an event for delivery. It returns false if the event was not
+// queued because it was a duplicate within the dedupe window, the buffer was
+// full, or the emitter is closed.
+func (e *EventEmitter) Emit(event *EvaluationEvent) bool {
+	if event == nil {
+		return false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.closed {
+		return false
+	}
+
+	var key dedupeKey
+	if e.dedupe != nil {
+		key = event.dedupeKey()
+		if !e.dedupe.claim(key, event.Timestamp) {
+			return false
+		}
+	}
+
+	select {
+	case e.events <- event:
+		return true
+	default:
+		e.dropped.Add(1)
+		if e.dedupe != nil {
+			e.dedupe.release(key, event.Timestamp)
+		}
+		return false
+	}
+}
+
+// Dropped returns the number of events discarded because the buffer was full.
+func (e *EventEmitter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Close stops accepting events, delivers everything still buffered and waits
+// for the background goroutine to exit or ctx to be done. When ctx is done
+// first, the context of the sink's in-flight and remaining sends is canceled.
+func (e *EventEmitter) Close(ctx context.Context) error {
+	e.closeOnce.Do(func() {
+		e.mu.Lock()
+		e.closed = true
+		close(e.events)
+		e.mu.Unlock()
+	})
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		e.cancelSends()
+		return ctx.Err()
+	}
+}
+
+func (e *EventEmitter) run() {
+	defer close(e.done)
+	defer e.cancelSends()
+
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*EvaluationEvent, 0, e.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := e.sink.Send(e.sendCtx, batch); err != nil && e.config.OnError != nil {
+			e.config.OnError(err)
+		}
+		batch = make([]*EvaluationEvent, 0, e.config.BatchSize)
+	}
+
+	for {
+		select {
+		case event, ok := <-e.events:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, event)
+			if len(batch) >= e.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			if e.dedupe != nil {
+				e.dedupe.expire(e.config.Now())
+			}
+		}
+	}
+}
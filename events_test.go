@@ -0,0 +1,295 @@
+package rulesengine_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]*rulesengine.EvaluationEvent
+	entered chan struct{}
+	block   chan struct{}
+	err     error
+}
+
+func (s *memorySink) Send(ctx context.Context, events []*rulesengine.EvaluationEvent) error {
+	if s.entered != nil {
+		s.entered <- struct{}{}
+	}
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, events)
+	return s.err
+}
+
+func (s *memorySink) events() []*rulesengine.EvaluationEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*rulesengine.EvaluationEvent
+	for _, batch := range s.batches {
+		events = append(events, batch...)
+	}
+	return events
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestEventEmitter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Emits an event per evaluation through hooks", func(t *testing.T) {
+		sink := &memorySink{}
+		clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{Now: clock.Now})
+
+		company := createTestCompany()
+		user := createTestUser()
+		flag := createTestFlag()
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+		condition.ResourceIDs = []string{company.ID}
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		engine := rulesengine.NewEngine(rulesengine.WithHooks(emitter))
+		_, err := engine.CheckFlag(ctx, company, user, flag)
+		require.NoError(t, err)
+		require.NoError(t, emitter.Close(ctx))
+
+		events := sink.events()
+		require.Len(t, events, 1)
+		assert.Equal(t, &rulesengine.EvaluationEvent{
+			CompanyID: &company.ID,
+			FlagID:    flag.ID,
+			FlagKey:   flag.Key,
+			RuleID:    &rule.ID,
+			RuleType:  &rule.RuleType,
+			Timestamp: clock.Now(),
+			UserID:    &user.ID,
+			Value:     true,
+		}, events[0])
+	})
+
+	t.Run("Does not emit for missing flags", func(t *testing.T) {
+		sink := &memorySink{}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{})
+
+		_, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, nil, rulesengine.WithHooks(emitter))
+		require.NoError(t, err)
+		require.NoError(t, emitter.Close(ctx))
+
+		assert.Empty(t, sink.events())
+	})
+
+	t.Run("Deduplicates repeat impressions within the window", func(t *testing.T) {
+		sink := &memorySink{}
+		clock := &fakeClock{now: time.Now()}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{
+			DedupeWindow: time.Minute,
+			Now:          clock.Now,
+		})
+
+		company := createTestCompany()
+		other := createTestCompany()
+		flag := createTestFlag()
+		engine := rulesengine.NewEngine(rulesengine.WithHooks(emitter))
+
+		for i := 0; i < 10; i++ {
+			_, err := engine.CheckFlag(ctx, company, nil, flag)
+			require.NoError(t, err)
+		}
+		_, err := engine.CheckFlag(ctx, other, nil, flag)
+		require.NoError(t, err)
+
+		clock.Advance(time.Minute)
+		_, err = engine.CheckFlag(ctx, company, nil, flag)
+		require.NoError(t, err)
+
+		require.NoError(t, emitter.Close(ctx))
+
+		events := sink.events()
+		require.Len(t, events, 3)
+		assert.Equal(t, &company.ID, events[0].CompanyID)
+		assert.Equal(t, &other.ID, events[1].CompanyID)
+		assert.Equal(t, &company.ID, events[2].CompanyID)
+	})
+
+	t.Run("Deduplicates across rotations of the dedupe window", func(t *testing.T) {
+		sink := &memorySink{}
+		start := time.Now()
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{DedupeWindow: time.Minute})
+
+		emit := func(after time.Duration) bool {
+			return emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag", Timestamp: start.Add(after)})
+		}
+
+		assert.True(t, emit(0))
+		assert.True(t, emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "other", Timestamp: start.Add(50 * time.Second)}))
+		assert.False(t, emit(59*time.Second))
+		assert.True(t, emit(time.Minute))
+		assert.False(t, emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "other", Timestamp: start.Add(100 * time.Second)}))
+		assert.False(t, emit(119*time.Second))
+		assert.True(t, emit(10*time.Minute))
+		require.NoError(t, emitter.Close(ctx))
+
+		assert.Len(t, sink.events(), 4)
+	})
+
+	t.Run("Concurrent repeats are emitted once", func(t *testing.T) {
+		sink := &memorySink{}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{})
+		timestamp := time.Now()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag", Timestamp: timestamp})
+			}()
+		}
+		wg.Wait()
+		require.NoError(t, emitter.Close(ctx))
+
+		assert.Len(t, sink.events(), 1)
+	})
+
+	t.Run("Negative dedupe window disables deduplication", func(t *testing.T) {
+		sink := &memorySink{}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{DedupeWindow: -1})
+
+		company := createTestCompany()
+		flag := createTestFlag()
+		for i := 0; i < 5; i++ {
+			_, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(emitter))
+			require.NoError(t, err)
+		}
+		require.NoError(t, emitter.Close(ctx))
+
+		assert.Len(t, sink.events(), 5)
+	})
+
+	t.Run("Delivers in batches of at most BatchSize", func(t *testing.T) {
+		sink := &memorySink{}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{BatchSize: 2, DedupeWindow: -1})
+
+		for i := 0; i < 5; i++ {
+			assert.True(t, emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"}))
+		}
+		require.NoError(t, emitter.Close(ctx))
+
+		require.Len(t, sink.batches, 3)
+		assert.Len(t, sink.batches[0], 2)
+		assert.Len(t, sink.batches[1], 2)
+		assert.Len(t, sink.batches[2], 1)
+	})
+
+	t.Run("Flushes partial batches on the interval", func(t *testing.T) {
+		sink := &memorySink{}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{FlushInterval: 10 * time.Millisecond})
+		defer emitter.Close(ctx)
+
+		emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"})
+
+		assert.Eventually(t, func() bool {
+			return len(sink.events()) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("Drops events instead of blocking when the buffer is full", func(t *testing.T) {
+		sink := &memorySink{entered: make(chan struct{}, 2), block: make(chan struct{})}
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{BufferSize: 1, BatchSize: 1, DedupeWindow: -1})
+
+		// The first event is picked up by the background goroutine and blocks
+		// in the sink; the second fills the buffer.
+		require.True(t, emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"}))
+		<-sink.entered
+		require.True(t, emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"}))
+
+		assert.False(t, emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"}))
+		assert.Equal(t, uint64(1), emitter.Dropped())
+
+		close(sink.block)
+		require.NoError(t, emitter.Close(ctx))
+		assert.Len(t, sink.events(), 2)
+	})
+
+	t.Run("Reports sink errors", func(t *testing.T) {
+		sinkErr := errors.New("sink unavailable")
+		sink := &memorySink{err: sinkErr}
+
+		var mu sync.Mutex
+		var reported []error
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{
+			OnError: func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				reported = append(reported, err)
+			},
+		})
+
+		emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"})
+		require.NoError(t, emitter.Close(ctx))
+
+		assert.Equal(t, []error{sinkErr}, reported)
+	})
+
+	t.Run("Close cancels an in-flight send when its context is done", func(t *testing.T) {
+		sent := make(chan error, 1)
+		sink := rulesengine.EventSinkFunc(func(ctx context.Context, events []*rulesengine.EvaluationEvent) error {
+			<-ctx.Done()
+			sent <- ctx.Err()
+			return ctx.Err()
+		})
+		emitter := rulesengine.NewEventEmitter(sink, rulesengine.EventEmitterConfig{})
+		emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"})
+
+		closeCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, emitter.Close(closeCtx), context.DeadlineExceeded)
+		select {
+		case err := <-sent:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(time.Second):
+			t.Fatal("the send was not canceled")
+		}
+		require.NoError(t, emitter.Close(ctx))
+	})
+
+	t.Run("Rejects events after Close", func(t *testing.T) {
+		emitter := rulesengine.NewEventEmitter(&memorySink{}, rulesengine.EventEmitterConfig{})
+		require.NoError(t, emitter.Close(ctx))
+		require.NoError(t, emitter.Close(ctx))
+
+		assert.False(t, emitter.Emit(&rulesengine.EvaluationEvent{FlagID: "flag"}))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/schematichq/rulesengine/typeconvert"
@@ -23,6 +24,7 @@ type CheckFlagResult struct {
 	Reason              string              `json:"reason"`
 	RuleID              *string             `json:"rule_id,omitempty"`
 	RuleType            *RuleType           `json:"rule_type,omitempty" binding:"oneof=default global_override company_override company_override_usage_exceeded plan_entitlement plan_entitlement_usage_exceeded standard"`
+	SkippedErrors       []*ErrorDetail      `json:"skipped_errors,omitempty"`
 	UserID              *string             `json:"user_id,omitempty"`
 	Value               bool                `json:"value"`
 }
@@ -31,13 +33,17 @@ const (
 	ReasonNoCompanyOrUser     = "No company or user context; default value for flag"
 	ReasonCompanyNotFound     = "Company not found"
 	ReasonCompanyNotSpecified = "Must specify a company"
+	ReasonEvaluationAborted   = "Evaluation aborted by hook; default value for flag"
 	ReasonFlagNotFound        = "Flag not found"
 	ReasonNoRulesMatched      = "No rules matched; default value for flag"
 	ReasonServerError         = "Server error; Schematic has been notified"
 	ReasonUserNotFound        = "User not found"
 )
 
-func (r *CheckFlagResult) setRuleFields(company *Company, rule *Rule) {
+// setRuleFields records the matched rule, and for entitlement rules the
+// company's usage and allocation. Traits and metrics are looked up through
+// resolvers, which memoized them when the rule's conditions were checked.
+func (r *CheckFlagResult) setRuleFields(ctx context.Context, company *Company, rule *Rule, now time.Time, resolvers *resolverCache) {
 	if rule == nil {
 		return
 	}
@@ -69,7 +75,7 @@ func (r *CheckFlagResult) setRuleFields(company *Company, rule *Rule) {
 	case ConditionTypeMetric:
 		if usageCondition.EventSubtype != nil {
 			r.FeatureUsageEvent = usageCondition.EventSubtype
-			usageMetric := company.Metrics.Find(*usageCondition.EventSubtype, usageCondition.MetricPeriod, usageCondition.MetricPeriodMonthReset)
+			usageMetric, _ := resolvers.companyMetric(ctx, company, *usageCondition.EventSubtype, usageCondition.MetricPeriod, usageCondition.MetricPeriodMonthReset)
 			if usageMetric != nil {
 				usage = usageMetric.Value
 			}
@@ -84,10 +90,10 @@ func (r *CheckFlagResult) setRuleFields(company *Company, rule *Rule) {
 			metricPeriod = *usageCondition.MetricPeriod
 		}
 		r.FeatureUsagePeriod = &metricPeriod
-		r.FeatureUsageResetAt = GetNextMetricPeriodStartFromCondition(usageCondition, company)
+		r.FeatureUsageResetAt = nextMetricPeriodStartFromCondition(usageCondition, company, now)
 	case ConditionTypeTrait:
 		if usageCondition.TraitDefinition != nil {
-			companyUsageTrait := company.getTraitByDefinitionID(usageCondition.TraitDefinition.ID)
+			companyUsageTrait, _ := resolvers.trait(ctx, EntityTypeCompany, company.ID, company.FindTrait, usageCondition.TraitDefinition)
 			if companyUsageTrait != nil {
 				usage = typeconvert.StringToInt64(companyUsageTrait.Value)
 			}
@@ -98,7 +104,7 @@ func (r *CheckFlagResult) setRuleFields(company *Company, rule *Rule) {
 
 	// if there is a comparison trait, this takes precedence for allocation over the numeric value
 	if usageCondition.ComparisonTraitDefinition != nil {
-		companyAllocationTrait := company.getTraitByDefinitionID(usageCondition.ComparisonTraitDefinition.ID)
+		companyAllocationTrait, _ := resolvers.trait(ctx, EntityTypeCompany, company.ID, company.FindTrait, usageCondition.ComparisonTraitDefinition)
 		if companyAllocationTrait != nil {
 			allocation = typeconvert.StringToInt64(companyAllocationTrait.Value)
 		}
@@ -120,13 +126,63 @@ func CheckFlag(
 		opt(options)
 	}
 
+	start := time.Now()
+	ctx, span := options.tracer.Start(ctx, SpanNameCheckFlag)
+	defer span.End()
+
+	// Evaluate snapshots so concurrent updates through the mutators can't
+	// change the company or user mid-check. Hooks get the same snapshots, so
+	// they observe exactly what was evaluated.
+	company, user = company.Snapshot(), user.Snapshot()
+
+	hooks := &hookRunner{
+		hooks: options.hooks,
+		eval:  &HookEvaluation{Company: company, User: user, Flag: flag},
+	}
+
+	resp, err := checkFlag(ctx, company, user, flag, options, hooks)
+
+	evalErr := err
+	if evalErr == nil {
+		evalErr = resp.Err
+	}
+	if evalErr != nil {
+		hooks.onError(ctx, evalErr)
+	}
+	hooks.afterEvaluation(ctx, resp)
+
+	recordEvaluation(ctx, span, options.meter, resp, evalErr, time.Since(start))
+
+	return resp, err
+}
+
+func checkFlag(
+	ctx context.Context,
+	company *Company,
+	user *User,
+	flag *Flag,
+	options *checkFlagOptions,
+	hooks *hookRunner,
+) (*CheckFlagResult, error) {
 	resp := &CheckFlagResult{Reason: ReasonNoRulesMatched}
 
+	// BeforeEvaluation runs before anything can end the evaluation, so every
+	// evaluation goes through each hook stage in order. An abort is reported
+	// once the result has been filled in, unless the evaluation fails first.
+	abortErr := hooks.beforeEvaluation(ctx)
+
 	if err := options.validate(); err != nil {
 		resp.Err = err
 		return resp, err
 	}
 
+	if options.validateInput {
+		if err := validateInputs(company, user, flag, options.conditions); err != nil {
+			resp.Err = err
+			return resp, err
+		}
+	}
+
 	if flag == nil {
 		resp.Reason = ReasonFlagNotFound
 		resp.Err = ErrorFlagNotFound
@@ -152,7 +208,19 @@ func CheckFlag(
 		resp.UserID = &user.ID
 	}
 
-	ruleChecker := NewRuleCheckService()
+	if abortErr != nil {
+		resp.Reason = ReasonEvaluationAborted
+		resp.Err = abortErr
+		return resp, nil
+	}
+
+	now := options.now()
+	if !flag.IsActiveAt(now) {
+		resp.Reason = fmt.Sprintf("Flag is inactive (%s); default value for flag", describeActiveWindow(flag.StartsAt, flag.EndsAt, now))
+		return resp, nil
+	}
+
+	ruleChecker := NewRuleCheckServiceWithConditions(options.conditions)
 	var companyRules, userRules []*Rule
 	if company != nil {
 		for _, rule := range company.Rules {
@@ -168,6 +236,9 @@ func CheckFlag(
 			}
 		}
 	}
+	budget := newEvaluationBudget(options.evaluationBudget)
+	resolvers := newResolverCache(options.traitResolver, options.metricResolver)
+	var inactiveRules, failedRules []string
 	for _, group := range GroupRulesByPriority(flag.Rules, companyRules, userRules) {
 		for _, rule := range group {
 			if rule == nil {
@@ -175,14 +246,33 @@ func CheckFlag(
 			}
 
 			checkRuleResp, err := ruleChecker.Check(ctx, &CheckScope{
-				Company:    company,
-				Rule:       rule,
-				User:       user,
-				creditCost: options.creditCost,
-				usage:      options.usage,
-				eventUsage: options.eventUsage,
+				Company:        company,
+				Rule:           rule,
+				User:           user,
+				EvaluationTime: now,
+				creditCost:     options.creditCost,
+				usage:          options.usage,
+				eventUsage:     options.eventUsage,
+				budget:         budget,
+				resolvers:      resolvers,
 			})
 			if err != nil {
+				err = withEvaluationIDs(err, flag.ID, rule.ID, "")
+				policy := options.errorPolicy
+				if ErrorCodeOf(err).IsLimitError() {
+					policy = ErrorPolicyAbort
+				}
+				switch policy {
+				case ErrorPolicySkipRule:
+					resp.SkippedErrors = append(resp.SkippedErrors, NewErrorDetail(err))
+					failedRules = append(failedRules, fmt.Sprintf("rule \"%s\" (%s)", rule.Name, rule.ID))
+					continue
+				case ErrorPolicyFixedValue:
+					resp.SkippedErrors = append(resp.SkippedErrors, NewErrorDetail(err))
+					resp.Value = options.errorValue
+					resp.Reason = withSkippedRules(fmt.Sprintf("Rule \"%s\" (%s) failed; error value for flag", rule.Name, rule.ID), inactiveRules, failedRules)
+					return resp, nil
+				}
 				resp.Err = err
 				return resp, err
 			}
@@ -192,23 +282,61 @@ func CheckFlag(
 				return resp, ErrorUnexpected
 			}
 
+			if checkRuleResp.Inactive {
+				inactiveRules = append(inactiveRules, fmt.Sprintf("rule \"%s\" (%s) %s", rule.Name, rule.ID, describeActiveWindow(rule.StartsAt, rule.EndsAt, now)))
+				continue
+			}
+
+			hooks.afterRule(ctx, rule, checkRuleResp.Match)
+
 			if checkRuleResp.Match {
 				resp.Value = rule.Value
-				resp.Reason = fmt.Sprintf("Matched %s rule \"%s\" (%s)", rule.RuleType.DisplayName(), rule.Name, rule.ID)
-				resp.setRuleFields(company, rule)
+				resp.Reason = withSkippedRules(fmt.Sprintf("Matched %s rule \"%s\" (%s)", rule.RuleType.DisplayName(), rule.Name, rule.ID), inactiveRules, failedRules)
+				resp.setRuleFields(ctx, company, rule, now, resolvers)
 				return resp, nil
 			}
 		}
 	}
 
+	resp.Reason = withSkippedRules(resp.Reason, inactiveRules, failedRules)
 	return resp, nil
 }
 
-// Given a list of rules, group by type, then sort each group as appropriate to the type
+// describeActiveWindow explains why now is outside an activation window.
+func describeActiveWindow(startsAt, endsAt *time.Time, now time.Time) string {
+	if startsAt != nil && now.Before(*startsAt) {
+		return "starts at " + startsAt.UTC().Format(time.RFC3339)
+	}
+	if endsAt != nil {
+		return "ended at " + endsAt.UTC().Format(time.RFC3339)
+	}
+	return "active"
+}
+
+// withSkippedRules notes the rules skipped as inactive, or because they
+// failed to evaluate, on a reason.
+func withSkippedRules(reason string, inactiveRules, failedRules []string) string {
+	if len(inactiveRules) > 0 {
+		reason = fmt.Sprintf("%s; skipped inactive %s", reason, strings.Join(inactiveRules, ", "))
+	}
+	if len(failedRules) > 0 {
+		reason = fmt.Sprintf("%s; skipped failed %s", reason, strings.Join(failedRules, ", "))
+	}
+	return reason
+}
+
+// Given a list of rules, group by type, then sort each group as appropriate to the type.
+// Nil rules are skipped. Sorting is stable, so rules that tie keep the order they were
+// given in: standard rules sort by ascending priority, and the optimistically prioritized
+// types only move rules with a true value ahead of those with a false one.
 func GroupRulesByPriority(ruleSlices ...[]*Rule) [][]*Rule {
 	allRules := []*Rule{}
 	for _, rules := range ruleSlices {
-		allRules = append(allRules, rules...)
+		for _, rule := range rules {
+			if rule != nil {
+				allRules = append(allRules, rule)
+			}
+		}
 	}
 
 	// Group rules by their type
@@ -220,14 +348,14 @@ func GroupRulesByPriority(ruleSlices ...[]*Rule) [][]*Rule {
 	for ruleType, rules := range grouped {
 		switch ruleType.PrioritizationMethod() {
 		case RulePrioritizationMethodPriority:
-			sort.Slice(rules, func(i, j int) bool {
+			sort.SliceStable(rules, func(i, j int) bool {
 				// Sort by ascending priority int
 				return rules[i].Priority < rules[j].Priority
 			})
 		case RulePrioritizationMethodOptimistic:
-			sort.Slice(rules, func(i, j int) bool {
+			sort.SliceStable(rules, func(i, j int) bool {
 				// Don't really care about order, just move all rules with true value to the front
-				return rules[i].Value
+				return rules[i].Value && !rules[j].Value
 			})
 		}
 	}
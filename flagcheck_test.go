@@ -2,12 +2,16 @@ package rulesengine_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/schematichq/rulesengine"
 	"github.com/schematichq/rulesengine/null"
 	"github.com/schematichq/rulesengine/typeconvert"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCheckFlag(t *testing.T) {
@@ -182,6 +186,39 @@ func TestCheckFlag(t *testing.T) {
 			assert.Equal(t, eventSubtype, *result.FeatureUsageEvent)
 		})
 
+		t.Run("Computes reset time as of the evaluation time", func(t *testing.T) {
+			company := createTestCompany()
+			flag := createTestFlag()
+
+			rule := createTestRule()
+			rule.RuleType = rulesengine.RuleTypePlanEntitlement
+			rule.Value = true
+
+			condition := createTestCondition(rulesengine.ConditionTypeMetric)
+			period := rulesengine.MetricPeriodCurrentMonth
+			condition.MetricPeriod = &period
+			metricValue := int64(10)
+			condition.MetricValue = &metricValue
+			condition.Operator = typeconvert.ComparableOperatorLte
+
+			rule.Conditions = append(rule.Conditions, condition)
+			flag.Rules = append(flag.Rules, rule)
+
+			asOf := time.Date(2024, time.February, 10, 12, 0, 0, 0, time.UTC)
+			result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationTime(asOf))
+
+			assert.NoError(t, err)
+			assert.True(t, result.Value)
+			require.NotNil(t, result.FeatureUsageResetAt)
+			assert.Equal(t, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), *result.FeatureUsageResetAt)
+
+			result, err = rulesengine.CheckFlag(ctx, company, nil, flag)
+
+			assert.NoError(t, err)
+			require.NotNil(t, result.FeatureUsageResetAt)
+			assert.Equal(t, rulesengine.GetNextMetricPeriodStartFromCondition(condition, company), result.FeatureUsageResetAt)
+		})
+
 		t.Run("Sets usage and allocation for trait condition", func(t *testing.T) {
 			company := createTestCompany()
 			flag := createTestFlag()
@@ -879,6 +916,373 @@ func TestCheckFlag(t *testing.T) {
 		})
 	})
 
+	t.Run("Activation windows", func(t *testing.T) {
+		launch := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+		end := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+		// promoFlag returns a flag whose override rule is active from launch
+		// until end, with a standard rule beneath it.
+		promoFlag := func() (*rulesengine.Flag, *rulesengine.Rule, *rulesengine.Rule) {
+			flag := createTestFlag()
+			flag.DefaultValue = false
+
+			promo := createTestRule()
+			promo.Name = "Spring promo"
+			promo.RuleType = rulesengine.RuleTypeGlobalOverride
+			promo.StartsAt = &launch
+			promo.EndsAt = &end
+
+			standard := createTestRule()
+			standard.Name = "Beta"
+			standard.Value = false
+
+			flag.Rules = []*rulesengine.Rule{promo, standard}
+			return flag, promo, standard
+		}
+
+		t.Run("Rules match only within their window", func(t *testing.T) {
+			company := createTestCompany()
+			flag, promo, standard := promoFlag()
+
+			result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationTime(launch))
+			require.NoError(t, err)
+			assert.True(t, result.Value)
+			assert.Equal(t, &promo.ID, result.RuleID)
+
+			result, err = rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationTime(end.Add(-time.Nanosecond)))
+			require.NoError(t, err)
+			assert.Equal(t, &promo.ID, result.RuleID)
+
+			result, err = rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationTime(launch.Add(-time.Second)))
+			require.NoError(t, err)
+			assert.False(t, result.Value)
+			assert.Equal(t, &standard.ID, result.RuleID)
+			assert.Equal(t, fmt.Sprintf(`Matched standard rule "Beta" (%s); skipped inactive rule "Spring promo" (%s) starts at 2024-03-01T00:00:00Z`, standard.ID, promo.ID), result.Reason)
+
+			result, err = rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationTime(end))
+			require.NoError(t, err)
+			assert.Equal(t, &standard.ID, result.RuleID)
+			assert.Contains(t, result.Reason, `skipped inactive rule "Spring promo" (`+promo.ID+`) ended at 2024-04-01T00:00:00Z`)
+		})
+
+		t.Run("Skipped rules are noted when no rule matches", func(t *testing.T) {
+			flag, promo, _ := promoFlag()
+			flag.Rules = flag.Rules[:1]
+
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithEvaluationTime(end))
+
+			require.NoError(t, err)
+			assert.False(t, result.Value)
+			assert.Nil(t, result.RuleID)
+			assert.Equal(t, rulesengine.ReasonNoRulesMatched+`; skipped inactive rule "Spring promo" (`+promo.ID+`) ended at 2024-04-01T00:00:00Z`, result.Reason)
+		})
+
+		t.Run("Company-provided rules respect their window", func(t *testing.T) {
+			company := createTestCompany()
+			flag := createTestFlag()
+			flag.DefaultValue = false
+
+			rule := createTestRule()
+			rule.RuleType = rulesengine.RuleTypeCompanyOverride
+			rule.FlagID = &flag.ID
+			rule.EndsAt = &end
+			company.Rules = []*rulesengine.Rule{rule}
+
+			result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationTime(launch))
+			require.NoError(t, err)
+			assert.True(t, result.Value)
+
+			result, err = rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationTime(end))
+			require.NoError(t, err)
+			assert.False(t, result.Value)
+		})
+
+		t.Run("Inactive flags return the default value without checking rules", func(t *testing.T) {
+			flag, _, _ := promoFlag()
+			flag.DefaultValue = true
+			flag.StartsAt = &launch
+			var rulesChecked int
+			hook := &countingRuleHook{count: &rulesChecked}
+
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithEvaluationTime(launch.Add(-time.Hour)), rulesengine.WithHooks(hook))
+
+			require.NoError(t, err)
+			assert.True(t, result.Value)
+			assert.Nil(t, result.RuleID)
+			assert.Equal(t, "Flag is inactive (starts at 2024-03-01T00:00:00Z); default value for flag", result.Reason)
+			assert.Zero(t, rulesChecked)
+
+			result, err = rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithEvaluationTime(launch))
+			require.NoError(t, err)
+			assert.NotNil(t, result.RuleID)
+		})
+
+		t.Run("Payloads without windows are always active", func(t *testing.T) {
+			var flag rulesengine.Flag
+			require.NoError(t, json.Unmarshal([]byte(`{"id": "flag_1", "key": "feature", "default_value": true, "rules": [{"id": "rule_1", "rule_type": "global_override", "value": false}]}`), &flag))
+
+			assert.Nil(t, flag.StartsAt)
+			assert.Nil(t, flag.EndsAt)
+			assert.Nil(t, flag.Rules[0].StartsAt)
+			assert.True(t, flag.IsActiveAt(time.Time{}))
+
+			data, err := json.Marshal(&flag)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "starts_at")
+			assert.NotContains(t, string(data), "ends_at")
+
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, &flag)
+			require.NoError(t, err)
+			assert.False(t, result.Value)
+		})
+	})
+
+	t.Run("Error policies", func(t *testing.T) {
+		// brokenFlag returns a flag whose first rule fails to evaluate, with a
+		// lower-priority rule beneath it that matches any company.
+		brokenFlag := func() (*rulesengine.Flag, *rulesengine.Rule, *rulesengine.Rule) {
+			flag := createTestFlag()
+			flag.DefaultValue = false
+
+			condition := createTestCondition(rulesengine.ConditionTypeMetric)
+			condition.MetricValue = nil
+			broken := createTestRule()
+			broken.Name = "Broken"
+			broken.Priority = 0
+			broken.Value = false
+			broken.Conditions = []*rulesengine.Condition{condition}
+
+			fallback := createTestRule()
+			fallback.Name = "Fallback"
+			fallback.Priority = 1
+			fallback.Value = true
+
+			flag.Rules = []*rulesengine.Rule{broken, fallback}
+			return flag, broken, fallback
+		}
+
+		t.Run("Abort returns the error and the default value", func(t *testing.T) {
+			flag, broken, _ := brokenFlag()
+
+			for _, opts := range [][]rulesengine.CheckFlagOption{nil, {rulesengine.WithErrorPolicy(rulesengine.ErrorPolicyAbort)}} {
+				result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, opts...)
+
+				require.ErrorIs(t, err, rulesengine.ErrorMissingMetricValue)
+				assert.False(t, result.Value)
+				assert.Nil(t, result.RuleID)
+				assert.Empty(t, result.SkippedErrors)
+				var evalErr *rulesengine.EvaluationError
+				require.ErrorAs(t, result.Err, &evalErr)
+				assert.Equal(t, broken.ID, evalErr.RuleID)
+			}
+		})
+
+		t.Run("Skip rule carries on with the next rule", func(t *testing.T) {
+			flag, broken, fallback := brokenFlag()
+
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithErrorPolicy(rulesengine.ErrorPolicySkipRule))
+
+			require.NoError(t, err)
+			assert.NoError(t, result.Err)
+			assert.True(t, result.Value)
+			assert.Equal(t, &fallback.ID, result.RuleID)
+			assert.Equal(t, fmt.Sprintf(`Matched standard rule "Fallback" (%s); skipped failed rule "Broken" (%s)`, fallback.ID, broken.ID), result.Reason)
+			require.Len(t, result.SkippedErrors, 1)
+			assert.Equal(t, rulesengine.ErrorCodeMissingMetricValue, result.SkippedErrors[0].Code)
+			assert.Equal(t, flag.ID, result.SkippedErrors[0].FlagID)
+			assert.Equal(t, broken.ID, result.SkippedErrors[0].RuleID)
+			assert.Equal(t, broken.Conditions[0].ID, result.SkippedErrors[0].ConditionID)
+			assert.ErrorIs(t, result.SkippedErrors[0].Err(), rulesengine.ErrorMissingMetricValue)
+		})
+
+		t.Run("Skip rule records every failing rule", func(t *testing.T) {
+			flag, broken, fallback := brokenFlag()
+			fallback.Conditions = []*rulesengine.Condition{broken.Conditions[0]}
+
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithErrorPolicy(rulesengine.ErrorPolicySkipRule))
+
+			require.NoError(t, err)
+			assert.False(t, result.Value)
+			assert.Nil(t, result.RuleID)
+			assert.Equal(t, fmt.Sprintf(`%s; skipped failed rule "Broken" (%s), rule "Fallback" (%s)`, rulesengine.ReasonNoRulesMatched, broken.ID, fallback.ID), result.Reason)
+			require.Len(t, result.SkippedErrors, 2)
+			assert.Equal(t, broken.ID, result.SkippedErrors[0].RuleID)
+			assert.Equal(t, fallback.ID, result.SkippedErrors[1].RuleID)
+		})
+
+		t.Run("Fixed value serves the error value", func(t *testing.T) {
+			flag, broken, _ := brokenFlag()
+
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithErrorValue(true))
+
+			require.NoError(t, err)
+			assert.NoError(t, result.Err)
+			assert.True(t, result.Value)
+			assert.Nil(t, result.RuleID)
+			assert.Equal(t, fmt.Sprintf(`Rule "Broken" (%s) failed; error value for flag`, broken.ID), result.Reason)
+			require.Len(t, result.SkippedErrors, 1)
+			assert.Equal(t, broken.ID, result.SkippedErrors[0].RuleID)
+
+			flag.DefaultValue = true
+			result, err = rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithErrorPolicy(rulesengine.ErrorPolicyFixedValue))
+			require.NoError(t, err)
+			assert.False(t, result.Value)
+		})
+
+		t.Run("Policies do not affect flags that evaluate cleanly", func(t *testing.T) {
+			flag, broken, _ := brokenFlag()
+			broken.Conditions = nil
+
+			for _, opt := range []rulesengine.CheckFlagOption{rulesengine.WithErrorPolicy(rulesengine.ErrorPolicySkipRule), rulesengine.WithErrorValue(true)} {
+				result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, opt)
+
+				require.NoError(t, err)
+				assert.False(t, result.Value)
+				assert.Equal(t, &broken.ID, result.RuleID)
+				assert.Nil(t, result.SkippedErrors)
+			}
+		})
+
+		t.Run("Rejects unknown policies", func(t *testing.T) {
+			flag, _, _ := brokenFlag()
+
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithErrorPolicy("retry"))
+
+			require.ErrorIs(t, err, rulesengine.ErrorUnknownErrorPolicy)
+			assert.Equal(t, rulesengine.ErrorCodeInvalidInput, rulesengine.ErrorCodeOf(err))
+			assert.Equal(t, err, result.Err)
+		})
+
+		t.Run("Skipped errors survive serialization", func(t *testing.T) {
+			flag, _, _ := brokenFlag()
+			result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithErrorPolicy(rulesengine.ErrorPolicySkipRule))
+			require.NoError(t, err)
+
+			data, err := json.Marshal(result)
+			require.NoError(t, err)
+			var decoded rulesengine.CheckFlagResult
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			assert.Equal(t, result.SkippedErrors, decoded.SkippedErrors)
+
+			data, err = result.MarshalBinary()
+			require.NoError(t, err)
+			decoded = rulesengine.CheckFlagResult{}
+			require.NoError(t, decoded.UnmarshalBinary(data))
+			assert.Equal(t, result.SkippedErrors, decoded.SkippedErrors)
+		})
+	})
+
+	t.Run("Cancellation and budgets", func(t *testing.T) {
+		company := createTestCompany()
+
+		// conditionFlag returns a flag with a rule per entry in conditions,
+		// each with that many conditions on company. Every condition but the
+		// last of each rule matches, so all of them are checked.
+		conditionFlag := func(conditions ...int) *rulesengine.Flag {
+			flag := createTestFlag()
+			flag.DefaultValue = false
+			for i, n := range conditions {
+				rule := createTestRule()
+				rule.Priority = int64(i)
+				for j := range n {
+					condition := createTestCondition(rulesengine.ConditionTypeCompany)
+					condition.ResourceIDs = []string{company.ID}
+					if j == n-1 {
+						condition.Operator = typeconvert.ComparableOperatorNotEquals
+					}
+					rule.Conditions = append(rule.Conditions, condition)
+				}
+				flag.Rules = append(flag.Rules, rule)
+			}
+			return flag
+		}
+
+		t.Run("Canceled contexts stop the evaluation", func(t *testing.T) {
+			flag := conditionFlag(1)
+			canceledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+
+			result, err := rulesengine.CheckFlag(canceledCtx, company, nil, flag)
+
+			require.ErrorIs(t, err, rulesengine.ErrorEvaluationCanceled)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Equal(t, rulesengine.ErrorCodeCanceled, rulesengine.ErrorCodeOf(err))
+			assert.False(t, result.Value)
+			assert.Equal(t, err, result.Err)
+		})
+
+		t.Run("Expired deadlines stop the evaluation", func(t *testing.T) {
+			flag := conditionFlag(1)
+			expiredCtx, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+			defer cancel()
+
+			_, err := rulesengine.CheckFlag(expiredCtx, company, nil, flag)
+
+			require.ErrorIs(t, err, rulesengine.ErrorEvaluationCanceled)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		})
+
+		t.Run("Cancellation is honored between rules", func(t *testing.T) {
+			flag := conditionFlag(1, 1)
+			cancelCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			hook := &cancelingHook{cancel: cancel}
+
+			_, err := rulesengine.CheckFlag(cancelCtx, company, nil, flag, rulesengine.WithHooks(hook))
+
+			require.ErrorIs(t, err, context.Canceled)
+			assert.Equal(t, 1, hook.rules)
+			var evalErr *rulesengine.EvaluationError
+			require.ErrorAs(t, err, &evalErr)
+			assert.Equal(t, flag.Rules[1].ID, evalErr.RuleID)
+		})
+
+		t.Run("Budgets cap the conditions checked across rules", func(t *testing.T) {
+			flag := conditionFlag(2, 3)
+
+			result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationBudget(5))
+			require.NoError(t, err)
+			assert.Equal(t, rulesengine.ReasonNoRulesMatched, result.Reason)
+
+			result, err = rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithEvaluationBudget(4))
+			require.ErrorIs(t, err, rulesengine.ErrorEvaluationBudgetExceeded)
+			assert.Equal(t, rulesengine.ErrorCodeBudgetExceeded, rulesengine.ErrorCodeOf(err))
+			assert.False(t, result.Value)
+			var evalErr *rulesengine.EvaluationError
+			require.ErrorAs(t, err, &evalErr)
+			assert.Equal(t, flag.Rules[1].ID, evalErr.RuleID)
+			assert.Equal(t, flag.Rules[1].Conditions[2].ID, evalErr.ConditionID)
+		})
+
+		t.Run("A zero budget means no limit", func(t *testing.T) {
+			_, err := rulesengine.CheckFlag(ctx, company, nil, conditionFlag(10, 10), rulesengine.WithEvaluationBudget(0))
+
+			require.NoError(t, err)
+		})
+
+		t.Run("Rejects negative budgets", func(t *testing.T) {
+			_, err := rulesengine.CheckFlag(ctx, company, nil, conditionFlag(1), rulesengine.WithEvaluationBudget(-1))
+
+			require.ErrorIs(t, err, rulesengine.ErrorNegativeEvaluationBudget)
+		})
+
+		t.Run("Limits stop the evaluation under every error policy", func(t *testing.T) {
+			flag := conditionFlag(2, 0)
+			canceledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+
+			for _, opt := range []rulesengine.CheckFlagOption{rulesengine.WithErrorPolicy(rulesengine.ErrorPolicySkipRule), rulesengine.WithErrorValue(true)} {
+				result, err := rulesengine.CheckFlag(ctx, company, nil, flag, opt, rulesengine.WithEvaluationBudget(1))
+				require.ErrorIs(t, err, rulesengine.ErrorEvaluationBudgetExceeded)
+				assert.False(t, result.Value)
+				assert.Empty(t, result.SkippedErrors)
+
+				_, err = rulesengine.CheckFlag(canceledCtx, company, nil, flag, opt)
+				require.ErrorIs(t, err, rulesengine.ErrorEvaluationCanceled)
+			}
+		})
+	})
+
 	t.Run("Preflight options", func(t *testing.T) {
 		// Builds a flag wrapping a credit-balance rule with an optional event_subtype.
 		// Returns flag and rule so callers can assert on result.RuleID == &rule.ID.
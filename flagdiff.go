@@ -0,0 +1,238 @@
+package rulesengine
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Subject is one company and/or user a flag is evaluated for.
+type Subject struct {
+	Company *Company
+	User    *User
+}
+
+// FlagDiff describes how publishing a new version of a flag would change
+// its evaluations across a population.
+type FlagDiff struct {
+	// Evaluated is the number of subjects evaluated.
+	Evaluated int
+
+	// Changes lists the subjects whose value or matched rule changed, in
+	// population order.
+	Changes []*FlagDiffChange
+
+	// ValueChanged counts the subjects whose value changed, of which
+	// TurnedOn went from false to true and TurnedOff from true to false.
+	ValueChanged int
+	TurnedOn     int
+	TurnedOff    int
+
+	// RuleChanged counts the subjects matched by a different rule.
+	RuleChanged int
+
+	// Rules summarizes matches per rule, ordered by rule ID. Subjects that
+	// matched no rule are counted under an empty RuleID.
+	Rules []*RuleDiffSummary
+}
+
+// FlagDiffChange is a subject whose evaluation differs between versions.
+type FlagDiffChange struct {
+	// Index is the subject's position in the population.
+	Index   int
+	Subject *Subject
+
+	Old *CheckFlagResult
+	New *CheckFlagResult
+
+	ValueChanged bool
+	RuleChanged  bool
+}
+
+// RuleDiffSummary counts the subjects matched by one rule under each version.
+type RuleDiffSummary struct {
+	RuleID string
+
+	// OldMatches and NewMatches count the subjects the rule matched under
+	// the old and new versions.
+	OldMatches int
+	NewMatches int
+
+	// Gained counts subjects the rule matches only under the new version,
+	// and Lost those it matches only under the old one.
+	Gained int
+	Lost   int
+}
+
+// FlagDiffOption configures DiffFlagVersions.
+type FlagDiffOption func(*flagDiffOptions)
+
+type flagDiffOptions struct {
+	concurrency int
+}
+
+// WithDiffConcurrency sets how many subjects are evaluated in parallel. It
+// defaults to GOMAXPROCS; values below one are treated as one.
+func WithDiffConcurrency(n int) FlagDiffOption {
+	return func(o *flagDiffOptions) {
+		o.concurrency = max(n, 1)
+	}
+}
+
+// DiffFlagVersions evaluates oldFlag and newFlag for every subject in
+// population and reports the subjects whose value or matched rule would
+// change. See Engine.DiffFlagVersions.
+func DiffFlagVersions(
+	ctx context.Context,
+	oldFlag *Flag,
+	newFlag *Flag,
+	population []*Subject,
+	opts ...FlagDiffOption,
+) (*FlagDiff, error) {
+	var engine *Engine
+	return engine.DiffFlagVersions(ctx, oldFlag, newFlag, population, opts...)
+}
+
+// DiffFlagVersions evaluates oldFlag and newFlag for every subject in
+// population with the engine's options, and reports the subjects whose value
+// or matched rule would change along with per-rule match counts. Subjects
+// are evaluated concurrently; the first evaluation error, or the context
+// being done, stops the diff and is returned.
+func (e *Engine) DiffFlagVersions(
+	ctx context.Context,
+	oldFlag *Flag,
+	newFlag *Flag,
+	population []*Subject,
+	opts ...FlagDiffOption,
+) (*FlagDiff, error) {
+	if oldFlag == nil || newFlag == nil {
+		return nil, ErrorFlagNotFound
+	}
+
+	options := &flagDiffOptions{concurrency: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type evaluation struct {
+		old, new *CheckFlagResult
+	}
+	evaluations := make([]evaluation, len(population))
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	indexes := make(chan int)
+	for range min(options.concurrency, len(population)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				subject := population[i]
+				if subject == nil {
+					subject = &Subject{}
+				}
+
+				oldResult, err := e.CheckFlag(ctx, subject.Company, subject.User, oldFlag)
+				if err != nil {
+					fail(fmt.Errorf("evaluating old flag for subject %d: %w", i, err))
+					continue
+				}
+				newResult, err := e.CheckFlag(ctx, subject.Company, subject.User, newFlag)
+				if err != nil {
+					fail(fmt.Errorf("evaluating new flag for subject %d: %w", i, err))
+					continue
+				}
+				evaluations[i] = evaluation{old: oldResult, new: newResult}
+			}
+		}()
+	}
+
+feed:
+	for i := range population {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	diff := &FlagDiff{Evaluated: len(population)}
+	rules := make(map[string]*RuleDiffSummary)
+	ruleSummary := func(ruleID string) *RuleDiffSummary {
+		summary, ok := rules[ruleID]
+		if !ok {
+			summary = &RuleDiffSummary{RuleID: ruleID}
+			rules[ruleID] = summary
+		}
+		return summary
+	}
+
+	for i, eval := range evaluations {
+		oldRule, newRule := matchedRuleID(eval.old), matchedRuleID(eval.new)
+		ruleSummary(oldRule).OldMatches++
+		ruleSummary(newRule).NewMatches++
+
+		change := &FlagDiffChange{
+			Index:        i,
+			Subject:      population[i],
+			Old:          eval.old,
+			New:          eval.new,
+			ValueChanged: eval.old.Value != eval.new.Value,
+			RuleChanged:  oldRule != newRule,
+		}
+		if change.RuleChanged {
+			diff.RuleChanged++
+			ruleSummary(oldRule).Lost++
+			ruleSummary(newRule).Gained++
+		}
+		if change.ValueChanged {
+			diff.ValueChanged++
+			if eval.new.Value {
+				diff.TurnedOn++
+			} else {
+				diff.TurnedOff++
+			}
+		}
+		if change.ValueChanged || change.RuleChanged {
+			diff.Changes = append(diff.Changes, change)
+		}
+	}
+
+	for _, ruleID := range sortedKeys(rules) {
+		diff.Rules = append(diff.Rules, rules[ruleID])
+	}
+
+	return diff, nil
+}
+
+// matchedRuleID returns the ID of the rule a result matched, or an empty
+// string if it fell back to the flag's default value.
+func matchedRuleID(result *CheckFlagResult) string {
+	if result == nil || result.RuleID == nil {
+		return ""
+	}
+	return *result.RuleID
+}
@@ -0,0 +1,164 @@
+package rulesengine_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planFlag returns a flag that is on for companies on any of the plans.
+func planFlag(ruleID string, planIDs ...string) *rulesengine.Flag {
+	flag := createTestFlag()
+	flag.ID = "flag_diff"
+	flag.DefaultValue = false
+
+	rule := createTestRule()
+	rule.ID = ruleID
+	rule.Value = true
+	condition := createTestCondition(rulesengine.ConditionTypePlan)
+	condition.ResourceIDs = planIDs
+	rule.Conditions = []*rulesengine.Condition{condition}
+	flag.Rules = []*rulesengine.Rule{rule}
+
+	return flag
+}
+
+func planPopulation(planIDs ...string) []*rulesengine.Subject {
+	population := make([]*rulesengine.Subject, len(planIDs))
+	for i, planID := range planIDs {
+		company := createTestCompany()
+		company.PlanIDs = []string{planID}
+		population[i] = &rulesengine.Subject{Company: company}
+	}
+	return population
+}
+
+func TestDiffFlagVersions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Reports subjects whose value changes", func(t *testing.T) {
+		oldFlag := planFlag("rule_plans", "plan_a", "plan_b")
+		newFlag := planFlag("rule_plans", "plan_b", "plan_c")
+		population := planPopulation("plan_a", "plan_b", "plan_c", "plan_d")
+
+		diff, err := rulesengine.DiffFlagVersions(ctx, oldFlag, newFlag, population)
+
+		require.NoError(t, err)
+		assert.Equal(t, 4, diff.Evaluated)
+		assert.Equal(t, 2, diff.ValueChanged)
+		assert.Equal(t, 1, diff.TurnedOn)
+		assert.Equal(t, 1, diff.TurnedOff)
+		assert.Equal(t, 2, diff.RuleChanged)
+
+		require.Len(t, diff.Changes, 2)
+		assert.Equal(t, 0, diff.Changes[0].Index)
+		assert.Same(t, population[0], diff.Changes[0].Subject)
+		assert.True(t, diff.Changes[0].Old.Value)
+		assert.False(t, diff.Changes[0].New.Value)
+		assert.Equal(t, 2, diff.Changes[1].Index)
+		assert.True(t, diff.Changes[1].New.Value)
+
+		assert.Equal(t, []*rulesengine.RuleDiffSummary{
+			{RuleID: "", OldMatches: 2, NewMatches: 2, Gained: 1, Lost: 1},
+			{RuleID: "rule_plans", OldMatches: 2, NewMatches: 2, Gained: 1, Lost: 1},
+		}, diff.Rules)
+	})
+
+	t.Run("Reports subjects matched by a different rule with the same value", func(t *testing.T) {
+		oldFlag := planFlag("rule_old", "plan_a")
+		newFlag := planFlag("rule_new", "plan_a")
+
+		diff, err := rulesengine.DiffFlagVersions(ctx, oldFlag, newFlag, planPopulation("plan_a", "plan_b"))
+
+		require.NoError(t, err)
+		assert.Zero(t, diff.ValueChanged)
+		assert.Equal(t, 1, diff.RuleChanged)
+		require.Len(t, diff.Changes, 1)
+		assert.False(t, diff.Changes[0].ValueChanged)
+		assert.True(t, diff.Changes[0].RuleChanged)
+		assert.Equal(t, []*rulesengine.RuleDiffSummary{
+			{RuleID: "", OldMatches: 1, NewMatches: 1},
+			{RuleID: "rule_new", NewMatches: 1, Gained: 1},
+			{RuleID: "rule_old", OldMatches: 1, Lost: 1},
+		}, diff.Rules)
+	})
+
+	t.Run("Results are independent of concurrency", func(t *testing.T) {
+		planIDs := make([]string, 500)
+		for i := range planIDs {
+			planIDs[i] = fmt.Sprintf("plan_%d", i%7)
+		}
+		population := planPopulation(planIDs...)
+		oldFlag := planFlag("rule_plans", "plan_0", "plan_1", "plan_2")
+		newFlag := planFlag("rule_plans", "plan_2", "plan_3")
+
+		serial, err := rulesengine.DiffFlagVersions(ctx, oldFlag, newFlag, population, rulesengine.WithDiffConcurrency(1))
+		require.NoError(t, err)
+		parallel, err := rulesengine.DiffFlagVersions(ctx, oldFlag, newFlag, population, rulesengine.WithDiffConcurrency(16))
+		require.NoError(t, err)
+
+		assert.Equal(t, serial, parallel)
+		assert.Equal(t, 500, parallel.Evaluated)
+		for i := 1; i < len(parallel.Changes); i++ {
+			assert.Less(t, parallel.Changes[i-1].Index, parallel.Changes[i].Index)
+		}
+	})
+
+	t.Run("Applies the engine's options", func(t *testing.T) {
+		var rulesChecked int
+		hook := &countingRuleHook{count: &rulesChecked}
+		engine := rulesengine.NewEngine(rulesengine.WithHooks(hook))
+
+		_, err := engine.DiffFlagVersions(ctx, planFlag("rule_a", "plan_a"), planFlag("rule_b", "plan_b"), planPopulation("plan_a", "plan_b"), rulesengine.WithDiffConcurrency(1))
+
+		require.NoError(t, err)
+		assert.Equal(t, 4, rulesChecked)
+	})
+
+	t.Run("Evaluation errors stop the diff", func(t *testing.T) {
+		usage := int64(-1)
+		engine := rulesengine.NewEngine(rulesengine.WithUsage(usage))
+
+		diff, err := engine.DiffFlagVersions(ctx, planFlag("rule_a", "plan_a"), planFlag("rule_a", "plan_b"), planPopulation("plan_a", "plan_b"))
+
+		assert.Nil(t, diff)
+		assert.ErrorIs(t, err, rulesengine.ErrorNegativePreflightUsage)
+	})
+
+	t.Run("Canceled contexts stop the diff", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		diff, err := rulesengine.DiffFlagVersions(ctx, planFlag("rule_a", "plan_a"), planFlag("rule_a", "plan_b"), planPopulation("plan_a"))
+
+		assert.Nil(t, diff)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Missing flags are rejected", func(t *testing.T) {
+		_, err := rulesengine.DiffFlagVersions(ctx, nil, planFlag("rule_a", "plan_a"), nil)
+
+		assert.ErrorIs(t, err, rulesengine.ErrorFlagNotFound)
+	})
+
+	t.Run("Empty and nil subjects are evaluated without context", func(t *testing.T) {
+		diff, err := rulesengine.DiffFlagVersions(ctx, planFlag("rule_a", "plan_a"), planFlag("rule_a", "plan_b"), []*rulesengine.Subject{nil, {}})
+
+		require.NoError(t, err)
+		assert.Equal(t, 2, diff.Evaluated)
+		assert.Empty(t, diff.Changes)
+	})
+}
+
+type countingRuleHook struct {
+	rulesengine.NoopHook
+	count *int
+}
+
+func (h *countingRuleHook) AfterRule(ctx context.Context, eval *rulesengine.HookEvaluation, rule *rulesengine.Rule, matched bool) {
+	*h.count++
+}
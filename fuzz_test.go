@@ -0,0 +1,132 @@
+package rulesengine_test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func FuzzCheckFlag(f *testing.F) {
+	for seed := range uint64(16) {
+		f.Add(seed, false, false)
+	}
+	f.Add(uint64(7), true, false)
+	f.Add(uint64(7), false, true)
+
+	f.Fuzz(func(t *testing.T, seed uint64, withNils bool, withoutContext bool) {
+		g := newGenerator(seed)
+		flag := g.flag()
+		company, user := g.company(flag.ID), g.user()
+		if withNils {
+			flag.Rules = append([]*rulesengine.Rule{nil}, flag.Rules...)
+			for _, rule := range flag.Rules {
+				if rule != nil {
+					rule.Conditions = append(rule.Conditions, nil)
+					rule.ConditionGroups = append(rule.ConditionGroups, nil)
+				}
+			}
+		}
+		if withoutContext {
+			company, user = nil, nil
+		}
+
+		result, err := rulesengine.CheckFlag(context.Background(), company, user, flag)
+		require.NoError(t, err)
+		checkResultSource(t, flag, company, result)
+
+		again, err := rulesengine.CheckFlag(context.Background(), company, user, flag)
+		require.NoError(t, err)
+		assert.Equal(t, result, again)
+	})
+}
+
+func FuzzGroupRulesByPriority(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 1, 2, 3, 4, 5, 6})
+	f.Add([]byte{0x15, 0x05, 0x35, 0x25})
+	f.Add([]byte{0x01, 0x11, 0x01, 0x11, 0x01})
+	f.Add([]byte{7, 8, 0x17, 5})
+
+	// Each byte is a rule: the low bits pick a known rule type, a nil rule or
+	// an unknown type, bit 4 the value and the high bits the priority.
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var rules []*rulesengine.Rule
+		var expected int
+		for i, b := range data {
+			var ruleType rulesengine.RuleType
+			switch kind := int(b&0x0f) % (len(rulesengine.RuleTypePriority) + 2); kind {
+			case len(rulesengine.RuleTypePriority):
+				rules = append(rules, nil)
+				continue
+			case len(rulesengine.RuleTypePriority) + 1:
+				ruleType = "unknown"
+			default:
+				ruleType = rulesengine.RuleTypePriority[kind]
+				expected++
+			}
+			rules = append(rules, &rulesengine.Rule{
+				ID:       string(rune('a' + i%26)),
+				RuleType: ruleType,
+				Value:    b&0x10 != 0,
+				Priority: int64(b >> 5),
+			})
+		}
+
+		grouped := rulesengine.GroupRulesByPriority(rules)
+
+		var seen int
+		lastTypeIndex := -1
+		for _, group := range grouped {
+			require.NotEmpty(t, group)
+			ruleType := group[0].RuleType
+			typeIndex := slices.Index(rulesengine.RuleTypePriority, ruleType)
+			require.Greater(t, typeIndex, lastTypeIndex, "groups out of order")
+			lastTypeIndex = typeIndex
+
+			for i, rule := range group {
+				require.NotNil(t, rule)
+				require.Equal(t, ruleType, rule.RuleType, "group mixes rule types")
+				if i == 0 {
+					continue
+				}
+				switch ruleType.PrioritizationMethod() {
+				case rulesengine.RulePrioritizationMethodPriority:
+					assert.LessOrEqual(t, group[i-1].Priority, rule.Priority, "%s rules out of priority order", ruleType)
+				case rulesengine.RulePrioritizationMethodOptimistic:
+					assert.False(t, rule.Value && !group[i-1].Value, "%s rule with value true after one with value false", ruleType)
+				}
+			}
+			seen += len(group)
+		}
+		assert.Equal(t, expected, seen)
+	})
+}
+
+func FuzzJSONSliceUnmarshal(f *testing.F) {
+	f.Add([]byte(`null`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`["a", "b"]`))
+	f.Add([]byte(`[null, ""]`))
+	f.Add([]byte(`{}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var s rulesengine.JSONSlice[string]
+		if err := json.Unmarshal(data, &s); err != nil {
+			return
+		}
+		require.NotNil(t, s)
+
+		out, err := json.Marshal(s)
+		require.NoError(t, err)
+		assert.NotEqual(t, "null", string(out))
+
+		var roundTripped rulesengine.JSONSlice[string]
+		require.NoError(t, json.Unmarshal(out, &roundTripped))
+		assert.Equal(t, s, roundTripped)
+	})
+}
@@ -1,80 +1,34 @@
 package rulesengine_test
 
 import (
-	"fmt"
-	"strings"
-	"time"
-
 	gofakeit "github.com/brianvoe/gofakeit/v6"
 	"github.com/schematichq/rulesengine"
-	"github.com/schematichq/rulesengine/null"
+	"github.com/schematichq/rulesengine/rulesenginetest"
 	"github.com/schematichq/rulesengine/typeconvert"
 )
 
 func generateTestID(prefix string) string {
-	const randomPartLength = 12
-	return fmt.Sprintf("%s_%s", prefix, strings.ToLower(gofakeit.LetterN(randomPartLength)))
+	return rulesenginetest.NewID(prefix)
 }
 
 func createTestCompany() *rulesengine.Company {
-	return &rulesengine.Company{
-		ID:                generateTestID("comp"),
-		AccountID:         generateTestID("acct"),
-		EnvironmentID:     generateTestID("env"),
-		PlanIDs:           []string{generateTestID("plan"), generateTestID("plan")},
-		PlanVersionIDs:    []string{generateTestID("plnv"), generateTestID("plnv")},
-		BillingProductIDs: []string{generateTestID("bilp"), generateTestID("bilp")},
-		BasePlanID:        null.Nullable(generateTestID("plan")),
-		Metrics:           make(rulesengine.CompanyMetricCollection, 0),
-		Traits:            make([]*rulesengine.Trait, 0),
-		Subscription: &rulesengine.Subscription{
-			ID:          generateTestID("bilsub"),
-			PeriodStart: time.Now().Add(-30 * 24 * time.Hour),
-			PeriodEnd:   time.Now().Add(30 * 24 * time.Hour),
-		},
-	}
+	return rulesenginetest.NewCompany().Build()
 }
 
 func createTestSubscription() *rulesengine.Subscription {
-	return &rulesengine.Subscription{
-		ID:          generateTestID("bilsub"),
-		PeriodStart: time.Now().Add(-30 * 24 * time.Hour),
-		PeriodEnd:   time.Now().Add(30 * 24 * time.Hour),
-	}
+	return rulesenginetest.NewSubscription()
 }
 
 func createTestUser() *rulesengine.User {
-	return &rulesengine.User{
-		ID:            generateTestID("user"),
-		AccountID:     generateTestID("acct"),
-		EnvironmentID: generateTestID("env"),
-		Traits:        make([]*rulesengine.Trait, 0),
-	}
+	return rulesenginetest.NewUser().Build()
 }
 
 func createTestRule() *rulesengine.Rule {
-	return &rulesengine.Rule{
-		ID:              generateTestID("rule"),
-		AccountID:       generateTestID("acct"),
-		EnvironmentID:   generateTestID("env"),
-		RuleType:        rulesengine.RuleTypeStandard,
-		Name:            gofakeit.Name(),
-		Priority:        1,
-		Conditions:      make([]*rulesengine.Condition, 0),
-		ConditionGroups: make([]*rulesengine.ConditionGroup, 0),
-		Value:           true,
-	}
+	return rulesenginetest.NewRule().Build()
 }
 
 func createTestFlag() *rulesengine.Flag {
-	return &rulesengine.Flag{
-		ID:            generateTestID("flag"),
-		AccountID:     generateTestID("acct"),
-		EnvironmentID: generateTestID("env"),
-		Key:           gofakeit.Word(),
-		Rules:         make([]*rulesengine.Rule, 0),
-		DefaultValue:  gofakeit.Bool(),
-	}
+	return rulesenginetest.NewFlag().DefaultValue(gofakeit.Bool()).Build()
 }
 
 func createTestCondition(conditionType rulesengine.ConditionType) *rulesengine.Condition {
@@ -105,36 +59,16 @@ func createTestCondition(conditionType rulesengine.ConditionType) *rulesengine.C
 }
 
 func createTestMetric(company *rulesengine.Company, eventSubtype string, period rulesengine.MetricPeriod, value int64) *rulesengine.CompanyMetric {
-	return &rulesengine.CompanyMetric{
-		AccountID:     company.AccountID,
-		EnvironmentID: company.EnvironmentID,
-		CompanyID:     company.ID,
-		EventSubtype:  eventSubtype,
-		Period:        period,
-		MonthReset:    rulesengine.MetricPeriodMonthResetFirst,
-		Value:         value,
-		CreatedAt:     time.Now(),
-	}
+	return rulesenginetest.NewMetric(company, eventSubtype, period, value)
 }
 
 func createTestTrait(value string, def *rulesengine.TraitDefinition) *rulesengine.Trait {
-	if def == nil {
-		def = createTestTraitDefinition(typeconvert.ComparableTypeInt, rulesengine.EntityTypeCompany)
-	}
-
-	return &rulesengine.Trait{
-		TraitDefinition: def,
-		Value:           value,
-	}
+	return rulesenginetest.NewTrait(def, value)
 }
 
 func createTestTraitDefinition(
 	comparableType typeconvert.ComparableType,
 	entityType rulesengine.EntityType,
 ) *rulesengine.TraitDefinition {
-	return &rulesengine.TraitDefinition{
-		ID:             generateTestID("trt"),
-		ComparableType: comparableType,
-		EntityType:     entityType,
-	}
+	return rulesenginetest.NewTraitDefinition(comparableType, entityType)
 }
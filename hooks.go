@@ -0,0 +1,138 @@
+package rulesengine
+
+import (
+	"context"
+)
+
+// EvaluationHook observes a flag evaluation from the outside. Hooks are the
+// extension point for analytics, logging and kill-switches around CheckFlag;
+// they are registered on an Engine with NewEngine(WithHooks(...)) or passed
+// to a single check with the WithHooks option.
+//
+// For a single evaluation the engine invokes hooks in this order:
+//
+//  1. BeforeEvaluation, once, before anything else, including the checks
+//     of the options and inputs that can end the evaluation early
+//  2. AfterRule, once for every rule that was checked, in evaluation order;
+//     rules skipped for being outside their activation window are not
+//     reported
+//  3. OnError, once, if the evaluation failed
+//  4. AfterEvaluation, once, with the final result
+//
+// Within each stage, hooks run in registration order; hooks registered on the
+// Engine run before hooks passed to an individual CheckFlag call.
+//
+// Hooks must not mutate the models or the result they receive. A panic in a
+// hook is recovered and discarded so that a faulty hook can never change the
+// outcome of an evaluation.
+type EvaluationHook interface {
+	// BeforeEvaluation runs before any rule is checked. Returning an error
+	// aborts the evaluation: the flag's default value is returned with
+	// ReasonEvaluationAborted and the error attached to CheckFlagResult.Err.
+	// This is how kill-switches are implemented.
+	BeforeEvaluation(ctx context.Context, eval *HookEvaluation) error
+
+	// AfterRule runs after each rule check with whether the rule matched.
+	AfterRule(ctx context.Context, eval *HookEvaluation, rule *Rule, matched bool)
+
+	// OnError runs when the evaluation returns an error.
+	OnError(ctx context.Context, eval *HookEvaluation, err error)
+
+	// AfterEvaluation runs last with the result returned to the caller.
+	AfterEvaluation(ctx context.Context, eval *HookEvaluation, result *CheckFlagResult)
+}
+
+// HookEvaluation identifies the evaluation a hook is being invoked for. The
+// same pointer is passed to every stage of a single evaluation, so hooks can
+// use it as a key to correlate stages. Company and User are the snapshots
+// the evaluation reads (see Company.Snapshot), not the pointers passed to
+// CheckFlag.
+type HookEvaluation struct {
+	Company *Company
+	User    *User
+	Flag    *Flag
+}
+
+// NoopHook implements EvaluationHook with no-op methods. Embed it to
+// implement only the stages a hook cares about.
+type NoopHook struct{}
+
+func (NoopHook) BeforeEvaluation(ctx context.Context, eval *HookEvaluation) error {
+	return nil
+}
+
+func (NoopHook) AfterRule(ctx context.Context, eval *HookEvaluation, rule *Rule, matched bool) {}
+
+func (NoopHook) OnError(ctx context.Context, eval *HookEvaluation, err error) {}
+
+func (NoopHook) AfterEvaluation(ctx context.Context, eval *HookEvaluation, result *CheckFlagResult) {}
+
+// WithHooks registers evaluation hooks. Calling it more than once appends to
+// the previously registered hooks.
+func WithHooks(hooks ...EvaluationHook) CheckFlagOption {
+	// Copy the hooks so later changes to the caller's slice don't reach
+	// evaluations, such as those of an Engine, that reuse the option.
+	registered := make([]EvaluationHook, 0, len(hooks))
+	for _, hook := range hooks {
+		if hook != nil {
+			registered = append(registered, hook)
+		}
+	}
+
+	return func(o *checkFlagOptions) {
+		o.hooks = append(o.hooks, registered...)
+	}
+}
+
+// hookRunner invokes the registered hooks for a single evaluation, isolating
+// the engine from hook panics.
+type hookRunner struct {
+	hooks []EvaluationHook
+	eval  *HookEvaluation
+}
+
+func (r *hookRunner) beforeEvaluation(ctx context.Context) error {
+	for _, hook := range r.hooks {
+		var err error
+		safeInvokeHook(func() {
+			err = hook.BeforeEvaluation(ctx, r.eval)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *hookRunner) afterRule(ctx context.Context, rule *Rule, matched bool) {
+	for _, hook := range r.hooks {
+		safeInvokeHook(func() {
+			hook.AfterRule(ctx, r.eval, rule, matched)
+		})
+	}
+}
+
+func (r *hookRunner) onError(ctx context.Context, err error) {
+	for _, hook := range r.hooks {
+		safeInvokeHook(func() {
+			hook.OnError(ctx, r.eval, err)
+		})
+	}
+}
+
+func (r *hookRunner) afterEvaluation(ctx context.Context, result *CheckFlagResult) {
+	for _, hook := range r.hooks {
+		safeInvokeHook(func() {
+			hook.AfterEvaluation(ctx, r.eval, result)
+		})
+	}
+}
+
+func safeInvokeHook(fn func()) {
+	defer func() {
+		_ = recover()
+	}()
+
+	fn()
+}
@@ -0,0 +1,335 @@
+package rulesengine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/null"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHook appends a line to a shared log for every stage it observes.
+type recordingHook struct {
+	name      string
+	mu        *sync.Mutex
+	log       *[]string
+	beforeErr error
+}
+
+func (h *recordingHook) record(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.log = append(*h.log, fmt.Sprintf("%s:%s", h.name, line))
+}
+
+func (h *recordingHook) BeforeEvaluation(ctx context.Context, eval *rulesengine.HookEvaluation) error {
+	h.record("before")
+	return h.beforeErr
+}
+
+func (h *recordingHook) AfterRule(ctx context.Context, eval *rulesengine.HookEvaluation, rule *rulesengine.Rule, matched bool) {
+	h.record(fmt.Sprintf("rule=%s matched=%t", rule.ID, matched))
+}
+
+func (h *recordingHook) OnError(ctx context.Context, eval *rulesengine.HookEvaluation, err error) {
+	h.record("error")
+}
+
+func (h *recordingHook) AfterEvaluation(ctx context.Context, eval *rulesengine.HookEvaluation, result *rulesengine.CheckFlagResult) {
+	h.record(fmt.Sprintf("after value=%t", result.Value))
+}
+
+type panickingHook struct{}
+
+func (panickingHook) BeforeEvaluation(ctx context.Context, eval *rulesengine.HookEvaluation) error {
+	panic("before")
+}
+
+func (panickingHook) AfterRule(ctx context.Context, eval *rulesengine.HookEvaluation, rule *rulesengine.Rule, matched bool) {
+	panic("rule")
+}
+
+func (panickingHook) OnError(ctx context.Context, eval *rulesengine.HookEvaluation, err error) {
+	panic("error")
+}
+
+func (panickingHook) AfterEvaluation(ctx context.Context, eval *rulesengine.HookEvaluation, result *rulesengine.CheckFlagResult) {
+	panic("after")
+}
+
+type afterOnlyHook struct {
+	rulesengine.NoopHook
+	eval   *rulesengine.HookEvaluation
+	result *rulesengine.CheckFlagResult
+}
+
+func (h *afterOnlyHook) AfterEvaluation(ctx context.Context, eval *rulesengine.HookEvaluation, result *rulesengine.CheckFlagResult) {
+	h.eval, h.result = eval, result
+}
+
+// cancelingHook cancels the evaluation's context after the first rule.
+type cancelingHook struct {
+	rulesengine.NoopHook
+	cancel context.CancelFunc
+	rules  int
+}
+
+func (h *cancelingHook) AfterRule(ctx context.Context, eval *rulesengine.HookEvaluation, rule *rulesengine.Rule, matched bool) {
+	h.rules++
+	h.cancel()
+}
+
+func newRecordingHooks(names ...string) ([]*recordingHook, *[]string) {
+	var mu sync.Mutex
+	log := []string{}
+	hooks := make([]*recordingHook, len(names))
+	for i, name := range names {
+		hooks[i] = &recordingHook{name: name, mu: &mu, log: &log}
+	}
+	return hooks, &log
+}
+
+func TestEvaluationHooks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Hooks are invoked in stage and registration order", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		flag.DefaultValue = false
+
+		missRule := createTestRule()
+		missRule.Priority = 1
+		missCondition := createTestCondition(rulesengine.ConditionTypeCompany)
+		missCondition.ResourceIDs = []string{"other-company"}
+		missRule.Conditions = []*rulesengine.Condition{missCondition}
+
+		hitRule := createTestRule()
+		hitRule.Priority = 2
+		hitCondition := createTestCondition(rulesengine.ConditionTypeCompany)
+		hitCondition.ResourceIDs = []string{company.ID}
+		hitRule.Conditions = []*rulesengine.Condition{hitCondition}
+
+		flag.Rules = []*rulesengine.Rule{hitRule, missRule}
+
+		hooks, log := newRecordingHooks("a", "b")
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(hooks[0], hooks[1]))
+
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+		assert.Equal(t, []string{
+			"a:before",
+			"b:before",
+			fmt.Sprintf("a:rule=%s matched=false", missRule.ID),
+			fmt.Sprintf("b:rule=%s matched=false", missRule.ID),
+			fmt.Sprintf("a:rule=%s matched=true", hitRule.ID),
+			fmt.Sprintf("b:rule=%s matched=true", hitRule.ID),
+			"a:after value=true",
+			"b:after value=true",
+		}, *log)
+	})
+
+	t.Run("OnError runs before AfterEvaluation when the evaluation fails", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		condition.MetricValue = nil
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		hooks, log := newRecordingHooks("a")
+		_, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(hooks[0]))
+
+		require.Error(t, err)
+		assert.Equal(t, []string{"a:before", "a:error", fmt.Sprintf("a:after value=%t", flag.DefaultValue)}, *log)
+	})
+
+	t.Run("Errors handled by the error policy do not reach OnError", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		condition.MetricValue = nil
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		hooks, log := newRecordingHooks("a")
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(hooks[0]), rulesengine.WithErrorPolicy(rulesengine.ErrorPolicySkipRule))
+
+		require.NoError(t, err)
+		assert.Len(t, result.SkippedErrors, 1)
+		assert.Equal(t, []string{"a:before", fmt.Sprintf("a:after value=%t", flag.DefaultValue)}, *log)
+	})
+
+	t.Run("BeforeEvaluation error aborts with the default value", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		flag.DefaultValue = false
+
+		rule := createTestRule()
+		rule.RuleType = rulesengine.RuleTypeGlobalOverride
+		rule.Value = true
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		killSwitch := errors.New("kill switch engaged")
+		hooks, log := newRecordingHooks("kill", "other")
+		hooks[0].beforeErr = killSwitch
+
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(hooks[0], hooks[1]))
+
+		require.NoError(t, err)
+		assert.False(t, result.Value)
+		assert.Equal(t, rulesengine.ReasonEvaluationAborted, result.Reason)
+		assert.Equal(t, killSwitch, result.Err)
+		assert.Nil(t, result.RuleID)
+		assert.Equal(t, []string{"kill:before", "kill:error", "other:error", "kill:after value=false", "other:after value=false"}, *log)
+	})
+
+	t.Run("Every stage runs when the evaluation ends early", func(t *testing.T) {
+		company := createTestCompany()
+		invalidFlag := createTestFlag()
+		invalidRule := createTestRule()
+		invalidRule.RuleType = "unknown"
+		invalidFlag.Rules = []*rulesengine.Rule{invalidRule}
+
+		for name, check := range map[string]func(hook rulesengine.EvaluationHook) error{
+			"invalid options": func(hook rulesengine.EvaluationHook) error {
+				_, err := rulesengine.CheckFlag(ctx, company, nil, createTestFlag(), rulesengine.WithHooks(hook), rulesengine.WithUsage(-1))
+				return err
+			},
+			"invalid input": func(hook rulesengine.EvaluationHook) error {
+				_, err := rulesengine.CheckFlag(ctx, company, nil, invalidFlag, rulesengine.WithHooks(hook), rulesengine.WithValidation())
+				return err
+			},
+			"missing flag": func(hook rulesengine.EvaluationHook) error {
+				_, err := rulesengine.CheckFlag(ctx, company, nil, nil, rulesengine.WithHooks(hook))
+				return err
+			},
+		} {
+			hooks, log := newRecordingHooks("a")
+			_ = check(hooks[0])
+
+			require.Len(t, *log, 3, name)
+			assert.Equal(t, []string{"a:before", "a:error"}, (*log)[:2], name)
+		}
+	})
+
+	t.Run("AfterRule is not reported for inactive rules", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		inactive := createTestRule()
+		inactive.Priority = 1
+		inactive.EndsAt = null.Nullable(time.Now().Add(-time.Hour))
+		active := createTestRule()
+		active.Priority = 2
+		flag.Rules = []*rulesengine.Rule{inactive, active}
+
+		hooks, log := newRecordingHooks("a")
+		_, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(hooks[0]))
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"a:before",
+			fmt.Sprintf("a:rule=%s matched=true", active.ID),
+			fmt.Sprintf("a:after value=%t", active.Value),
+		}, *log)
+	})
+
+	t.Run("Panicking hooks do not affect the evaluation", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		flag.DefaultValue = false
+
+		rule := createTestRule()
+		rule.RuleType = rulesengine.RuleTypeGlobalOverride
+		rule.Value = true
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		hooks, log := newRecordingHooks("a")
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(panickingHook{}, hooks[0]))
+
+		require.NoError(t, err)
+		assert.Equal(t, &rule.ID, result.RuleID)
+		assert.Len(t, *log, 3)
+	})
+
+	t.Run("NoopHook can be embedded to implement a single stage", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		hook := &afterOnlyHook{}
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(hook))
+
+		require.NoError(t, err)
+		assert.Same(t, result, hook.result)
+	})
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Engine hooks run before per-call hooks", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		hooks, log := newRecordingHooks("engine", "call")
+		engine := rulesengine.NewEngine(rulesengine.WithHooks(hooks[0]))
+
+		_, err := engine.CheckFlag(ctx, company, nil, flag, rulesengine.WithHooks(hooks[1]))
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"engine:before",
+			"call:before",
+			fmt.Sprintf("engine:after value=%t", flag.DefaultValue),
+			fmt.Sprintf("call:after value=%t", flag.DefaultValue),
+		}, *log)
+	})
+
+	t.Run("Engine keeps its own copy of the hooks", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		recording, log := newRecordingHooks("engine", "replaced")
+		hooks := []rulesengine.EvaluationHook{recording[0]}
+		engine := rulesengine.NewEngine(rulesengine.WithHooks(hooks...))
+		hooks[0] = recording[1]
+
+		_, err := engine.CheckFlag(ctx, company, nil, flag)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"engine:before", fmt.Sprintf("engine:after value=%t", flag.DefaultValue)}, *log)
+	})
+
+	t.Run("Engine options apply to every call", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		engine := rulesengine.NewEngine(rulesengine.WithUsage(-1))
+
+		for i := 0; i < 2; i++ {
+			_, err := engine.CheckFlag(ctx, company, nil, flag)
+			assert.Equal(t, rulesengine.ErrorNegativePreflightUsage, err)
+		}
+	})
+
+	t.Run("Nil engine behaves like CheckFlag", func(t *testing.T) {
+		var engine *rulesengine.Engine
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		result, err := engine.CheckFlag(ctx, company, nil, flag)
+
+		require.NoError(t, err)
+		assert.Equal(t, flag.DefaultValue, result.Value)
+	})
+}
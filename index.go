@@ -0,0 +1,208 @@
+package rulesengine
+
+import (
+	"sync/atomic"
+)
+
+// sliceIndex maps keys to positions in a slice. It remembers the backing
+// array and length of the slice it was built from, so lookups can tell when
+// the slice has been reassigned, appended to or truncated and rebuild it.
+type sliceIndex[K comparable] struct {
+	first any
+	len   int
+	byKey map[K]int
+}
+
+// current reports whether the index was built from s.
+func (i *sliceIndex[K]) current(first any, n int) bool {
+	return i != nil && i.len == n && i.first == first
+}
+
+// lazyIndex is a sliceIndex over a model's slice. The model's mutators
+// store the index of every slice they produce; a slice assigned directly is
+// indexed on its first lookup, and again whenever it is reassigned or its
+// length changes. Lookups trust the index, so an element replaced or changed
+// in place is only found under its new key once the slice itself changes or
+// a mutator runs; a hit is still checked against the element it points at,
+// so a stale key is never returned. It is safe for concurrent lookups.
+type lazyIndex[K comparable, E any] struct {
+	index atomic.Value // *sliceIndex[K]
+}
+
+// lookup returns the position of the first element of s with key, and
+// whether there is one. keyOf returns an element's key, or false for
+// elements that can't be looked up, such as nil ones.
+func (l *lazyIndex[K, E]) lookup(s []E, key K, keyOf func(E) (K, bool)) (int, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+
+	index := l.current(s, keyOf)
+	pos, ok := index.byKey[key]
+	if !ok {
+		return 0, false
+	}
+
+	// The element has been replaced or changed in place since the index was
+	// built; rebuild rather than return it under a key it no longer has.
+	if k, valid := keyOf(s[pos]); !valid || k != key {
+		index = l.build(s, keyOf)
+		pos, ok = index.byKey[key]
+	}
+	return pos, ok
+}
+
+// current returns the index of s, building it if needed. s must not be
+// empty.
+func (l *lazyIndex[K, E]) current(s []E, keyOf func(E) (K, bool)) *sliceIndex[K] {
+	index, _ := l.index.Load().(*sliceIndex[K])
+	if !index.current(any(&s[0]), len(s)) {
+		index = l.build(s, keyOf)
+	}
+	return index
+}
+
+// shareWith gives dst the index of s, building it if needed, for a model
+// sharing s.
+func (l *lazyIndex[K, E]) shareWith(dst *lazyIndex[K, E], s []E, keyOf func(E) (K, bool)) {
+	if len(s) == 0 {
+		return
+	}
+	dst.index.Store(l.current(s, keyOf))
+}
+
+// build indexes s and stores the index.
+func (l *lazyIndex[K, E]) build(s []E, keyOf func(E) (K, bool)) *sliceIndex[K] {
+	index := newSliceIndex(s, keyOf)
+	l.store(s, index.byKey)
+	return index
+}
+
+// store sets the index of s, a slice a mutator is about to assign, to
+// byKey. byKey must not be modified afterwards: snapshots share it.
+func (l *lazyIndex[K, E]) store(s []E, byKey map[K]int) {
+	if len(s) == 0 {
+		l.index.Store((*sliceIndex[K])(nil))
+		return
+	}
+	l.index.Store(&sliceIndex[K]{first: any(&s[0]), len: len(s), byKey: byKey})
+}
+
+// newSliceIndex indexes s from scratch. Mutators use it rather than the
+// stored index, so that the slices they produce are keyed correctly even
+// after elements were written directly.
+func newSliceIndex[K comparable, E any](s []E, keyOf func(E) (K, bool)) *sliceIndex[K] {
+	index := &sliceIndex[K]{len: len(s), byKey: make(map[K]int, len(s)+1)}
+	if len(s) > 0 {
+		index.first = any(&s[0])
+	}
+	for pos, e := range s {
+		key, ok := keyOf(e)
+		if !ok {
+			continue
+		}
+		if _, seen := index.byKey[key]; !seen {
+			index.byKey[key] = pos
+		}
+	}
+	return index
+}
+
+// companyMetricKey is the unique key of a company metric.
+type companyMetricKey struct {
+	eventSubtype string
+	period       MetricPeriod
+	monthReset   MetricPeriodMonthReset
+}
+
+// newCompanyMetricKey returns the key for a metric lookup, defaulting the
+// period to all_time and the month reset to first_of_month as
+// CompanyMetricCollection.Find does.
+func newCompanyMetricKey(eventSubtype string, period *MetricPeriod, monthReset *MetricPeriodMonthReset) companyMetricKey {
+	key := companyMetricKey{eventSubtype: eventSubtype, period: MetricPeriodAllTime, monthReset: MetricPeriodMonthResetFirst}
+	if period != nil {
+		key.period = *period
+	}
+	if monthReset != nil {
+		key.monthReset = *monthReset
+	}
+	return key
+}
+
+func metricKeyOf(metric *CompanyMetric) (companyMetricKey, bool) {
+	if metric == nil {
+		return companyMetricKey{}, false
+	}
+	return companyMetricKey{eventSubtype: metric.EventSubtype, period: metric.Period, monthReset: metric.MonthReset}, true
+}
+
+func traitKeyOf(trait *Trait) (string, bool) {
+	if trait == nil || trait.TraitDefinition == nil {
+		return "", false
+	}
+	return trait.TraitDefinition.ID, true
+}
+
+// traitIndex indexes a model's traits by definition ID.
+type traitIndex = lazyIndex[string, *Trait]
+
+// metricIndex indexes a company's metrics by event subtype, period and month
+// reset.
+type metricIndex = lazyIndex[companyMetricKey, *CompanyMetric]
+
+// FindMetric returns the company's metric for the event subtype, period and
+// month reset, or nil if it has none. A nil period means all_time and a nil
+// month reset first_of_month. Unlike Metrics.Find, it looks the metric up in
+// the company's index rather than scanning; see lazyIndex for when changes
+// made directly to Metrics become visible.
+func (c *Company) FindMetric(eventSubtype string, period *MetricPeriod, monthReset *MetricPeriodMonthReset) *CompanyMetric {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	metrics := c.Metrics
+	pos, ok := c.metricIndex.lookup(metrics, newCompanyMetricKey(eventSubtype, period, monthReset), metricKeyOf)
+	if !ok {
+		return nil
+	}
+	return metrics[pos]
+}
+
+// FindTrait returns the company's trait with the definition ID, or nil if it
+// has none, using an index of Traits; see lazyIndex for when changes made
+// directly to Traits become visible.
+func (c *Company) FindTrait(definitionID string) *Trait {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return findIndexedTrait(&c.traitIndex, c.Traits, definitionID)
+}
+
+// FindTrait returns the user's trait with the definition ID, or nil if it
+// has none, using an index of Traits; see lazyIndex for when changes made
+// directly to Traits become visible.
+func (u *User) FindTrait(definitionID string) *Trait {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return findIndexedTrait(&u.traitIndex, u.Traits, definitionID)
+}
+
+func findIndexedTrait(index *traitIndex, traits []*Trait, definitionID string) *Trait {
+	pos, ok := index.lookup(traits, definitionID, traitKeyOf)
+	if !ok {
+		return nil
+	}
+	return traits[pos]
+}
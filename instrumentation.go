@@ -0,0 +1,136 @@
+package rulesengine
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Attribute keys recorded on evaluation spans and metrics.
+const (
+	AttributeFlagID   = "rulesengine.flag.id"
+	AttributeFlagKey  = "rulesengine.flag.key"
+	AttributeReason   = "rulesengine.reason"
+	AttributeRuleID   = "rulesengine.rule.id"
+	AttributeRuleType = "rulesengine.rule.type"
+	AttributeValue    = "rulesengine.value"
+)
+
+// SpanNameCheckFlag is the name of the span recorded around each CheckFlag.
+const SpanNameCheckFlag = "rulesengine.CheckFlag"
+
+// Attribute is a key/value pair attached to spans and metric recordings.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Tracer starts spans around flag evaluations. The returned context is the
+// one passed down to the rest of the evaluation, including hooks.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced evaluation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Meter records evaluation counters and latency.
+type Meter interface {
+	// AddEvaluation counts one completed evaluation.
+	AddEvaluation(ctx context.Context, attrs ...Attribute)
+	// AddError counts one evaluation that returned an error.
+	AddError(ctx context.Context, attrs ...Attribute)
+	// RecordLatency records how long an evaluation took.
+	RecordLatency(ctx context.Context, duration time.Duration, attrs ...Attribute)
+}
+
+// WithTracer records a span for the evaluation using tracer.
+func WithTracer(tracer Tracer) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		if tracer != nil {
+			o.tracer = tracer
+		}
+	}
+}
+
+// WithMeter records evaluation counters and latency using meter.
+func WithMeter(meter Meter) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		if meter != nil {
+			o.meter = meter
+		}
+	}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+
+func (noopSpan) RecordError(err error) {}
+
+func (noopSpan) End() {}
+
+type noopMeter struct{}
+
+func (noopMeter) AddEvaluation(ctx context.Context, attrs ...Attribute) {}
+
+func (noopMeter) AddError(ctx context.Context, attrs ...Attribute) {}
+
+func (noopMeter) RecordLatency(ctx context.Context, duration time.Duration, attrs ...Attribute) {}
+
+// recordEvaluation annotates span and records metrics for a finished
+// evaluation. Span attributes carry the full detail of the decision; metric
+// attributes are restricted to low-cardinality values (flag key and matched
+// rule type) so they are safe to aggregate.
+func recordEvaluation(
+	ctx context.Context,
+	span Span,
+	meter Meter,
+	result *CheckFlagResult,
+	err error,
+	duration time.Duration,
+) {
+	metricAttrs := []Attribute{}
+	spanAttrs := []Attribute{}
+	if result != nil {
+		ruleType := ""
+		if result.RuleType != nil {
+			ruleType = string(*result.RuleType)
+		}
+		metricAttrs = append(metricAttrs,
+			Attribute{Key: AttributeFlagKey, Value: result.FlagKey},
+			Attribute{Key: AttributeRuleType, Value: ruleType},
+		)
+
+		spanAttrs = append(spanAttrs, metricAttrs...)
+		spanAttrs = append(spanAttrs,
+			Attribute{Key: AttributeReason, Value: result.Reason},
+			Attribute{Key: AttributeValue, Value: strconv.FormatBool(result.Value)},
+		)
+		if result.FlagID != nil {
+			spanAttrs = append(spanAttrs, Attribute{Key: AttributeFlagID, Value: *result.FlagID})
+		}
+		if result.RuleID != nil {
+			spanAttrs = append(spanAttrs, Attribute{Key: AttributeRuleID, Value: *result.RuleID})
+		}
+	}
+
+	span.SetAttributes(spanAttrs...)
+	if err != nil {
+		span.RecordError(err)
+		meter.AddError(ctx, metricAttrs...)
+	}
+
+	meter.AddEvaluation(ctx, metricAttrs...)
+	meter.RecordLatency(ctx, duration, metricAttrs...)
+}
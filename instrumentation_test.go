@@ -0,0 +1,181 @@
+package rulesengine_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spanCtxKey struct{}
+
+type memorySpan struct {
+	name  string
+	attrs map[string]string
+	errs  []error
+	ended bool
+}
+
+func (s *memorySpan) SetAttributes(attrs ...rulesengine.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *memorySpan) RecordError(err error) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *memorySpan) End() {
+	s.ended = true
+}
+
+type memoryTracer struct {
+	spans []*memorySpan
+}
+
+func (t *memoryTracer) Start(ctx context.Context, name string) (context.Context, rulesengine.Span) {
+	span := &memorySpan{name: name, attrs: map[string]string{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanCtxKey{}, span), span
+}
+
+type memoryMeter struct {
+	mu          sync.Mutex
+	evaluations []map[string]string
+	errors      []map[string]string
+	latencies   []time.Duration
+}
+
+func attrMap(attrs []rulesengine.Attribute) map[string]string {
+	m := map[string]string{}
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value
+	}
+	return m
+}
+
+func (m *memoryMeter) AddEvaluation(ctx context.Context, attrs ...rulesengine.Attribute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evaluations = append(m.evaluations, attrMap(attrs))
+}
+
+func (m *memoryMeter) AddError(ctx context.Context, attrs ...rulesengine.Attribute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, attrMap(attrs))
+}
+
+func (m *memoryMeter) RecordLatency(ctx context.Context, duration time.Duration, attrs ...rulesengine.Attribute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies = append(m.latencies, duration)
+}
+
+type spanContextHook struct {
+	rulesengine.NoopHook
+	span any
+}
+
+func (h *spanContextHook) BeforeEvaluation(ctx context.Context, eval *rulesengine.HookEvaluation) error {
+	h.span = ctx.Value(spanCtxKey{})
+	return nil
+}
+
+func TestInstrumentation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Records a span with the matched rule", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+		condition.ResourceIDs = []string{company.ID}
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		tracer := &memoryTracer{}
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithTracer(tracer))
+
+		require.NoError(t, err)
+		require.Len(t, tracer.spans, 1)
+		span := tracer.spans[0]
+		assert.Equal(t, rulesengine.SpanNameCheckFlag, span.name)
+		assert.True(t, span.ended)
+		assert.Empty(t, span.errs)
+		assert.Equal(t, flag.Key, span.attrs[rulesengine.AttributeFlagKey])
+		assert.Equal(t, flag.ID, span.attrs[rulesengine.AttributeFlagID])
+		assert.Equal(t, rule.ID, span.attrs[rulesengine.AttributeRuleID])
+		assert.Equal(t, string(rulesengine.RuleTypeStandard), span.attrs[rulesengine.AttributeRuleType])
+		assert.Equal(t, result.Reason, span.attrs[rulesengine.AttributeReason])
+		assert.Equal(t, "true", span.attrs[rulesengine.AttributeValue])
+	})
+
+	t.Run("Span context is propagated to hooks", func(t *testing.T) {
+		tracer := &memoryTracer{}
+		hook := &spanContextHook{}
+
+		_, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, createTestFlag(), rulesengine.WithTracer(tracer), rulesengine.WithHooks(hook))
+
+		require.NoError(t, err)
+		require.Len(t, tracer.spans, 1)
+		assert.Same(t, tracer.spans[0], hook.span)
+	})
+
+	t.Run("Records counters and latency", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		meter := &memoryMeter{}
+
+		for i := 0; i < 3; i++ {
+			_, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithMeter(meter))
+			require.NoError(t, err)
+		}
+
+		assert.Len(t, meter.evaluations, 3)
+		assert.Empty(t, meter.errors)
+		assert.Len(t, meter.latencies, 3)
+		assert.Equal(t, map[string]string{
+			rulesengine.AttributeFlagKey:  flag.Key,
+			rulesengine.AttributeRuleType: "",
+		}, meter.evaluations[0])
+	})
+
+	t.Run("Records errors on span and meter", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		condition.MetricValue = nil
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		tracer := &memoryTracer{}
+		meter := &memoryMeter{}
+		_, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithTracer(tracer), rulesengine.WithMeter(meter))
+
+		require.Error(t, err)
+		require.Len(t, tracer.spans, 1)
+		assert.Equal(t, []error{err}, tracer.spans[0].errs)
+		assert.Len(t, meter.errors, 1)
+		assert.Len(t, meter.evaluations, 1)
+	})
+
+	t.Run("Records result errors that are not returned", func(t *testing.T) {
+		tracer := &memoryTracer{}
+		meter := &memoryMeter{}
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, nil, rulesengine.WithTracer(tracer), rulesengine.WithMeter(meter))
+
+		require.NoError(t, err)
+		require.Len(t, tracer.spans, 1)
+		assert.True(t, errors.Is(tracer.spans[0].errs[0], result.Err))
+		assert.Len(t, meter.errors, 1)
+	})
+}
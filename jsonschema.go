@@ -0,0 +1,244 @@
+package rulesengine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSONSchemaDialect is the JSON Schema draft the generated schemas declare.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is a JSON Schema document or subschema. Only the keywords the
+// generator emits are modeled.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 any                    `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           *orderedSchemaMap      `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+// orderedSchemaMap preserves struct field order when marshaling properties,
+// so generated schemas are stable and diff cleanly.
+type orderedSchemaMap struct {
+	keys   []string
+	values map[string]*JSONSchema
+}
+
+func (m *orderedSchemaMap) set(key string, value *JSONSchema) {
+	if m.values == nil {
+		m.values = map[string]*JSONSchema{}
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the schema for a property.
+func (m *orderedSchemaMap) Get(key string) *JSONSchema {
+	if m == nil {
+		return nil
+	}
+	return m.values[key]
+}
+
+func (m *orderedSchemaMap) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+	errorDetailType   = reflect.TypeOf(ErrorDetail{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// GenerateJSONSchema reflects over the struct type of v and returns a JSON
+// Schema describing its wire form. Named struct types are emitted once under
+// $defs and referenced elsewhere.
+//
+// The schema follows the package's JSON conventions:
+//   - `binding:"oneof=..."` tags become enums
+//   - `desc` tags become descriptions
+//   - pointer fields are nullable, and fields tagged omitempty are optional
+//   - JSONSlice fields are non-null arrays, since nil serializes as []
+func GenerateJSONSchema(v any) *JSONSchema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	g := &schemaGenerator{defs: map[string]*JSONSchema{}}
+	root := g.schemaFor(t, false)
+
+	return &JSONSchema{
+		Schema: JSONSchemaDialect,
+		Title:  t.Name(),
+		Ref:    root.Ref,
+		Defs:   g.defs,
+	}
+}
+
+// ModelJSONSchemas returns schemas for the top-level wire models, keyed by
+// type name. These are the types hashed into VersionKey.
+func ModelJSONSchemas() map[string]*JSONSchema {
+	return map[string]*JSONSchema{
+		"CheckFlagResult": GenerateJSONSchema(CheckFlagResult{}),
+		"Company":         GenerateJSONSchema(Company{}),
+		"Flag":            GenerateJSONSchema(Flag{}),
+		"User":            GenerateJSONSchema(User{}),
+	}
+}
+
+type schemaGenerator struct {
+	defs map[string]*JSONSchema
+}
+
+// schemaFor returns the schema for t. When nullable is set, null is added to
+// the permitted types.
+func (g *schemaGenerator) schemaFor(t reflect.Type, nullable bool) *JSONSchema {
+	if t.Kind() == reflect.Ptr {
+		return g.schemaFor(t.Elem(), true)
+	}
+
+	var schema *JSONSchema
+	switch {
+	case t == timeType:
+		schema = &JSONSchema{Type: "string", Format: "date-time"}
+	case t == errorType:
+		// CheckFlagResult.Err, the only error field, is marshaled as an
+		// ErrorDetail.
+		return g.schemaFor(errorDetailType, nullable)
+	case t.Kind() == reflect.Slice && t.Implements(jsonMarshalerType):
+		// JSONSlice (and CompanyMetricCollection, which follows the same
+		// contract) marshals nil as [], so the array itself is never null.
+		return &JSONSchema{Type: "array", Items: g.elemSchemaFor(t.Elem())}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			schema = &JSONSchema{Type: "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			schema = &JSONSchema{Type: "integer"}
+		case reflect.Float32, reflect.Float64:
+			schema = &JSONSchema{Type: "number"}
+		case reflect.String:
+			schema = &JSONSchema{Type: "string"}
+		case reflect.Slice, reflect.Array:
+			// A nil plain slice marshals as null.
+			schema = &JSONSchema{Type: "array", Items: g.elemSchemaFor(t.Elem())}
+			nullable = nullable || t.Kind() == reflect.Slice
+		case reflect.Map:
+			// A nil map marshals as null.
+			schema = &JSONSchema{Type: "object", AdditionalProperties: g.elemSchemaFor(t.Elem())}
+			nullable = true
+		case reflect.Struct:
+			return g.refFor(t, nullable)
+		default:
+			return &JSONSchema{}
+		}
+	}
+
+	if nullable {
+		schema.Type = []string{schema.Type.(string), "null"}
+	}
+	return schema
+}
+
+// elemSchemaFor returns the schema for slice and map elements. Elements are
+// pointers so the models can share them, not because they can be null, so
+// they are not made nullable.
+func (g *schemaGenerator) elemSchemaFor(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return g.schemaFor(t, false)
+}
+
+// refFor registers t under $defs and returns a reference to it.
+func (g *schemaGenerator) refFor(t reflect.Type, nullable bool) *JSONSchema {
+	name := t.Name()
+	if _, ok := g.defs[name]; !ok {
+		// Reserve the name before recursing so self-referential types
+		// terminate.
+		g.defs[name] = &JSONSchema{}
+		g.defs[name] = g.structSchema(t)
+	}
+
+	ref := &JSONSchema{Ref: "#/$defs/" + name}
+	if nullable {
+		return &JSONSchema{AnyOf: []*JSONSchema{ref, {Type: "null"}}}
+	}
+	return ref
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *JSONSchema {
+	schema := &JSONSchema{Type: "object", Properties: &orderedSchemaMap{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := jsonFieldName(field)
+		if name == "" {
+			continue
+		}
+
+		fieldSchema := g.schemaFor(field.Type, false)
+
+		if values := parseBindingOneOf(field.Tag); values != nil {
+			enum := make([]any, 0, len(values)+1)
+			for _, value := range values {
+				enum = append(enum, value)
+			}
+			if field.Type.Kind() == reflect.Ptr {
+				enum = append(enum, nil)
+			}
+			fieldSchema.Enum = enum
+		}
+
+		if desc := field.Tag.Get("desc"); desc != "" {
+			fieldSchema.Description = desc
+		}
+
+		schema.Properties.set(name, fieldSchema)
+
+		if !strings.Contains(field.Tag.Get("json"), ",omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
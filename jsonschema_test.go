@@ -0,0 +1,95 @@
+package rulesengine_test
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateSchemas = flag.Bool("update-schemas", false, "rewrite the JSON Schema files in schemas/")
+
+func TestModelJSONSchemas(t *testing.T) {
+	for name, schema := range rulesengine.ModelJSONSchemas() {
+		t.Run(name, func(t *testing.T) {
+			got, err := json.MarshalIndent(schema, "", "  ")
+			require.NoError(t, err)
+			got = append(got, '\n')
+
+			path := filepath.Join("schemas", name+".schema.json")
+			if *updateSchemas {
+				require.NoError(t, os.WriteFile(path, got, 0o644))
+			}
+
+			want, err := os.ReadFile(path)
+			require.NoError(t, err, "run `go test -run TestModelJSONSchemas -update-schemas` to generate")
+			assert.Equal(t, string(want), string(got), "schema is out of date; run `go test -run TestModelJSONSchemas -update-schemas`")
+		})
+	}
+}
+
+func TestGenerateJSONSchema(t *testing.T) {
+	schema := rulesengine.GenerateJSONSchema(&rulesengine.Company{})
+	defs := schema.Defs
+
+	t.Run("Root references its definition", func(t *testing.T) {
+		assert.Equal(t, rulesengine.JSONSchemaDialect, schema.Schema)
+		assert.Equal(t, "Company", schema.Title)
+		assert.Equal(t, "#/$defs/Company", schema.Ref)
+		require.Contains(t, defs, "Company")
+	})
+
+	t.Run("JSONSlice fields are non-null arrays", func(t *testing.T) {
+		planIDs := defs["Company"].Properties.Get("plan_ids")
+		require.NotNil(t, planIDs)
+		assert.Equal(t, "array", planIDs.Type)
+		assert.Equal(t, "string", planIDs.Items.Type)
+
+		metrics := defs["Company"].Properties.Get("metrics")
+		assert.Equal(t, "array", metrics.Type)
+		assert.Equal(t, "#/$defs/CompanyMetric", metrics.Items.Ref)
+	})
+
+	t.Run("Maps and pointers are nullable", func(t *testing.T) {
+		assert.Equal(t, []string{"object", "null"}, defs["Company"].Properties.Get("credit_balances").Type)
+		assert.Equal(t, []string{"string", "null"}, defs["Company"].Properties.Get("base_plan_id").Type)
+
+		subscription := defs["Company"].Properties.Get("subscription")
+		require.Len(t, subscription.AnyOf, 2)
+		assert.Equal(t, "#/$defs/Subscription", subscription.AnyOf[0].Ref)
+		assert.Equal(t, "null", subscription.AnyOf[1].Type)
+	})
+
+	t.Run("Binding tags become enums", func(t *testing.T) {
+		period := defs["CompanyMetric"].Properties.Get("period")
+		assert.Equal(t, []any{"all_time", "current_day", "current_month", "current_week"}, period.Enum)
+
+		optionalPeriod := defs["FeatureEntitlement"].Properties.Get("metric_period")
+		assert.Equal(t, []any{"all_time", "current_day", "current_month", "current_week", nil}, optionalPeriod.Enum)
+	})
+
+	t.Run("Desc tags become descriptions", func(t *testing.T) {
+		featureID := defs["FeatureEntitlement"].Properties.Get("feature_id")
+		assert.Equal(t, "The ID of the feature", featureID.Description)
+	})
+
+	t.Run("Omitempty fields are optional", func(t *testing.T) {
+		assert.Contains(t, defs["Company"].Required, "id")
+		assert.NotContains(t, defs["Company"].Required, "entitlements")
+	})
+
+	t.Run("Unexported fields are skipped", func(t *testing.T) {
+		assert.Nil(t, defs["Company"].Properties.Get("mu"))
+	})
+
+	t.Run("Times are date-time strings", func(t *testing.T) {
+		createdAt := defs["CompanyMetric"].Properties.Get("created_at")
+		assert.Equal(t, "string", createdAt.Type)
+		assert.Equal(t, "date-time", createdAt.Format)
+	})
+}
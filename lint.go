@@ -0,0 +1,555 @@
+package rulesengine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/schematichq/rulesengine/set"
+	"github.com/schematichq/rulesengine/typeconvert"
+)
+
+type LintCode string
+
+const (
+	// A condition or combination of conditions can never be satisfied, so
+	// the rule can never match.
+	LintCodeContradictoryConditions LintCode = "contradictory_conditions"
+	// Conditions on a rule type that ignores conditions.
+	LintCodeIgnoredConditions LintCode = "ignored_conditions"
+	// An activation window ends before it starts, so it is never active.
+	LintCodeEmptyActiveWindow LintCode = "empty_active_window"
+	// A field the condition type relies on is not set.
+	LintCodeMissingField LintCode = "missing_field"
+	// An earlier rule always matches, so this rule is never evaluated.
+	LintCodeUnreachableRule LintCode = "unreachable_rule"
+	// An enum field holds a value the engine doesn't recognize.
+	LintCodeUnknownValue LintCode = "unknown_value"
+)
+
+type LintSeverity string
+
+const (
+	// The rule will never behave as configured, or will fail evaluation.
+	LintSeverityError LintSeverity = "error"
+	// The configuration is legal but probably not what was intended.
+	LintSeverityWarning LintSeverity = "warning"
+)
+
+// LintIssue describes a single problem found in a flag's rules. Path locates
+// the offending value using JSON field names, e.g.
+// `rules[1].conditions[0].metric_value`.
+type LintIssue struct {
+	Code        LintCode     `json:"code"`
+	ConditionID string       `json:"condition_id,omitempty"`
+	Message     string       `json:"message"`
+	Path        string       `json:"path"`
+	RuleID      string       `json:"rule_id,omitempty"`
+	Severity    LintSeverity `json:"severity"`
+}
+
+func (i *LintIssue) String() string {
+	return fmt.Sprintf("%s: %s [%s] %s", i.Severity, i.Path, i.Code, i.Message)
+}
+
+// LintOption configures LintFlag and LintRule.
+type LintOption func(*lintOptions)
+
+type lintOptions struct {
+	conditions *ConditionRegistry
+}
+
+func newLintOptions(opts []LintOption) *lintOptions {
+	options := &lintOptions{conditions: DefaultConditions}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithLintConditionRegistry makes the condition types registered on registry
+// known rather than those on DefaultConditions; pass the registry the flag is
+// evaluated with. A nil registry means DefaultConditions.
+func WithLintConditionRegistry(registry *ConditionRegistry) LintOption {
+	return func(o *lintOptions) {
+		if registry == nil {
+			registry = DefaultConditions
+		}
+		o.conditions = registry
+	}
+}
+
+// LintFlag statically analyzes a flag's rules and reports rules that can
+// never match, either because an earlier rule in RuleTypePriority order
+// always matches or because their conditions contradict each other, as well
+// as missing required fields and unknown enum values. Condition types
+// registered on DefaultConditions are known, unless
+// WithLintConditionRegistry names another registry.
+//
+// Only the flag's own rules are considered; company- and user-provided rules
+// merged in at evaluation time can shadow further rules but can never make an
+// unreachable rule reachable.
+func LintFlag(flag *Flag, opts ...LintOption) []*LintIssue {
+	if flag == nil {
+		return nil
+	}
+
+	options := newLintOptions(opts)
+
+	unreachable := unreachableRules(flag.Rules)
+
+	var issues []*LintIssue
+	if isEmptyActiveWindow(flag.StartsAt, flag.EndsAt) {
+		issues = append(issues, &LintIssue{
+			Code:     LintCodeEmptyActiveWindow,
+			Message:  "flag ends_at is not after starts_at; the flag always evaluates to its default value",
+			Path:     "ends_at",
+			Severity: LintSeverityError,
+		})
+	}
+
+	for i, rule := range flag.Rules {
+		if rule == nil {
+			continue
+		}
+
+		path := fmt.Sprintf("rules[%d]", i)
+		issues = append(issues, lintRule(path, rule, options)...)
+
+		if shadowedBy, ok := unreachable[rule]; ok {
+			issues = append(issues, &LintIssue{
+				Code:     LintCodeUnreachableRule,
+				Message:  fmt.Sprintf("rule is never evaluated because %s rule %q (%s) always matches first", shadowedBy.RuleType.DisplayName(), shadowedBy.Name, shadowedBy.ID),
+				Path:     path,
+				RuleID:   rule.ID,
+				Severity: LintSeverityError,
+			})
+		}
+	}
+
+	return issues
+}
+
+// LintRule analyzes a single rule in isolation. Paths are relative to the
+// rule.
+func LintRule(rule *Rule, opts ...LintOption) []*LintIssue {
+	if rule == nil {
+		return nil
+	}
+
+	issues := lintRule("", rule, newLintOptions(opts))
+	for _, issue := range issues {
+		issue.Path = strings.TrimPrefix(issue.Path, ".")
+	}
+	return issues
+}
+
+// unreachableRules walks the rules in evaluation order and returns, for each
+// rule that can never be reached, the rule that always matches before it.
+func unreachableRules(rules []*Rule) map[*Rule]*Rule {
+	unreachable := map[*Rule]*Rule{}
+
+	nonNil := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		if rule != nil {
+			nonNil = append(nonNil, rule)
+		}
+	}
+
+	var shadowing *Rule
+	for _, group := range GroupRulesByPriority(nonNil) {
+		for _, rule := range group {
+			if shadowing != nil {
+				unreachable[rule] = shadowing
+				continue
+			}
+
+			if ruleAlwaysMatches(rule) {
+				shadowing = rule
+			}
+		}
+	}
+
+	return unreachable
+}
+
+// ruleAlwaysMatches mirrors RuleCheckService.Check: override and default rules
+// match unconditionally, and so does any rule without conditions, unless an
+// activation window makes them inactive some of the time.
+func ruleAlwaysMatches(rule *Rule) bool {
+	if rule.StartsAt != nil || rule.EndsAt != nil {
+		return false
+	}
+
+	if rule.RuleType == RuleTypeGlobalOverride || rule.RuleType == RuleTypeDefault {
+		return true
+	}
+
+	return len(rule.Conditions) == 0 && len(rule.ConditionGroups) == 0
+}
+
+func lintRule(path string, rule *Rule, options *lintOptions) []*LintIssue {
+	l := &ruleLinter{rule: rule, conditions: options.conditions}
+
+	if !bindingOneOf(rule, "RuleType").Contains(string(rule.RuleType)) {
+		l.add(LintCodeUnknownValue, LintSeverityError, path+".rule_type", nil,
+			fmt.Sprintf("unknown rule type %q; the rule is never evaluated", rule.RuleType))
+	}
+
+	if isEmptyActiveWindow(rule.StartsAt, rule.EndsAt) {
+		l.add(LintCodeEmptyActiveWindow, LintSeverityError, path+".ends_at", nil,
+			"ends_at is not after starts_at; the rule is never active")
+	}
+
+	if (rule.RuleType == RuleTypeGlobalOverride || rule.RuleType == RuleTypeDefault) &&
+		(len(rule.Conditions) > 0 || len(rule.ConditionGroups) > 0) {
+		l.add(LintCodeIgnoredConditions, LintSeverityWarning, path, nil,
+			fmt.Sprintf("%s rules always match; their conditions are ignored", rule.RuleType.DisplayName()))
+	}
+
+	// Top-level conditions are AND'd together, and so is a condition group
+	// with a single condition, so all of these are checked for contradictions
+	// as one set.
+	var conjunction []*Condition
+	for i, condition := range rule.Conditions {
+		if condition == nil {
+			continue
+		}
+		l.lintCondition(fmt.Sprintf("%s.conditions[%d]", path, i), condition)
+		conjunction = append(conjunction, condition)
+	}
+
+	for i, group := range rule.ConditionGroups {
+		groupPath := fmt.Sprintf("%s.condition_groups[%d]", path, i)
+		if group == nil || len(group.Conditions) == 0 {
+			l.add(LintCodeContradictoryConditions, LintSeverityError, groupPath, nil,
+				"condition group has no conditions and can never match")
+			continue
+		}
+
+		for j, condition := range group.Conditions {
+			if condition == nil {
+				continue
+			}
+			l.lintCondition(fmt.Sprintf("%s.conditions[%d]", groupPath, j), condition)
+		}
+
+		if len(group.Conditions) == 1 && group.Conditions[0] != nil {
+			conjunction = append(conjunction, group.Conditions[0])
+		}
+	}
+
+	for _, message := range contradictions(conjunction) {
+		l.add(LintCodeContradictoryConditions, LintSeverityError, path, nil, message)
+	}
+
+	return l.issues
+}
+
+type ruleLinter struct {
+	rule       *Rule
+	conditions *ConditionRegistry
+	issues     []*LintIssue
+}
+
+func (l *ruleLinter) add(code LintCode, severity LintSeverity, path string, condition *Condition, message string) {
+	issue := &LintIssue{
+		Code:     code,
+		Message:  message,
+		Path:     path,
+		RuleID:   l.rule.ID,
+		Severity: severity,
+	}
+	if condition != nil {
+		issue.ConditionID = condition.ID
+	}
+
+	l.issues = append(l.issues, issue)
+}
+
+func (l *ruleLinter) lintCondition(path string, condition *Condition) {
+	if _, ok := l.conditions.Evaluator(condition.ConditionType); !ok {
+		l.add(LintCodeUnknownValue, LintSeverityError, path+".condition_type", condition,
+			fmt.Sprintf("unknown condition type %q; the condition never matches", condition.ConditionType))
+	}
+
+	if !bindingOneOf(condition, "Operator").Contains(string(condition.Operator)) {
+		l.add(LintCodeUnknownValue, LintSeverityError, path+".operator", condition,
+			fmt.Sprintf("unknown operator %q", condition.Operator))
+	}
+
+	if condition.MetricPeriod != nil && !bindingOneOf(condition, "MetricPeriod").Contains(string(*condition.MetricPeriod)) {
+		l.add(LintCodeUnknownValue, LintSeverityError, path+".metric_period", condition,
+			fmt.Sprintf("unknown metric period %q", *condition.MetricPeriod))
+	}
+
+	if condition.MetricPeriodMonthReset != nil && !bindingOneOf(condition, "MetricPeriodMonthReset").Contains(string(*condition.MetricPeriodMonthReset)) {
+		l.add(LintCodeUnknownValue, LintSeverityError, path+".metric_period_month_reset", condition,
+			fmt.Sprintf("unknown metric period month reset %q", *condition.MetricPeriodMonthReset))
+	}
+
+	l.lintTraitDefinition(path+".trait_definition", condition, condition.TraitDefinition)
+	l.lintTraitDefinition(path+".comparison_trait_definition", condition, condition.ComparisonTraitDefinition)
+
+	switch condition.ConditionType {
+	case ConditionTypeMetric:
+		if condition.EventSubtype == nil {
+			l.add(LintCodeMissingField, LintSeverityError, path+".event_subtype", condition,
+				"metric condition has no event_subtype and can never match")
+		}
+		if condition.MetricValue == nil {
+			l.add(LintCodeMissingField, LintSeverityError, path+".metric_value", condition,
+				"metric condition has no metric_value; evaluation will fail")
+		}
+	case ConditionTypeCredit:
+		if condition.CreditID == nil {
+			l.add(LintCodeMissingField, LintSeverityError, path+".credit_id", condition,
+				"credit condition has no credit_id and can never match")
+		}
+	case ConditionTypeTrait:
+		if condition.TraitDefinition == nil {
+			l.add(LintCodeMissingField, LintSeverityError, path+".trait_definition", condition,
+				"trait condition has no trait_definition and can never match")
+		}
+	case ConditionTypeCompany, ConditionTypeUser, ConditionTypePlan, ConditionTypePlanVersion, ConditionTypeBillingProduct:
+		if len(condition.ResourceIDs) == 0 && condition.Operator != typeconvert.ComparableOperatorNotEquals {
+			l.add(LintCodeMissingField, LintSeverityError, path+".resource_ids", condition,
+				fmt.Sprintf("%s condition has no resource_ids and can never match", condition.ConditionType))
+		}
+	case ConditionTypeBasePlan:
+		switch condition.Operator {
+		case typeconvert.ComparableOperatorEquals:
+			if len(condition.ResourceIDs) == 0 {
+				l.add(LintCodeMissingField, LintSeverityError, path+".resource_ids", condition,
+					"base_plan condition has no resource_ids and can never match")
+			}
+		case typeconvert.ComparableOperatorNotEquals, typeconvert.ComparableOperatorIsEmpty, typeconvert.ComparableOperatorNotEmpty:
+		default:
+			l.add(LintCodeContradictoryConditions, LintSeverityError, path+".operator", condition,
+				fmt.Sprintf("operator %q never matches a base_plan condition", condition.Operator))
+		}
+	}
+}
+
+func (l *ruleLinter) lintTraitDefinition(path string, condition *Condition, def *TraitDefinition) {
+	if def == nil {
+		return
+	}
+
+	if !bindingOneOf(def, "ComparableType").Contains(string(def.ComparableType)) {
+		l.add(LintCodeUnknownValue, LintSeverityError, path+".comparable_type", condition,
+			fmt.Sprintf("unknown comparable type %q", def.ComparableType))
+	}
+
+	if !bindingOneOf(def, "EntityType").Contains(string(def.EntityType)) {
+		l.add(LintCodeUnknownValue, LintSeverityError, path+".entity_type", condition,
+			fmt.Sprintf("unknown entity type %q; the condition never matches", def.EntityType))
+	}
+}
+
+// contradictions returns a message for each group of AND'd conditions that
+// can't be satisfied together.
+func contradictions(conditions []*Condition) []string {
+	var messages []string
+
+	// Resource conditions on single-valued attributes: a company has one ID
+	// and at most one base plan.
+	for _, conditionType := range []ConditionType{ConditionTypeCompany, ConditionTypeUser, ConditionTypeBasePlan} {
+		if message := singleValuedContradiction(conditionType, conditions); message != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	// Resource conditions on multi-valued attributes: an "eq" needs an
+	// overlap with the resource IDs that a "ne" forbids.
+	for _, conditionType := range []ConditionType{ConditionTypePlan, ConditionTypePlanVersion, ConditionTypeBillingProduct} {
+		if message := multiValuedContradiction(conditionType, conditions); message != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	messages = append(messages, numericContradictions(conditions)...)
+
+	return messages
+}
+
+func singleValuedContradiction(conditionType ConditionType, conditions []*Condition) string {
+	var allowed set.Set[string]
+	excluded := set.NewSet[string]()
+	requireEmpty, requirePresent := false, false
+
+	for _, condition := range conditions {
+		if condition.ConditionType != conditionType {
+			continue
+		}
+
+		switch {
+		case conditionType == ConditionTypeBasePlan && condition.Operator == typeconvert.ComparableOperatorIsEmpty:
+			requireEmpty = true
+		case conditionType == ConditionTypeBasePlan && condition.Operator == typeconvert.ComparableOperatorNotEmpty:
+			requirePresent = true
+		case condition.Operator == typeconvert.ComparableOperatorNotEquals:
+			excluded.Add(condition.ResourceIDs...)
+		case conditionType == ConditionTypeBasePlan && condition.Operator != typeconvert.ComparableOperatorEquals:
+			// Other operators never match; reported per condition.
+		default:
+			requirePresent = true
+			ids := set.NewSet(condition.ResourceIDs...)
+			if allowed == nil {
+				allowed = ids
+			} else {
+				allowed = allowed.Intersection(ids)
+			}
+		}
+	}
+
+	if requireEmpty && requirePresent {
+		return fmt.Sprintf("%s conditions require the value to be both empty and present", conditionType)
+	}
+
+	if allowed != nil && allowed.Difference(excluded).Len() == 0 {
+		return fmt.Sprintf("%s conditions have no resource ID that satisfies all of them", conditionType)
+	}
+
+	return ""
+}
+
+func multiValuedContradiction(conditionType ConditionType, conditions []*Condition) string {
+	excluded := set.NewSet[string]()
+	var required []set.Set[string]
+
+	for _, condition := range conditions {
+		if condition.ConditionType != conditionType {
+			continue
+		}
+
+		if condition.Operator == typeconvert.ComparableOperatorNotEquals {
+			excluded.Add(condition.ResourceIDs...)
+		} else {
+			required = append(required, set.NewSet(condition.ResourceIDs...))
+		}
+	}
+
+	for _, ids := range required {
+		if ids.Len() > 0 && ids.Difference(excluded).Len() == 0 {
+			return fmt.Sprintf("%s conditions require a resource ID that another condition excludes", conditionType)
+		}
+	}
+
+	return ""
+}
+
+// int64Range is an inclusive range of values that satisfies a set of numeric
+// comparisons against the same left-hand value.
+type int64Range struct {
+	label    string
+	lo, hi   int64
+	excluded set.Set[int64]
+}
+
+func (r *int64Range) apply(operator typeconvert.ComparableOperator, v int64) {
+	switch operator {
+	case typeconvert.ComparableOperatorEquals:
+		r.lo = max(r.lo, v)
+		r.hi = min(r.hi, v)
+	case typeconvert.ComparableOperatorNotEquals:
+		r.excluded.Add(v)
+	case typeconvert.ComparableOperatorGt:
+		if v == math.MaxInt64 {
+			r.lo, r.hi = 1, 0
+		} else {
+			r.lo = max(r.lo, v+1)
+		}
+	case typeconvert.ComparableOperatorGte:
+		r.lo = max(r.lo, v)
+	case typeconvert.ComparableOperatorLt:
+		if v == math.MinInt64 {
+			r.lo, r.hi = 1, 0
+		} else {
+			r.hi = min(r.hi, v-1)
+		}
+	case typeconvert.ComparableOperatorLte:
+		r.hi = min(r.hi, v)
+	case typeconvert.ComparableOperatorIsEmpty:
+		r.lo = max(r.lo, 0)
+		r.hi = min(r.hi, 0)
+	case typeconvert.ComparableOperatorNotEmpty:
+		r.lo = max(r.lo, 1)
+	}
+}
+
+func (r *int64Range) empty() bool {
+	if r.lo > r.hi {
+		return true
+	}
+
+	return r.lo == r.hi && r.excluded.Contains(r.lo)
+}
+
+// numericContradictions finds metric and int trait conditions on the same
+// value whose comparisons against fixed numbers can't all hold. Preflight
+// usage shifts every comparison on a value by the same amount, so it can't
+// resolve a contradiction.
+func numericContradictions(conditions []*Condition) []string {
+	ranges := map[string]*int64Range{}
+	var order []string
+
+	rangeFor := func(key, label string) *int64Range {
+		if r, ok := ranges[key]; ok {
+			return r
+		}
+		r := &int64Range{label: label, lo: math.MinInt64, hi: math.MaxInt64, excluded: set.NewSet[int64]()}
+		ranges[key] = r
+		order = append(order, key)
+		return r
+	}
+
+	for _, condition := range conditions {
+		if condition.ComparisonTraitDefinition != nil {
+			continue
+		}
+
+		switch condition.ConditionType {
+		case ConditionTypeMetric:
+			if condition.EventSubtype == nil || condition.MetricValue == nil {
+				continue
+			}
+
+			period := MetricPeriodAllTime
+			if condition.MetricPeriod != nil {
+				period = *condition.MetricPeriod
+			}
+			monthReset := MetricPeriodMonthResetFirst
+			if condition.MetricPeriodMonthReset != nil {
+				monthReset = *condition.MetricPeriodMonthReset
+			}
+
+			key := fmt.Sprintf("metric/%s/%s/%s", *condition.EventSubtype, period, monthReset)
+			rangeFor(key, fmt.Sprintf("metric %q", *condition.EventSubtype)).apply(condition.Operator, *condition.MetricValue)
+		case ConditionTypeTrait:
+			def := condition.TraitDefinition
+			if def == nil || def.ComparableType != typeconvert.ComparableTypeInt {
+				continue
+			}
+
+			key := fmt.Sprintf("trait/%s", def.ID)
+			rangeFor(key, fmt.Sprintf("trait %q", def.ID)).apply(condition.Operator, typeconvert.StringToInt64(condition.TraitValue))
+		}
+	}
+
+	var messages []string
+	for _, key := range order {
+		if r := ranges[key]; r.empty() {
+			messages = append(messages, fmt.Sprintf("%s conditions can't all be satisfied by the same value", r.label))
+		}
+	}
+
+	return messages
+}
+
+// isEmptyActiveWindow reports whether an activation window with both bounds
+// set contains no instant.
+func isEmptyActiveWindow(startsAt, endsAt *time.Time) bool {
+	return startsAt != nil && endsAt != nil && !endsAt.After(*startsAt)
+}
@@ -0,0 +1,377 @@
+package rulesengine_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/null"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func issueCodes(issues []*rulesengine.LintIssue) []rulesengine.LintCode {
+	codes := make([]rulesengine.LintCode, len(issues))
+	for i, issue := range issues {
+		codes[i] = issue.Code
+	}
+	return codes
+}
+
+func TestLintFlag(t *testing.T) {
+	t.Run("Clean flag has no issues", func(t *testing.T) {
+		flag := createTestFlag()
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+		condition.ResourceIDs = []string{"comp_1"}
+		rule.Conditions = []*rulesengine.Condition{condition}
+
+		defaultRule := createTestRule()
+		defaultRule.RuleType = rulesengine.RuleTypeDefault
+		defaultRule.Conditions = nil
+		flag.Rules = []*rulesengine.Rule{rule, defaultRule}
+
+		assert.Empty(t, rulesengine.LintFlag(flag))
+	})
+
+	t.Run("Nil flag has no issues", func(t *testing.T) {
+		assert.Nil(t, rulesengine.LintFlag(nil))
+	})
+
+	t.Run("Unreachable rules", func(t *testing.T) {
+		t.Run("Standard rule shadowed by an earlier unconditional rule", func(t *testing.T) {
+			flag := createTestFlag()
+			catchAll := createTestRule()
+			catchAll.Priority = 1
+
+			shadowed := createTestRule()
+			shadowed.Priority = 2
+			condition := createTestCondition(rulesengine.ConditionTypeCompany)
+			condition.ResourceIDs = []string{"comp_1"}
+			shadowed.Conditions = []*rulesengine.Condition{condition}
+
+			flag.Rules = []*rulesengine.Rule{shadowed, catchAll}
+
+			issues := rulesengine.LintFlag(flag)
+
+			require.Len(t, issues, 1)
+			assert.Equal(t, rulesengine.LintCodeUnreachableRule, issues[0].Code)
+			assert.Equal(t, shadowed.ID, issues[0].RuleID)
+			assert.Equal(t, "rules[0]", issues[0].Path)
+			assert.Contains(t, issues[0].Message, catchAll.ID)
+		})
+
+		t.Run("Global override shadows every other rule type", func(t *testing.T) {
+			flag := createTestFlag()
+			override := createTestRule()
+			override.RuleType = rulesengine.RuleTypeGlobalOverride
+
+			entitlement := createTestRule()
+			entitlement.RuleType = rulesengine.RuleTypePlanEntitlement
+			condition := createTestCondition(rulesengine.ConditionTypePlan)
+			condition.ResourceIDs = []string{"plan_1"}
+			entitlement.Conditions = []*rulesengine.Condition{condition}
+
+			defaultRule := createTestRule()
+			defaultRule.RuleType = rulesengine.RuleTypeDefault
+
+			flag.Rules = []*rulesengine.Rule{entitlement, defaultRule, override}
+
+			issues := rulesengine.LintFlag(flag)
+
+			assert.Equal(t, []rulesengine.LintCode{rulesengine.LintCodeUnreachableRule, rulesengine.LintCodeUnreachableRule}, issueCodes(issues))
+			assert.Equal(t, entitlement.ID, issues[0].RuleID)
+			assert.Equal(t, defaultRule.ID, issues[1].RuleID)
+		})
+
+		t.Run("Scheduled rules do not shadow later rules", func(t *testing.T) {
+			flag := createTestFlag()
+			override := createTestRule()
+			override.RuleType = rulesengine.RuleTypeGlobalOverride
+			endsAt := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+			override.EndsAt = &endsAt
+
+			defaultRule := createTestRule()
+			defaultRule.RuleType = rulesengine.RuleTypeDefault
+
+			flag.Rules = []*rulesengine.Rule{override, defaultRule}
+
+			assert.Empty(t, rulesengine.LintFlag(flag))
+		})
+
+		t.Run("Later priority group is not shadowed by a conditional rule", func(t *testing.T) {
+			flag := createTestFlag()
+			first := createTestRule()
+			condition := createTestCondition(rulesengine.ConditionTypeCompany)
+			condition.ResourceIDs = []string{"comp_1"}
+			first.Conditions = []*rulesengine.Condition{condition}
+
+			defaultRule := createTestRule()
+			defaultRule.RuleType = rulesengine.RuleTypeDefault
+
+			flag.Rules = []*rulesengine.Rule{first, defaultRule}
+
+			assert.Empty(t, rulesengine.LintFlag(flag))
+		})
+	})
+
+	t.Run("Contradictory conditions", func(t *testing.T) {
+		lintConditions := func(conditions ...*rulesengine.Condition) []*rulesengine.LintIssue {
+			rule := createTestRule()
+			rule.Conditions = conditions
+			return rulesengine.LintRule(rule)
+		}
+
+		t.Run("Base plan is_empty and eq", func(t *testing.T) {
+			empty := createTestCondition(rulesengine.ConditionTypeBasePlan)
+			empty.Operator = typeconvert.ComparableOperatorIsEmpty
+			eq := createTestCondition(rulesengine.ConditionTypeBasePlan)
+			eq.ResourceIDs = []string{"plan_1"}
+
+			issues := lintConditions(empty, eq)
+
+			require.Len(t, issues, 1)
+			assert.Equal(t, rulesengine.LintCodeContradictoryConditions, issues[0].Code)
+			assert.Equal(t, rulesengine.LintSeverityError, issues[0].Severity)
+		})
+
+		t.Run("Company eq disjoint resource IDs", func(t *testing.T) {
+			a := createTestCondition(rulesengine.ConditionTypeCompany)
+			a.ResourceIDs = []string{"comp_1"}
+			b := createTestCondition(rulesengine.ConditionTypeCompany)
+			b.ResourceIDs = []string{"comp_2"}
+
+			assert.Equal(t, []rulesengine.LintCode{rulesengine.LintCodeContradictoryConditions}, issueCodes(lintConditions(a, b)))
+		})
+
+		t.Run("Company eq and ne the same ID", func(t *testing.T) {
+			a := createTestCondition(rulesengine.ConditionTypeCompany)
+			a.ResourceIDs = []string{"comp_1"}
+			b := createTestCondition(rulesengine.ConditionTypeCompany)
+			b.Operator = typeconvert.ComparableOperatorNotEquals
+			b.ResourceIDs = []string{"comp_1", "comp_2"}
+
+			assert.Equal(t, []rulesengine.LintCode{rulesengine.LintCodeContradictoryConditions}, issueCodes(lintConditions(a, b)))
+		})
+
+		t.Run("Plan eq disjoint resource IDs is satisfiable", func(t *testing.T) {
+			a := createTestCondition(rulesengine.ConditionTypePlan)
+			a.ResourceIDs = []string{"plan_1"}
+			b := createTestCondition(rulesengine.ConditionTypePlan)
+			b.ResourceIDs = []string{"plan_2"}
+
+			assert.Empty(t, lintConditions(a, b))
+		})
+
+		t.Run("Plan eq subset of plan ne", func(t *testing.T) {
+			a := createTestCondition(rulesengine.ConditionTypePlan)
+			a.ResourceIDs = []string{"plan_1"}
+			b := createTestCondition(rulesengine.ConditionTypePlan)
+			b.Operator = typeconvert.ComparableOperatorNotEquals
+			b.ResourceIDs = []string{"plan_1"}
+
+			assert.Equal(t, []rulesengine.LintCode{rulesengine.LintCodeContradictoryConditions}, issueCodes(lintConditions(a, b)))
+		})
+
+		t.Run("Metric range with no solution", func(t *testing.T) {
+			lt := createTestCondition(rulesengine.ConditionTypeMetric)
+			lt.Operator = typeconvert.ComparableOperatorLt
+			lt.MetricValue = null.Nullable(int64(5))
+
+			gt := createTestCondition(rulesengine.ConditionTypeMetric)
+			gt.EventSubtype = lt.EventSubtype
+			gt.Operator = typeconvert.ComparableOperatorGte
+			gt.MetricValue = null.Nullable(int64(5))
+
+			issues := lintConditions(lt, gt)
+
+			require.Len(t, issues, 1)
+			assert.Contains(t, issues[0].Message, *lt.EventSubtype)
+		})
+
+		t.Run("Metric ranges on different periods are independent", func(t *testing.T) {
+			lt := createTestCondition(rulesengine.ConditionTypeMetric)
+			lt.Operator = typeconvert.ComparableOperatorLt
+			lt.MetricValue = null.Nullable(int64(5))
+
+			gt := createTestCondition(rulesengine.ConditionTypeMetric)
+			gt.EventSubtype = lt.EventSubtype
+			gt.MetricPeriod = null.Nullable(rulesengine.MetricPeriodCurrentMonth)
+			gt.Operator = typeconvert.ComparableOperatorGt
+			gt.MetricValue = null.Nullable(int64(10))
+
+			assert.Empty(t, lintConditions(lt, gt))
+		})
+
+		t.Run("Int trait eq and ne the same value", func(t *testing.T) {
+			eq := createTestCondition(rulesengine.ConditionTypeTrait)
+			eq.TraitValue = "3"
+			ne := createTestCondition(rulesengine.ConditionTypeTrait)
+			ne.TraitDefinition = eq.TraitDefinition
+			ne.Operator = typeconvert.ComparableOperatorNotEquals
+			ne.TraitValue = "3"
+
+			assert.Equal(t, []rulesengine.LintCode{rulesengine.LintCodeContradictoryConditions}, issueCodes(lintConditions(eq, ne)))
+		})
+
+		t.Run("Single-condition groups are AND'd with top-level conditions", func(t *testing.T) {
+			a := createTestCondition(rulesengine.ConditionTypeUser)
+			a.ResourceIDs = []string{"user_1"}
+			b := createTestCondition(rulesengine.ConditionTypeUser)
+			b.ResourceIDs = []string{"user_2"}
+
+			rule := createTestRule()
+			rule.Conditions = []*rulesengine.Condition{a}
+			rule.ConditionGroups = []*rulesengine.ConditionGroup{{Conditions: []*rulesengine.Condition{b}}}
+
+			assert.Equal(t, []rulesengine.LintCode{rulesengine.LintCodeContradictoryConditions}, issueCodes(rulesengine.LintRule(rule)))
+		})
+
+		t.Run("Empty condition group", func(t *testing.T) {
+			rule := createTestRule()
+			rule.ConditionGroups = []*rulesengine.ConditionGroup{{}}
+
+			issues := rulesengine.LintRule(rule)
+
+			require.Len(t, issues, 1)
+			assert.Equal(t, "condition_groups[0]", issues[0].Path)
+		})
+	})
+
+	t.Run("Missing fields", func(t *testing.T) {
+		t.Run("Metric condition without metric value", func(t *testing.T) {
+			flag := createTestFlag()
+			rule := createTestRule()
+			condition := createTestCondition(rulesengine.ConditionTypeMetric)
+			condition.MetricValue = nil
+			rule.Conditions = []*rulesengine.Condition{condition}
+			flag.Rules = []*rulesengine.Rule{rule}
+
+			issues := rulesengine.LintFlag(flag)
+
+			require.Len(t, issues, 1)
+			assert.Equal(t, rulesengine.LintCodeMissingField, issues[0].Code)
+			assert.Equal(t, "rules[0].conditions[0].metric_value", issues[0].Path)
+			assert.Equal(t, condition.ID, issues[0].ConditionID)
+			assert.Equal(t, rule.ID, issues[0].RuleID)
+		})
+
+		t.Run("Credit condition without credit ID", func(t *testing.T) {
+			rule := createTestRule()
+			condition := createTestCondition(rulesengine.ConditionTypeCredit)
+			rule.ConditionGroups = []*rulesengine.ConditionGroup{{Conditions: []*rulesengine.Condition{createTestCondition(rulesengine.ConditionTypeCredit), condition}}}
+			rule.ConditionGroups[0].Conditions[0].CreditID = null.Nullable("credit_1")
+
+			issues := rulesengine.LintRule(rule)
+
+			require.Len(t, issues, 1)
+			assert.Equal(t, "condition_groups[0].conditions[1].credit_id", issues[0].Path)
+		})
+
+		t.Run("Resource condition without resource IDs", func(t *testing.T) {
+			rule := createTestRule()
+			rule.Conditions = []*rulesengine.Condition{createTestCondition(rulesengine.ConditionTypePlanVersion)}
+
+			assert.Equal(t, []rulesengine.LintCode{rulesengine.LintCodeMissingField}, issueCodes(rulesengine.LintRule(rule)))
+		})
+	})
+
+	t.Run("Unknown values", func(t *testing.T) {
+		t.Run("Misspelled condition type", func(t *testing.T) {
+			rule := createTestRule()
+			condition := createTestCondition("metrc")
+			rule.Conditions = []*rulesengine.Condition{condition}
+
+			issues := rulesengine.LintRule(rule)
+
+			require.Len(t, issues, 1)
+			assert.Equal(t, rulesengine.LintCodeUnknownValue, issues[0].Code)
+			assert.Equal(t, "conditions[0].condition_type", issues[0].Path)
+		})
+
+		t.Run("Condition types registered on another registry", func(t *testing.T) {
+			flag, _, _ := customConditionFlag(conditionTypeAllowlist, "10.0.0.1")
+			registry := rulesengine.NewConditionRegistry()
+			registry.MustRegister(conditionTypeAllowlist, allowlistEvaluator)
+
+			issues := rulesengine.LintFlag(flag)
+			require.Len(t, issues, 1)
+			assert.Equal(t, "rules[0].conditions[0].condition_type", issues[0].Path)
+
+			assert.Empty(t, rulesengine.LintFlag(flag, rulesengine.WithLintConditionRegistry(registry)))
+			assert.Empty(t, rulesengine.LintRule(flag.Rules[0], rulesengine.WithLintConditionRegistry(registry)))
+		})
+
+		t.Run("Unknown rule type, operator, period and trait enums", func(t *testing.T) {
+			rule := createTestRule()
+			rule.RuleType = "experiment"
+
+			metric := createTestCondition(rulesengine.ConditionTypeMetric)
+			metric.Operator = "between"
+			metric.MetricPeriod = null.Nullable(rulesengine.MetricPeriod("current_year"))
+			metric.MetricPeriodMonthReset = null.Nullable(rulesengine.MetricPeriodMonthReset("last_of_month"))
+
+			trait := createTestCondition(rulesengine.ConditionTypeTrait)
+			trait.TraitDefinition.ComparableType = "float"
+			trait.TraitDefinition.EntityType = "account"
+
+			rule.Conditions = []*rulesengine.Condition{metric, trait}
+
+			var paths []string
+			for _, issue := range rulesengine.LintRule(rule) {
+				assert.Equal(t, rulesengine.LintCodeUnknownValue, issue.Code)
+				paths = append(paths, issue.Path)
+			}
+			assert.Equal(t, []string{
+				"rule_type",
+				"conditions[0].operator",
+				"conditions[0].metric_period",
+				"conditions[0].metric_period_month_reset",
+				"conditions[1].trait_definition.comparable_type",
+				"conditions[1].trait_definition.entity_type",
+			}, paths)
+		})
+	})
+
+	t.Run("Empty activation windows", func(t *testing.T) {
+		startsAt := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+		endsAt := startsAt.Add(-time.Hour)
+
+		flag := createTestFlag()
+		flag.StartsAt = &startsAt
+		flag.EndsAt = &startsAt
+		rule := createTestRule()
+		rule.StartsAt = &startsAt
+		rule.EndsAt = &endsAt
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		issues := rulesengine.LintFlag(flag)
+
+		require.Len(t, issues, 2)
+		assert.Equal(t, rulesengine.LintCodeEmptyActiveWindow, issues[0].Code)
+		assert.Equal(t, "ends_at", issues[0].Path)
+		assert.Empty(t, issues[0].RuleID)
+		assert.Equal(t, rulesengine.LintCodeEmptyActiveWindow, issues[1].Code)
+		assert.Equal(t, "rules[0].ends_at", issues[1].Path)
+		assert.Equal(t, rule.ID, issues[1].RuleID)
+
+		rule.EndsAt = nil
+		flag.EndsAt = nil
+		assert.Empty(t, rulesengine.LintFlag(flag))
+	})
+
+	t.Run("Conditions on override rules are reported as ignored", func(t *testing.T) {
+		rule := createTestRule()
+		rule.RuleType = rulesengine.RuleTypeGlobalOverride
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+		condition.ResourceIDs = []string{"comp_1"}
+		rule.Conditions = []*rulesengine.Condition{condition}
+
+		issues := rulesengine.LintRule(rule)
+
+		require.Len(t, issues, 1)
+		assert.Equal(t, rulesengine.LintCodeIgnoredConditions, issues[0].Code)
+		assert.Equal(t, rulesengine.LintSeverityWarning, issues[0].Severity)
+	})
+}
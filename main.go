@@ -6,52 +6,120 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"syscall/js"
 )
 
+// WasmInput is the payload of the legacy checkFlag global.
 type WasmInput struct {
-	Company Company `json:"company"`
-	User    User    `json:"user"`
-	Flag    Flag    `json:"flag"`
+	Company *Company `json:"company"`
+	User    *User    `json:"user"`
+	Flag    *Flag    `json:"flag"`
 }
 
+// WasmOutput is the response of the legacy checkFlag global.
 type WasmOutput struct {
 	Result *CheckFlagResult `json:"result"`
 	Error  string           `json:"error,omitempty"`
 }
 
-func checkFlag(this js.Value, args []js.Value) interface{} {
-	input := args[0].String()
+// wasmGlobal is the name of the object the versioned bridge API is
+// installed under.
+const wasmGlobal = "schematicRulesEngine"
 
-	var wasmInput WasmInput
-	json.Unmarshal([]byte(input), &wasmInput)
-
-	result, err := CheckFlag(context.Background(), &wasmInput.Company, &wasmInput.User, &wasmInput.Flag)
+// legacyCheckFlag serves the original checkFlag global, whose response
+// carries errors as a plain string. New hosts should use the bridge API.
+func legacyCheckFlag(input string) string {
+	var output WasmOutput
 
-	output := WasmOutput{
-		Result: result,
-		Error:  "",
-	}
-	if err != nil {
+	var wasmInput WasmInput
+	if err := decodeBridgePayload([]byte(input), &wasmInput); err != nil {
 		output.Error = err.Error()
+	} else if wasmInput.Flag == nil {
+		output.Error = newBridgeInputError("flag is required").Error()
+	} else {
+		result, err := CheckFlag(context.Background(), wasmInput.Company, wasmInput.User, wasmInput.Flag)
+		output.Result = result
+		if err != nil {
+			output.Error = err.Error()
+		}
 	}
 
 	outputBytes, _ := json.Marshal(output)
 	return string(outputBytes)
 }
 
+// wasmMethod adapts a bridge method to a JS function taking an optional JSON
+// string and returning the JSON response string.
+func wasmMethod(method string) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) any {
+		var payload []byte
+		if len(args) > 0 && args[0].Type() == js.TypeString {
+			payload = []byte(args[0].String())
+		}
+		return string(BridgeCall(context.Background(), method, payload))
+	})
+}
+
 func main() {
-	c := make(chan struct{}, 0)
-	js.Global().Set("checkFlag", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+	var funcs []js.Func
+	register := func(target js.Value, name string, fn js.Func) {
+		funcs = append(funcs, fn)
+		target.Set(name, fn)
+	}
+
+	api := js.Global().Get("Object").New()
+	api.Set("apiVersion", BridgeAPIVersion)
+	api.Set("versionKey", VersionKey)
+
+	register(api, "call", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) == 0 || args[0].Type() != js.TypeString {
+			return string(BridgeCall(context.Background(), "", nil))
+		}
+
+		var payload []byte
+		if len(args) > 1 && args[1].Type() == js.TypeString {
+			payload = []byte(args[1].String())
+		}
+		return string(BridgeCall(context.Background(), args[0].String(), payload))
+	}))
+	for method := range bridgeHandlers {
+		if method == BridgeMethodAPIVersion || method == BridgeMethodVersionKey {
+			continue
+		}
+		register(api, method, wasmMethod(method))
+	}
+
+	register(js.Global(), "checkFlag", js.FuncOf(func(this js.Value, args []js.Value) (result any) {
 		defer func() {
 			if r := recover(); r != nil {
-				fmt.Printf("Recovered from panic: %v\n", r)
+				output, _ := json.Marshal(WasmOutput{Error: fmt.Sprintf("%s: panic: %v", BridgeErrorInternal, r)})
+				result = string(output)
 			}
 		}()
 
-		return checkFlag(this, args)
+		if len(args) == 0 || args[0].Type() != js.TypeString {
+			output, _ := json.Marshal(WasmOutput{Error: newBridgeInputError("expected a JSON string argument").Error()})
+			return string(output)
+		}
+		return legacyCheckFlag(args[0].String())
 	}))
 
-	// go program stays running
-	<-c
+	// The module runs until the host calls close(), after which the
+	// functions are released and the Go program exits.
+	done := make(chan struct{})
+	var closeOnce sync.Once
+	register(api, "close", js.FuncOf(func(this js.Value, args []js.Value) any {
+		closeOnce.Do(func() { close(done) })
+		return nil
+	}))
+	js.Global().Set(wasmGlobal, api)
+
+	<-done
+
+	js.Global().Delete(wasmGlobal)
+	js.Global().Delete("checkFlag")
+	for _, fn := range funcs {
+		fn.Release()
+	}
 }
@@ -0,0 +1,339 @@
+package rulesengine
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"reflect"
+	"strings"
+)
+
+// VersionManifest is the canonical description of the model structure that
+// VersionKey is derived from. It can be serialized as JSON and stored
+// alongside a release, so tooling can later diff it against the manifest of
+// another release.
+type VersionManifest struct {
+	VersionKey string           `json:"version_key"`
+	Models     []*ModelManifest `json:"models"`
+}
+
+// ModelManifest describes one of the hashed wire models.
+type ModelManifest struct {
+	Model ModelName     `json:"model"`
+	Type  *TypeManifest `json:"type"`
+}
+
+// TypeManifest describes a type the way it is hashed: its name and kind,
+// the exported fields of structs, the element type of slices, arrays and
+// pointers, and the key and element types of maps.
+type TypeManifest struct {
+	Name   string           `json:"name,omitempty"`
+	Kind   string           `json:"kind"`
+	Fields []*FieldManifest `json:"fields,omitempty"`
+	Key    *TypeManifest    `json:"key,omitempty"`
+	Elem   *TypeManifest    `json:"elem,omitempty"`
+}
+
+// FieldManifest describes a struct field, including its full tag.
+type FieldManifest struct {
+	Name string        `json:"name"`
+	Tag  string        `json:"tag,omitempty"`
+	Type *TypeManifest `json:"type"`
+}
+
+// hashedModels lists the models in the order they are hashed.
+var hashedModels = []struct {
+	name ModelName
+	t    reflect.Type
+}{
+	{ModelCompany, reflect.TypeOf((*Company)(nil)).Elem()},
+	{ModelUser, reflect.TypeOf((*User)(nil)).Elem()},
+	{ModelFlag, reflect.TypeOf((*Flag)(nil)).Elem()},
+	{ModelCheckFlagResult, reflect.TypeOf((*CheckFlagResult)(nil)).Elem()},
+}
+
+// GetVersionManifest returns the manifest for the current models.
+func GetVersionManifest() *VersionManifest {
+	manifest := &VersionManifest{}
+	for _, model := range hashedModels {
+		manifest.Models = append(manifest.Models, &ModelManifest{
+			Model: model.name,
+			Type:  newTypeManifest(model.t),
+		})
+	}
+	manifest.VersionKey = manifest.Key()
+
+	return manifest
+}
+
+func newTypeManifest(t reflect.Type) *TypeManifest {
+	// Errors are described by their wire form, so changes to it change the
+	// key.
+	if t == errorType {
+		t = errorDetailType
+	}
+
+	m := &TypeManifest{Name: t.Name(), Kind: t.Kind().String()}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			// Unexported fields, such as locks and lookup indexes, never
+			// reach the wire, so they don't affect cached payloads.
+			if !field.IsExported() {
+				continue
+			}
+			m.Fields = append(m.Fields, &FieldManifest{
+				Name: field.Name,
+				Tag:  string(field.Tag),
+				Type: newTypeManifest(field.Type),
+			})
+		}
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		m.Elem = newTypeManifest(t.Elem())
+	case reflect.Map:
+		m.Key = newTypeManifest(t.Key())
+		m.Elem = newTypeManifest(t.Elem())
+	}
+
+	return m
+}
+
+// Key computes the version key for the manifest. For the manifest of the
+// current models this is VersionKey; for a stored manifest it is the key the
+// release it came from used.
+func (m *VersionManifest) Key() string {
+	hasher := sha256.New()
+	for _, model := range m.Models {
+		model.Type.hash(hasher)
+	}
+
+	// Get first 8 characters of the hash (similar to current format)
+	hash := fmt.Sprintf("%x", hasher.Sum(nil))
+	return hash[:8]
+}
+
+// hash writes the type to hasher. The byte sequence must not change, or
+// every cached payload would be invalidated without any model change.
+func (m *TypeManifest) hash(hasher hash.Hash) {
+	if m == nil {
+		return
+	}
+
+	// Write the type name and kind
+	hasher.Write([]byte(m.Name))
+	hasher.Write([]byte(m.Kind))
+
+	// Only the fields relevant to the kind are set, so they can be written
+	// unconditionally.
+	for _, field := range m.Fields {
+		hasher.Write([]byte(field.Name))
+		hasher.Write([]byte(field.Tag))
+		field.Type.hash(hasher)
+	}
+	m.Key.hash(hasher)
+	m.Elem.hash(hasher)
+}
+
+// String renders the type in Go-like syntax, e.g. `*Subscription` or
+// `map[string]float64`.
+func (m *TypeManifest) String() string {
+	if m == nil {
+		return "<none>"
+	}
+
+	switch {
+	case m.Name != "":
+		return m.Name
+	case m.Kind == reflect.Ptr.String():
+		return "*" + m.Elem.String()
+	case m.Kind == reflect.Slice.String() || m.Kind == reflect.Array.String():
+		return "[]" + m.Elem.String()
+	case m.Kind == reflect.Map.String():
+		return fmt.Sprintf("map[%s]%s", m.Key, m.Elem)
+	default:
+		return m.Kind
+	}
+}
+
+// ManifestChangeKind classifies a difference between two manifests.
+type ManifestChangeKind string
+
+const (
+	ManifestChangeFieldAdded    ManifestChangeKind = "field_added"
+	ManifestChangeFieldRemoved  ManifestChangeKind = "field_removed"
+	ManifestChangeFieldsReorder ManifestChangeKind = "fields_reordered"
+	ManifestChangeModelAdded    ManifestChangeKind = "model_added"
+	ManifestChangeModelRemoved  ManifestChangeKind = "model_removed"
+	ManifestChangeTagChanged    ManifestChangeKind = "tag_changed"
+	ManifestChangeTypeChanged   ManifestChangeKind = "type_changed"
+)
+
+// ManifestChange is one difference between two manifests. Path locates the
+// change from the model down, e.g. `Company.Rules[].Conditions[].Operator`;
+// `[]` steps into slice, array and map elements and `[key]` into map keys.
+type ManifestChange struct {
+	Kind ManifestChangeKind `json:"kind"`
+	Path string             `json:"path"`
+	Old  string             `json:"old,omitempty"`
+	New  string             `json:"new,omitempty"`
+}
+
+func (c *ManifestChange) String() string {
+	switch c.Kind {
+	case ManifestChangeFieldAdded, ManifestChangeModelAdded:
+		return fmt.Sprintf("%s: added (%s)", c.Path, c.New)
+	case ManifestChangeFieldRemoved, ManifestChangeModelRemoved:
+		return fmt.Sprintf("%s: removed (%s)", c.Path, c.Old)
+	case ManifestChangeFieldsReorder:
+		return fmt.Sprintf("%s: fields reordered from [%s] to [%s]", c.Path, c.Old, c.New)
+	case ManifestChangeTagChanged:
+		return fmt.Sprintf("%s: tag changed from `%s` to `%s`", c.Path, c.Old, c.New)
+	default:
+		return fmt.Sprintf("%s: type changed from %s to %s", c.Path, c.Old, c.New)
+	}
+}
+
+// DiffManifests lists every structural difference between two manifests,
+// in model and field order. An empty result means the manifests produce the
+// same version key.
+//
+// Nested types are reported at every path they are reachable from: a change
+// to Condition appears under Company, User and Flag rules alike, since each
+// of those models is affected.
+func DiffManifests(old, new *VersionManifest) []*ManifestChange {
+	var changes []*ManifestChange
+
+	newModels := map[ModelName]*ModelManifest{}
+	for _, model := range new.Models {
+		newModels[model.Model] = model
+	}
+
+	oldModels := map[ModelName]bool{}
+	for _, oldModel := range old.Models {
+		oldModels[oldModel.Model] = true
+
+		newModel, ok := newModels[oldModel.Model]
+		if !ok {
+			changes = append(changes, &ManifestChange{
+				Kind: ManifestChangeModelRemoved,
+				Path: string(oldModel.Model),
+				Old:  oldModel.Type.String(),
+			})
+			continue
+		}
+		changes = diffTypes(changes, string(oldModel.Model), oldModel.Type, newModel.Type)
+	}
+
+	for _, newModel := range new.Models {
+		if !oldModels[newModel.Model] {
+			changes = append(changes, &ManifestChange{
+				Kind: ManifestChangeModelAdded,
+				Path: string(newModel.Model),
+				New:  newModel.Type.String(),
+			})
+		}
+	}
+
+	return changes
+}
+
+func diffTypes(changes []*ManifestChange, path string, old, new *TypeManifest) []*ManifestChange {
+	if old == nil || new == nil {
+		return changes
+	}
+
+	if old.Kind != new.Kind {
+		// Nothing below a kind change is comparable.
+		return append(changes, &ManifestChange{
+			Kind: ManifestChangeTypeChanged,
+			Path: path,
+			Old:  old.String(),
+			New:  new.String(),
+		})
+	}
+
+	if old.Name != new.Name {
+		changes = append(changes, &ManifestChange{
+			Kind: ManifestChangeTypeChanged,
+			Path: path,
+			Old:  old.String(),
+			New:  new.String(),
+		})
+	}
+
+	switch old.Kind {
+	case reflect.Struct.String():
+		return diffFields(changes, path, old.Fields, new.Fields)
+	case reflect.Ptr.String():
+		return diffTypes(changes, path, old.Elem, new.Elem)
+	case reflect.Map.String():
+		changes = diffTypes(changes, path+"[key]", old.Key, new.Key)
+		return diffTypes(changes, path+"[]", old.Elem, new.Elem)
+	case reflect.Slice.String(), reflect.Array.String():
+		return diffTypes(changes, path+"[]", old.Elem, new.Elem)
+	}
+
+	return changes
+}
+
+func diffFields(changes []*ManifestChange, path string, old, new []*FieldManifest) []*ManifestChange {
+	newFields := map[string]*FieldManifest{}
+	for _, field := range new {
+		newFields[field.Name] = field
+	}
+
+	var oldOrder []string
+	oldFields := map[string]bool{}
+	for _, oldField := range old {
+		oldFields[oldField.Name] = true
+		fieldPath := path + "." + oldField.Name
+
+		newField, ok := newFields[oldField.Name]
+		if !ok {
+			changes = append(changes, &ManifestChange{
+				Kind: ManifestChangeFieldRemoved,
+				Path: fieldPath,
+				Old:  oldField.Type.String(),
+			})
+			continue
+		}
+		oldOrder = append(oldOrder, oldField.Name)
+
+		if oldField.Tag != newField.Tag {
+			changes = append(changes, &ManifestChange{
+				Kind: ManifestChangeTagChanged,
+				Path: fieldPath,
+				Old:  oldField.Tag,
+				New:  newField.Tag,
+			})
+		}
+		changes = diffTypes(changes, fieldPath, oldField.Type, newField.Type)
+	}
+
+	var newOrder []string
+	for _, newField := range new {
+		if oldFields[newField.Name] {
+			newOrder = append(newOrder, newField.Name)
+			continue
+		}
+		changes = append(changes, &ManifestChange{
+			Kind: ManifestChangeFieldAdded,
+			Path: path + "." + newField.Name,
+			New:  newField.Type.String(),
+		})
+	}
+
+	// Field order is part of the hash, so a move alone changes the key.
+	if strings.Join(oldOrder, ",") != strings.Join(newOrder, ",") {
+		changes = append(changes, &ManifestChange{
+			Kind: ManifestChangeFieldsReorder,
+			Path: path,
+			Old:  strings.Join(oldOrder, " "),
+			New:  strings.Join(newOrder, " "),
+		})
+	}
+
+	return changes
+}
@@ -0,0 +1,187 @@
+package rulesengine_test
+
+import (
+	"encoding/json"
+	"go/token"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyManifest deep-copies a manifest through its JSON form, which is also
+// how release tooling would store it.
+func copyManifest(t *testing.T, manifest *rulesengine.VersionManifest) *rulesengine.VersionManifest {
+	t.Helper()
+
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	var copied rulesengine.VersionManifest
+	require.NoError(t, json.Unmarshal(data, &copied))
+	return &copied
+}
+
+func findModel(t *testing.T, manifest *rulesengine.VersionManifest, name rulesengine.ModelName) *rulesengine.TypeManifest {
+	t.Helper()
+
+	for _, model := range manifest.Models {
+		if model.Model == name {
+			return model.Type
+		}
+	}
+	require.FailNow(t, "model not found", name)
+	return nil
+}
+
+func findField(t *testing.T, typ *rulesengine.TypeManifest, name string) *rulesengine.FieldManifest {
+	t.Helper()
+
+	for _, field := range typ.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	require.FailNow(t, "field not found", name)
+	return nil
+}
+
+func TestGetVersionManifest(t *testing.T) {
+	manifest := rulesengine.GetVersionManifest()
+
+	t.Run("Key matches VersionKey", func(t *testing.T) {
+		assert.Equal(t, rulesengine.VersionKey, manifest.VersionKey)
+		assert.Equal(t, rulesengine.VersionKey, manifest.Key())
+	})
+
+	t.Run("Lists the hashed models in order", func(t *testing.T) {
+		var names []rulesengine.ModelName
+		for _, model := range manifest.Models {
+			names = append(names, model.Model)
+		}
+		assert.Equal(t, []rulesengine.ModelName{
+			rulesengine.ModelCompany,
+			rulesengine.ModelUser,
+			rulesengine.ModelFlag,
+			rulesengine.ModelCheckFlagResult,
+		}, names)
+	})
+
+	t.Run("Describes fields recursively", func(t *testing.T) {
+		company := findModel(t, manifest, rulesengine.ModelCompany)
+
+		subscription := findField(t, company, "Subscription")
+		assert.Equal(t, `json:"subscription"`, subscription.Tag)
+		assert.Equal(t, "*Subscription", subscription.Type.String())
+		assert.NotEmpty(t, subscription.Type.Elem.Fields)
+
+		assert.Equal(t, "map[string]float64", findField(t, company, "CreditBalances").Type.String())
+	})
+
+	t.Run("Leaves out unexported fields", func(t *testing.T) {
+		for _, model := range manifest.Models {
+			for _, field := range model.Type.Fields {
+				assert.True(t, token.IsExported(field.Name), "%s.%s", model.Model, field.Name)
+			}
+		}
+	})
+
+	t.Run("Survives a JSON round trip with the same key", func(t *testing.T) {
+		assert.Equal(t, rulesengine.VersionKey, copyManifest(t, manifest).Key())
+	})
+}
+
+func TestDiffManifests(t *testing.T) {
+	current := rulesengine.GetVersionManifest()
+
+	t.Run("Identical manifests have no changes", func(t *testing.T) {
+		assert.Empty(t, rulesengine.DiffManifests(current, copyManifest(t, current)))
+	})
+
+	t.Run("Reports added and removed fields", func(t *testing.T) {
+		old := copyManifest(t, current)
+		user := findModel(t, old, rulesengine.ModelUser)
+		user.Fields = append(user.Fields[:1], user.Fields[2:]...)
+		user.Fields = append(user.Fields, &rulesengine.FieldManifest{
+			Name: "Email",
+			Tag:  `json:"email"`,
+			Type: &rulesengine.TypeManifest{Name: "string", Kind: "string"},
+		})
+
+		changes := rulesengine.DiffManifests(old, current)
+
+		require.Len(t, changes, 2)
+		assert.Equal(t, rulesengine.ManifestChangeFieldRemoved, changes[0].Kind)
+		assert.Equal(t, "User.Email", changes[0].Path)
+		assert.Equal(t, "User.Email: removed (string)", changes[0].String())
+		assert.Equal(t, rulesengine.ManifestChangeFieldAdded, changes[1].Kind)
+		assert.Equal(t, "User.AccountID", changes[1].Path)
+		assert.NotEqual(t, old.Key(), current.Key())
+	})
+
+	t.Run("Reports tag changes at every path the type is reachable from", func(t *testing.T) {
+		old := copyManifest(t, current)
+		for _, model := range old.Models {
+			if model.Model == rulesengine.ModelCheckFlagResult {
+				continue
+			}
+			rule := findField(t, model.Type, "Rules").Type.Elem.Elem
+			conditions := findField(t, rule, "Conditions").Type.Elem.Elem
+			findField(t, conditions, "Operator").Tag = `json:"operator"`
+		}
+
+		changes := rulesengine.DiffManifests(old, current)
+
+		var paths []string
+		for _, change := range changes {
+			assert.Equal(t, rulesengine.ManifestChangeTagChanged, change.Kind)
+			assert.Equal(t, `json:"operator"`, change.Old)
+			paths = append(paths, change.Path)
+		}
+		assert.Equal(t, []string{
+			"Company.Rules[].Conditions[].Operator",
+			"User.Rules[].Conditions[].Operator",
+			"Flag.Rules[].Conditions[].Operator",
+		}, paths)
+	})
+
+	t.Run("Reports type changes", func(t *testing.T) {
+		old := copyManifest(t, current)
+		findField(t, findModel(t, old, rulesengine.ModelCompany), "BasePlanID").Type = &rulesengine.TypeManifest{Name: "string", Kind: "string"}
+		findField(t, findModel(t, old, rulesengine.ModelCompany), "CreditBalances").Type.Elem = &rulesengine.TypeManifest{Name: "int64", Kind: "int64"}
+
+		changes := rulesengine.DiffManifests(old, current)
+
+		require.Len(t, changes, 2)
+		assert.Equal(t, "Company.BasePlanID: type changed from string to *string", changes[0].String())
+		assert.Equal(t, "Company.CreditBalances[]: type changed from int64 to float64", changes[1].String())
+	})
+
+	t.Run("Reports reordered fields", func(t *testing.T) {
+		old := copyManifest(t, current)
+		flag := findModel(t, old, rulesengine.ModelFlag)
+		flag.Fields[0], flag.Fields[1] = flag.Fields[1], flag.Fields[0]
+
+		changes := rulesengine.DiffManifests(old, current)
+
+		require.Len(t, changes, 1)
+		assert.Equal(t, rulesengine.ManifestChangeFieldsReorder, changes[0].Kind)
+		assert.Equal(t, "Flag", changes[0].Path)
+		assert.NotEqual(t, old.Key(), current.Key())
+	})
+
+	t.Run("Reports added and removed models", func(t *testing.T) {
+		old := copyManifest(t, current)
+		old.Models = old.Models[:3]
+
+		changes := rulesengine.DiffManifests(old, current)
+		require.Len(t, changes, 1)
+		assert.Equal(t, rulesengine.ManifestChangeModelAdded, changes[0].Kind)
+		assert.Equal(t, "CheckFlagResult", changes[0].Path)
+
+		changes = rulesengine.DiffManifests(current, old)
+		require.Len(t, changes, 1)
+		assert.Equal(t, rulesengine.ManifestChangeModelRemoved, changes[0].Kind)
+	})
+}
@@ -117,20 +117,24 @@ func MetricPeriodMonthResetFromInt(i int) MetricPeriodMonthReset {
 // Given a calendar-based metric period, return the beginning of the current metric period
 // Will return nil for non-calendar-based metric periods such as all-time or billing cycle
 func GetCurrentMetricPeriodStartForCalendarMetricPeriod(metricPeriod MetricPeriod) *time.Time {
+	return currentMetricPeriodStartForCalendarMetricPeriod(metricPeriod, time.Now())
+}
+
+func currentMetricPeriodStartForCalendarMetricPeriod(metricPeriod MetricPeriod, now time.Time) *time.Time {
+	now = now.UTC()
+
 	switch metricPeriod {
 	case MetricPeriodCurrentDay:
 		// UTC midnight for the current day
-		today := time.Now().UTC().Truncate(24 * time.Hour)
+		today := now.Truncate(24 * time.Hour)
 		return &today
 	case MetricPeriodCurrentWeek:
 		// UTC midnight for the most recent Sunday
-		now := time.Now().UTC()
 		daysSinceSunday := int(now.Weekday())
 		currentSunday := now.Truncate(24 * time.Hour).Add(-time.Duration(daysSinceSunday) * 24 * time.Hour)
 		return &currentSunday
 	case MetricPeriodCurrentMonth:
 		// UTC midnight for the first day of current month
-		now := time.Now().UTC()
 		firstDayOfCurrentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
 		return &firstDayOfCurrentMonth
 	}
@@ -140,17 +144,21 @@ func GetCurrentMetricPeriodStartForCalendarMetricPeriod(metricPeriod MetricPerio
 
 // Given a company, determine the beginning of the current metric period based on the company's billing subscription
 func GetCurrentMetricPeriodStartForCompanyBillingSubscription(company *Company) *time.Time {
+	return currentMetricPeriodStartForCompanyBillingSubscription(company, time.Now())
+}
+
+func currentMetricPeriodStartForCompanyBillingSubscription(company *Company, now time.Time) *time.Time {
 	// if no subscription exists, we use calendar month reset
 	if company == nil || company.Subscription == nil {
-		return GetCurrentMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth)
+		return currentMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth, now)
 	}
 
-	now := time.Now().UTC()
+	now = now.UTC()
 	periodStart := company.Subscription.PeriodStart
 
 	// if the start period is in the future, the metric period is from the start of the current calendar month
 	if periodStart.After(now) {
-		return GetCurrentMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth)
+		return currentMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth, now)
 	}
 
 	// find the most recent reset date based on subscription start date
@@ -181,14 +189,19 @@ func GetCurrentMetricPeriodStartForCompanyBillingSubscription(company *Company)
 // Given a calendar-based metric period, return the next metric period reset time
 // Will return nil for non-calendar-based metric periods such as all-time or billing cycle
 func GetNextMetricPeriodStartForCalendarMetricPeriod(metricPeriod MetricPeriod) *time.Time {
+	return nextMetricPeriodStartForCalendarMetricPeriod(metricPeriod, time.Now())
+}
+
+func nextMetricPeriodStartForCalendarMetricPeriod(metricPeriod MetricPeriod, now time.Time) *time.Time {
+	now = now.UTC()
+
 	switch metricPeriod {
 	case MetricPeriodCurrentDay:
 		// UTC midnight for upcoming day
-		tomorrow := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		tomorrow := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
 		return &tomorrow
 	case MetricPeriodCurrentWeek:
 		// UTC midnight for upcoming Sunday
-		now := time.Now().UTC()
 		daysUntilSunday := (7 - int(now.Weekday())) % 7
 		if daysUntilSunday == 0 {
 			// if it is currently sunday, we want to look forward to the next sunday
@@ -198,7 +211,6 @@ func GetNextMetricPeriodStartForCalendarMetricPeriod(metricPeriod MetricPeriod)
 		return &upcomingSunday
 	case MetricPeriodCurrentMonth:
 		// UTC midnight for the first day of next month
-		now := time.Now().UTC()
 		firstDayOfCurrentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
 		nextMonth := firstDayOfCurrentMonth.AddDate(0, 1, 0)
 		return &nextMonth
@@ -210,28 +222,36 @@ func GetNextMetricPeriodStartForCalendarMetricPeriod(metricPeriod MetricPeriod)
 // GetNextMetricPeriodStartForCompanyBillingSubscription determines the next metric period start
 // based on the company's billing subscription.
 func GetNextMetricPeriodStartForCompanyBillingSubscription(company *Company) *time.Time {
+	return nextMetricPeriodStartForCompanyBillingSubscription(company, time.Now())
+}
+
+func nextMetricPeriodStartForCompanyBillingSubscription(company *Company, now time.Time) *time.Time {
 	if company == nil {
-		return GetNextMetricPeriodStartForSubscription(nil)
+		return nextMetricPeriodStartForSubscription(nil, now)
 	}
-	return GetNextMetricPeriodStartForSubscription(company.Subscription)
+	return nextMetricPeriodStartForSubscription(company.Subscription, now)
 }
 
 // GetNextMetricPeriodStartForSubscription determines the next metric period start based on the
 // subscription's billing cycle. If subscription is nil, returns the start of the next calendar month.
 func GetNextMetricPeriodStartForSubscription(subscription *Subscription) *time.Time {
+	return nextMetricPeriodStartForSubscription(subscription, time.Now())
+}
+
+func nextMetricPeriodStartForSubscription(subscription *Subscription, now time.Time) *time.Time {
 	// if no subscription exists, we use calendar month reset
 	if subscription == nil {
-		return GetNextMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth)
+		return nextMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth, now)
 	}
 
-	now := time.Now().UTC()
+	now = now.UTC()
 	periodEnd := subscription.PeriodEnd
 	periodStart := subscription.PeriodStart
 
 	// if the start period is in the future, the metric period is from the start of the current calendar month until either
 	// the end of the current calendar month or the start of the billing period, whichever comes first
 	if periodStart.After(now) {
-		startOfNextMonth := GetNextMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth)
+		startOfNextMonth := nextMetricPeriodStartForCalendarMetricPeriod(MetricPeriodCurrentMonth, now)
 		if periodStart.After(*startOfNextMonth) {
 			return startOfNextMonth
 		}
@@ -269,6 +289,14 @@ func GetNextMetricPeriodStartForSubscription(subscription *Subscription) *time.T
 func GetNextMetricPeriodStartFromCondition(
 	condition *Condition,
 	company *Company,
+) *time.Time {
+	return nextMetricPeriodStartFromCondition(condition, company, time.Now())
+}
+
+func nextMetricPeriodStartFromCondition(
+	condition *Condition,
+	company *Company,
+	now time.Time,
 ) *time.Time {
 	// Only metric conditions have a metric period that can reset
 	if condition == nil || condition.ConditionType != ConditionTypeMetric {
@@ -283,9 +311,9 @@ func GetNextMetricPeriodStartFromCondition(
 	// Metric period current month with billing cycle reset
 	monthReset := condition.MetricPeriodMonthReset
 	if *condition.MetricPeriod == MetricPeriodCurrentMonth && monthReset != nil && *monthReset == MetricPeriodMonthResetBilling {
-		return GetNextMetricPeriodStartForCompanyBillingSubscription(company)
+		return nextMetricPeriodStartForCompanyBillingSubscription(company, now)
 	}
 
 	// Calendar-based metric periods
-	return GetNextMetricPeriodStartForCalendarMetricPeriod(*condition.MetricPeriod)
+	return nextMetricPeriodStartForCalendarMetricPeriod(*condition.MetricPeriod, now)
 }
@@ -0,0 +1,309 @@
+package rulesengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ModelName identifies one of the wire models whose structure is hashed into
+// VersionKey.
+type ModelName string
+
+const (
+	ModelCheckFlagResult ModelName = "CheckFlagResult"
+	ModelCompany         ModelName = "Company"
+	ModelFlag            ModelName = "Flag"
+	ModelUser            ModelName = "User"
+)
+
+// ErrNoMigrationPath is returned when a payload's version key has no chain of
+// registered migrations leading to the current VersionKey.
+var ErrNoMigrationPath = errors.New("no migration path to current version")
+
+// MigrationFunc upgrades a decoded JSON object in place.
+type MigrationFunc func(doc map[string]any) error
+
+// MigrationRegistry upgrades JSON payloads serialized under older model
+// versions to the current model structure, so cached data can be rewritten
+// under the current VersionKey instead of being discarded.
+//
+// Each step is keyed by the historical version key it upgrades from and
+// names the version key it produces. Steps are chained until the current
+// VersionKey is reached. A step only needs functions for the models whose
+// wire form changed; other models pass through it unchanged.
+type MigrationRegistry struct {
+	mu    sync.RWMutex
+	steps map[string]*migrationStep
+}
+
+type migrationStep struct {
+	to         string
+	migrations map[ModelName]MigrationFunc
+}
+
+// NewMigrationRegistry returns an empty registry.
+func NewMigrationRegistry() *MigrationRegistry {
+	return &MigrationRegistry{steps: map[string]*migrationStep{}}
+}
+
+// DefaultMigrations holds the migrations between released model versions.
+// When a change to the models alters VersionKey, point the step from the
+// last released key at the new one, extending its functions as needed; keys
+// that were never released need no steps of their own.
+var DefaultMigrations = NewMigrationRegistry()
+
+func init() {
+	// Since ad96bec2:
+	//  - Rule and Flag gained the optional starts_at and ends_at fields, and
+	//    CheckFlagResult the optional skipped_errors field; older payloads
+	//    decode unchanged.
+	//  - CheckFlagResult.Err became an ErrorDetail. It used to marshal as an
+	//    empty object, so all that is known about older errors is that there
+	//    was one.
+	DefaultMigrations.MustRegister("ad96bec2", "d5bab0f5", ModelFlag, nil)
+	DefaultMigrations.MustRegister("ad96bec2", "d5bab0f5", ModelCheckFlagResult, AtPath("err", ChainMigrations(
+		SetDefault("code", string(ErrorCodeUnexpected)),
+		SetDefault("message", ErrorUnexpected.Error()),
+	)))
+}
+
+// Register adds a step upgrading payloads for model from version key from to
+// version key to. Several models may register functions for the same step,
+// but every registration for a step must agree on its target, and a model
+// may only be registered once per step. fn may be nil for a step that
+// changes no wire forms, such as one that only adds optional fields, so the
+// step still links the two version keys.
+func (r *MigrationRegistry) Register(from, to string, model ModelName, fn MigrationFunc) error {
+	if from == to {
+		return fmt.Errorf("migration from %s to itself", from)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	step, ok := r.steps[from]
+	if !ok {
+		step = &migrationStep{to: to, migrations: map[ModelName]MigrationFunc{}}
+		r.steps[from] = step
+	}
+
+	if step.to != to {
+		return fmt.Errorf("migration from %s already targets %s, not %s", from, step.to, to)
+	}
+	if _, ok := step.migrations[model]; ok {
+		return fmt.Errorf("migration from %s to %s already registered for %s", from, to, model)
+	}
+
+	step.migrations[model] = fn
+	return nil
+}
+
+// MustRegister is Register for package-level registration; it panics on
+// conflicting registrations.
+func (r *MigrationRegistry) MustRegister(from, to string, model ModelName, fn MigrationFunc) {
+	if err := r.Register(from, to, model, fn); err != nil {
+		panic(err)
+	}
+}
+
+// CanMigrate reports whether payloads serialized under version key from can
+// be upgraded to the current VersionKey.
+func (r *MigrationRegistry) CanMigrate(from string) bool {
+	_, err := r.path(from)
+	return err == nil
+}
+
+// Migrate upgrades a JSON payload for model serialized under version key
+// from, returning it in the current model's wire form. Payloads already at
+// the current VersionKey are returned unchanged.
+func (r *MigrationRegistry) Migrate(model ModelName, from string, data []byte) ([]byte, error) {
+	steps, err := r.path(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var fns []MigrationFunc
+	for _, step := range steps {
+		if fn := step.migrations[model]; fn != nil {
+			fns = append(fns, fn)
+		}
+	}
+	if len(fns) == 0 {
+		return data, nil
+	}
+
+	// Decode numbers as json.Number so int64 values such as metric counts
+	// survive the round trip without float64 rounding.
+	var doc map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding %s payload: %w", model, err)
+	}
+	if doc == nil {
+		return data, nil
+	}
+
+	for _, fn := range fns {
+		if err := fn(doc); err != nil {
+			return nil, fmt.Errorf("migrating %s payload from %s: %w", model, from, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// Unmarshal migrates a JSON payload serialized under version key from and
+// decodes it into v, which must be a *Company, *User, *Flag or
+// *CheckFlagResult.
+func (r *MigrationRegistry) Unmarshal(from string, data []byte, v any) error {
+	var model ModelName
+	switch v.(type) {
+	case *Company:
+		model = ModelCompany
+	case *User:
+		model = ModelUser
+	case *Flag:
+		model = ModelFlag
+	case *CheckFlagResult:
+		model = ModelCheckFlagResult
+	default:
+		return fmt.Errorf("cannot migrate %T", v)
+	}
+
+	migrated, err := r.Migrate(model, from, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(migrated, v)
+}
+
+// path returns the steps leading from version key from to the current
+// VersionKey.
+func (r *MigrationRegistry) path(from string) ([]*migrationStep, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var steps []*migrationStep
+	seen := map[string]bool{}
+	for key := from; key != VersionKey; {
+		if seen[key] {
+			return nil, fmt.Errorf("%w: migration cycle at %s", ErrNoMigrationPath, key)
+		}
+		seen[key] = true
+
+		step, ok := r.steps[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration registered from %s", ErrNoMigrationPath, key)
+		}
+		steps = append(steps, step)
+		key = step.to
+	}
+
+	return steps, nil
+}
+
+// Migration helpers
+//
+// Paths are dot-separated JSON field names. A `[]` suffix applies the rest
+// of the path to every element of an array, e.g. `rules[].conditions[]`
+// visits every condition of every rule. Missing or null values along a path
+// are skipped.
+
+// ChainMigrations runs fns in order, stopping at the first error.
+func ChainMigrations(fns ...MigrationFunc) MigrationFunc {
+	return func(doc map[string]any) error {
+		for _, fn := range fns {
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AtPath applies fn to every object found at path.
+func AtPath(path string, fn MigrationFunc) MigrationFunc {
+	segments := strings.Split(path, ".")
+	return func(doc map[string]any) error {
+		return visitPath(doc, segments, fn)
+	}
+}
+
+// RenameField moves the value at field to newField, unless newField is
+// already set.
+func RenameField(field, newField string) MigrationFunc {
+	return func(doc map[string]any) error {
+		value, ok := doc[field]
+		if !ok {
+			return nil
+		}
+		delete(doc, field)
+		if _, exists := doc[newField]; !exists {
+			doc[newField] = value
+		}
+		return nil
+	}
+}
+
+// RemoveField deletes field.
+func RemoveField(field string) MigrationFunc {
+	return func(doc map[string]any) error {
+		delete(doc, field)
+		return nil
+	}
+}
+
+// SetDefault sets field to value if it is missing. The value must be
+// representable in JSON.
+func SetDefault(field string, value any) MigrationFunc {
+	return func(doc map[string]any) error {
+		if _, ok := doc[field]; !ok {
+			doc[field] = value
+		}
+		return nil
+	}
+}
+
+func visitPath(doc map[string]any, segments []string, fn MigrationFunc) error {
+	if len(segments) == 0 || (len(segments) == 1 && segments[0] == "") {
+		return fn(doc)
+	}
+
+	field, each := strings.CutSuffix(segments[0], "[]")
+	value := doc[field]
+	if value == nil {
+		return nil
+	}
+
+	if !each {
+		child, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", field, value)
+		}
+		return visitPath(child, segments[1:], fn)
+	}
+
+	items, ok := value.([]any)
+	if !ok {
+		return fmt.Errorf("%s: expected array, got %T", field, value)
+	}
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		child, ok := item.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s[%d]: expected object, got %T", field, i, item)
+		}
+		if err := visitPath(child, segments[1:], fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
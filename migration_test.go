@@ -0,0 +1,220 @@
+package rulesengine_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oldestTestVersion = "0000aaaa"
+	olderTestVersion  = "0000bbbb"
+)
+
+func newTestMigrationRegistry(t *testing.T) *rulesengine.MigrationRegistry {
+	t.Helper()
+
+	registry := rulesengine.NewMigrationRegistry()
+
+	// oldest -> older: companies called plan IDs "plans"; conditions had no
+	// resource IDs.
+	require.NoError(t, registry.Register(oldestTestVersion, olderTestVersion, rulesengine.ModelCompany,
+		rulesengine.ChainMigrations(
+			rulesengine.RenameField("plans", "plan_ids"),
+			rulesengine.AtPath("rules[].conditions[]", rulesengine.SetDefault("resource_ids", []any{})),
+		),
+	))
+	require.NoError(t, registry.Register(oldestTestVersion, olderTestVersion, rulesengine.ModelFlag,
+		rulesengine.AtPath("rules[].conditions[]", rulesengine.SetDefault("resource_ids", []any{})),
+	))
+
+	// older -> current: companies had a legacy "tier" field.
+	require.NoError(t, registry.Register(olderTestVersion, rulesengine.VersionKey, rulesengine.ModelCompany,
+		rulesengine.RemoveField("tier"),
+	))
+
+	return registry
+}
+
+func TestMigrationRegistry(t *testing.T) {
+	t.Run("Chains migrations to the current version", func(t *testing.T) {
+		registry := newTestMigrationRegistry(t)
+		payload := []byte(`{
+			"id": "comp_1",
+			"plans": ["plan_1"],
+			"tier": "gold",
+			"rules": [{"id": "rule_1", "conditions": [{"id": "cond_1", "condition_type": "plan"}]}],
+			"metrics": [{"event_subtype": "calls", "value": 9007199254740993}]
+		}`)
+
+		var company rulesengine.Company
+		require.NoError(t, registry.Unmarshal(oldestTestVersion, payload, &company))
+
+		assert.Equal(t, "comp_1", company.ID)
+		assert.Equal(t, rulesengine.JSONSlice[string]{"plan_1"}, company.PlanIDs)
+		require.Len(t, company.Rules, 1)
+		require.Len(t, company.Rules[0].Conditions, 1)
+		assert.NotNil(t, company.Rules[0].Conditions[0].ResourceIDs)
+		require.Len(t, company.Metrics, 1)
+		assert.Equal(t, int64(9007199254740993), company.Metrics[0].Value)
+
+		migrated, err := registry.Migrate(rulesengine.ModelCompany, oldestTestVersion, payload)
+		require.NoError(t, err)
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(migrated, &doc))
+		assert.NotContains(t, doc, "tier")
+		assert.NotContains(t, doc, "plans")
+	})
+
+	t.Run("Starts from an intermediate version", func(t *testing.T) {
+		registry := newTestMigrationRegistry(t)
+
+		migrated, err := registry.Migrate(rulesengine.ModelCompany, olderTestVersion, []byte(`{"plans":["kept"],"tier":"gold"}`))
+
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"plans":["kept"]}`, string(migrated))
+	})
+
+	t.Run("Models without migrations for a step pass through", func(t *testing.T) {
+		registry := newTestMigrationRegistry(t)
+		payload := []byte(`{"id":"user_1","tier":"gold"}`)
+
+		migrated, err := registry.Migrate(rulesengine.ModelUser, oldestTestVersion, payload)
+
+		require.NoError(t, err)
+		assert.Equal(t, payload, migrated)
+	})
+
+	t.Run("Current payloads are returned unchanged", func(t *testing.T) {
+		registry := rulesengine.NewMigrationRegistry()
+		payload := []byte(`{"id":"flag_1"}`)
+
+		migrated, err := registry.Migrate(rulesengine.ModelFlag, rulesengine.VersionKey, payload)
+
+		require.NoError(t, err)
+		assert.Equal(t, payload, migrated)
+		assert.True(t, registry.CanMigrate(rulesengine.VersionKey))
+	})
+
+	t.Run("Unknown versions have no path", func(t *testing.T) {
+		registry := newTestMigrationRegistry(t)
+
+		_, err := registry.Migrate(rulesengine.ModelCompany, "deadbeef", []byte(`{}`))
+
+		assert.True(t, errors.Is(err, rulesengine.ErrNoMigrationPath))
+		assert.False(t, registry.CanMigrate("deadbeef"))
+		assert.True(t, registry.CanMigrate(oldestTestVersion))
+	})
+
+	t.Run("Cycles have no path", func(t *testing.T) {
+		registry := rulesengine.NewMigrationRegistry()
+		require.NoError(t, registry.Register(oldestTestVersion, olderTestVersion, rulesengine.ModelUser, rulesengine.RemoveField("x")))
+		require.NoError(t, registry.Register(olderTestVersion, oldestTestVersion, rulesengine.ModelUser, rulesengine.RemoveField("x")))
+
+		_, err := registry.Migrate(rulesengine.ModelUser, oldestTestVersion, []byte(`{}`))
+
+		assert.True(t, errors.Is(err, rulesengine.ErrNoMigrationPath))
+	})
+
+	t.Run("Rejects conflicting registrations", func(t *testing.T) {
+		registry := newTestMigrationRegistry(t)
+
+		assert.Error(t, registry.Register(oldestTestVersion, "0000cccc", rulesengine.ModelUser, rulesengine.RemoveField("x")))
+		assert.Error(t, registry.Register(oldestTestVersion, olderTestVersion, rulesengine.ModelCompany, rulesengine.RemoveField("x")))
+		assert.Error(t, registry.Register(oldestTestVersion, oldestTestVersion, rulesengine.ModelUser, rulesengine.RemoveField("x")))
+		assert.Panics(t, func() {
+			registry.MustRegister(oldestTestVersion, "0000cccc", rulesengine.ModelUser, rulesengine.RemoveField("x"))
+		})
+	})
+
+	t.Run("Migration errors are reported", func(t *testing.T) {
+		registry := rulesengine.NewMigrationRegistry()
+		require.NoError(t, registry.Register(oldestTestVersion, rulesengine.VersionKey, rulesengine.ModelFlag,
+			rulesengine.AtPath("rules[]", rulesengine.RemoveField("x")),
+		))
+
+		_, err := registry.Migrate(rulesengine.ModelFlag, oldestTestVersion, []byte(`{"rules":{"id":"not-an-array"}}`))
+		assert.ErrorContains(t, err, "rules: expected array")
+
+		_, err = registry.Migrate(rulesengine.ModelFlag, oldestTestVersion, []byte(`not json`))
+		assert.Error(t, err)
+	})
+
+	t.Run("Steps without functions link versions", func(t *testing.T) {
+		registry := rulesengine.NewMigrationRegistry()
+		require.NoError(t, registry.Register(olderTestVersion, rulesengine.VersionKey, rulesengine.ModelFlag, nil))
+
+		migrated, err := registry.Migrate(rulesengine.ModelFlag, olderTestVersion, []byte(`{"key":"flag"}`))
+
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"key":"flag"}`, string(migrated))
+	})
+
+	t.Run("Default migrations cover released versions", func(t *testing.T) {
+		// ad96bec2 is the only version released before the current one.
+		for _, version := range []string{"ad96bec2", rulesengine.VersionKey} {
+			assert.True(t, rulesengine.DefaultMigrations.CanMigrate(version), version)
+		}
+
+		var flag rulesengine.Flag
+		require.NoError(t, rulesengine.DefaultMigrations.Unmarshal("ad96bec2", []byte(`{"key":"flag","rules":[{"id":"rule_1"}]}`), &flag))
+		assert.Nil(t, flag.StartsAt)
+		assert.Nil(t, flag.Rules[0].EndsAt)
+
+		var result rulesengine.CheckFlagResult
+		require.NoError(t, rulesengine.DefaultMigrations.Unmarshal("ad96bec2", []byte(`{"flag_key":"flag","err":{}}`), &result))
+		assert.ErrorIs(t, result.Err, rulesengine.ErrorUnexpected)
+	})
+
+	t.Run("Unmarshal rejects unsupported types", func(t *testing.T) {
+		var rule rulesengine.Rule
+
+		err := rulesengine.NewMigrationRegistry().Unmarshal(rulesengine.VersionKey, []byte(`{}`), &rule)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestMigrationHelpers(t *testing.T) {
+	t.Run("RenameField keeps an existing target", func(t *testing.T) {
+		doc := map[string]any{"old": 1, "new": 2}
+
+		require.NoError(t, rulesengine.RenameField("old", "new")(doc))
+
+		assert.Equal(t, map[string]any{"new": 2}, doc)
+	})
+
+	t.Run("SetDefault keeps an existing value", func(t *testing.T) {
+		doc := map[string]any{"value": false}
+
+		require.NoError(t, rulesengine.SetDefault("value", true)(doc))
+		require.NoError(t, rulesengine.SetDefault("priority", 0)(doc))
+
+		assert.Equal(t, map[string]any{"value": false, "priority": 0}, doc)
+	})
+
+	t.Run("AtPath skips null values and elements", func(t *testing.T) {
+		doc := map[string]any{
+			"subscription": nil,
+			"rules":        []any{nil, map[string]any{"condition_groups": nil}},
+		}
+
+		err := rulesengine.AtPath("rules[].condition_groups[].conditions[]", rulesengine.RemoveField("x"))(doc)
+		require.NoError(t, err)
+
+		err = rulesengine.AtPath("subscription", rulesengine.RemoveField("x"))(doc)
+		require.NoError(t, err)
+	})
+
+	t.Run("AtPath descends into objects", func(t *testing.T) {
+		doc := map[string]any{"subscription": map[string]any{"start": "2026-01-01T00:00:00Z"}}
+
+		require.NoError(t, rulesengine.AtPath("subscription", rulesengine.RenameField("start", "period_start"))(doc))
+
+		assert.Equal(t, map[string]any{"subscription": map[string]any{"period_start": "2026-01-01T00:00:00Z"}}, doc)
+	})
+}
@@ -2,6 +2,8 @@ package rulesengine
 
 import (
 	"encoding/json"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -21,6 +23,19 @@ type Flag struct {
 	Key           string           `json:"key"`
 	Rules         JSONSlice[*Rule] `json:"rules"`
 	DefaultValue  bool             `json:"default_value"`
+
+	// StartsAt and EndsAt optionally limit when the flag's rules are
+	// evaluated; outside the window every subject gets DefaultValue. See
+	// IsActiveAt.
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+// IsActiveAt reports whether t falls within the flag's activation window,
+// which starts at StartsAt inclusive and ends at EndsAt exclusive. Unset
+// bounds are open.
+func (f *Flag) IsActiveAt(t time.Time) bool {
+	return isActiveAt(f.StartsAt, f.EndsAt, t)
 }
 
 type Rule struct {
@@ -34,6 +49,28 @@ type Rule struct {
 	Conditions      JSONSlice[*Condition]      `json:"conditions"`
 	ConditionGroups JSONSlice[*ConditionGroup] `json:"condition_groups"`
 	Value           bool                       `json:"value"`
+
+	// StartsAt and EndsAt optionally limit when the rule can match; outside
+	// the window it is skipped. See IsActiveAt.
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+// IsActiveAt reports whether t falls within the rule's activation window,
+// which starts at StartsAt inclusive and ends at EndsAt exclusive. Unset
+// bounds are open.
+func (r *Rule) IsActiveAt(t time.Time) bool {
+	return isActiveAt(r.StartsAt, r.EndsAt, t)
+}
+
+func isActiveAt(startsAt, endsAt *time.Time, t time.Time) bool {
+	if startsAt != nil && t.Before(*startsAt) {
+		return false
+	}
+	if endsAt != nil && !t.Before(*endsAt) {
+		return false
+	}
+	return true
 }
 
 type Condition struct {
@@ -94,6 +131,11 @@ func (c CompanyMetricCollection) MarshalJSON() ([]byte, error) {
 	return json.Marshal([]*CompanyMetric(c))
 }
 
+// Find returns the metric for the event subtype, period and month reset, or
+// nil if there is none. A nil period means all_time and a nil month reset
+// first_of_month. A bare collection has nowhere to keep an index, so Find
+// scans it; use Company.FindMetric to look up a company's metrics through
+// its index.
 func (c CompanyMetricCollection) Find(
 	eventSubtype string,
 	period *MetricPeriod,
@@ -155,6 +197,11 @@ type FeatureEntitlement struct {
 	ValueType       EntitlementValueType    `json:"value_type" binding:"oneof=boolean credit numeric trait unknown unlimited" desc:"The type of the entitlement value"`
 }
 
+// Company is a company flags are checked for. Its methods are safe to call
+// while the company is being checked: CheckFlag evaluates a Snapshot, and
+// the mutators replace the slices and maps snapshots share rather than
+// modifying them. Assigning fields directly is not safe while other
+// goroutines use the company.
 type Company struct {
 	ID            string `json:"id"`
 	AccountID     string `json:"account_id"`
@@ -172,58 +219,157 @@ type Company struct {
 	Subscription      *Subscription                  `json:"subscription"`
 	Traits            JSONSlice[*Trait]              `json:"traits"`
 
-	mu sync.Mutex `json:"-"` // mutex for thread safety
+	mu sync.RWMutex `json:"-"` // mutex for thread safety
+
+	metricIndex metricIndex
+	traitIndex  traitIndex
+}
+
+// AddMetric adds a new metric to the company's metrics collection or replaces an existing one
+// that matches the same unique constraint (eventSubtype, period, and monthReset).
+// It uses a mutex to ensure thread safety.
+func (c *Company) AddMetric(metric *CompanyMetric) {
+	if c == nil || metric == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byKey := newSliceIndex(c.Metrics, metricKeyOf).byKey
+	key, _ := metricKeyOf(metric)
+	if i, ok := byKey[key]; ok {
+		metrics := slices.Clone(c.Metrics)
+		metrics[i] = metric
+		c.metricIndex.store(metrics, byKey)
+		c.Metrics = metrics
+		return
+	}
+
+	// Appending never touches the elements snapshots can see.
+	metrics := append(c.Metrics, metric)
+	byKey[key] = len(metrics) - 1
+	c.metricIndex.store(metrics, byKey)
+	c.Metrics = metrics
 }
 
-func (c *Company) getTraitByDefinitionID(traitDefinitionID string) *Trait {
+// SetTrait adds a trait to the company or replaces the one with the same
+// trait definition. Traits without a definition are ignored.
+func (c *Company) SetTrait(trait *Trait) {
+	if c == nil || trait == nil || trait.TraitDefinition == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Traits = setTrait(&c.traitIndex, c.Traits, trait)
+}
+
+// RemoveTrait removes the company's traits with the trait definition.
+func (c *Company) RemoveTrait(definitionID string) {
 	if c == nil {
-		return nil
+		return
 	}
 
-	if len(c.Traits) == 0 {
-		return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Traits = removeTrait(&c.traitIndex, c.Traits, definitionID)
+}
+
+// SetCreditBalance sets the company's balance of a credit.
+func (c *Company) SetCreditBalance(creditID string, balance float64) {
+	if c == nil {
+		return
 	}
 
-	for _, trait := range c.Traits {
-		if trait.TraitDefinition != nil && trait.TraitDefinition.ID == traitDefinitionID {
-			return trait
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	balances := make(map[string]float64, len(c.CreditBalances)+1)
+	maps.Copy(balances, c.CreditBalances)
+	balances[creditID] = balance
+	c.CreditBalances = balances
+}
+
+// AddPlanID adds a plan to the company's plans, unless it is already on it.
+func (c *Company) AddPlanID(planID string) {
+	if c == nil {
+		return
 	}
 
-	return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !slices.Contains(c.PlanIDs, planID) {
+		c.PlanIDs = append(c.PlanIDs, planID)
+	}
 }
 
-// AddMetric adds a new metric to the company's metrics collection or replaces an existing one
-// that matches the same unique constraint (eventSubtype, period, and monthReset).
-// It uses a mutex to ensure thread safety.
-func (c *Company) AddMetric(metric *CompanyMetric) {
-	if c == nil || metric == nil {
+// RemovePlanID removes a plan from the company's plans.
+func (c *Company) RemovePlanID(planID string) {
+	if c == nil {
 		return
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if len(c.Metrics) == 0 {
-		c.Metrics = CompanyMetricCollection{metric}
+	if slices.Contains(c.PlanIDs, planID) {
+		c.PlanIDs = slices.DeleteFunc(slices.Clone(c.PlanIDs), func(id string) bool { return id == planID })
+	}
+}
+
+// SetRules replaces the company's rules.
+func (c *Company) SetRules(rules []*Rule) {
+	if c == nil {
 		return
 	}
 
-	// Loop through once, either replace an existing metric or append a new one
-	for i, m := range c.Metrics {
-		if m.EventSubtype == metric.EventSubtype &&
-			m.Period == metric.Period &&
-			m.MonthReset == metric.MonthReset {
-			// Found a match, replace it
-			c.Metrics[i] = metric
-			return
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Rules = rules
+}
+
+// Snapshot returns a copy of the company that later calls to its mutators
+// don't affect. The copy shares the company's slices, maps and elements, so
+// it is cheap, and must be treated as read-only. CheckFlag evaluates a
+// snapshot of the company it is given and passes the same snapshot to
+// evaluation hooks.
+func (c *Company) Snapshot() *Company {
+	if c == nil {
+		return nil
 	}
 
-	// If we get here, no match was found, so append the new metric
-	c.Metrics = append(c.Metrics, metric)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := &Company{
+		ID:                c.ID,
+		AccountID:         c.AccountID,
+		EnvironmentID:     c.EnvironmentID,
+		BasePlanID:        c.BasePlanID,
+		BillingProductIDs: c.BillingProductIDs,
+		CreditBalances:    c.CreditBalances,
+		Entitlements:      c.Entitlements,
+		Keys:              c.Keys,
+		Metrics:           c.Metrics,
+		PlanIDs:           c.PlanIDs,
+		PlanVersionIDs:    c.PlanVersionIDs,
+		Rules:             c.Rules,
+		Subscription:      c.Subscription,
+		Traits:            c.Traits,
+	}
+	c.metricIndex.shareWith(&snapshot.metricIndex, c.Metrics, metricKeyOf)
+	c.traitIndex.shareWith(&snapshot.traitIndex, c.Traits, traitKeyOf)
+	return snapshot
 }
 
+// User is a user flags are checked for. Like Company, its methods are safe
+// to call while the user is being checked, but assigning fields directly is
+// not.
 type User struct {
 	ID            string `json:"id"`
 	AccountID     string `json:"account_id"`
@@ -232,4 +378,103 @@ type User struct {
 	Keys   map[string]string `json:"keys"`
 	Traits JSONSlice[*Trait] `json:"traits"`
 	Rules  JSONSlice[*Rule]  `json:"rules"`
+
+	mu sync.RWMutex `json:"-"` // mutex for thread safety
+
+	traitIndex traitIndex
+}
+
+// SetTrait adds a trait to the user or replaces the one with the same trait
+// definition. Traits without a definition are ignored.
+func (u *User) SetTrait(trait *Trait) {
+	if u == nil || trait == nil || trait.TraitDefinition == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.Traits = setTrait(&u.traitIndex, u.Traits, trait)
+}
+
+// RemoveTrait removes the user's traits with the trait definition.
+func (u *User) RemoveTrait(definitionID string) {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.Traits = removeTrait(&u.traitIndex, u.Traits, definitionID)
+}
+
+// SetRules replaces the user's rules.
+func (u *User) SetRules(rules []*Rule) {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.Rules = rules
+}
+
+// Snapshot returns a copy of the user that later calls to its mutators
+// don't affect. Like Company.Snapshot, the copy shares the user's slices,
+// maps and elements and must be treated as read-only. CheckFlag evaluates a
+// snapshot of the user it is given.
+func (u *User) Snapshot() *User {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	snapshot := &User{
+		ID:            u.ID,
+		AccountID:     u.AccountID,
+		EnvironmentID: u.EnvironmentID,
+		Keys:          u.Keys,
+		Traits:        u.Traits,
+		Rules:         u.Rules,
+	}
+	u.traitIndex.shareWith(&snapshot.traitIndex, u.Traits, traitKeyOf)
+	return snapshot
+}
+
+// setTrait returns traits with trait added or replacing the one with the
+// same definition, leaving traits itself unmodified, and stores the index of
+// the result.
+func setTrait(index *traitIndex, traits JSONSlice[*Trait], trait *Trait) JSONSlice[*Trait] {
+	byKey := newSliceIndex(traits, traitKeyOf).byKey
+	if pos, ok := byKey[trait.TraitDefinition.ID]; ok {
+		replaced := slices.Clone(traits)
+		replaced[pos] = trait
+		index.store(replaced, byKey)
+		return replaced
+	}
+
+	added := append(traits, trait)
+	byKey[trait.TraitDefinition.ID] = len(added) - 1
+	index.store(added, byKey)
+	return added
+}
+
+// removeTrait returns traits without those with the definition, leaving
+// traits itself unmodified, and stores the index of the result.
+func removeTrait(index *traitIndex, traits JSONSlice[*Trait], definitionID string) JSONSlice[*Trait] {
+	matches := func(trait *Trait) bool {
+		id, ok := traitKeyOf(trait)
+		return ok && id == definitionID
+	}
+	if !slices.ContainsFunc(traits, matches) {
+		return traits
+	}
+
+	removed := slices.DeleteFunc(slices.Clone(traits), matches)
+	index.build(removed, traitKeyOf)
+	return removed
 }
@@ -1,5 +1,9 @@
 package rulesengine
 
+import (
+	"time"
+)
+
 // CheckFlagOption configures a CheckFlag invocation. Functional options let
 // callers express preflight semantics ("simulate this much additional usage"
 // or "this is the exact credit cost") without expanding the positional
@@ -50,6 +54,41 @@ type checkFlagOptions struct {
 	// against the balance). Deliberately singular: one check preflights
 	// one action.
 	eventUsage *eventUsage
+
+	// hooks are invoked around the evaluation in registration order. See
+	// EvaluationHook for the stages and their ordering.
+	hooks []EvaluationHook
+
+	// validateInput validates the company, user and flag against their
+	// binding tags before evaluating.
+	validateInput bool
+
+	// tracer and meter instrument the evaluation. They default to no-ops.
+	tracer Tracer
+	meter  Meter
+
+	// evaluationTime is the instant the evaluation is performed as of, used
+	// to compute metric reset times. Zero means the current time.
+	evaluationTime time.Time
+
+	// errorPolicy decides what happens when a rule fails to evaluate, and
+	// errorValue is the value served under ErrorPolicyFixedValue. An empty
+	// policy is ErrorPolicyAbort.
+	errorPolicy ErrorPolicy
+	errorValue  bool
+
+	// evaluationBudget caps the number of conditions the evaluation may
+	// check. Zero means no limit.
+	evaluationBudget int
+
+	// conditions evaluates each condition by its type. It defaults to
+	// DefaultConditions.
+	conditions *ConditionRegistry
+
+	// traitResolver and metricResolver load traits and metrics missing from
+	// the company and user. Nil means only the models are consulted.
+	traitResolver  TraitResolver
+	metricResolver MetricResolver
 }
 
 // eventUsage pairs an event_subtype with a simulated quantity for preflight.
@@ -59,10 +98,14 @@ type eventUsage struct {
 }
 
 // newCheckFlagOptions returns a zero-valued checkFlagOptions with its maps
-// initialized, so option setters don't need to nil-check before writing.
+// initialized and no-op instrumentation in place, so option setters and the
+// engine don't need to nil-check before using them.
 func newCheckFlagOptions() *checkFlagOptions {
 	return &checkFlagOptions{
 		creditCost: make(map[string]float64),
+		tracer:     noopTracer{},
+		meter:      noopMeter{},
+		conditions: DefaultConditions,
 	}
 }
 
@@ -82,9 +125,25 @@ func (o *checkFlagOptions) validate() error {
 			return ErrorNegativePreflightCreditCost
 		}
 	}
+	if o.evaluationBudget < 0 {
+		return ErrorNegativeEvaluationBudget
+	}
+	switch o.errorPolicy {
+	case "", ErrorPolicyAbort, ErrorPolicySkipRule, ErrorPolicyFixedValue:
+	default:
+		return ErrorUnknownErrorPolicy
+	}
 	return nil
 }
 
+// now returns the time the evaluation is performed as of.
+func (o *checkFlagOptions) now() time.Time {
+	if o.evaluationTime.IsZero() {
+		return time.Now()
+	}
+	return o.evaluationTime
+}
+
 // WithCreditCost gates a credit-balance condition on `balance >= cost` when
 // the condition's credit_id matches. Lets callers supply an already-
 // computed per-call cost in credits, bypassing the engine's default
@@ -130,3 +189,108 @@ func WithEventUsage(eventSubtype string, quantity int64) CheckFlagOption {
 		o.eventUsage = &eventUsage{eventSubtype: eventSubtype, quantity: quantity}
 	}
 }
+
+// WithEvaluationTime evaluates the flag as of t rather than the current
+// time. t decides whether the flag and each of its rules are within their
+// StartsAt/EndsAt activation windows, so it can change the value returned,
+// and sets time-dependent outputs such as
+// CheckFlagResult.FeatureUsageResetAt; company metrics are still read as
+// supplied. Useful for reproducing a past decision or for deterministic
+// tests. A zero t means the current time.
+func WithEvaluationTime(t time.Time) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		o.evaluationTime = t
+	}
+}
+
+// WithEvaluationBudget caps the number of conditions CheckFlag checks while
+// evaluating a flag, across all of its rules. An evaluation that needs more
+// stops with ErrorEvaluationBudgetExceeded, so a pathological flag can't
+// stall the caller. Zero means no limit; negative budgets are rejected by
+// CheckFlag with ErrorNegativeEvaluationBudget.
+func WithEvaluationBudget(maxConditions int) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		o.evaluationBudget = maxConditions
+	}
+}
+
+// ErrorPolicy decides what CheckFlag does when a rule fails to evaluate,
+// typically because one of its conditions is misconfigured.
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyAbort stops the evaluation at the failing rule and returns
+	// the error along with the flag's default value. This is the default.
+	ErrorPolicyAbort ErrorPolicy = "abort"
+
+	// ErrorPolicySkipRule treats the failing rule as not matching and
+	// carries on with the next one, so the rest of the flag still decides
+	// the value.
+	ErrorPolicySkipRule ErrorPolicy = "skip_rule"
+
+	// ErrorPolicyFixedValue stops the evaluation at the failing rule and
+	// serves the value set with WithErrorValue, false unless set.
+	ErrorPolicyFixedValue ErrorPolicy = "fixed_value"
+)
+
+// WithErrorPolicy sets what CheckFlag does when a rule fails to evaluate.
+// Under any policy but ErrorPolicyAbort, CheckFlag returns no error for a
+// failing rule; the error is recorded on CheckFlagResult.SkippedErrors
+// instead, and EvaluationHook.OnError is not called for it. Cancellation
+// and exhausted evaluation budgets stop the evaluation under every policy.
+// Unknown policies are rejected by CheckFlag with ErrorUnknownErrorPolicy.
+func WithErrorPolicy(policy ErrorPolicy) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		o.errorPolicy = policy
+	}
+}
+
+// WithErrorValue serves value whenever a rule fails to evaluate, failing
+// open with true or closed with false. It implies ErrorPolicyFixedValue.
+func WithErrorValue(value bool) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		o.errorPolicy = ErrorPolicyFixedValue
+		o.errorValue = value
+	}
+}
+
+// PreflightOptions is the serializable form of the preflight options, for
+// callers that receive them over the wire (the WASM bridges, for example)
+// rather than constructing them in Go.
+type PreflightOptions struct {
+	// CreditCosts maps credit IDs to per-call costs; see WithCreditCost.
+	CreditCosts map[string]float64 `json:"credit_costs,omitempty"`
+
+	// EventUsage simulates usage of one event subtype; see WithEventUsage.
+	EventUsage *PreflightEventUsage `json:"event_usage,omitempty"`
+
+	// Usage simulates a generic quantity; see WithUsage.
+	Usage *int64 `json:"usage,omitempty"`
+}
+
+// PreflightEventUsage pairs an event subtype with a simulated quantity.
+type PreflightEventUsage struct {
+	EventSubtype string `json:"event_subtype"`
+	Quantity     int64  `json:"quantity"`
+}
+
+// CheckFlagOptions converts p to the equivalent CheckFlagOptions. A nil p
+// yields no options.
+func (p *PreflightOptions) CheckFlagOptions() []CheckFlagOption {
+	if p == nil {
+		return nil
+	}
+
+	var opts []CheckFlagOption
+	for _, creditID := range sortedKeys(p.CreditCosts) {
+		opts = append(opts, WithCreditCost(creditID, p.CreditCosts[creditID]))
+	}
+	if p.EventUsage != nil {
+		opts = append(opts, WithEventUsage(p.EventUsage.EventSubtype, p.EventUsage.Quantity))
+	}
+	if p.Usage != nil {
+		opts = append(opts, WithUsage(*p.Usage))
+	}
+
+	return opts
+}
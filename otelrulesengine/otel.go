@@ -0,0 +1,122 @@
+// Package otelrulesengine adapts OpenTelemetry tracer and meter providers to
+// the rulesengine.Tracer and rulesengine.Meter instrumentation interfaces.
+//
+//	tracer := otelrulesengine.NewTracer(otel.GetTracerProvider())
+//	meter, err := otelrulesengine.NewMeter(otel.GetMeterProvider())
+//	engine := rulesengine.NewEngine(rulesengine.WithTracer(tracer), rulesengine.WithMeter(meter))
+package otelrulesengine
+
+import (
+	"context"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope used for tracers and meters created
+// by this package.
+const ScopeName = "github.com/schematichq/rulesengine"
+
+// Metric instrument names.
+const (
+	MetricEvaluations = "rulesengine.evaluations"
+	MetricErrors      = "rulesengine.errors"
+	MetricDuration    = "rulesengine.evaluation.duration"
+)
+
+// NewTracer returns a rulesengine.Tracer that records spans with a tracer
+// obtained from tp.
+func NewTracer(tp trace.TracerProvider) rulesengine.Tracer {
+	return &otelTracer{tracer: tp.Tracer(ScopeName)}
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t *otelTracer) Start(ctx context.Context, name string) (context.Context, rulesengine.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SetAttributes(attrs ...rulesengine.Attribute) {
+	s.span.SetAttributes(toKeyValues(attrs)...)
+}
+
+func (s *otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *otelSpan) End() {
+	s.span.End()
+}
+
+// NewMeter returns a rulesengine.Meter that records the evaluation counters
+// and duration histogram with a meter obtained from mp.
+func NewMeter(mp metric.MeterProvider) (rulesengine.Meter, error) {
+	m := mp.Meter(ScopeName)
+
+	evaluations, err := m.Int64Counter(
+		MetricEvaluations,
+		metric.WithDescription("Number of flag evaluations"),
+		metric.WithUnit("{evaluation}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	errs, err := m.Int64Counter(
+		MetricErrors,
+		metric.WithDescription("Number of flag evaluations that resulted in an error"),
+		metric.WithUnit("{evaluation}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := m.Float64Histogram(
+		MetricDuration,
+		metric.WithDescription("Duration of flag evaluations"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otelMeter{evaluations: evaluations, errors: errs, duration: duration}, nil
+}
+
+type otelMeter struct {
+	evaluations metric.Int64Counter
+	errors      metric.Int64Counter
+	duration    metric.Float64Histogram
+}
+
+func (m *otelMeter) AddEvaluation(ctx context.Context, attrs ...rulesengine.Attribute) {
+	m.evaluations.Add(ctx, 1, metric.WithAttributes(toKeyValues(attrs)...))
+}
+
+func (m *otelMeter) AddError(ctx context.Context, attrs ...rulesengine.Attribute) {
+	m.errors.Add(ctx, 1, metric.WithAttributes(toKeyValues(attrs)...))
+}
+
+func (m *otelMeter) RecordLatency(ctx context.Context, duration time.Duration, attrs ...rulesengine.Attribute) {
+	m.duration.Record(ctx, duration.Seconds(), metric.WithAttributes(toKeyValues(attrs)...))
+}
+
+func toKeyValues(attrs []rulesengine.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, attribute.String(attr.Key, attr.Value))
+	}
+	return kvs
+}
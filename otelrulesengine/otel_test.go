@@ -0,0 +1,124 @@
+package otelrulesengine_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/otelrulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newFlag(rules ...*rulesengine.Rule) *rulesengine.Flag {
+	return &rulesengine.Flag{
+		ID:    "flag_1",
+		Key:   "my-flag",
+		Rules: rules,
+	}
+}
+
+func spanAttrs(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value.AsString()
+	}
+	return attrs
+}
+
+func findMetric(t *testing.T, rm metricdata.ResourceMetrics, name string) metricdata.Metrics {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	t.Fatalf("metric %s not recorded", name)
+	return metricdata.Metrics{}
+}
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Exports a span for a matched rule", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		rule := &rulesengine.Rule{ID: "rule_1", Name: "everyone", RuleType: rulesengine.RuleTypeGlobalOverride, Value: true}
+		_, err := rulesengine.CheckFlag(ctx, &rulesengine.Company{ID: "comp_1"}, nil, newFlag(rule),
+			rulesengine.WithTracer(otelrulesengine.NewTracer(tp)))
+		require.NoError(t, err)
+
+		spans := exporter.GetSpans().Snapshots()
+		require.Len(t, spans, 1)
+		assert.Equal(t, rulesengine.SpanNameCheckFlag, spans[0].Name())
+		assert.Equal(t, otelrulesengine.ScopeName, spans[0].InstrumentationScope().Name)
+
+		attrs := spanAttrs(spans[0])
+		assert.Equal(t, "my-flag", attrs[rulesengine.AttributeFlagKey])
+		assert.Equal(t, "rule_1", attrs[rulesengine.AttributeRuleID])
+		assert.Equal(t, string(rulesengine.RuleTypeGlobalOverride), attrs[rulesengine.AttributeRuleType])
+		assert.Equal(t, "true", attrs[rulesengine.AttributeValue])
+		assert.Contains(t, attrs[rulesengine.AttributeReason], "Matched global override rule")
+	})
+
+	t.Run("Marks the span as errored", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		_, err := rulesengine.CheckFlag(ctx, nil, nil, newFlag(), rulesengine.WithUsage(-1),
+			rulesengine.WithTracer(otelrulesengine.NewTracer(tp)))
+		require.Error(t, err)
+
+		spans := exporter.GetSpans().Snapshots()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		require.Len(t, spans[0].Events(), 1)
+		assert.Equal(t, "exception", spans[0].Events()[0].Name)
+	})
+}
+
+func TestMeter(t *testing.T) {
+	ctx := context.Background()
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	meter, err := otelrulesengine.NewMeter(mp)
+	require.NoError(t, err)
+
+	flag := newFlag()
+	for i := 0; i < 2; i++ {
+		_, err := rulesengine.CheckFlag(ctx, nil, nil, flag, rulesengine.WithMeter(meter))
+		require.NoError(t, err)
+	}
+	_, err = rulesengine.CheckFlag(ctx, nil, nil, flag, rulesengine.WithMeter(meter), rulesengine.WithUsage(-1))
+	require.Error(t, err)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+
+	evaluations := findMetric(t, rm, otelrulesengine.MetricEvaluations).Data.(metricdata.Sum[int64])
+	var total int64
+	for _, dp := range evaluations.DataPoints {
+		total += dp.Value
+	}
+	assert.Equal(t, int64(3), total)
+
+	errs := findMetric(t, rm, otelrulesengine.MetricErrors).Data.(metricdata.Sum[int64])
+	require.Len(t, errs.DataPoints, 1)
+	assert.Equal(t, int64(1), errs.DataPoints[0].Value)
+
+	duration := findMetric(t, rm, otelrulesengine.MetricDuration).Data.(metricdata.Histogram[float64])
+	var count uint64
+	for _, dp := range duration.DataPoints {
+		count += dp.Count
+	}
+	assert.Equal(t, uint64(3), count)
+}
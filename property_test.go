@@ -0,0 +1,290 @@
+package rulesengine_test
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/rulesenginetest"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// propertyIterations is how many generated cases each property test checks.
+const propertyIterations = 500
+
+// Generated models draw their IDs from small pools so that conditions match
+// often enough to exercise both outcomes.
+var (
+	genCompanyIDs      = []string{"comp_a", "comp_b", "comp_c"}
+	genUserIDs         = []string{"user_a", "user_b", "user_c"}
+	genPlanIDs         = []string{"plan_a", "plan_b", "plan_c", "plan_d"}
+	genPlanVersionIDs  = []string{"plnv_a", "plnv_b", "plnv_c"}
+	genProductIDs      = []string{"bilp_a", "bilp_b", "bilp_c"}
+	genEventSubtypes   = []string{"api_calls", "seats"}
+	genCreditIDs       = []string{"bcrd_a", "bcrd_b"}
+	genCompanyTraitDef = &rulesengine.TraitDefinition{ID: "trt_company", ComparableType: typeconvert.ComparableTypeInt, EntityType: rulesengine.EntityTypeCompany}
+	genUserTraitDef    = &rulesengine.TraitDefinition{ID: "trt_user", ComparableType: typeconvert.ComparableTypeString, EntityType: rulesengine.EntityTypeUser}
+	genUserTraitValues = []string{"admin", "member", "viewer", ""}
+
+	genResourceConditionTypes = []rulesengine.ConditionType{
+		rulesengine.ConditionTypeCompany,
+		rulesengine.ConditionTypeUser,
+		rulesengine.ConditionTypePlan,
+		rulesengine.ConditionTypePlanVersion,
+		rulesengine.ConditionTypeBasePlan,
+		rulesengine.ConditionTypeBillingProduct,
+	}
+	genOrderedOperators = []typeconvert.ComparableOperator{
+		typeconvert.ComparableOperatorEquals,
+		typeconvert.ComparableOperatorNotEquals,
+		typeconvert.ComparableOperatorGt,
+		typeconvert.ComparableOperatorLt,
+		typeconvert.ComparableOperatorGte,
+		typeconvert.ComparableOperatorLte,
+	}
+	// Global overrides and default rules are left out: they always match, so
+	// they would decide most generated flags on their own.
+	genRuleTypes = []rulesengine.RuleType{
+		rulesengine.RuleTypeStandard,
+		rulesengine.RuleTypeStandard,
+		rulesengine.RuleTypeStandard,
+		rulesengine.RuleTypePlanEntitlement,
+		rulesengine.RuleTypePlanEntitlementUsageExceeded,
+		rulesengine.RuleTypeCompanyOverride,
+		rulesengine.RuleTypeCompanyOverrideUsageExceeded,
+	}
+)
+
+// generator builds random valid flags, companies and users from a seed, so
+// a failing case can be reproduced from the seed alone.
+type generator struct {
+	r *rand.Rand
+}
+
+func newGenerator(seed uint64) *generator {
+	return &generator{r: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func pick[T any](g *generator, items []T) T {
+	return items[g.r.IntN(len(items))]
+}
+
+func (g *generator) bool() bool {
+	return g.r.IntN(2) == 0
+}
+
+func (g *generator) subset(items []string) []string {
+	var subset []string
+	for _, item := range items {
+		if g.bool() {
+			subset = append(subset, item)
+		}
+	}
+	return subset
+}
+
+// company returns a company, with company override rules for the flag with
+// flagID.
+func (g *generator) company(flagID string) *rulesengine.Company {
+	builder := rulesenginetest.NewCompany().
+		ID(pick(g, genCompanyIDs)).
+		PlanIDs(g.subset(genPlanIDs)...).
+		PlanVersionIDs(g.subset(genPlanVersionIDs)...).
+		BillingProductIDs(g.subset(genProductIDs)...).
+		BasePlanID(pick(g, append([]string{""}, genPlanIDs...)))
+
+	for _, subtype := range genEventSubtypes {
+		if g.bool() {
+			builder.Metric(subtype, rulesengine.MetricPeriodAllTime, g.r.Int64N(20))
+		}
+	}
+	if g.bool() {
+		builder.Trait(genCompanyTraitDef, strconv.Itoa(g.r.IntN(20)))
+	}
+	for _, creditID := range genCreditIDs {
+		if g.bool() {
+			builder.CreditBalance(creditID, float64(g.r.IntN(5)))
+		}
+	}
+	if g.r.IntN(4) == 0 {
+		builder.Rules(g.rule(rulesengine.RuleTypeCompanyOverride).FlagID(flagID).Build())
+	}
+
+	return builder.Build()
+}
+
+func (g *generator) user() *rulesengine.User {
+	builder := rulesenginetest.NewUser().ID(pick(g, genUserIDs))
+	if g.bool() {
+		builder.Trait(genUserTraitDef, pick(g, genUserTraitValues))
+	}
+	return builder.Build()
+}
+
+// resourceCondition returns a condition on resource IDs of conditionType,
+// using the equals operator.
+func (g *generator) resourceCondition(conditionType rulesengine.ConditionType) *rulesengine.Condition {
+	var pool []string
+	switch conditionType {
+	case rulesengine.ConditionTypeCompany:
+		pool = genCompanyIDs
+	case rulesengine.ConditionTypeUser:
+		pool = genUserIDs
+	case rulesengine.ConditionTypePlanVersion:
+		pool = genPlanVersionIDs
+	case rulesengine.ConditionTypeBillingProduct:
+		pool = genProductIDs
+	default:
+		pool = genPlanIDs
+	}
+
+	return rulesenginetest.NewCondition(conditionType).ResourceIDs(g.subset(pool)...).Build()
+}
+
+func (g *generator) condition() *rulesengine.Condition {
+	switch g.r.IntN(4) {
+	case 0:
+		return rulesenginetest.NewMetricCondition(pick(g, genEventSubtypes), pick(g, genOrderedOperators), g.r.Int64N(20)).Build()
+	case 1:
+		if g.bool() {
+			return rulesenginetest.NewTraitCondition(genCompanyTraitDef, pick(g, genOrderedOperators), strconv.Itoa(g.r.IntN(20))).Build()
+		}
+		return rulesenginetest.NewTraitCondition(genUserTraitDef, pick(g, genOrderedOperators), pick(g, genUserTraitValues)).Build()
+	case 2:
+		return rulesenginetest.NewCreditCondition(pick(g, genCreditIDs), float64(1+g.r.IntN(3))).Build()
+	}
+
+	condition := g.resourceCondition(pick(g, genResourceConditionTypes))
+	if g.bool() {
+		condition.Operator = typeconvert.ComparableOperatorNotEquals
+	}
+	return condition
+}
+
+func (g *generator) rule(ruleType rulesengine.RuleType) *rulesenginetest.RuleBuilder {
+	builder := rulesenginetest.NewRule().
+		Type(ruleType).
+		Priority(g.r.Int64N(5)).
+		Value(g.bool())
+	for range g.r.IntN(3) {
+		builder.Conditions(g.condition())
+	}
+	for range g.r.IntN(2) {
+		group := make([]*rulesengine.Condition, 1+g.r.IntN(2))
+		for i := range group {
+			group[i] = g.condition()
+		}
+		builder.ConditionGroup(group...)
+	}
+	return builder
+}
+
+func (g *generator) flag() *rulesengine.Flag {
+	builder := rulesenginetest.NewFlag().ID("flag_generated").DefaultValue(g.bool())
+	for range g.r.IntN(5) {
+		builder.Rules(g.rule(pick(g, genRuleTypes)).Build())
+	}
+	return builder.Build()
+}
+
+func TestProperties(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("A global override decides the value", func(t *testing.T) {
+		for seed := range uint64(propertyIterations) {
+			g := newGenerator(seed)
+			flag := g.flag()
+			company, user := g.company(flag.ID), g.user()
+			override := rulesenginetest.NewRule().Type(rulesengine.RuleTypeGlobalOverride).Value(g.bool()).Build()
+			flag.Rules = append(flag.Rules, override)
+
+			result, err := rulesengine.CheckFlag(ctx, company, user, flag)
+
+			require.NoError(t, err, "seed %d", seed)
+			assert.Equal(t, override.Value, result.Value, "seed %d", seed)
+			require.NotNil(t, result.RuleID, "seed %d", seed)
+			assert.Equal(t, override.ID, *result.RuleID, "seed %d", seed)
+		}
+	})
+
+	t.Run("Not equals negates equals for resource conditions", func(t *testing.T) {
+		for seed := range uint64(propertyIterations) {
+			g := newGenerator(seed)
+			company, user := g.company(""), g.user()
+			conditionType := pick(g, genResourceConditionTypes)
+			condition := g.resourceCondition(conditionType)
+			flag := rulesenginetest.NewFlag().Rules(rulesenginetest.NewRule().Conditions(condition).Build()).Build()
+
+			equals, err := rulesengine.CheckFlag(ctx, company, user, flag)
+			require.NoError(t, err)
+			condition.Operator = typeconvert.ComparableOperatorNotEquals
+			notEquals, err := rulesengine.CheckFlag(ctx, company, user, flag)
+			require.NoError(t, err)
+
+			assert.NotEqual(t, equals.Value, notEquals.Value, "seed %d: %s condition on %v", seed, conditionType, condition.ResourceIDs)
+		}
+	})
+
+	t.Run("Results come from the matched rule or the default", func(t *testing.T) {
+		for seed := range uint64(propertyIterations) {
+			g := newGenerator(seed)
+			flag := g.flag()
+
+			company := g.company(flag.ID)
+
+			result, err := rulesengine.CheckFlag(ctx, company, g.user(), flag)
+
+			require.NoError(t, err, "seed %d", seed)
+			checkResultSource(t, flag, company, result)
+		}
+	})
+
+	t.Run("Rule order within a flag does not change the result", func(t *testing.T) {
+		for seed := range uint64(propertyIterations) {
+			g := newGenerator(seed)
+			flag := g.flag()
+			company, user := g.company(flag.ID), g.user()
+			// Ties in priority are broken by order, so give every rule its own.
+			for i, rule := range flag.Rules {
+				rule.Priority = int64(i)
+			}
+
+			before, err := rulesengine.CheckFlag(ctx, company, user, flag)
+			require.NoError(t, err)
+			g.r.Shuffle(len(flag.Rules), func(i, j int) {
+				flag.Rules[i], flag.Rules[j] = flag.Rules[j], flag.Rules[i]
+			})
+			after, err := rulesengine.CheckFlag(ctx, company, user, flag)
+			require.NoError(t, err)
+
+			assert.Equal(t, before.Value, after.Value, "seed %d", seed)
+		}
+	})
+}
+
+// checkResultSource checks that a result's value is its matched rule's value,
+// or the flag's default when no rule matched.
+func checkResultSource(t *testing.T, flag *rulesengine.Flag, company *rulesengine.Company, result *rulesengine.CheckFlagResult) {
+	t.Helper()
+
+	if result.RuleID == nil {
+		assert.Equal(t, flag.DefaultValue, result.Value, "no rule matched")
+		return
+	}
+
+	rules := flag.Rules
+	if company != nil {
+		rules = append(rules[:len(rules):len(rules)], company.Rules...)
+	}
+	for _, rule := range rules {
+		if rule != nil && rule.ID == *result.RuleID {
+			assert.Equal(t, rule.Value, result.Value, "matched rule %s", rule.ID)
+			return
+		}
+	}
+	assert.Fail(t, "matched rule is not part of the flag", "rule %s", *result.RuleID)
+}
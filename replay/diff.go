@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/schematichq/rulesengine"
+)
+
+// Diff is a difference between a recorded and a replayed result.
+type Diff struct {
+	// Path locates the field by its JSON names, such as "rule_id" or
+	// "entitlement.allocation". Errors are compared under "error".
+	Path string `json:"path"`
+
+	// Expected and Actual are the recorded and replayed JSON values; nil
+	// when the field is absent or null.
+	Expected any `json:"expected"`
+	Actual   any `json:"actual"`
+}
+
+func (d *Diff) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", d.Path, formatValue(d.Expected), formatValue(d.Actual))
+}
+
+func formatValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// diffResults compares the JSON forms of two results field by field. Err is
+// left out, since errors are compared by message.
+func diffResults(expected, actual *rulesengine.CheckFlagResult, ignore map[string]bool) []*Diff {
+	var diffs []*Diff
+	diffValues("", resultValue(expected), resultValue(actual), ignore, &diffs)
+	return diffs
+}
+
+// resultValue returns the generic JSON form of a result. Numbers are kept as
+// json.Number so int64 values compare exactly.
+func resultValue(result *rulesengine.CheckFlagResult) any {
+	if result == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err.Error()
+	}
+
+	var v map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return err.Error()
+	}
+	delete(v, "err")
+	return v
+}
+
+func diffValues(path string, expected, actual any, ignore map[string]bool, diffs *[]*Diff) {
+	if ignore[path] {
+		return
+	}
+
+	switch e := expected.(type) {
+	case map[string]any:
+		if a, ok := actual.(map[string]any); ok {
+			keys := make(map[string]bool, len(e)+len(a))
+			for key := range e {
+				keys[key] = true
+			}
+			for key := range a {
+				keys[key] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for key := range keys {
+				sorted = append(sorted, key)
+			}
+			sort.Strings(sorted)
+
+			for _, key := range sorted {
+				childPath := key
+				if path != "" {
+					childPath = path + "." + key
+				}
+				diffValues(childPath, e[key], a[key], ignore, diffs)
+			}
+			return
+		}
+	case []any:
+		if a, ok := actual.([]any); ok {
+			for i := 0; i < len(e) || i < len(a); i++ {
+				var ev, av any
+				if i < len(e) {
+					ev = e[i]
+				}
+				if i < len(a) {
+					av = a[i]
+				}
+				diffValues(fmt.Sprintf("%s[%d]", path, i), ev, av, ignore, diffs)
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		*diffs = append(*diffs, &Diff{Path: path, Expected: expected, Actual: actual})
+	}
+}
@@ -0,0 +1,315 @@
+// Package replay re-evaluates recorded flag checks with the current engine
+// and reports where the results differ, so engine changes can be regression
+// tested against captured production traffic before they ship.
+//
+// Recordings are JSON Lines: one Record per line, each holding the inputs of
+// a CheckFlag call and the result it produced at the time.
+//
+//	replayer := replay.New(replay.IgnoreFields("feature_usage_reset_at"))
+//	summary, err := replayer.Replay(ctx, file, func(outcome *replay.Outcome) error {
+//		if !outcome.Matched() {
+//			log.Println(outcome)
+//		}
+//		return nil
+//	})
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+)
+
+// Record is one recorded evaluation.
+type Record struct {
+	// ID optionally identifies the record in reports.
+	ID string `json:"id,omitempty"`
+
+	// VersionKey is the rulesengine.VersionKey the models were serialized
+	// under. Records from older versions are migrated before evaluation; an
+	// empty key is treated as the current version.
+	VersionKey string `json:"version_key,omitempty"`
+
+	// EvaluatedAt is when the original evaluation ran. When set, the replay
+	// evaluates as of the same time, so reset times are reproducible.
+	EvaluatedAt *time.Time `json:"evaluated_at,omitempty"`
+
+	Company *rulesengine.Company          `json:"company,omitempty"`
+	User    *rulesengine.User             `json:"user,omitempty"`
+	Flag    *rulesengine.Flag             `json:"flag"`
+	Options *rulesengine.PreflightOptions `json:"options,omitempty"`
+
+	// Expected is the result the original evaluation returned.
+	Expected *rulesengine.CheckFlagResult `json:"expected"`
+
+	// ExpectedError is the message of the error the original evaluation
+	// returned, either from CheckFlag or on the result's Err.
+	ExpectedError string `json:"expected_error,omitempty"`
+}
+
+// rawRecord defers decoding of the models until their version is known.
+type rawRecord struct {
+	ID            string                        `json:"id"`
+	VersionKey    string                        `json:"version_key"`
+	EvaluatedAt   *time.Time                    `json:"evaluated_at"`
+	Company       json.RawMessage               `json:"company"`
+	User          json.RawMessage               `json:"user"`
+	Flag          json.RawMessage               `json:"flag"`
+	Options       *rulesengine.PreflightOptions `json:"options"`
+	Expected      json.RawMessage               `json:"expected"`
+	ExpectedError string                        `json:"expected_error"`
+}
+
+// Outcome is the result of replaying one record.
+type Outcome struct {
+	// Line is the 1-based line of the record in the recording.
+	Line int
+
+	// Record is the decoded record; nil if it could not be decoded.
+	Record *Record
+
+	// Result and Error are what the current engine returned.
+	Result *rulesengine.CheckFlagResult
+	Error  string
+
+	// Diffs lists the differences from the recorded result.
+	Diffs []*Diff
+
+	// DecodeErr is set if the record could not be decoded or migrated, in
+	// which case it was not evaluated.
+	DecodeErr error
+}
+
+// Matched reports whether the record was replayed with an identical result.
+func (o *Outcome) Matched() bool {
+	return o.DecodeErr == nil && len(o.Diffs) == 0
+}
+
+func (o *Outcome) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "line %d", o.Line)
+	if o.Record != nil && o.Record.ID != "" {
+		fmt.Fprintf(&buf, " (%s)", o.Record.ID)
+	}
+
+	switch {
+	case o.DecodeErr != nil:
+		fmt.Fprintf(&buf, ": %v", o.DecodeErr)
+	case len(o.Diffs) == 0:
+		buf.WriteString(": matched")
+	default:
+		buf.WriteString(": mismatch")
+		for _, diff := range o.Diffs {
+			fmt.Fprintf(&buf, "\n  %s", diff)
+		}
+	}
+
+	return buf.String()
+}
+
+// Summary counts the outcomes of a replay.
+type Summary struct {
+	Total      int `json:"total"`
+	Matched    int `json:"matched"`
+	Mismatched int `json:"mismatched"`
+	Failed     int `json:"failed"`
+}
+
+// OK reports whether every record was replayed with an identical result.
+func (s *Summary) OK() bool {
+	return s.Mismatched == 0 && s.Failed == 0
+}
+
+func (s *Summary) add(outcome *Outcome) {
+	s.Total++
+	switch {
+	case outcome.DecodeErr != nil:
+		s.Failed++
+	case len(outcome.Diffs) > 0:
+		s.Mismatched++
+	default:
+		s.Matched++
+	}
+}
+
+// Option configures a Replayer.
+type Option func(*Replayer)
+
+// WithEngine evaluates records with engine, so hooks and instrumentation
+// configured on it apply to the replay.
+func WithEngine(engine *rulesengine.Engine) Option {
+	return func(r *Replayer) {
+		r.engine = engine
+	}
+}
+
+// WithMigrations migrates records from older versions with registry instead
+// of rulesengine.DefaultMigrations.
+func WithMigrations(registry *rulesengine.MigrationRegistry) Option {
+	return func(r *Replayer) {
+		r.migrations = registry
+	}
+}
+
+// IgnoreFields excludes result fields from comparison. Paths use the JSON
+// names, such as "feature_usage_reset_at" or "entitlement.usage"; ignoring a
+// field ignores everything beneath it.
+func IgnoreFields(paths ...string) Option {
+	return func(r *Replayer) {
+		for _, path := range paths {
+			r.ignore[path] = true
+		}
+	}
+}
+
+// Replayer re-evaluates recorded evaluations.
+type Replayer struct {
+	engine     *rulesengine.Engine
+	migrations *rulesengine.MigrationRegistry
+	ignore     map[string]bool
+}
+
+// New returns a Replayer configured by opts.
+func New(opts ...Option) *Replayer {
+	r := &Replayer{
+		migrations: rulesengine.DefaultMigrations,
+		ignore:     make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Replay streams the JSON Lines recording in, replays each record and passes
+// its outcome to fn. Blank lines are skipped, and records that fail to decode
+// are reported as failed outcomes rather than stopping the replay. Replay
+// stops early if reading fails, ctx is done or fn returns an error.
+func (r *Replayer) Replay(ctx context.Context, in io.Reader, fn func(*Outcome) error) (*Summary, error) {
+	summary := &Summary{}
+	reader := bufio.NewReader(in)
+
+	for line := 1; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return summary, err
+		}
+
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 {
+			outcome := r.replayLine(ctx, trimmed)
+			outcome.Line = line
+			summary.add(outcome)
+			if fn != nil {
+				if err := fn(outcome); err != nil {
+					return summary, err
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return summary, nil
+		}
+	}
+}
+
+func (r *Replayer) replayLine(ctx context.Context, data []byte) *Outcome {
+	record, err := r.decode(data)
+	if err != nil {
+		return &Outcome{Record: record, DecodeErr: err}
+	}
+	return r.ReplayRecord(ctx, record)
+}
+
+// decode decodes a record, migrating its models to the current version.
+func (r *Replayer) decode(data []byte) (*Record, error) {
+	var raw rawRecord
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decoding record: %w", err)
+	}
+
+	record := &Record{
+		ID:            raw.ID,
+		VersionKey:    raw.VersionKey,
+		EvaluatedAt:   raw.EvaluatedAt,
+		Options:       raw.Options,
+		ExpectedError: raw.ExpectedError,
+	}
+
+	from := raw.VersionKey
+	if from == "" {
+		from = rulesengine.VersionKey
+	}
+
+	var err error
+	if record.Company, err = decodeModel[rulesengine.Company](r.migrations, from, raw.Company); err != nil {
+		return record, fmt.Errorf("decoding company: %w", err)
+	}
+	if record.User, err = decodeModel[rulesengine.User](r.migrations, from, raw.User); err != nil {
+		return record, fmt.Errorf("decoding user: %w", err)
+	}
+	if record.Flag, err = decodeModel[rulesengine.Flag](r.migrations, from, raw.Flag); err != nil {
+		return record, fmt.Errorf("decoding flag: %w", err)
+	}
+	if record.Expected, err = decodeModel[rulesengine.CheckFlagResult](r.migrations, from, raw.Expected); err != nil {
+		return record, fmt.Errorf("decoding expected result: %w", err)
+	}
+
+	if record.Flag == nil {
+		return record, errors.New("record has no flag")
+	}
+	if record.Expected == nil {
+		return record, errors.New("record has no expected result")
+	}
+	return record, nil
+}
+
+// decodeModel migrates data from version key from and decodes it, returning
+// nil for an absent or null model.
+func decodeModel[T any](migrations *rulesengine.MigrationRegistry, from string, data json.RawMessage) (*T, error) {
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+
+	v := new(T)
+	if err := migrations.Unmarshal(from, data, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ReplayRecord re-evaluates a single record and compares the result with the
+// recorded one.
+func (r *Replayer) ReplayRecord(ctx context.Context, record *Record) *Outcome {
+	opts := record.Options.CheckFlagOptions()
+	if record.EvaluatedAt != nil {
+		opts = append(opts, rulesengine.WithEvaluationTime(*record.EvaluatedAt))
+	}
+
+	result, err := r.engine.CheckFlag(ctx, record.Company, record.User, record.Flag, opts...)
+	if err == nil && result != nil {
+		err = result.Err
+	}
+
+	outcome := &Outcome{Record: record, Result: result}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+
+	if outcome.Error != record.ExpectedError {
+		outcome.Diffs = append(outcome.Diffs, &Diff{Path: "error", Expected: record.ExpectedError, Actual: outcome.Error})
+	}
+	outcome.Diffs = append(outcome.Diffs, diffResults(record.Expected, result, r.ignore)...)
+
+	return outcome
+}
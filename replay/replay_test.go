@@ -0,0 +1,277 @@
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/replay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testInputs() (*rulesengine.Company, *rulesengine.Flag) {
+	subtype := "api-calls"
+	period := rulesengine.MetricPeriodCurrentMonth
+	limit := int64(10)
+
+	company := &rulesengine.Company{
+		ID: "comp_1",
+		Metrics: rulesengine.CompanyMetricCollection{{
+			CompanyID:    "comp_1",
+			EventSubtype: subtype,
+			Period:       period,
+			MonthReset:   rulesengine.MetricPeriodMonthResetFirst,
+			Value:        8,
+		}},
+	}
+	flag := &rulesengine.Flag{ID: "flag_1", Key: "metered", Rules: []*rulesengine.Rule{{
+		ID:       "rule_1",
+		Name:     "Metered",
+		RuleType: rulesengine.RuleTypePlanEntitlement,
+		Value:    true,
+		Conditions: []*rulesengine.Condition{{
+			ID:            "cond_1",
+			ConditionType: rulesengine.ConditionTypeMetric,
+			Operator:      "lte",
+			EventSubtype:  &subtype,
+			MetricValue:   &limit,
+			MetricPeriod:  &period,
+		}},
+	}}}
+
+	return company, flag
+}
+
+// record evaluates the inputs and captures them along with the result, the
+// way a recording would.
+func record(t *testing.T, id string, options *rulesengine.PreflightOptions) *replay.Record {
+	t.Helper()
+
+	company, flag := testInputs()
+	evaluatedAt := time.Date(2024, time.February, 10, 12, 0, 0, 0, time.UTC)
+	opts := append(options.CheckFlagOptions(), rulesengine.WithEvaluationTime(evaluatedAt))
+	result, err := rulesengine.CheckFlag(context.Background(), company, nil, flag, opts...)
+
+	rec := &replay.Record{
+		ID:          id,
+		VersionKey:  rulesengine.VersionKey,
+		EvaluatedAt: &evaluatedAt,
+		Company:     company,
+		Flag:        flag,
+		Options:     options,
+		Expected:    result,
+	}
+	if err == nil {
+		err = result.Err
+	}
+	if err != nil {
+		rec.ExpectedError = err.Error()
+	}
+	return rec
+}
+
+func recording(t *testing.T, lines ...any) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if s, ok := line.(string); ok {
+			buf.WriteString(s)
+		} else {
+			data, err := json.Marshal(line)
+			require.NoError(t, err)
+			buf.Write(data)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func replayAll(t *testing.T, replayer *replay.Replayer, in string) ([]*replay.Outcome, *replay.Summary) {
+	t.Helper()
+
+	var outcomes []*replay.Outcome
+	summary, err := replayer.Replay(context.Background(), strings.NewReader(in), func(outcome *replay.Outcome) error {
+		outcomes = append(outcomes, outcome)
+		return nil
+	})
+	require.NoError(t, err)
+	return outcomes, summary
+}
+
+func TestReplay(t *testing.T) {
+	usage := int64(5)
+	negative := int64(-1)
+
+	t.Run("Unchanged evaluations match", func(t *testing.T) {
+		in := recording(t,
+			record(t, "plain", nil),
+			record(t, "preflight", &rulesengine.PreflightOptions{Usage: &usage}),
+			record(t, "error", &rulesengine.PreflightOptions{Usage: &negative}),
+		)
+
+		outcomes, summary := replayAll(t, replay.New(), in)
+
+		assert.Equal(t, &replay.Summary{Total: 3, Matched: 3}, summary)
+		assert.True(t, summary.OK())
+		for i, outcome := range outcomes {
+			assert.True(t, outcome.Matched(), outcome.String())
+			assert.Equal(t, i+1, outcome.Line)
+		}
+		assert.Equal(t, "line 1 (plain): matched", outcomes[0].String())
+	})
+
+	t.Run("Changed results are reported with diffs", func(t *testing.T) {
+		rec := record(t, "changed", nil)
+		rec.Expected.Value = false
+		otherRule := "rule_2"
+		rec.Expected.RuleID = &otherRule
+		rec.Expected.FeatureUsageEvent = nil
+
+		outcomes, summary := replayAll(t, replay.New(), recording(t, rec))
+
+		assert.Equal(t, &replay.Summary{Total: 1, Mismatched: 1}, summary)
+		assert.False(t, summary.OK())
+		require.Len(t, outcomes, 1)
+		assert.Equal(t, []*replay.Diff{
+			{Path: "feature_usage_event", Expected: nil, Actual: "api-calls"},
+			{Path: "rule_id", Expected: "rule_2", Actual: "rule_1"},
+			{Path: "value", Expected: false, Actual: true},
+		}, outcomes[0].Diffs)
+		assert.Equal(t, strings.Join([]string{
+			"line 1 (changed): mismatch",
+			`  feature_usage_event: expected null, got "api-calls"`,
+			`  rule_id: expected "rule_2", got "rule_1"`,
+			"  value: expected false, got true",
+		}, "\n"), outcomes[0].String())
+	})
+
+	t.Run("Errors are compared by message", func(t *testing.T) {
+		rec := record(t, "error", &rulesengine.PreflightOptions{Usage: &negative})
+		rec.ExpectedError = ""
+
+		outcomes, _ := replayAll(t, replay.New(), recording(t, rec))
+
+		require.Len(t, outcomes[0].Diffs, 1)
+		assert.Equal(t, "error", outcomes[0].Diffs[0].Path)
+		assert.Equal(t, rulesengine.ErrorNegativePreflightUsage.Error(), outcomes[0].Error)
+	})
+
+	t.Run("Ignored fields are not compared", func(t *testing.T) {
+		rec := record(t, "", nil)
+		rec.EvaluatedAt = nil
+		rec.Expected.Entitlement = &rulesengine.FeatureEntitlement{FeatureKey: "metered"}
+
+		outcomes, _ := replayAll(t, replay.New(), recording(t, rec))
+		require.Len(t, outcomes[0].Diffs, 2)
+		assert.Equal(t, "entitlement", outcomes[0].Diffs[0].Path)
+		assert.Equal(t, "feature_usage_reset_at", outcomes[0].Diffs[1].Path)
+
+		outcomes, _ = replayAll(t, replay.New(replay.IgnoreFields("entitlement", "feature_usage_reset_at")), recording(t, rec))
+		assert.True(t, outcomes[0].Matched())
+	})
+
+	t.Run("Undecodable records fail without stopping the replay", func(t *testing.T) {
+		noFlag := record(t, "no-flag", nil)
+		noFlag.Flag = nil
+
+		in := recording(t, `{"flag": `, "", noFlag, record(t, "ok", nil))
+		outcomes, summary := replayAll(t, replay.New(), in)
+
+		assert.Equal(t, &replay.Summary{Total: 3, Matched: 1, Failed: 2}, summary)
+		require.Len(t, outcomes, 3)
+		assert.Error(t, outcomes[0].DecodeErr)
+		assert.Equal(t, 1, outcomes[0].Line)
+		assert.EqualError(t, outcomes[1].DecodeErr, "record has no flag")
+		assert.Equal(t, 3, outcomes[1].Line)
+		assert.True(t, outcomes[2].Matched())
+		assert.Equal(t, 4, outcomes[2].Line)
+	})
+
+	t.Run("Recorded errors on the result are decoded", func(t *testing.T) {
+		in := recording(t, record(t, "error", &rulesengine.PreflightOptions{Usage: &negative}))
+		assert.Contains(t, in, `"err":{"code":"invalid_preflight"`)
+
+		outcomes, summary := replayAll(t, replay.New(), in)
+		assert.True(t, summary.OK())
+		assert.ErrorIs(t, outcomes[0].Record.Expected.Err, rulesengine.ErrorNegativePreflightUsage)
+	})
+
+	t.Run("Errors recorded before they had a wire form are tolerated", func(t *testing.T) {
+		rec := record(t, "error", &rulesengine.PreflightOptions{Usage: &negative})
+		rec.VersionKey = "ad96bec2"
+		in := regexp.MustCompile(`"err":\{[^}]*\}`).ReplaceAllString(recording(t, rec), `"err":{}`)
+
+		outcomes, summary := replayAll(t, replay.New(), in)
+		assert.True(t, summary.OK())
+		assert.Equal(t, rulesengine.ErrorCodeUnexpected, rulesengine.ErrorCodeOf(outcomes[0].Record.Expected.Err))
+	})
+
+	t.Run("Records from older versions are migrated", func(t *testing.T) {
+		const oldKey = "0ldv3rsn"
+		migrations := rulesengine.NewMigrationRegistry()
+		migrations.MustRegister(oldKey, rulesengine.VersionKey, rulesengine.ModelFlag, rulesengine.RenameField("default", "default_value"))
+
+		rec := record(t, "old", nil)
+		rec.VersionKey = oldKey
+		rec.Flag.DefaultValue = true
+		rec.Flag.Rules = nil
+		rec.Expected, _ = rulesengine.CheckFlag(context.Background(), rec.Company, nil, rec.Flag)
+		in := strings.Replace(recording(t, rec), `"default_value":true`, `"default":true`, 1)
+
+		outcomes, _ := replayAll(t, replay.New(replay.WithMigrations(migrations)), in)
+		assert.True(t, outcomes[0].Matched(), outcomes[0].String())
+		assert.True(t, outcomes[0].Record.Flag.DefaultValue)
+
+		outcomes, _ = replayAll(t, replay.New(), in)
+		assert.ErrorIs(t, outcomes[0].DecodeErr, rulesengine.ErrNoMigrationPath)
+	})
+
+	t.Run("Replays with the engine's options", func(t *testing.T) {
+		var evaluated int
+		hook := &countingHook{count: &evaluated}
+
+		_, summary := replayAll(t, replay.New(replay.WithEngine(rulesengine.NewEngine(rulesengine.WithHooks(hook)))), recording(t, record(t, "", nil)))
+
+		assert.True(t, summary.OK())
+		assert.Equal(t, 1, evaluated)
+	})
+
+	t.Run("Stops when the callback fails", func(t *testing.T) {
+		stop := errors.New("stop")
+		in := recording(t, record(t, "1", nil), record(t, "2", nil))
+
+		summary, err := replay.New().Replay(context.Background(), strings.NewReader(in), func(*replay.Outcome) error {
+			return stop
+		})
+
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, summary.Total)
+	})
+
+	t.Run("Stops when the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		summary, err := replay.New().Replay(ctx, strings.NewReader(recording(t, record(t, "", nil))), nil)
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Zero(t, summary.Total)
+	})
+}
+
+type countingHook struct {
+	rulesengine.NoopHook
+	count *int
+}
+
+func (h *countingHook) AfterEvaluation(ctx context.Context, eval *rulesengine.HookEvaluation, result *rulesengine.CheckFlagResult) {
+	*h.count++
+}
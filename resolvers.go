@@ -0,0 +1,165 @@
+package rulesengine
+
+import (
+	"context"
+	"fmt"
+)
+
+// TraitResolver loads traits the company or user being evaluated doesn't
+// carry, so callers don't need to fetch every trait a flag might reference
+// up front. A nil trait with a nil error means the entity has no value for
+// the trait, as if it were absent from the model.
+type TraitResolver interface {
+	ResolveTrait(ctx context.Context, entityType EntityType, entityID string, definition *TraitDefinition) (*Trait, error)
+}
+
+// TraitResolverFunc adapts a function to a TraitResolver.
+type TraitResolverFunc func(ctx context.Context, entityType EntityType, entityID string, definition *TraitDefinition) (*Trait, error)
+
+func (f TraitResolverFunc) ResolveTrait(ctx context.Context, entityType EntityType, entityID string, definition *TraitDefinition) (*Trait, error) {
+	return f(ctx, entityType, entityID, definition)
+}
+
+// MetricResolver loads company metrics the company being evaluated doesn't
+// carry. The period and month reset are resolved to their defaults, all_time
+// and first_of_month, before the resolver is called. A nil metric with a nil
+// error means the company has no usage recorded, as if it were absent from
+// the model.
+type MetricResolver interface {
+	ResolveMetric(ctx context.Context, companyID string, eventSubtype string, period MetricPeriod, monthReset MetricPeriodMonthReset) (*CompanyMetric, error)
+}
+
+// MetricResolverFunc adapts a function to a MetricResolver.
+type MetricResolverFunc func(ctx context.Context, companyID string, eventSubtype string, period MetricPeriod, monthReset MetricPeriodMonthReset) (*CompanyMetric, error)
+
+func (f MetricResolverFunc) ResolveMetric(ctx context.Context, companyID string, eventSubtype string, period MetricPeriod, monthReset MetricPeriodMonthReset) (*CompanyMetric, error) {
+	return f(ctx, companyID, eventSubtype, period, monthReset)
+}
+
+// WithTraitResolver resolves traits missing from the company or user with
+// resolver. Each trait is resolved at most once per CheckFlag call.
+func WithTraitResolver(resolver TraitResolver) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		o.traitResolver = resolver
+	}
+}
+
+// WithMetricResolver resolves metrics missing from the company with
+// resolver. Each metric is resolved at most once per CheckFlag call.
+func WithMetricResolver(resolver MetricResolver) CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		o.metricResolver = resolver
+	}
+}
+
+// resolverCache looks up traits and metrics on the models being evaluated,
+// falling back to the resolvers and memoizing what they return for the rest
+// of the evaluation. A nil cache only looks at the models.
+type resolverCache struct {
+	traitResolver  TraitResolver
+	metricResolver MetricResolver
+
+	traits  map[traitKey]resolved[*Trait]
+	metrics map[metricKey]resolved[*CompanyMetric]
+}
+
+type traitKey struct {
+	entityType   EntityType
+	entityID     string
+	definitionID string
+}
+
+type metricKey struct {
+	companyID string
+	companyMetricKey
+}
+
+type resolved[T any] struct {
+	value T
+	err   error
+}
+
+// newResolverCache returns a cache for the resolvers, or nil if there are
+// none.
+func newResolverCache(traitResolver TraitResolver, metricResolver MetricResolver) *resolverCache {
+	if traitResolver == nil && metricResolver == nil {
+		return nil
+	}
+	return &resolverCache{
+		traitResolver:  traitResolver,
+		metricResolver: metricResolver,
+		traits:         map[traitKey]resolved[*Trait]{},
+		metrics:        map[metricKey]resolved[*CompanyMetric]{},
+	}
+}
+
+// trait returns the trait with the definition found by lookup, or resolves
+// it for the entity. It returns nil if neither has it.
+func (c *resolverCache) trait(
+	ctx context.Context,
+	entityType EntityType,
+	entityID string,
+	lookup func(definitionID string) *Trait,
+	definition *TraitDefinition,
+) (*Trait, error) {
+	if trait := lookup(definition.ID); trait != nil {
+		return trait, nil
+	}
+	if c == nil || c.traitResolver == nil {
+		return nil, nil
+	}
+
+	key := traitKey{entityType: entityType, entityID: entityID, definitionID: definition.ID}
+	if r, ok := c.traits[key]; ok {
+		return r.value, r.err
+	}
+
+	trait, err := c.traitResolver.ResolveTrait(ctx, entityType, entityID, definition)
+	if err != nil {
+		// A resolver failing because the evaluation was canceled hasn't
+		// failed; report the cancellation, which ends the evaluation under
+		// any error policy, and leave the key uncached.
+		if canceled := checkCanceled(ctx); canceled != nil {
+			return nil, canceled
+		}
+		trait, err = nil, fmt.Errorf("%w: trait %s: %w", ErrorResolverFailed, definition.ID, err)
+	} else if trait != nil && trait.TraitDefinition == nil {
+		trait = &Trait{TraitDefinition: definition, Value: trait.Value}
+	}
+
+	c.traits[key] = resolved[*Trait]{value: trait, err: err}
+	return trait, err
+}
+
+// companyMetric returns the company's metric, or resolves it. It returns nil
+// if neither has it.
+func (c *resolverCache) companyMetric(
+	ctx context.Context,
+	company *Company,
+	eventSubtype string,
+	period *MetricPeriod,
+	monthReset *MetricPeriodMonthReset,
+) (*CompanyMetric, error) {
+	if metric := company.FindMetric(eventSubtype, period, monthReset); metric != nil {
+		return metric, nil
+	}
+	if c == nil || c.metricResolver == nil {
+		return nil, nil
+	}
+
+	key := metricKey{companyID: company.ID, companyMetricKey: newCompanyMetricKey(eventSubtype, period, monthReset)}
+	if r, ok := c.metrics[key]; ok {
+		return r.value, r.err
+	}
+
+	metric, err := c.metricResolver.ResolveMetric(ctx, key.companyID, eventSubtype, key.period, key.monthReset)
+	if err != nil {
+		if canceled := checkCanceled(ctx); canceled != nil {
+			return nil, canceled
+		}
+		metric, err = nil, fmt.Errorf("%w: metric %s: %w", ErrorResolverFailed, eventSubtype, err)
+	}
+
+	c.metrics[key] = resolved[*CompanyMetric]{value: metric, err: err}
+	return metric, err
+}
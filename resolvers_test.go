@@ -0,0 +1,219 @@
+package rulesengine_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/rulesenginetest"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type resolverContextKey struct{}
+
+// metricCall records the arguments a MetricResolver was called with.
+type metricCall struct {
+	companyID    string
+	eventSubtype string
+	period       rulesengine.MetricPeriod
+	monthReset   rulesengine.MetricPeriodMonthReset
+}
+
+// countingMetricResolver resolves every metric to value and records its
+// calls.
+func countingMetricResolver(value int64, calls *[]metricCall) rulesengine.MetricResolver {
+	return rulesengine.MetricResolverFunc(func(ctx context.Context, companyID string, eventSubtype string, period rulesengine.MetricPeriod, monthReset rulesengine.MetricPeriodMonthReset) (*rulesengine.CompanyMetric, error) {
+		*calls = append(*calls, metricCall{companyID, eventSubtype, period, monthReset})
+		return &rulesengine.CompanyMetric{CompanyID: companyID, EventSubtype: eventSubtype, Period: period, MonthReset: monthReset, Value: value}, nil
+	})
+}
+
+func TestResolvers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Missing metrics are resolved", func(t *testing.T) {
+		company := createTestCompany()
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Value(true).Conditions(
+				rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorLt, 10).Build(),
+			).Build(),
+		).Build()
+
+		var calls []metricCall
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithMetricResolver(countingMetricResolver(5, &calls)))
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+		assert.Equal(t, []metricCall{{company.ID, "api_calls", rulesengine.MetricPeriodAllTime, rulesengine.MetricPeriodMonthResetFirst}}, calls)
+
+		result, err = rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithMetricResolver(countingMetricResolver(50, &calls)))
+		require.NoError(t, err)
+		assert.False(t, result.Value)
+		assert.Len(t, calls, 2)
+	})
+
+	t.Run("Metrics on the company are not resolved", func(t *testing.T) {
+		company := rulesenginetest.NewCompany().Metric("api_calls", rulesengine.MetricPeriodCurrentMonth, 5).Build()
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Value(true).Conditions(
+				rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorLt, 10).Period(rulesengine.MetricPeriodCurrentMonth).Build(),
+			).Build(),
+		).Build()
+
+		var calls []metricCall
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithMetricResolver(countingMetricResolver(50, &calls)))
+
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+		assert.Empty(t, calls)
+	})
+
+	t.Run("Resolved values are memoized for the evaluation", func(t *testing.T) {
+		company := createTestCompany()
+		rule := func(limit int64) *rulesengine.Rule {
+			return rulesenginetest.NewRule().Priority(limit).Value(true).Conditions(
+				rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorGt, limit).Build(),
+			).Build()
+		}
+		flag := rulesenginetest.NewFlag().Rules(rule(100), rule(200), rule(300)).Build()
+
+		var calls []metricCall
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithMetricResolver(countingMetricResolver(5, &calls)))
+
+		require.NoError(t, err)
+		assert.False(t, result.Value)
+		assert.Len(t, calls, 1)
+	})
+
+	t.Run("Missing traits are resolved for their entity", func(t *testing.T) {
+		company, user := createTestCompany(), createTestUser()
+		companyDef := createTestTraitDefinition(typeconvert.ComparableTypeInt, rulesengine.EntityTypeCompany)
+		userDef := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Value(true).Conditions(
+				rulesenginetest.NewTraitCondition(companyDef, typeconvert.ComparableOperatorGte, "3").Build(),
+				rulesenginetest.NewTraitCondition(userDef, typeconvert.ComparableOperatorEquals, "admin").Build(),
+			).Build(),
+		).Build()
+
+		var requested []string
+		resolver := rulesengine.TraitResolverFunc(func(ctx context.Context, entityType rulesengine.EntityType, entityID string, definition *rulesengine.TraitDefinition) (*rulesengine.Trait, error) {
+			requested = append(requested, string(entityType)+":"+entityID)
+			switch definition.ID {
+			case companyDef.ID:
+				return &rulesengine.Trait{Value: "4"}, nil
+			case userDef.ID:
+				return &rulesengine.Trait{TraitDefinition: definition, Value: "admin"}, nil
+			}
+			return nil, nil
+		})
+
+		result, err := rulesengine.CheckFlag(ctx, company, user, flag, rulesengine.WithTraitResolver(resolver))
+
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+		assert.Equal(t, []string{"company:" + company.ID, "user:" + user.ID}, requested)
+	})
+
+	t.Run("Traits resolved as absent compare as empty", func(t *testing.T) {
+		def := createTestTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeCompany)
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Value(true).Conditions(
+				rulesenginetest.NewTraitCondition(def, typeconvert.ComparableOperatorIsEmpty, "").Build(),
+			).Build(),
+		).Build()
+		resolver := rulesengine.TraitResolverFunc(func(ctx context.Context, entityType rulesengine.EntityType, entityID string, definition *rulesengine.TraitDefinition) (*rulesengine.Trait, error) {
+			return nil, nil
+		})
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithTraitResolver(resolver))
+
+		require.NoError(t, err)
+		assert.True(t, result.Value)
+	})
+
+	t.Run("Resolvers receive the evaluation's context", func(t *testing.T) {
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Conditions(
+				rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorLt, 10).Build(),
+			).Build(),
+		).Build()
+
+		var got any
+		resolver := rulesengine.MetricResolverFunc(func(ctx context.Context, companyID string, eventSubtype string, period rulesengine.MetricPeriod, monthReset rulesengine.MetricPeriodMonthReset) (*rulesengine.CompanyMetric, error) {
+			got = ctx.Value(resolverContextKey{})
+			return nil, nil
+		})
+
+		_, err := rulesengine.CheckFlag(context.WithValue(ctx, resolverContextKey{}, "request"), createTestCompany(), nil, flag, rulesengine.WithMetricResolver(resolver))
+
+		require.NoError(t, err)
+		assert.Equal(t, "request", got)
+	})
+
+	t.Run("Resolver errors fail the condition", func(t *testing.T) {
+		condition := rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorLt, 10).Build()
+		rule := rulesenginetest.NewRule().Conditions(condition).Build()
+		flag := rulesenginetest.NewFlag().Rules(rule).Build()
+		dbErr := errors.New("connection refused")
+		resolver := rulesengine.MetricResolverFunc(func(ctx context.Context, companyID string, eventSubtype string, period rulesengine.MetricPeriod, monthReset rulesengine.MetricPeriodMonthReset) (*rulesengine.CompanyMetric, error) {
+			return nil, dbErr
+		})
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag, rulesengine.WithMetricResolver(resolver))
+
+		require.ErrorIs(t, err, dbErr)
+		assert.ErrorIs(t, err, rulesengine.ErrorResolverFailed)
+		assert.Equal(t, rulesengine.ErrorCodeResolverFailed, rulesengine.ErrorCodeOf(err))
+		assert.ErrorContains(t, err, "resolver failed: metric api_calls: connection refused")
+		var evalErr *rulesengine.EvaluationError
+		require.ErrorAs(t, err, &evalErr)
+		assert.Equal(t, rule.ID, evalErr.RuleID)
+		assert.Equal(t, condition.ID, evalErr.ConditionID)
+		assert.Equal(t, flag.DefaultValue, result.Value)
+	})
+
+	t.Run("Resolver errors after cancellation cancel the evaluation", func(t *testing.T) {
+		condition := rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorLt, 10).Build()
+		rule := rulesenginetest.NewRule().Conditions(condition).Build()
+		later := rulesenginetest.NewRule().Value(true).Build()
+		flag := rulesenginetest.NewFlag().Rules(rule, later).Build()
+
+		var calls int
+		cancelCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		resolver := rulesengine.MetricResolverFunc(func(ctx context.Context, companyID string, eventSubtype string, period rulesengine.MetricPeriod, monthReset rulesengine.MetricPeriodMonthReset) (*rulesengine.CompanyMetric, error) {
+			calls++
+			cancel()
+			return nil, ctx.Err()
+		})
+
+		result, err := rulesengine.CheckFlag(cancelCtx, createTestCompany(), nil, flag, rulesengine.WithMetricResolver(resolver), rulesengine.WithErrorPolicy(rulesengine.ErrorPolicySkipRule))
+
+		require.ErrorIs(t, err, rulesengine.ErrorEvaluationCanceled)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, rulesengine.ErrorResolverFailed)
+		assert.Equal(t, rulesengine.ErrorCodeCanceled, rulesengine.ErrorCodeOf(err))
+		assert.Nil(t, result.RuleID)
+		assert.Equal(t, flag.DefaultValue, result.Value)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Entitlement usage comes from resolved metrics", func(t *testing.T) {
+		company := createTestCompany()
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Type(rulesengine.RuleTypePlanEntitlement).Value(true).Conditions(
+				rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorLt, 10).Build(),
+			).Build(),
+		).Build()
+
+		var calls []metricCall
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithMetricResolver(countingMetricResolver(7, &calls)))
+
+		require.NoError(t, err)
+		rulesenginetest.AssertUsage(t, result, 7, 10)
+		assert.Len(t, calls, 1)
+	})
+}
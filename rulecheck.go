@@ -3,16 +3,24 @@ package rulesengine
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/schematichq/rulesengine/set"
 	"github.com/schematichq/rulesengine/typeconvert"
 )
 
+// CheckScope is what a rule's conditions are evaluated against. Its methods
+// give condition evaluators the traits, metrics, preflight options and budget
+// of the evaluation.
 type CheckScope struct {
 	Company *Company
 	Rule    *Rule
 	User    *User
 
+	// EvaluationTime is the instant rule activation windows are checked
+	// against. Zero means the current time.
+	EvaluationTime time.Time
+
 	// Preflight options, populated by CheckFlag from CheckFlagOption setters.
 	// Unexported so external callers of RuleCheckService.Check can't bypass
 	// the validation that CheckFlag runs on these values. Empty/nil == legacy
@@ -20,18 +28,161 @@ type CheckScope struct {
 	creditCost map[string]float64
 	usage      *int64
 	eventUsage *eventUsage
+
+	// budget is shared by the scopes of one CheckFlag evaluation. Nil means
+	// no limit.
+	budget *evaluationBudget
+
+	// resolvers is shared by the scopes of one CheckFlag evaluation, so each
+	// trait and metric is resolved once. Nil means only the models are
+	// consulted.
+	resolvers *resolverCache
+}
+
+// evaluationBudget counts down the conditions an evaluation may still check.
+type evaluationBudget struct {
+	remaining int
+}
+
+// newEvaluationBudget returns a budget of maxConditions, or nil for no limit.
+func newEvaluationBudget(maxConditions int) *evaluationBudget {
+	if maxConditions <= 0 {
+		return nil
+	}
+	return &evaluationBudget{remaining: maxConditions}
+}
+
+// spend takes one condition from the budget.
+func (b *evaluationBudget) spend() error {
+	if b == nil {
+		return nil
+	}
+	if b.remaining == 0 {
+		return ErrorEvaluationBudgetExceeded
+	}
+	b.remaining--
+	return nil
+}
+
+// checkCanceled returns an error matching both ErrorEvaluationCanceled and
+// the context's error once ctx is done.
+func checkCanceled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrorEvaluationCanceled, err)
+	}
+	return nil
 }
 
 type CheckResult struct {
 	*CheckScope
 	Match bool
+
+	// Inactive is set when the rule was skipped because the evaluation time
+	// is outside its activation window.
+	Inactive bool
+}
+
+func (s *CheckScope) now() time.Time {
+	if s.EvaluationTime.IsZero() {
+		return time.Now()
+	}
+	return s.EvaluationTime
+}
+
+// Trait returns the trait with definition of the scope's company or user,
+// whichever the definition's entity type names, resolving it if the model
+// doesn't carry it. A trait neither has is returned with only the
+// definition; nil is returned when the scope has no such entity.
+func (s *CheckScope) Trait(ctx context.Context, definition *TraitDefinition) (*Trait, error) {
+	if definition == nil {
+		return nil, nil
+	}
+	return s.trait(ctx, definition.EntityType, definition)
+}
+
+// trait is Trait looking definition up on the entity of entityType, which
+// comparison traits take from the trait they're compared with.
+func (s *CheckScope) trait(ctx context.Context, entityType EntityType, definition *TraitDefinition) (*Trait, error) {
+	if definition == nil {
+		return nil, nil
+	}
+
+	var trait *Trait
+	var err error
+	switch {
+	case entityType == EntityTypeCompany && s.Company != nil:
+		trait, err = s.resolvers.trait(ctx, entityType, s.Company.ID, s.Company.FindTrait, definition)
+	case entityType == EntityTypeUser && s.User != nil:
+		trait, err = s.resolvers.trait(ctx, entityType, s.User.ID, s.User.FindTrait, definition)
+	default:
+		return nil, nil
+	}
+	if err != nil || trait != nil {
+		return trait, err
+	}
+
+	return &Trait{TraitDefinition: definition}, nil
+}
+
+// Metric returns the scope's company's metric, resolving it if the company
+// doesn't carry it. A nil period means all_time and a nil
+// month reset first_of_month. It returns nil when neither has the metric or the scope has no
+// company.
+func (s *CheckScope) Metric(ctx context.Context, eventSubtype string, period *MetricPeriod, monthReset *MetricPeriodMonthReset) (*CompanyMetric, error) {
+	if s.Company == nil {
+		return nil, nil
+	}
+	return s.resolvers.companyMetric(ctx, s.Company, eventSubtype, period, monthReset)
+}
+
+// CreditCost returns the per-call cost of creditID set with WithCreditCost,
+// and whether one was set.
+func (s *CheckScope) CreditCost(creditID string) (float64, bool) {
+	cost, ok := s.creditCost[creditID]
+	return cost, ok
+}
+
+// Usage returns the generic quantity simulated with WithUsage, or zero.
+func (s *CheckScope) Usage() int64 {
+	if s.usage == nil {
+		return 0
+	}
+	return *s.usage
+}
+
+// EventUsage returns the quantity of eventSubtype simulated with
+// WithEventUsage, or zero when none was simulated for it.
+func (s *CheckScope) EventUsage(eventSubtype string) int64 {
+	if s.eventUsage == nil || s.eventUsage.eventSubtype != eventSubtype {
+		return 0
+	}
+	return s.eventUsage.quantity
+}
+
+// RemainingConditions returns how many more conditions the evaluation may
+// check under WithMaxConditions, and false when it has no limit. The
+// condition being evaluated has already been counted.
+func (s *CheckScope) RemainingConditions() (int, bool) {
+	if s.budget == nil {
+		return 0, false
+	}
+	return s.budget.remaining, true
 }
 
 type RuleCheckService struct {
+	conditions *ConditionRegistry
 }
 
+// NewRuleCheckService returns a service evaluating conditions with
+// DefaultConditions.
 func NewRuleCheckService() *RuleCheckService {
-	return &RuleCheckService{}
+	return &RuleCheckService{conditions: DefaultConditions}
+}
+
+// NewRuleCheckServiceWithConditions returns a service evaluating conditions
+// with conditions.
+func NewRuleCheckServiceWithConditions(conditions *ConditionRegistry) *RuleCheckService {
+	return &RuleCheckService{conditions: conditions}
 }
 
 func (s *RuleCheckService) Check(ctx context.Context, scope *CheckScope) (res *CheckResult, err error) {
@@ -43,6 +194,15 @@ func (s *RuleCheckService) Check(ctx context.Context, scope *CheckScope) (res *C
 		return
 	}
 
+	if err = checkCanceled(ctx); err != nil {
+		return
+	}
+
+	if !scope.Rule.IsActiveAt(scope.now()) {
+		res.Inactive = true
+		return
+	}
+
 	if scope.Rule.RuleType == RuleTypeDefault || scope.Rule.RuleType == RuleTypeGlobalOverride {
 		res.Match = true
 		return
@@ -72,28 +232,44 @@ func (s *RuleCheckService) checkCondition(ctx context.Context, scope *CheckScope
 		return false, nil
 	}
 
-	switch condition.ConditionType {
-	case ConditionTypeCompany:
-		return s.checkCompanyCondition(ctx, scope.Company, condition)
-	case ConditionTypeMetric:
-		return s.checkMetricCondition(ctx, scope, condition)
-	case ConditionTypeBasePlan:
-		return s.checkBasePlanCondition(ctx, scope.Company, condition)
-	case ConditionTypePlan:
-		return s.checkPlanCondition(ctx, scope.Company, condition)
-	case ConditionTypePlanVersion:
-		return s.checkPlanVersionCondition(ctx, scope.Company, condition)
-	case ConditionTypeTrait:
-		return s.checkTraitCondition(ctx, scope, condition)
-	case ConditionTypeUser:
-		return s.checkUserCondition(ctx, scope.User, condition)
-	case ConditionTypeBillingProduct:
-		return s.checkBillingProductCondition(ctx, scope.Company, condition)
-	case ConditionTypeCredit:
-		return s.checkCreditBalanceCondition(ctx, scope, condition)
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Errors without a code of their own mean the condition couldn't be
+		// evaluated as configured.
+		if ErrorCodeOf(err) == ErrorCodeUnexpected {
+			err = fmt.Errorf("%w: %w", ErrorInvalidCondition, err)
+		}
+		err = withEvaluationIDs(err, "", scope.Rule.ID, condition.ID)
+	}()
+
+	if err = checkCanceled(ctx); err != nil {
+		return false, err
+	}
+	if err = scope.budget.spend(); err != nil {
+		return false, err
+	}
+
+	conditions := s.conditions
+	if conditions == nil {
+		conditions = DefaultConditions
+	}
+	evaluator, custom, ok := conditions.lookup(condition.ConditionType)
+	if !ok {
+		return false, nil
 	}
 
-	return
+	// A panic in a registered evaluator fails its condition, but one in a
+	// built-in evaluator is a bug in the engine and must not be hidden.
+	if custom {
+		defer func() {
+			if r := recover(); r != nil {
+				match, err = false, fmt.Errorf("condition evaluator panicked: %v", r)
+			}
+		}()
+	}
+	return evaluator.EvaluateCondition(ctx, scope, condition)
 }
 
 func (s *RuleCheckService) checkConditionGroup(ctx context.Context, scope *CheckScope, group *ConditionGroup) (bool, error) {
@@ -116,12 +292,12 @@ func (s *RuleCheckService) checkConditionGroup(ctx context.Context, scope *Check
 	return false, nil
 }
 
-func (s *RuleCheckService) checkCompanyCondition(ctx context.Context, company *Company, condition *Condition) (bool, error) {
-	if condition.ConditionType != ConditionTypeCompany || company == nil {
+func (s *RuleCheckService) checkCompanyCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+	if condition.ConditionType != ConditionTypeCompany || scope.Company == nil {
 		return false, nil
 	}
 
-	resourceMatch := set.NewSet(condition.ResourceIDs...).Contains(company.ID)
+	resourceMatch := set.NewSet(condition.ResourceIDs...).Contains(scope.Company.ID)
 	if condition.Operator == typeconvert.ComparableOperatorNotEquals {
 		return !resourceMatch, nil
 	}
@@ -157,28 +333,29 @@ func (s *RuleCheckService) checkCreditBalanceCondition(ctx context.Context, scop
 	//   3. usage: generic quantity (no event disambiguation); gate on
 	//      balance >= quantity × consumption_rate.
 	//   4. Legacy: balance >= consumption_rate (single unit).
-	if cost, ok := scope.creditCost[*condition.CreditID]; ok {
+	if cost, ok := scope.CreditCost(*condition.CreditID); ok {
 		return creditBalance >= cost, nil
 	}
 
-	if eu := scope.eventUsage; eu != nil && condition.EventSubtype != nil &&
-		eu.eventSubtype == *condition.EventSubtype && eu.quantity > 0 {
-		return creditBalance >= float64(eu.quantity)*consumptionRate, nil
+	if condition.EventSubtype != nil {
+		if quantity := scope.EventUsage(*condition.EventSubtype); quantity > 0 {
+			return creditBalance >= float64(quantity)*consumptionRate, nil
+		}
 	}
 
-	if scope.usage != nil && *scope.usage > 0 {
-		return creditBalance >= float64(*scope.usage)*consumptionRate, nil
+	if quantity := scope.Usage(); quantity > 0 {
+		return creditBalance >= float64(quantity)*consumptionRate, nil
 	}
 
 	return creditBalance >= consumptionRate, nil
 }
 
-func (s *RuleCheckService) checkBillingProductCondition(ctx context.Context, company *Company, condition *Condition) (bool, error) {
-	if condition.ConditionType != ConditionTypeBillingProduct || company == nil {
+func (s *RuleCheckService) checkBillingProductCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+	if condition.ConditionType != ConditionTypeBillingProduct || scope.Company == nil {
 		return false, nil
 	}
 
-	companyBillingProductIDs := set.NewSet(company.BillingProductIDs...)
+	companyBillingProductIDs := set.NewSet(scope.Company.BillingProductIDs...)
 	resourceMatch := set.NewSet(condition.ResourceIDs...).Intersection(companyBillingProductIDs).Len() > 0
 	if condition.Operator == typeconvert.ComparableOperatorNotEquals {
 		return !resourceMatch, nil
@@ -187,12 +364,12 @@ func (s *RuleCheckService) checkBillingProductCondition(ctx context.Context, com
 	return resourceMatch, nil
 }
 
-func (s *RuleCheckService) checkPlanCondition(ctx context.Context, company *Company, condition *Condition) (bool, error) {
-	if condition.ConditionType != ConditionTypePlan || company == nil {
+func (s *RuleCheckService) checkPlanCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+	if condition.ConditionType != ConditionTypePlan || scope.Company == nil {
 		return false, nil
 	}
 
-	companyPlanIDs := set.NewSet(company.PlanIDs...)
+	companyPlanIDs := set.NewSet(scope.Company.PlanIDs...)
 	resourceMatch := set.NewSet(condition.ResourceIDs...).Intersection(companyPlanIDs).Len() > 0
 	if condition.Operator == typeconvert.ComparableOperatorNotEquals {
 		return !resourceMatch, nil
@@ -201,12 +378,12 @@ func (s *RuleCheckService) checkPlanCondition(ctx context.Context, company *Comp
 	return resourceMatch, nil
 }
 
-func (s *RuleCheckService) checkPlanVersionCondition(ctx context.Context, company *Company, condition *Condition) (bool, error) {
-	if condition.ConditionType != ConditionTypePlanVersion || company == nil {
+func (s *RuleCheckService) checkPlanVersionCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+	if condition.ConditionType != ConditionTypePlanVersion || scope.Company == nil {
 		return false, nil
 	}
 
-	companyPlanVersionIDs := set.NewSet(company.PlanVersionIDs...)
+	companyPlanVersionIDs := set.NewSet(scope.Company.PlanVersionIDs...)
 	resourceMatch := set.NewSet(condition.ResourceIDs...).Intersection(companyPlanVersionIDs).Len() > 0
 
 	if condition.Operator == typeconvert.ComparableOperatorNotEquals {
@@ -216,8 +393,8 @@ func (s *RuleCheckService) checkPlanVersionCondition(ctx context.Context, compan
 	return resourceMatch, nil
 }
 
-func (s *RuleCheckService) checkBasePlanCondition(ctx context.Context, company *Company, condition *Condition) (bool, error) {
-	if condition.ConditionType != ConditionTypeBasePlan || company == nil {
+func (s *RuleCheckService) checkBasePlanCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+	if condition.ConditionType != ConditionTypeBasePlan || scope.Company == nil {
 		return false, nil
 	}
 
@@ -225,13 +402,13 @@ func (s *RuleCheckService) checkBasePlanCondition(ctx context.Context, company *
 
 	switch condition.Operator {
 	case typeconvert.ComparableOperatorEquals:
-		return company.BasePlanID != nil && conditionPlanIDSet.Contains(*company.BasePlanID), nil
+		return scope.Company.BasePlanID != nil && conditionPlanIDSet.Contains(*scope.Company.BasePlanID), nil
 	case typeconvert.ComparableOperatorNotEquals:
-		return company.BasePlanID == nil || !conditionPlanIDSet.Contains(*company.BasePlanID), nil
+		return scope.Company.BasePlanID == nil || !conditionPlanIDSet.Contains(*scope.Company.BasePlanID), nil
 	case typeconvert.ComparableOperatorIsEmpty:
-		return company.BasePlanID == nil, nil
+		return scope.Company.BasePlanID == nil, nil
 	case typeconvert.ComparableOperatorNotEmpty:
-		return company.BasePlanID != nil, nil
+		return scope.Company.BasePlanID != nil, nil
 	}
 
 	return false, nil
@@ -247,8 +424,15 @@ func (s *RuleCheckService) checkMetricCondition(
 		return false, nil
 	}
 
+	if condition.MetricValue == nil {
+		return false, ErrorMissingMetricValue
+	}
+
 	leftVal := int64(0)
-	metric := scope.Company.Metrics.Find(*condition.EventSubtype, condition.MetricPeriod, condition.MetricPeriodMonthReset)
+	metric, err := scope.Metric(ctx, *condition.EventSubtype, condition.MetricPeriod, condition.MetricPeriodMonthReset)
+	if err != nil {
+		return false, err
+	}
 	if metric != nil {
 		leftVal = metric.Value
 	}
@@ -256,19 +440,18 @@ func (s *RuleCheckService) checkMetricCondition(
 	// Preflight: simulate additional usage on top of the current metric value.
 	// eventUsage takes precedence over usage when its subtype matches the
 	// condition's.
-	if eu := scope.eventUsage; eu != nil && eu.eventSubtype == *condition.EventSubtype && eu.quantity > 0 {
-		leftVal += eu.quantity
-	} else if scope.usage != nil && *scope.usage > 0 {
-		leftVal += *scope.usage
-	}
-
-	if condition.MetricValue == nil {
-		return false, fmt.Errorf("expected metric value for condition: %s, but received nil ", condition.ID)
+	if quantity := scope.EventUsage(*condition.EventSubtype); quantity > 0 {
+		leftVal += quantity
+	} else if quantity := scope.Usage(); quantity > 0 {
+		leftVal += quantity
 	}
 
 	rightVal := *condition.MetricValue
 	if condition.ComparisonTraitDefinition != nil {
-		comparisonTrait := s.findTrait(ctx, condition.ComparisonTraitDefinition, scope.Company.Traits)
+		comparisonTrait, err := scope.trait(ctx, EntityTypeCompany, condition.ComparisonTraitDefinition)
+		if err != nil {
+			return false, err
+		}
 		if comparisonTrait == nil {
 			rightVal = 0
 		} else {
@@ -286,27 +469,31 @@ func (s *RuleCheckService) checkTraitCondition(ctx context.Context, scope *Check
 	}
 
 	traitDef := condition.TraitDefinition
-	var trait *Trait
-	var comparisonTrait *Trait
-	if traitDef.EntityType == EntityTypeCompany && scope.Company != nil {
-		trait = s.findTrait(ctx, traitDef, scope.Company.Traits)
-		comparisonTrait = s.findTrait(ctx, condition.ComparisonTraitDefinition, scope.Company.Traits)
-	} else if traitDef.EntityType == EntityTypeUser && scope.User != nil {
-		trait = s.findTrait(ctx, traitDef, scope.User.Traits)
-		comparisonTrait = s.findTrait(ctx, condition.ComparisonTraitDefinition, scope.User.Traits)
-	} else {
+	switch {
+	case traitDef.EntityType == EntityTypeCompany && scope.Company != nil:
+	case traitDef.EntityType == EntityTypeUser && scope.User != nil:
+	default:
 		return false, nil
 	}
 
+	trait, err := scope.Trait(ctx, traitDef)
+	if err != nil {
+		return false, err
+	}
+	comparisonTrait, err := scope.trait(ctx, traitDef.EntityType, condition.ComparisonTraitDefinition)
+	if err != nil {
+		return false, err
+	}
+
 	return s.compareTraits(ctx, scope, condition, trait, comparisonTrait), nil
 }
 
-func (s *RuleCheckService) checkUserCondition(ctx context.Context, user *User, condition *Condition) (bool, error) {
-	if condition.ConditionType != ConditionTypeUser || user == nil {
+func (s *RuleCheckService) checkUserCondition(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+	if condition.ConditionType != ConditionTypeUser || scope.User == nil {
 		return false, nil
 	}
 
-	resourceMatch := set.NewSet(condition.ResourceIDs...).Contains(user.ID)
+	resourceMatch := set.NewSet(condition.ResourceIDs...).Contains(scope.User.ID)
 	if condition.Operator == typeconvert.ComparableOperatorNotEquals {
 		return !resourceMatch, nil
 	}
@@ -333,26 +520,10 @@ func (s *RuleCheckService) compareTraits(ctx context.Context, scope *CheckScope,
 	// generic usage, simulate adding it to the trait value. eventUsage is
 	// intentionally not applied here because traits aren't keyed by
 	// event_subtype.
-	if comparableType == typeconvert.ComparableTypeInt && scope.usage != nil && *scope.usage > 0 {
+	if quantity := scope.Usage(); comparableType == typeconvert.ComparableTypeInt && quantity > 0 {
 		current := typeconvert.StringToInt64(leftVal)
-		leftVal = fmt.Sprintf("%d", current+*scope.usage)
+		leftVal = fmt.Sprintf("%d", current+quantity)
 	}
 
 	return typeconvert.Compare(leftVal, rightVal, comparableType, condition.Operator)
 }
-
-func (s *RuleCheckService) findTrait(ctx context.Context, traitDef *TraitDefinition, traits []*Trait) *Trait {
-	if traitDef == nil {
-		return nil
-	}
-
-	// If the company has the trait, return the view for this
-	if trait, ok := find(traits, func(trait *Trait) bool {
-		return trait.TraitDefinition != nil && trait.TraitDefinition.ID == traitDef.ID
-	}); ok {
-		return trait
-	}
-
-	// Otherwise, return a trait with only the definition
-	return &Trait{TraitDefinition: traitDef}
-}
@@ -0,0 +1,41 @@
+package rulesengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConditionPanics(t *testing.T) {
+	panicking := ConditionEvaluatorFunc(func(ctx context.Context, scope *CheckScope, condition *Condition) (bool, error) {
+		panic("boom")
+	})
+	scope := &CheckScope{
+		Company: &Company{ID: "company"},
+		Rule:    &Rule{ID: "rule", RuleType: RuleTypeStandard},
+	}
+
+	t.Run("Panics in built-in evaluators are not recovered", func(t *testing.T) {
+		// Stands in for a bug in one of the built-in evaluators, which can't
+		// be replaced through Register.
+		registry := NewConditionRegistry()
+		registry.evaluators[ConditionTypePlan] = panicking
+		service := NewRuleCheckServiceWithConditions(registry)
+
+		assert.PanicsWithValue(t, "boom", func() {
+			_, _ = service.checkCondition(context.Background(), scope, &Condition{ID: "condition", ConditionType: ConditionTypePlan})
+		})
+	})
+
+	t.Run("Panics in registered evaluators fail the condition", func(t *testing.T) {
+		registry := NewConditionRegistry()
+		registry.MustRegister("custom", panicking)
+		service := NewRuleCheckServiceWithConditions(registry)
+
+		match, err := service.checkCondition(context.Background(), scope, &Condition{ID: "condition", ConditionType: "custom"})
+
+		assert.False(t, match)
+		assert.ErrorIs(t, err, ErrorInvalidCondition)
+	})
+}
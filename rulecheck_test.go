@@ -3,6 +3,7 @@ package rulesengine_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/schematichq/rulesengine"
 	"github.com/schematichq/rulesengine/null"
@@ -28,6 +29,29 @@ func TestRuleCheckService(t *testing.T) {
 			assert.False(t, result.Match)
 		})
 
+		t.Run("Check skips rules outside their activation window", func(t *testing.T) {
+			svc := rulesengine.NewRuleCheckService()
+			rule := createTestRule()
+			rule.RuleType = rulesengine.RuleTypeGlobalOverride
+			startsAt := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+			rule.StartsAt = &startsAt
+
+			result, err := svc.Check(ctx, &rulesengine.CheckScope{Rule: rule, EvaluationTime: startsAt.Add(-time.Second)})
+			assert.NoError(t, err)
+			assert.False(t, result.Match)
+			assert.True(t, result.Inactive)
+
+			result, err = svc.Check(ctx, &rulesengine.CheckScope{Rule: rule, EvaluationTime: startsAt})
+			assert.NoError(t, err)
+			assert.True(t, result.Match)
+			assert.False(t, result.Inactive)
+
+			// Without an evaluation time, the current time is used.
+			result, err = svc.Check(ctx, &rulesengine.CheckScope{Rule: rule})
+			assert.NoError(t, err)
+			assert.True(t, result.Match)
+		})
+
 		t.Run("Check returns true for default rules", func(t *testing.T) {
 			svc := rulesengine.NewRuleCheckService()
 			company := createTestCompany()
@@ -57,6 +81,23 @@ func TestRuleCheckService(t *testing.T) {
 			assert.NoError(t, err)
 			assert.True(t, result.Match)
 		})
+
+		t.Run("Check returns an error once the context is done", func(t *testing.T) {
+			svc := rulesengine.NewRuleCheckService()
+			rule := createTestRule()
+			rule.RuleType = rulesengine.RuleTypeGlobalOverride
+			canceledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+
+			result, err := svc.Check(canceledCtx, &rulesengine.CheckScope{
+				Company: createTestCompany(),
+				Rule:    rule,
+			})
+
+			assert.ErrorIs(t, err, rulesengine.ErrorEvaluationCanceled)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.False(t, result.Match)
+		})
 	})
 
 	t.Run("Company targeting", func(t *testing.T) {
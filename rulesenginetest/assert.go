@@ -0,0 +1,135 @@
+package rulesenginetest
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+)
+
+// RequireResult stops the test unless the evaluation succeeded, and returns
+// the result for further assertions.
+func RequireResult(t testing.TB, result *rulesengine.CheckFlagResult, err error) *rulesengine.CheckFlagResult {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("evaluating flag: unexpected error: %v", err)
+	}
+	if result == nil {
+		t.Fatalf("evaluating flag: no result")
+	}
+	if result.Err != nil {
+		t.Fatalf("evaluating flag %q: result has error: %v", result.FlagKey, result.Err)
+	}
+	return result
+}
+
+// AssertValue checks the flag's value, reporting the reason on mismatch.
+func AssertValue(t testing.TB, result *rulesengine.CheckFlagResult, want bool) bool {
+	t.Helper()
+	if !checkResult(t, result) {
+		return false
+	}
+	if result.Value != want {
+		t.Errorf("flag %q: expected value %t, got %t (%s)", result.FlagKey, want, result.Value, result.Reason)
+		return false
+	}
+	return true
+}
+
+// AssertMatchedRule checks that the flag's value came from the rule with
+// ruleID.
+func AssertMatchedRule(t testing.TB, result *rulesengine.CheckFlagResult, ruleID string) bool {
+	t.Helper()
+	if !checkResult(t, result) {
+		return false
+	}
+	if result.RuleID == nil {
+		t.Errorf("flag %q: expected rule %q to match, but no rule matched (%s)", result.FlagKey, ruleID, result.Reason)
+		return false
+	}
+	if *result.RuleID != ruleID {
+		t.Errorf("flag %q: expected rule %q to match, got %q (%s)", result.FlagKey, ruleID, *result.RuleID, result.Reason)
+		return false
+	}
+	return true
+}
+
+// AssertNoRuleMatched checks that the flag fell back to its default value.
+func AssertNoRuleMatched(t testing.TB, result *rulesengine.CheckFlagResult) bool {
+	t.Helper()
+	if !checkResult(t, result) {
+		return false
+	}
+	if result.RuleID != nil {
+		t.Errorf("flag %q: expected no rule to match, got %q (%s)", result.FlagKey, *result.RuleID, result.Reason)
+		return false
+	}
+	return true
+}
+
+// AssertRuleType checks the type of the rule the flag's value came from.
+func AssertRuleType(t testing.TB, result *rulesengine.CheckFlagResult, want rulesengine.RuleType) bool {
+	t.Helper()
+	if !checkResult(t, result) {
+		return false
+	}
+	if result.RuleType == nil || *result.RuleType != want {
+		got := "none"
+		if result.RuleType != nil {
+			got = string(*result.RuleType)
+		}
+		t.Errorf("flag %q: expected rule type %s, got %s (%s)", result.FlagKey, want, got, result.Reason)
+		return false
+	}
+	return true
+}
+
+// AssertReason checks that the result's reason contains substr.
+func AssertReason(t testing.TB, result *rulesengine.CheckFlagResult, substr string) bool {
+	t.Helper()
+	if !checkResult(t, result) {
+		return false
+	}
+	if !strings.Contains(result.Reason, substr) {
+		t.Errorf("flag %q: expected reason to contain %q, got %q", result.FlagKey, substr, result.Reason)
+		return false
+	}
+	return true
+}
+
+// AssertUsage checks the feature usage and allocation reported for a
+// metered flag.
+func AssertUsage(t testing.TB, result *rulesengine.CheckFlagResult, usage, allocation int64) bool {
+	t.Helper()
+	if !checkResult(t, result) {
+		return false
+	}
+
+	ok := true
+	if result.FeatureUsage == nil || *result.FeatureUsage != usage {
+		t.Errorf("flag %q: expected usage %d, got %s", result.FlagKey, usage, formatInt64(result.FeatureUsage))
+		ok = false
+	}
+	if result.FeatureAllocation == nil || *result.FeatureAllocation != allocation {
+		t.Errorf("flag %q: expected allocation %d, got %s", result.FlagKey, allocation, formatInt64(result.FeatureAllocation))
+		ok = false
+	}
+	return ok
+}
+
+func checkResult(t testing.TB, result *rulesengine.CheckFlagResult) bool {
+	t.Helper()
+	if result == nil {
+		t.Errorf("expected a flag check result, got nil")
+		return false
+	}
+	return true
+}
+
+func formatInt64(v *int64) string {
+	if v == nil {
+		return "none"
+	}
+	return strconv.FormatInt(*v, 10)
+}
@@ -0,0 +1,71 @@
+package rulesenginetest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/rulesenginetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT captures failures instead of failing the enclosing test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	ruleID := "rule_a"
+	ruleType := rulesengine.RuleTypeStandard
+	usage, allocation := int64(3), int64(10)
+	result := &rulesengine.CheckFlagResult{
+		FlagKey:           "feature",
+		Reason:            `Matched standard rule "A" (rule_a)`,
+		RuleID:            &ruleID,
+		RuleType:          &ruleType,
+		FeatureUsage:      &usage,
+		FeatureAllocation: &allocation,
+		Value:             true,
+	}
+
+	t.Run("Passing assertions report nothing", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+
+		assert.True(t, rulesenginetest.AssertValue(rt, result, true))
+		assert.True(t, rulesenginetest.AssertMatchedRule(rt, result, "rule_a"))
+		assert.True(t, rulesenginetest.AssertRuleType(rt, result, rulesengine.RuleTypeStandard))
+		assert.True(t, rulesenginetest.AssertReason(rt, result, "Matched standard rule"))
+		assert.True(t, rulesenginetest.AssertUsage(rt, result, 3, 10))
+		assert.Empty(t, rt.errors)
+	})
+
+	t.Run("Failures describe the result", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+
+		assert.False(t, rulesenginetest.AssertValue(rt, result, false))
+		assert.False(t, rulesenginetest.AssertMatchedRule(rt, result, "rule_b"))
+		assert.False(t, rulesenginetest.AssertNoRuleMatched(rt, result))
+		assert.False(t, rulesenginetest.AssertUsage(rt, result, 4, 10))
+
+		assert.Equal(t, []string{
+			`flag "feature": expected value false, got true (Matched standard rule "A" (rule_a))`,
+			`flag "feature": expected rule "rule_b" to match, got "rule_a" (Matched standard rule "A" (rule_a))`,
+			`flag "feature": expected no rule to match, got "rule_a" (Matched standard rule "A" (rule_a))`,
+			`flag "feature": expected usage 4, got 3`,
+		}, rt.errors)
+	})
+
+	t.Run("Missing results fail", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+
+		assert.False(t, rulesenginetest.AssertValue(rt, nil, true))
+		assert.Len(t, rt.errors, 1)
+	})
+}
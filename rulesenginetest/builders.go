@@ -0,0 +1,559 @@
+// Package rulesenginetest provides fixture builders and assertions for
+// testing code that evaluates flags with rulesengine.
+//
+// Builders start from sensible defaults with randomized identifiers, so a
+// test only spells out what it depends on:
+//
+//	company := rulesenginetest.NewCompany().PlanIDs("plan_pro").Build()
+//	flag := rulesenginetest.NewFlag().Rules(
+//		rulesenginetest.NewRule().Value(true).Conditions(
+//			rulesenginetest.NewPlanCondition("plan_pro").Build(),
+//		).Build(),
+//	).Build()
+//
+//	result, err := rulesengine.CheckFlag(ctx, company, nil, flag)
+//	rulesenginetest.RequireResult(t, result, err)
+//	rulesenginetest.AssertMatchedRule(t, result, flag.Rules[0].ID)
+//
+// Build returns the model the builder has been populating, so each builder
+// should be built once.
+package rulesenginetest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	gofakeit "github.com/brianvoe/gofakeit/v6"
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/null"
+	"github.com/schematichq/rulesengine/typeconvert"
+)
+
+// NewID returns a random identifier in the style of Schematic IDs, such as
+// "comp_abcdefghijkl".
+func NewID(prefix string) string {
+	const randomPartLength = 12
+	return fmt.Sprintf("%s_%s", prefix, strings.ToLower(gofakeit.LetterN(randomPartLength)))
+}
+
+// NewSubscription returns a billing subscription whose period started 30
+// days ago and ends in 30 days.
+func NewSubscription() *rulesengine.Subscription {
+	now := time.Now()
+	return &rulesengine.Subscription{
+		ID:          NewID("bilsub"),
+		PeriodStart: now.Add(-30 * 24 * time.Hour),
+		PeriodEnd:   now.Add(30 * 24 * time.Hour),
+	}
+}
+
+// NewTraitDefinition returns a trait definition with a random ID.
+func NewTraitDefinition(comparableType typeconvert.ComparableType, entityType rulesengine.EntityType) *rulesengine.TraitDefinition {
+	return &rulesengine.TraitDefinition{
+		ID:             NewID("trt"),
+		ComparableType: comparableType,
+		EntityType:     entityType,
+	}
+}
+
+// NewTrait returns a trait holding value. A nil definition is replaced by a
+// new int-comparable company trait definition.
+func NewTrait(def *rulesengine.TraitDefinition, value string) *rulesengine.Trait {
+	if def == nil {
+		def = NewTraitDefinition(typeconvert.ComparableTypeInt, rulesengine.EntityTypeCompany)
+	}
+
+	return &rulesengine.Trait{
+		TraitDefinition: def,
+		Value:           value,
+	}
+}
+
+// NewMetric returns a metric value for company, resetting on the first of
+// the month.
+func NewMetric(company *rulesengine.Company, eventSubtype string, period rulesengine.MetricPeriod, value int64) *rulesengine.CompanyMetric {
+	metric := &rulesengine.CompanyMetric{
+		EventSubtype: eventSubtype,
+		Period:       period,
+		MonthReset:   rulesengine.MetricPeriodMonthResetFirst,
+		Value:        value,
+		CreatedAt:    time.Now(),
+	}
+	if company != nil {
+		metric.AccountID = company.AccountID
+		metric.EnvironmentID = company.EnvironmentID
+		metric.CompanyID = company.ID
+	}
+	return metric
+}
+
+// FlagBuilder builds a rulesengine.Flag. The default flag has no rules and
+// defaults to false.
+type FlagBuilder struct {
+	flag *rulesengine.Flag
+}
+
+// NewFlag starts a flag with random IDs and key.
+func NewFlag() *FlagBuilder {
+	return &FlagBuilder{flag: &rulesengine.Flag{
+		ID:            NewID("flag"),
+		AccountID:     NewID("acct"),
+		EnvironmentID: NewID("env"),
+		Key:           gofakeit.Word(),
+		Rules:         make([]*rulesengine.Rule, 0),
+	}}
+}
+
+func (b *FlagBuilder) ID(id string) *FlagBuilder {
+	b.flag.ID = id
+	return b
+}
+
+func (b *FlagBuilder) Key(key string) *FlagBuilder {
+	b.flag.Key = key
+	return b
+}
+
+func (b *FlagBuilder) DefaultValue(value bool) *FlagBuilder {
+	b.flag.DefaultValue = value
+	return b
+}
+
+// Rules appends rules to the flag.
+func (b *FlagBuilder) Rules(rules ...*rulesengine.Rule) *FlagBuilder {
+	b.flag.Rules = append(b.flag.Rules, rules...)
+	return b
+}
+
+func (b *FlagBuilder) StartsAt(t time.Time) *FlagBuilder {
+	b.flag.StartsAt = &t
+	return b
+}
+
+func (b *FlagBuilder) EndsAt(t time.Time) *FlagBuilder {
+	b.flag.EndsAt = &t
+	return b
+}
+
+func (b *FlagBuilder) Build() *rulesengine.Flag {
+	return b.flag
+}
+
+// RuleBuilder builds a rulesengine.Rule. The default rule is an
+// unconditional standard rule with priority 1 and value true.
+type RuleBuilder struct {
+	rule *rulesengine.Rule
+}
+
+// NewRule starts a rule with random IDs and name.
+func NewRule() *RuleBuilder {
+	return &RuleBuilder{rule: &rulesengine.Rule{
+		ID:              NewID("rule"),
+		AccountID:       NewID("acct"),
+		EnvironmentID:   NewID("env"),
+		RuleType:        rulesengine.RuleTypeStandard,
+		Name:            gofakeit.Name(),
+		Priority:        1,
+		Conditions:      make([]*rulesengine.Condition, 0),
+		ConditionGroups: make([]*rulesengine.ConditionGroup, 0),
+		Value:           true,
+	}}
+}
+
+func (b *RuleBuilder) ID(id string) *RuleBuilder {
+	b.rule.ID = id
+	return b
+}
+
+func (b *RuleBuilder) Name(name string) *RuleBuilder {
+	b.rule.Name = name
+	return b
+}
+
+func (b *RuleBuilder) Type(ruleType rulesengine.RuleType) *RuleBuilder {
+	b.rule.RuleType = ruleType
+	return b
+}
+
+func (b *RuleBuilder) Priority(priority int64) *RuleBuilder {
+	b.rule.Priority = priority
+	return b
+}
+
+func (b *RuleBuilder) Value(value bool) *RuleBuilder {
+	b.rule.Value = value
+	return b
+}
+
+// FlagID targets the rule at a flag, as company- and user-provided rules
+// must be.
+func (b *RuleBuilder) FlagID(flagID string) *RuleBuilder {
+	b.rule.FlagID = &flagID
+	return b
+}
+
+// Conditions appends conditions, all of which must match.
+func (b *RuleBuilder) Conditions(conditions ...*rulesengine.Condition) *RuleBuilder {
+	b.rule.Conditions = append(b.rule.Conditions, conditions...)
+	return b
+}
+
+// ConditionGroup appends a group of conditions, any of which must match.
+func (b *RuleBuilder) ConditionGroup(conditions ...*rulesengine.Condition) *RuleBuilder {
+	b.rule.ConditionGroups = append(b.rule.ConditionGroups, &rulesengine.ConditionGroup{Conditions: conditions})
+	return b
+}
+
+func (b *RuleBuilder) StartsAt(t time.Time) *RuleBuilder {
+	b.rule.StartsAt = &t
+	return b
+}
+
+func (b *RuleBuilder) EndsAt(t time.Time) *RuleBuilder {
+	b.rule.EndsAt = &t
+	return b
+}
+
+func (b *RuleBuilder) Build() *rulesengine.Rule {
+	return b.rule
+}
+
+// ConditionBuilder builds a rulesengine.Condition.
+type ConditionBuilder struct {
+	condition *rulesengine.Condition
+}
+
+// NewCondition starts a condition of conditionType with the equals operator
+// and random values for the fields the type relies on: a metric condition
+// gets an event subtype and a value between 1 and 1000 over all time, and a
+// trait condition an int company trait with a value in the same range.
+// Resource-based conditions start with no resource IDs.
+func NewCondition(conditionType rulesengine.ConditionType) *ConditionBuilder {
+	condition := &rulesengine.Condition{
+		ID:            NewID("cond"),
+		AccountID:     NewID("acct"),
+		EnvironmentID: NewID("env"),
+		ConditionType: conditionType,
+		Operator:      typeconvert.ComparableOperatorEquals,
+	}
+
+	switch conditionType {
+	case rulesengine.ConditionTypeMetric:
+		subtype := gofakeit.Word()
+		value := int64(gofakeit.Number(1, 1000))
+		period := rulesengine.MetricPeriodAllTime
+		reset := rulesengine.MetricPeriodMonthResetFirst
+		condition.EventSubtype = &subtype
+		condition.MetricValue = &value
+		condition.MetricPeriod = &period
+		condition.MetricPeriodMonthReset = &reset
+	case rulesengine.ConditionTypeTrait:
+		condition.TraitDefinition = NewTraitDefinition(typeconvert.ComparableTypeInt, rulesengine.EntityTypeCompany)
+		condition.TraitValue = strconv.Itoa(gofakeit.Number(1, 1000))
+	case rulesengine.ConditionTypeCredit:
+		creditID := NewID("bcrd")
+		consumptionRate := 1.0
+		condition.CreditID = &creditID
+		condition.ConsumptionRate = &consumptionRate
+	}
+
+	return &ConditionBuilder{condition: condition}
+}
+
+// NewCompanyCondition matches companies with any of ids.
+func NewCompanyCondition(ids ...string) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypeCompany).ResourceIDs(ids...)
+}
+
+// NewUserCondition matches users with any of ids.
+func NewUserCondition(ids ...string) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypeUser).ResourceIDs(ids...)
+}
+
+// NewPlanCondition matches companies on any of the plans.
+func NewPlanCondition(planIDs ...string) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypePlan).ResourceIDs(planIDs...)
+}
+
+// NewPlanVersionCondition matches companies on any of the plan versions.
+func NewPlanVersionCondition(planVersionIDs ...string) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypePlanVersion).ResourceIDs(planVersionIDs...)
+}
+
+// NewBasePlanCondition matches companies whose base plan is any of the
+// plans.
+func NewBasePlanCondition(planIDs ...string) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypeBasePlan).ResourceIDs(planIDs...)
+}
+
+// NewBillingProductCondition matches companies subscribed to any of the
+// billing products.
+func NewBillingProductCondition(billingProductIDs ...string) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypeBillingProduct).ResourceIDs(billingProductIDs...)
+}
+
+// NewMetricCondition compares the company's all-time usage of eventSubtype
+// with value.
+func NewMetricCondition(eventSubtype string, operator typeconvert.ComparableOperator, value int64) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypeMetric).
+		EventSubtype(eventSubtype).
+		Operator(operator).
+		MetricValue(value)
+}
+
+// NewTraitCondition compares the trait with definition def against value.
+func NewTraitCondition(def *rulesengine.TraitDefinition, operator typeconvert.ComparableOperator, value string) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypeTrait).
+		TraitDefinition(def).
+		Operator(operator).
+		TraitValue(value)
+}
+
+// NewCreditCondition gates on the company's balance of creditID covering
+// consumptionRate credits per unit of usage.
+func NewCreditCondition(creditID string, consumptionRate float64) *ConditionBuilder {
+	return NewCondition(rulesengine.ConditionTypeCredit).
+		CreditID(creditID).
+		ConsumptionRate(consumptionRate)
+}
+
+func (b *ConditionBuilder) ID(id string) *ConditionBuilder {
+	b.condition.ID = id
+	return b
+}
+
+func (b *ConditionBuilder) Operator(operator typeconvert.ComparableOperator) *ConditionBuilder {
+	b.condition.Operator = operator
+	return b
+}
+
+// ResourceIDs replaces the condition's resource IDs.
+func (b *ConditionBuilder) ResourceIDs(ids ...string) *ConditionBuilder {
+	b.condition.ResourceIDs = append([]string{}, ids...)
+	return b
+}
+
+func (b *ConditionBuilder) EventSubtype(eventSubtype string) *ConditionBuilder {
+	b.condition.EventSubtype = &eventSubtype
+	return b
+}
+
+func (b *ConditionBuilder) MetricValue(value int64) *ConditionBuilder {
+	b.condition.MetricValue = &value
+	return b
+}
+
+func (b *ConditionBuilder) Period(period rulesengine.MetricPeriod) *ConditionBuilder {
+	b.condition.MetricPeriod = &period
+	return b
+}
+
+func (b *ConditionBuilder) MonthReset(reset rulesengine.MetricPeriodMonthReset) *ConditionBuilder {
+	b.condition.MetricPeriodMonthReset = &reset
+	return b
+}
+
+func (b *ConditionBuilder) CreditID(creditID string) *ConditionBuilder {
+	b.condition.CreditID = &creditID
+	return b
+}
+
+func (b *ConditionBuilder) ConsumptionRate(consumptionRate float64) *ConditionBuilder {
+	b.condition.ConsumptionRate = &consumptionRate
+	return b
+}
+
+func (b *ConditionBuilder) TraitDefinition(def *rulesengine.TraitDefinition) *ConditionBuilder {
+	b.condition.TraitDefinition = def
+	return b
+}
+
+func (b *ConditionBuilder) TraitValue(value string) *ConditionBuilder {
+	b.condition.TraitValue = value
+	return b
+}
+
+// ComparisonTrait compares against the value of the trait with definition
+// def instead of the condition's own value.
+func (b *ConditionBuilder) ComparisonTrait(def *rulesengine.TraitDefinition) *ConditionBuilder {
+	b.condition.ComparisonTraitDefinition = def
+	return b
+}
+
+func (b *ConditionBuilder) Build() *rulesengine.Condition {
+	return b.condition
+}
+
+// CompanyBuilder builds a rulesengine.Company. The default company has two
+// plans, plan versions and billing products, a base plan and a subscription
+// whose period includes now, with no traits, metrics or rules.
+type CompanyBuilder struct {
+	company *rulesengine.Company
+
+	// metrics added with Metric, whose company fields follow later changes
+	// to the company's IDs.
+	metrics []*rulesengine.CompanyMetric
+}
+
+// NewCompany starts a company with random IDs.
+func NewCompany() *CompanyBuilder {
+	return &CompanyBuilder{company: &rulesengine.Company{
+		ID:                NewID("comp"),
+		AccountID:         NewID("acct"),
+		EnvironmentID:     NewID("env"),
+		PlanIDs:           []string{NewID("plan"), NewID("plan")},
+		PlanVersionIDs:    []string{NewID("plnv"), NewID("plnv")},
+		BillingProductIDs: []string{NewID("bilp"), NewID("bilp")},
+		BasePlanID:        null.Nullable(NewID("plan")),
+		Metrics:           make(rulesengine.CompanyMetricCollection, 0),
+		Traits:            make([]*rulesengine.Trait, 0),
+		Subscription:      NewSubscription(),
+	}}
+}
+
+func (b *CompanyBuilder) ID(id string) *CompanyBuilder {
+	b.company.ID = id
+	return b
+}
+
+// PlanIDs replaces the company's plans.
+func (b *CompanyBuilder) PlanIDs(planIDs ...string) *CompanyBuilder {
+	b.company.PlanIDs = append([]string{}, planIDs...)
+	return b
+}
+
+// PlanVersionIDs replaces the company's plan versions.
+func (b *CompanyBuilder) PlanVersionIDs(planVersionIDs ...string) *CompanyBuilder {
+	b.company.PlanVersionIDs = append([]string{}, planVersionIDs...)
+	return b
+}
+
+// BillingProductIDs replaces the company's billing products.
+func (b *CompanyBuilder) BillingProductIDs(billingProductIDs ...string) *CompanyBuilder {
+	b.company.BillingProductIDs = append([]string{}, billingProductIDs...)
+	return b
+}
+
+// BasePlanID sets the base plan; an empty ID clears it.
+func (b *CompanyBuilder) BasePlanID(planID string) *CompanyBuilder {
+	if planID == "" {
+		b.company.BasePlanID = nil
+		return b
+	}
+	b.company.BasePlanID = null.Nullable(planID)
+	return b
+}
+
+// Subscription replaces the subscription; nil removes it.
+func (b *CompanyBuilder) Subscription(subscription *rulesengine.Subscription) *CompanyBuilder {
+	b.company.Subscription = subscription
+	return b
+}
+
+// Trait appends a trait. A nil definition is replaced by a new int company
+// trait definition.
+func (b *CompanyBuilder) Trait(def *rulesengine.TraitDefinition, value string) *CompanyBuilder {
+	b.company.Traits = append(b.company.Traits, NewTrait(def, value))
+	return b
+}
+
+// Metric records the company's usage of eventSubtype over period.
+func (b *CompanyBuilder) Metric(eventSubtype string, period rulesengine.MetricPeriod, value int64) *CompanyBuilder {
+	metric := NewMetric(b.company, eventSubtype, period, value)
+	b.metrics = append(b.metrics, metric)
+	b.company.AddMetric(metric)
+	return b
+}
+
+// CreditBalance sets the company's balance of creditID.
+func (b *CompanyBuilder) CreditBalance(creditID string, balance float64) *CompanyBuilder {
+	if b.company.CreditBalances == nil {
+		b.company.CreditBalances = make(map[string]float64)
+	}
+	b.company.CreditBalances[creditID] = balance
+	return b
+}
+
+// Key sets one of the company's lookup keys.
+func (b *CompanyBuilder) Key(key, value string) *CompanyBuilder {
+	if b.company.Keys == nil {
+		b.company.Keys = make(map[string]string)
+	}
+	b.company.Keys[key] = value
+	return b
+}
+
+// Rules appends company-provided rules. They apply only to flags whose ID
+// they are targeted at with RuleBuilder.FlagID.
+func (b *CompanyBuilder) Rules(rules ...*rulesengine.Rule) *CompanyBuilder {
+	b.company.Rules = append(b.company.Rules, rules...)
+	return b
+}
+
+// Entitlements appends feature entitlements.
+func (b *CompanyBuilder) Entitlements(entitlements ...*rulesengine.FeatureEntitlement) *CompanyBuilder {
+	b.company.Entitlements = append(b.company.Entitlements, entitlements...)
+	return b
+}
+
+func (b *CompanyBuilder) Build() *rulesengine.Company {
+	for _, metric := range b.metrics {
+		metric.AccountID = b.company.AccountID
+		metric.EnvironmentID = b.company.EnvironmentID
+		metric.CompanyID = b.company.ID
+	}
+	return b.company
+}
+
+// UserBuilder builds a rulesengine.User. The default user has no traits or
+// rules.
+type UserBuilder struct {
+	user *rulesengine.User
+}
+
+// NewUser starts a user with random IDs.
+func NewUser() *UserBuilder {
+	return &UserBuilder{user: &rulesengine.User{
+		ID:            NewID("user"),
+		AccountID:     NewID("acct"),
+		EnvironmentID: NewID("env"),
+		Traits:        make([]*rulesengine.Trait, 0),
+	}}
+}
+
+func (b *UserBuilder) ID(id string) *UserBuilder {
+	b.user.ID = id
+	return b
+}
+
+// Trait appends a trait. A nil definition is replaced by a new int user
+// trait definition.
+func (b *UserBuilder) Trait(def *rulesengine.TraitDefinition, value string) *UserBuilder {
+	if def == nil {
+		def = NewTraitDefinition(typeconvert.ComparableTypeInt, rulesengine.EntityTypeUser)
+	}
+	b.user.Traits = append(b.user.Traits, NewTrait(def, value))
+	return b
+}
+
+// Key sets one of the user's lookup keys.
+func (b *UserBuilder) Key(key, value string) *UserBuilder {
+	if b.user.Keys == nil {
+		b.user.Keys = make(map[string]string)
+	}
+	b.user.Keys[key] = value
+	return b
+}
+
+// Rules appends user-provided rules. They apply only to flags whose ID they
+// are targeted at with RuleBuilder.FlagID.
+func (b *UserBuilder) Rules(rules ...*rulesengine.Rule) *UserBuilder {
+	b.user.Rules = append(b.user.Rules, rules...)
+	return b
+}
+
+func (b *UserBuilder) Build() *rulesengine.User {
+	return b.user
+}
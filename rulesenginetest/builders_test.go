@@ -0,0 +1,133 @@
+package rulesenginetest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/rulesenginetest"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilders(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Defaults pass lint", func(t *testing.T) {
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Conditions(
+				rulesenginetest.NewPlanCondition("plan_a").Build(),
+				rulesenginetest.NewCondition(rulesengine.ConditionTypeMetric).Build(),
+				rulesenginetest.NewCondition(rulesengine.ConditionTypeTrait).Build(),
+			).Build(),
+		).Build()
+
+		assert.Empty(t, rulesengine.LintFlag(flag))
+	})
+
+	t.Run("Identifiers are random", func(t *testing.T) {
+		a, b := rulesenginetest.NewCompany().Build(), rulesenginetest.NewCompany().Build()
+
+		assert.NotEqual(t, a.ID, b.ID)
+		assert.Regexp(t, `^comp_[a-z]{12}$`, a.ID)
+		assert.Len(t, a.PlanIDs, 2)
+		require.NotNil(t, a.BasePlanID)
+		require.NotNil(t, a.Subscription)
+		assert.True(t, a.Subscription.PeriodStart.Before(time.Now()))
+		assert.True(t, a.Subscription.PeriodEnd.After(time.Now()))
+	})
+
+	t.Run("Flags match on plans", func(t *testing.T) {
+		rule := rulesenginetest.NewRule().Conditions(rulesenginetest.NewPlanCondition("plan_pro").Build()).Build()
+		flag := rulesenginetest.NewFlag().Rules(rule).Build()
+
+		result, err := rulesengine.CheckFlag(ctx, rulesenginetest.NewCompany().PlanIDs("plan_pro").Build(), nil, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertValue(t, result, true)
+		rulesenginetest.AssertMatchedRule(t, result, rule.ID)
+
+		result, err = rulesengine.CheckFlag(ctx, rulesenginetest.NewCompany().PlanIDs("plan_free").Build(), nil, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertValue(t, result, false)
+		rulesenginetest.AssertNoRuleMatched(t, result)
+	})
+
+	t.Run("Company metrics follow the company's IDs", func(t *testing.T) {
+		company := rulesenginetest.NewCompany().
+			Metric("api_calls", rulesengine.MetricPeriodAllTime, 5).
+			ID("comp_fixed").
+			Build()
+
+		metric := company.Metrics.Find("api_calls", nil, nil)
+		require.NotNil(t, metric)
+		assert.Equal(t, "comp_fixed", metric.CompanyID)
+		assert.Equal(t, int64(5), metric.Value)
+	})
+
+	t.Run("Metered flags report usage", func(t *testing.T) {
+		company := rulesenginetest.NewCompany().Metric("api_calls", rulesengine.MetricPeriodAllTime, 5).Build()
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().
+				Type(rulesengine.RuleTypePlanEntitlement).
+				Conditions(rulesenginetest.NewMetricCondition("api_calls", typeconvert.ComparableOperatorLt, 10).Build()).
+				Build(),
+		).Build()
+
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertValue(t, result, true)
+		rulesenginetest.AssertRuleType(t, result, rulesengine.RuleTypePlanEntitlement)
+		rulesenginetest.AssertUsage(t, result, 5, 10)
+	})
+
+	t.Run("Traits match trait conditions", func(t *testing.T) {
+		def := rulesenginetest.NewTraitDefinition(typeconvert.ComparableTypeString, rulesengine.EntityTypeUser)
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Conditions(
+				rulesenginetest.NewTraitCondition(def, typeconvert.ComparableOperatorEquals, "admin").Build(),
+			).Build(),
+		).Build()
+		user := rulesenginetest.NewUser().Trait(def, "admin").Build()
+
+		result, err := rulesengine.CheckFlag(ctx, nil, user, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertValue(t, result, true)
+	})
+
+	t.Run("Credit conditions use company balances", func(t *testing.T) {
+		flag := rulesenginetest.NewFlag().Rules(
+			rulesenginetest.NewRule().Conditions(rulesenginetest.NewCreditCondition("bcrd_a", 2).Build()).Build(),
+		).Build()
+
+		result, err := rulesengine.CheckFlag(ctx, rulesenginetest.NewCompany().CreditBalance("bcrd_a", 5).Build(), nil, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertValue(t, result, true)
+
+		result, err = rulesengine.CheckFlag(ctx, rulesenginetest.NewCompany().CreditBalance("bcrd_a", 1).Build(), nil, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertValue(t, result, false)
+	})
+
+	t.Run("Company rules apply to their flag", func(t *testing.T) {
+		flag := rulesenginetest.NewFlag().Build()
+		rule := rulesenginetest.NewRule().Type(rulesengine.RuleTypeCompanyOverride).FlagID(flag.ID).Build()
+		company := rulesenginetest.NewCompany().Rules(rule).Build()
+
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertMatchedRule(t, result, rule.ID)
+		rulesenginetest.AssertReason(t, result, "Matched company override rule")
+	})
+
+	t.Run("Rules can be scheduled", func(t *testing.T) {
+		future := time.Now().Add(time.Hour)
+		flag := rulesenginetest.NewFlag().Rules(rulesenginetest.NewRule().StartsAt(future).Build()).Build()
+
+		result, err := rulesengine.CheckFlag(ctx, rulesenginetest.NewCompany().Build(), nil, flag)
+		rulesenginetest.RequireResult(t, result, err)
+		rulesenginetest.AssertNoRuleMatched(t, result)
+		rulesenginetest.AssertReason(t, result, "skipped inactive rule")
+	})
+}
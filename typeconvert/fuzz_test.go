@@ -0,0 +1,92 @@
+package typeconvert_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var comparableTypes = []typeconvert.ComparableType{
+	typeconvert.ComparableTypeBool,
+	typeconvert.ComparableTypeDate,
+	typeconvert.ComparableTypeInt,
+	typeconvert.ComparableTypeString,
+}
+
+func FuzzCompare(f *testing.F) {
+	f.Add("", "")
+	f.Add("1", "2")
+	f.Add("-5", "abc")
+	f.Add("true", "false")
+	f.Add("2024-01-15", "2024-01-15T21:59:40.162Z")
+	f.Add("2024-01-15", "")
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		compare := func(comparableType typeconvert.ComparableType, operator typeconvert.ComparableOperator, x, y string) bool {
+			return typeconvert.Compare(x, y, comparableType, operator)
+		}
+
+		for _, ct := range comparableTypes {
+			eq := compare(ct, typeconvert.ComparableOperatorEquals, a, b)
+			assert.Equal(t, !eq, compare(ct, typeconvert.ComparableOperatorNotEquals, a, b), "%s: ne is not the negation of eq", ct)
+			assert.Equal(t, eq, compare(ct, typeconvert.ComparableOperatorEquals, b, a), "%s: eq is not symmetric", ct)
+			assert.True(t, compare(ct, typeconvert.ComparableOperatorEquals, a, a), "%s: eq is not reflexive", ct)
+			assert.False(t, compare(ct, "unknown", a, b), "%s: unknown operators match", ct)
+
+			if ct == typeconvert.ComparableTypeBool {
+				continue
+			}
+
+			gt := compare(ct, typeconvert.ComparableOperatorGt, a, b)
+			lt := compare(ct, typeconvert.ComparableOperatorLt, a, b)
+			assert.Equal(t, gt, compare(ct, typeconvert.ComparableOperatorLt, b, a), "%s: gt is not the converse of lt", ct)
+			assert.Equal(t, gt || eq, compare(ct, typeconvert.ComparableOperatorGte, a, b), "%s: gte is not gt or eq", ct)
+			assert.Equal(t, lt || eq, compare(ct, typeconvert.ComparableOperatorLte, a, b), "%s: lte is not lt or eq", ct)
+			assert.Equal(t, 1, countTrue(gt, lt, eq), "%s: gt, lt and eq are not exclusive", ct)
+		}
+
+		for _, ct := range []typeconvert.ComparableType{typeconvert.ComparableTypeDate, typeconvert.ComparableTypeString} {
+			assert.NotEqual(t,
+				compare(ct, typeconvert.ComparableOperatorIsEmpty, a, b),
+				compare(ct, typeconvert.ComparableOperatorNotEmpty, a, b),
+				"%s: is_empty and not_empty agree", ct,
+			)
+		}
+	})
+}
+
+func FuzzStringToDate(f *testing.F) {
+	f.Add("")
+	f.Add("2024-01-15")
+	f.Add("2024-01-15T21:59:40.162Z")
+	f.Add("2024-01-15 21:59:40 UTC")
+	f.Add("Tue Jan 16 2024")
+	f.Add("Tue Jan 16 2024 12:44:18 GMT-0500 (Eastern Standard Time)")
+	f.Add("Tue Jan 16 2024 12:44:18 GMT-0800 (Pacific Standard Time)")
+
+	f.Fuzz(func(t *testing.T, v string) {
+		date := typeconvert.StringToDate(v)
+		if date == nil {
+			return
+		}
+
+		// Dates survive formatting in the ISO layout and parsing back as the
+		// same instant, whatever zone they were parsed in.
+		reparsed := typeconvert.StringToDate(date.Format(time.RFC3339Nano))
+		require.NotNil(t, reparsed, "formatted as %s", date.Format(time.RFC3339Nano))
+		assert.True(t, date.Equal(*reparsed), "%s became %s", date, reparsed)
+	})
+}
+
+func countTrue(values ...bool) int {
+	var n int
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
@@ -1,6 +1,7 @@
 package rulesengine_test
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/schematichq/rulesengine"
@@ -100,4 +101,56 @@ func TestGroupRulesByPriority(t *testing.T) {
 		assert.Len(t, grouped[0], 1)
 		assert.Equal(t, "flag_rule_1", grouped[0][0].ID)
 	})
+
+	t.Run("Nil rules are skipped", func(t *testing.T) {
+		rule := &rulesengine.Rule{ID: "rule_1", RuleType: rulesengine.RuleTypeStandard}
+
+		grouped := rulesengine.GroupRulesByPriority([]*rulesengine.Rule{nil, rule, nil})
+
+		assert.Equal(t, [][]*rulesengine.Rule{{rule}}, grouped)
+	})
+
+	t.Run("Rules with the same priority keep their order", func(t *testing.T) {
+		var rules, want []*rulesengine.Rule
+		for i := 0; i < 40; i++ {
+			rules = append(rules, &rulesengine.Rule{
+				ID:       "rule_" + strconv.Itoa(i),
+				RuleType: rulesengine.RuleTypeStandard,
+				Priority: int64(i % 2),
+			})
+		}
+		for _, priority := range []int64{0, 1} {
+			for _, rule := range rules {
+				if rule.Priority == priority {
+					want = append(want, rule)
+				}
+			}
+		}
+
+		grouped := rulesengine.GroupRulesByPriority(rules)
+
+		assert.Equal(t, [][]*rulesengine.Rule{want}, grouped)
+	})
+
+	t.Run("Optimistic rules with a true value come first in their order", func(t *testing.T) {
+		var rules, want []*rulesengine.Rule
+		for i := 0; i < 40; i++ {
+			rules = append(rules, &rulesengine.Rule{
+				ID:       "rule_" + strconv.Itoa(i),
+				RuleType: rulesengine.RuleTypePlanEntitlement,
+				Value:    i%3 == 0,
+			})
+		}
+		for _, value := range []bool{true, false} {
+			for _, rule := range rules {
+				if rule.Value == value {
+					want = append(want, rule)
+				}
+			}
+		}
+
+		grouped := rulesengine.GroupRulesByPriority(rules)
+
+		assert.Equal(t, [][]*rulesengine.Rule{want}, grouped)
+	})
 }
@@ -0,0 +1,284 @@
+package rulesengine
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldError is a single validation failure. Field is the path to the value
+// using JSON field names, e.g. `rules[0].conditions[1].condition_type`.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Value   string `json:"value"`
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors collects every FieldError found while validating a model.
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Code() ErrorCode {
+	return ErrorCodeInvalidInput
+}
+
+// StatusCode reports invalid models as a client error, matching
+// RulesEngineError.
+func (e ValidationErrors) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Validate checks the rule and its conditions against the enums declared in
+// their binding tags.
+func (r *Rule) Validate() error {
+	return validateModel(r, DefaultConditions)
+}
+
+// ValidateWithConditions is Validate, accepting the condition types
+// registered on conditions rather than on DefaultConditions.
+func (r *Rule) ValidateWithConditions(conditions *ConditionRegistry) error {
+	return validateModel(r, conditions)
+}
+
+// Validate checks the condition against the enums declared in its binding
+// tags.
+func (c *Condition) Validate() error {
+	return validateModel(c, DefaultConditions)
+}
+
+// ValidateWithConditions is Validate, accepting the condition types
+// registered on conditions rather than on DefaultConditions.
+func (c *Condition) ValidateWithConditions(conditions *ConditionRegistry) error {
+	return validateModel(c, conditions)
+}
+
+// Validate checks every condition in the group.
+func (g *ConditionGroup) Validate() error {
+	return validateModel(g, DefaultConditions)
+}
+
+// ValidateWithConditions is Validate, accepting the condition types
+// registered on conditions rather than on DefaultConditions.
+func (g *ConditionGroup) ValidateWithConditions(conditions *ConditionRegistry) error {
+	return validateModel(g, conditions)
+}
+
+// Validate checks the trait definition's comparable and entity types.
+func (d *TraitDefinition) Validate() error {
+	return validateModel(d, DefaultConditions)
+}
+
+// Validate checks the trait's definition.
+func (t *Trait) Validate() error {
+	return validateModel(t, DefaultConditions)
+}
+
+// Validate checks the metric's period and month reset.
+func (m *CompanyMetric) Validate() error {
+	return validateModel(m, DefaultConditions)
+}
+
+// Validate checks the entitlement's value type and metric period fields.
+func (e *FeatureEntitlement) Validate() error {
+	return validateModel(e, DefaultConditions)
+}
+
+// Validate checks the flag's rules.
+func (f *Flag) Validate() error {
+	return validateModel(f, DefaultConditions)
+}
+
+// ValidateWithConditions is Validate, accepting the condition types
+// registered on conditions rather than on DefaultConditions. Use it for flags
+// evaluated with WithConditionRegistry; a nil registry means
+// DefaultConditions.
+func (f *Flag) ValidateWithConditions(conditions *ConditionRegistry) error {
+	return validateModel(f, conditions)
+}
+
+// Validate checks the company's metrics, entitlements, rules and traits.
+func (c *Company) Validate() error {
+	return validateModel(c, DefaultConditions)
+}
+
+// ValidateWithConditions is Validate, accepting the condition types
+// registered on conditions rather than on DefaultConditions.
+func (c *Company) ValidateWithConditions(conditions *ConditionRegistry) error {
+	return validateModel(c, conditions)
+}
+
+// Validate checks the user's rules and traits.
+func (u *User) Validate() error {
+	return validateModel(u, DefaultConditions)
+}
+
+// ValidateWithConditions is Validate, accepting the condition types
+// registered on conditions rather than on DefaultConditions.
+func (u *User) ValidateWithConditions(conditions *ConditionRegistry) error {
+	return validateModel(u, conditions)
+}
+
+// WithValidation validates the company, user and flag before evaluating. An
+// invalid model fails the check with ValidationErrors instead of silently
+// evaluating conditions with unknown types or operators as non-matching.
+// Condition types registered on the evaluation's ConditionRegistry are
+// accepted.
+func WithValidation() CheckFlagOption {
+	return func(o *checkFlagOptions) {
+		o.validateInput = true
+	}
+}
+
+// validateInputs validates each non-nil model, prefixing field paths with the
+// model name so errors from different inputs can be told apart.
+func validateInputs(company *Company, user *User, flag *Flag, conditions *ConditionRegistry) error {
+	var errs ValidationErrors
+	collect := func(prefix string, model any) {
+		v := reflect.ValueOf(model)
+		if v.IsNil() {
+			return
+		}
+		validateValue(prefix, v, conditions, &errs)
+	}
+
+	collect("company", company)
+	collect("user", user)
+	collect("flag", flag)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateModel walks a model recursively, including through JSONSlice
+// children, and checks every field that declares a `binding:"oneof=..."`
+// tag. Nil pointers are treated as unset and are not validated. Condition
+// types registered on conditions are accepted; a nil registry means
+// DefaultConditions.
+func validateModel(model any, conditions *ConditionRegistry) error {
+	if conditions == nil {
+		conditions = DefaultConditions
+	}
+
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	var errs ValidationErrors
+	validateValue("", v, conditions, &errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateValue(path string, v reflect.Value, conditions *ConditionRegistry, errs *ValidationErrors) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			validateValue(path, v.Elem(), conditions, errs)
+		}
+	case reflect.Struct:
+		validateStruct(path, v, conditions, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(fmt.Sprintf("%s[%d]", path, i), v.Index(i), conditions, errs)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			validateValue(fmt.Sprintf("%s[%v]", path, key.Interface()), v.MapIndex(key), conditions, errs)
+		}
+	}
+}
+
+func validateStruct(path string, v reflect.Value, conditions *ConditionRegistry, errs *ValidationErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := jsonFieldName(field)
+		if name == "" {
+			continue
+		}
+
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+
+		fv := v.Field(i)
+		if allowed := bindingOneOfForType(t, field.Name); allowed != nil {
+			if value, ok := stringValue(fv); ok && !allowed.Contains(value) && !isRegisteredConditionType(t, field.Name, value, conditions) {
+				*errs = append(*errs, &FieldError{
+					Field:   fieldPath,
+					Message: fmt.Sprintf("must be one of [%s]", strings.Join(parseBindingOneOf(field.Tag), " ")),
+					Value:   value,
+				})
+			}
+		}
+
+		validateValue(fieldPath, fv, conditions, errs)
+	}
+}
+
+// jsonFieldName returns the name a field is serialized under, or "" for
+// fields excluded from JSON.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// stringValue dereferences v and returns its value if it is string-kinded.
+// A nil pointer reports ok == false.
+func stringValue(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// isRegisteredConditionType reports whether value is a condition type with
+// an evaluator on conditions, for the ConditionType field of Condition.
+func isRegisteredConditionType(t reflect.Type, field, value string, conditions *ConditionRegistry) bool {
+	if t != reflect.TypeOf(Condition{}) || field != "ConditionType" || conditions == nil {
+		return false
+	}
+	_, ok := conditions.Evaluator(ConditionType(value))
+	return ok
+}
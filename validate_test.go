@@ -0,0 +1,220 @@
+package rulesengine_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/schematichq/rulesengine/null"
+	"github.com/schematichq/rulesengine/typeconvert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fieldErrors(t *testing.T, err error) rulesengine.ValidationErrors {
+	t.Helper()
+
+	var errs rulesengine.ValidationErrors
+	require.True(t, errors.As(err, &errs), "expected ValidationErrors, got %v", err)
+	return errs
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Valid models pass", func(t *testing.T) {
+		company := createTestCompany()
+		company.AddMetric(createTestMetric(company, "api-calls", rulesengine.MetricPeriodCurrentMonth, 5))
+		company.Traits = append(company.Traits, createTestTrait("5", nil))
+
+		flag := createTestFlag()
+		rule := createTestRule()
+		rule.Conditions = []*rulesengine.Condition{
+			createTestCondition(rulesengine.ConditionTypeMetric),
+			createTestCondition(rulesengine.ConditionTypeTrait),
+		}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		assert.NoError(t, company.Validate())
+		assert.NoError(t, createTestUser().Validate())
+		assert.NoError(t, flag.Validate())
+	})
+
+	t.Run("Nil models are valid", func(t *testing.T) {
+		var flag *rulesengine.Flag
+		var condition *rulesengine.Condition
+
+		assert.NoError(t, flag.Validate())
+		assert.NoError(t, condition.Validate())
+	})
+
+	t.Run("Condition", func(t *testing.T) {
+		condition := createTestCondition(rulesengine.ConditionTypeMetric)
+		condition.ConditionType = "metrc"
+		condition.MetricPeriod = null.Nullable(rulesengine.MetricPeriod("current_year"))
+
+		errs := fieldErrors(t, condition.Validate())
+
+		require.Len(t, errs, 2)
+		assert.Equal(t, "condition_type", errs[0].Field)
+		assert.Equal(t, "metrc", errs[0].Value)
+		assert.Contains(t, errs[0].Message, "base_plan")
+		assert.Equal(t, "metric_period", errs[1].Field)
+	})
+
+	t.Run("Condition types registered on another registry", func(t *testing.T) {
+		flag, rule, condition := customConditionFlag(conditionTypeAllowlist, "10.0.0.1")
+		registry := rulesengine.NewConditionRegistry()
+		registry.MustRegister(conditionTypeAllowlist, allowlistEvaluator)
+		company := createTestCompany()
+		company.Rules = []*rulesengine.Rule{rule}
+
+		assert.Error(t, flag.Validate())
+		assert.Error(t, company.Validate())
+		assert.NoError(t, flag.ValidateWithConditions(registry))
+		assert.NoError(t, company.ValidateWithConditions(registry))
+		assert.NoError(t, rule.ValidateWithConditions(registry))
+		assert.NoError(t, condition.ValidateWithConditions(registry))
+		assert.Error(t, flag.ValidateWithConditions(nil))
+	})
+
+	t.Run("Nil optional enum pointers are not validated", func(t *testing.T) {
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+
+		assert.Nil(t, condition.MetricPeriod)
+		assert.NoError(t, condition.Validate())
+	})
+
+	t.Run("Rule recurses into conditions and condition groups", func(t *testing.T) {
+		rule := createTestRule()
+		rule.RuleType = "experiment"
+
+		trait := createTestCondition(rulesengine.ConditionTypeTrait)
+		trait.TraitDefinition.EntityType = "account"
+		rule.ConditionGroups = []*rulesengine.ConditionGroup{
+			{Conditions: []*rulesengine.Condition{createTestCondition(rulesengine.ConditionTypeCompany), trait}},
+		}
+
+		errs := fieldErrors(t, rule.Validate())
+
+		require.Len(t, errs, 2)
+		assert.Equal(t, "rule_type", errs[0].Field)
+		assert.Equal(t, "condition_groups[0].conditions[1].trait_definition.entity_type", errs[1].Field)
+	})
+
+	t.Run("Flag paths include the rule index", func(t *testing.T) {
+		flag := createTestFlag()
+		rule := createTestRule()
+		condition := createTestCondition(rulesengine.ConditionTypeCompany)
+		condition.Operator = "contains"
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{createTestRule(), rule}
+
+		errs := fieldErrors(t, flag.Validate())
+
+		require.Len(t, errs, 1)
+		assert.Equal(t, "rules[1].conditions[0].operator", errs[0].Field)
+		assert.Equal(t, "rules[1].conditions[0].operator: must be one of [eq ne gt lt gte lte is_empty not_empty]", errs[0].Error())
+	})
+
+	t.Run("CompanyMetric", func(t *testing.T) {
+		company := createTestCompany()
+		metric := createTestMetric(company, "api-calls", "yearly", 1)
+		metric.MonthReset = "whenever"
+
+		errs := fieldErrors(t, metric.Validate())
+
+		require.Len(t, errs, 2)
+		assert.Equal(t, "period", errs[0].Field)
+		assert.Equal(t, "month_reset", errs[1].Field)
+	})
+
+	t.Run("FeatureEntitlement", func(t *testing.T) {
+		entitlement := &rulesengine.FeatureEntitlement{
+			FeatureKey:   "feature",
+			ValueType:    "boolen",
+			MetricPeriod: null.Nullable(rulesengine.MetricPeriodCurrentDay),
+		}
+
+		errs := fieldErrors(t, entitlement.Validate())
+
+		require.Len(t, errs, 1)
+		assert.Equal(t, "value_type", errs[0].Field)
+	})
+
+	t.Run("Company recurses into metrics, entitlements and traits", func(t *testing.T) {
+		company := createTestCompany()
+		company.Metrics = rulesengine.CompanyMetricCollection{createTestMetric(company, "api-calls", "yearly", 1)}
+		company.Entitlements = []*rulesengine.FeatureEntitlement{{ValueType: "bogus"}}
+		company.Traits = []*rulesengine.Trait{createTestTrait("1", &rulesengine.TraitDefinition{ID: "t", ComparableType: "float", EntityType: rulesengine.EntityTypeCompany})}
+
+		errs := fieldErrors(t, company.Validate())
+
+		var fields []string
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+		assert.Equal(t, []string{
+			"entitlements[0].value_type",
+			"metrics[0].period",
+			"traits[0].trait_definition.comparable_type",
+		}, fields)
+	})
+}
+
+func TestCheckFlagWithValidation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Rejects invalid input before evaluating", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+		rule := createTestRule()
+		condition := createTestCondition("metrc")
+		rule.Conditions = []*rulesengine.Condition{condition}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		result, err := rulesengine.CheckFlag(ctx, company, nil, flag, rulesengine.WithValidation())
+
+		errs := fieldErrors(t, err)
+		require.Len(t, errs, 1)
+		assert.Equal(t, "flag.rules[0].conditions[0].condition_type", errs[0].Field)
+		assert.Equal(t, http.StatusBadRequest, errs.StatusCode())
+		assert.Equal(t, err, result.Err)
+	})
+
+	t.Run("Reports errors from every input", func(t *testing.T) {
+		company := createTestCompany()
+		company.Metrics = rulesengine.CompanyMetricCollection{createTestMetric(company, "api-calls", "yearly", 1)}
+		user := createTestUser()
+		user.Traits = []*rulesengine.Trait{createTestTrait("1", &rulesengine.TraitDefinition{ID: "t", ComparableType: typeconvert.ComparableTypeBool, EntityType: "team"})}
+
+		_, err := rulesengine.CheckFlag(ctx, company, user, createTestFlag(), rulesengine.WithValidation())
+
+		errs := fieldErrors(t, err)
+		require.Len(t, errs, 2)
+		assert.Equal(t, "company.metrics[0].period", errs[0].Field)
+		assert.Equal(t, "user.traits[0].trait_definition.entity_type", errs[1].Field)
+	})
+
+	t.Run("Valid input evaluates normally", func(t *testing.T) {
+		company := createTestCompany()
+		flag := createTestFlag()
+
+		result, err := rulesengine.CheckFlag(ctx, company, createTestUser(), flag, rulesengine.WithValidation())
+
+		require.NoError(t, err)
+		assert.Equal(t, rulesengine.ReasonNoRulesMatched, result.Reason)
+	})
+
+	t.Run("Invalid input is ignored without the option", func(t *testing.T) {
+		flag := createTestFlag()
+		rule := createTestRule()
+		rule.Conditions = []*rulesengine.Condition{createTestCondition("metrc")}
+		flag.Rules = []*rulesengine.Rule{rule}
+
+		result, err := rulesengine.CheckFlag(ctx, createTestCompany(), nil, flag)
+
+		require.NoError(t, err)
+		assert.Nil(t, result.RuleID)
+	})
+}
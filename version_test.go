@@ -1,6 +1,10 @@
 package rulesengine
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"reflect"
 	"testing"
 )
 
@@ -44,4 +48,51 @@ func TestGetVersionKey(t *testing.T) {
 			}
 		}
 	})
+	t.Run("Version key matches a reflection hash of the wire shape", func(t *testing.T) {
+		// The manifest must hash exactly the bytes a direct walk of the
+		// models' wire shape would; see wireShapeHash.
+		hasher := sha256.New()
+		wireShapeHash(hasher, reflect.TypeOf((*Company)(nil)).Elem())
+		wireShapeHash(hasher, reflect.TypeOf((*User)(nil)).Elem())
+		wireShapeHash(hasher, reflect.TypeOf((*Flag)(nil)).Elem())
+		wireShapeHash(hasher, reflect.TypeOf((*CheckFlagResult)(nil)).Elem())
+		want := fmt.Sprintf("%x", hasher.Sum(nil))[:8]
+
+		if key := GetVersionKey(); key != want {
+			t.Errorf("Expected version key %s, got %s", want, key)
+		}
+	})
+}
+
+// wireShapeHash is the reflection-based hash the manifest replaced, adjusted
+// to the wire shape the version key now tracks: errors hash as ErrorDetail,
+// their wire form, and unexported fields are left out.
+func wireShapeHash(hasher hash.Hash, t reflect.Type) {
+	if t == nil {
+		return
+	}
+	if t == errorType {
+		t = errorDetailType
+	}
+
+	hasher.Write([]byte(t.Name()))
+	hasher.Write([]byte(t.Kind().String()))
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			hasher.Write([]byte(field.Name))
+			hasher.Write([]byte(field.Tag))
+			wireShapeHash(hasher, field.Type)
+		}
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		wireShapeHash(hasher, t.Elem())
+	case reflect.Map:
+		wireShapeHash(hasher, t.Key())
+		wireShapeHash(hasher, t.Elem())
+	}
 }
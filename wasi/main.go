@@ -0,0 +1,107 @@
+//go:build wasip1
+
+// Command wasi builds the rules engine as a WASI reactor module for
+// server-side WebAssembly runtimes such as wasmtime and wazero, which cannot
+// host the syscall/js build.
+//
+// Build it with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o rulesengine.wasm ./wasi
+//
+// Hosts call _initialize once, then exchange JSON through linear memory:
+// alloc a buffer, write the request into it, call evaluate or bridge_call,
+// read the response and free both buffers. Requests must be passed in
+// buffers obtained from alloc. Responses are returned as a
+// packed uint64 of (pointer << 32 | length); requests and responses use the
+// bridge API described in the rulesengine package.
+package main
+
+import (
+	"context"
+	"sync"
+	"unsafe"
+
+	"github.com/schematichq/rulesengine"
+)
+
+// buffers keeps allocations handed to the host reachable until they are
+// freed, so the garbage collector does not reclaim memory the host is still
+// writing to or reading from.
+var (
+	buffersMu sync.Mutex
+	buffers   = map[uint32][]byte{}
+)
+
+// alloc reserves size bytes of linear memory for the host and returns a
+// pointer to them.
+//
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	if size == 0 {
+		size = 1
+	}
+	buf := make([]byte, size)
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+
+	buffersMu.Lock()
+	buffers[ptr] = buf
+	buffersMu.Unlock()
+
+	return ptr
+}
+
+// free releases a buffer returned by alloc or by a call.
+//
+//go:wasmexport free
+func free(ptr uint32) {
+	buffersMu.Lock()
+	delete(buffers, ptr)
+	buffersMu.Unlock()
+}
+
+// api_version returns rulesengine.BridgeAPIVersion.
+//
+//go:wasmexport api_version
+func apiVersion() uint32 {
+	return rulesengine.BridgeAPIVersion
+}
+
+// evaluate runs the bridge checkFlag method on the JSON request at
+// ptr/length.
+//
+//go:wasmexport evaluate
+func evaluate(ptr, length uint32) uint64 {
+	return respond(rulesengine.BridgeCall(context.Background(), rulesengine.BridgeMethodCheckFlag, bytesAt(ptr, length)))
+}
+
+// bridge_call runs any bridge method, named by the string at
+// methodPtr/methodLength, on the JSON request at ptr/length.
+//
+//go:wasmexport bridge_call
+func bridgeCall(methodPtr, methodLength, ptr, length uint32) uint64 {
+	method := string(bytesAt(methodPtr, methodLength))
+	return respond(rulesengine.BridgeCall(context.Background(), method, bytesAt(ptr, length)))
+}
+
+// bytesAt returns the first length bytes of the buffer alloc returned at
+// ptr. Pointers that were not returned by alloc, or lengths past the end of
+// the buffer, yield nil, which the bridge rejects as an empty payload.
+func bytesAt(ptr, length uint32) []byte {
+	buffersMu.Lock()
+	buf, ok := buffers[ptr]
+	buffersMu.Unlock()
+
+	if !ok || length == 0 || int(length) > len(buf) {
+		return nil
+	}
+	return buf[:length]
+}
+
+// respond copies a response into a host-owned buffer and packs its location.
+func respond(data []byte) uint64 {
+	ptr := alloc(uint32(len(data)))
+	copy(bytesAt(ptr, uint32(len(data))), data)
+	return uint64(ptr)<<32 | uint64(len(data))
+}
+
+func main() {}
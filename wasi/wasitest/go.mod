@@ -0,0 +1,19 @@
+module github.com/schematichq/rulesengine/wasi/wasitest
+
+go 1.24.0
+
+require (
+	github.com/schematichq/rulesengine v0.0.0
+	github.com/stretchr/testify v1.10.0
+	github.com/tetratelabs/wazero v1.11.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// The test builds and runs the reactor in the parent directory.
+replace github.com/schematichq/rulesengine => ../../
@@ -0,0 +1,252 @@
+// Package wasitest runs the WASI reactor in wazero. It is its own module so
+// the engine doesn't depend on wazero.
+package wasitest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/schematichq/rulesengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// buildModule compiles the reactor in the parent directory for wasip1. The
+// test is only skipped if there is no go toolchain to build with; a failing
+// build fails it.
+func buildModule(t *testing.T) []byte {
+	t.Helper()
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not found")
+	}
+
+	out := filepath.Join(t.TempDir(), "rulesengine.wasm")
+	cmd := exec.Command(goBin, "build", "-buildmode=c-shared", "-o", out, ".")
+	cmd.Dir = ".."
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building wasip1 module failed: %v\n%s", err, output)
+	}
+
+	module, err := os.ReadFile(out)
+	require.NoError(t, err)
+	return module
+}
+
+type wasiModule struct {
+	t      *testing.T
+	ctx    context.Context
+	module api.Module
+}
+
+func instantiate(t *testing.T) *wasiModule {
+	t.Helper()
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntime(ctx)
+	t.Cleanup(func() { _ = runtime.Close(ctx) })
+
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	compiled, err := runtime.CompileModule(ctx, buildModule(t))
+	require.NoError(t, err)
+
+	// Metric reset times depend on the current time, so use the host clock
+	// rather than wazero's deterministic default.
+	config := wazero.NewModuleConfig().
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime()
+	module, err := runtime.InstantiateModule(ctx, compiled, config)
+	require.NoError(t, err)
+
+	return &wasiModule{t: t, ctx: ctx, module: module}
+}
+
+func (m *wasiModule) call(name string, params ...uint64) []uint64 {
+	m.t.Helper()
+
+	results, err := m.module.ExportedFunction(name).Call(m.ctx, params...)
+	require.NoError(m.t, err)
+	return results
+}
+
+// write copies data into a buffer allocated by the module.
+func (m *wasiModule) write(data []byte) (ptr, length uint64) {
+	m.t.Helper()
+
+	ptr = m.call("alloc", uint64(len(data)))[0]
+	require.True(m.t, m.module.Memory().Write(uint32(ptr), data))
+	return ptr, uint64(len(data))
+}
+
+// read copies out and frees a packed response.
+func (m *wasiModule) read(packed uint64) []byte {
+	m.t.Helper()
+
+	ptr, length := uint32(packed>>32), uint32(packed)
+	data, ok := m.module.Memory().Read(ptr, length)
+	require.True(m.t, ok)
+	data = append([]byte(nil), data...)
+	m.call("free", uint64(ptr))
+	return data
+}
+
+func (m *wasiModule) evaluate(payload []byte) []byte {
+	m.t.Helper()
+
+	ptr, length := m.write(payload)
+	defer m.call("free", ptr)
+	return m.read(m.call("evaluate", ptr, length)[0])
+}
+
+func (m *wasiModule) bridgeCall(method string, payload []byte) []byte {
+	m.t.Helper()
+
+	methodPtr, methodLength := m.write([]byte(method))
+	defer m.call("free", methodPtr)
+	ptr, length := m.write(payload)
+	defer m.call("free", ptr)
+	return m.read(m.call("bridge_call", methodPtr, methodLength, ptr, length)[0])
+}
+
+func testRequests() map[string]*rulesengine.BridgeCheckFlagRequest {
+	period := rulesengine.MetricPeriodCurrentMonth
+	subtype := "api-calls"
+	limit := int64(10)
+	usage := int64(5)
+
+	company := &rulesengine.Company{
+		ID:      "comp_1",
+		PlanIDs: []string{"plan_1"},
+		Metrics: rulesengine.CompanyMetricCollection{{
+			CompanyID:    "comp_1",
+			EventSubtype: subtype,
+			Period:       period,
+			MonthReset:   rulesengine.MetricPeriodMonthResetFirst,
+			Value:        8,
+			CreatedAt:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		Traits: []*rulesengine.Trait{{
+			TraitDefinition: &rulesengine.TraitDefinition{ID: "trait_1", ComparableType: "string", EntityType: rulesengine.EntityTypeCompany},
+			Value:           "enterprise",
+		}},
+	}
+
+	planFlag := &rulesengine.Flag{ID: "flag_plan", Key: "plan-feature", Rules: []*rulesengine.Rule{{
+		ID:       "rule_plan",
+		RuleType: rulesengine.RuleTypePlanEntitlement,
+		Value:    true,
+		Conditions: []*rulesengine.Condition{{
+			ID:            "cond_plan",
+			ConditionType: rulesengine.ConditionTypePlan,
+			Operator:      "eq",
+			ResourceIDs:   []string{"plan_1"},
+		}},
+	}}}
+
+	meteredFlag := &rulesengine.Flag{ID: "flag_metered", Key: "metered", Rules: []*rulesengine.Rule{{
+		ID:       "rule_metered",
+		RuleType: rulesengine.RuleTypePlanEntitlement,
+		Value:    true,
+		Conditions: []*rulesengine.Condition{{
+			ID:            "cond_metric",
+			ConditionType: rulesengine.ConditionTypeMetric,
+			Operator:      "lte",
+			EventSubtype:  &subtype,
+			MetricValue:   &limit,
+			MetricPeriod:  &period,
+		}},
+	}}}
+
+	traitFlag := &rulesengine.Flag{ID: "flag_trait", Key: "trait", DefaultValue: true, Rules: []*rulesengine.Rule{{
+		ID:       "rule_trait",
+		RuleType: rulesengine.RuleTypeStandard,
+		Value:    false,
+		Conditions: []*rulesengine.Condition{{
+			ID:              "cond_trait",
+			ConditionType:   rulesengine.ConditionTypeTrait,
+			Operator:        "eq",
+			TraitDefinition: company.Traits[0].TraitDefinition,
+			TraitValue:      "enterprise",
+		}},
+	}}}
+
+	return map[string]*rulesengine.BridgeCheckFlagRequest{
+		"Plan match":              {Company: company, Flag: planFlag},
+		"Metric under limit":      {Company: company, Flag: meteredFlag},
+		"Metric with preflight":   {Company: company, Flag: meteredFlag, Options: &rulesengine.PreflightOptions{Usage: &usage}},
+		"Trait match":             {Company: company, Flag: traitFlag},
+		"No company":              {Flag: planFlag},
+		"Negative preflight":      {Company: company, Flag: planFlag, Options: &rulesengine.PreflightOptions{CreditCosts: map[string]float64{"c": -1}}},
+		"Company without matches": {Company: &rulesengine.Company{ID: "comp_2"}, Flag: planFlag},
+	}
+}
+
+func TestWASIModule(t *testing.T) {
+	module := instantiate(t)
+
+	t.Run("Reports the bridge API version", func(t *testing.T) {
+		assert.Equal(t, uint64(rulesengine.BridgeAPIVersion), module.call("api_version")[0])
+	})
+
+	t.Run("Evaluations match native CheckFlag", func(t *testing.T) {
+		for name, req := range testRequests() {
+			t.Run(name, func(t *testing.T) {
+				payload, err := json.Marshal(req)
+				require.NoError(t, err)
+
+				got := module.evaluate(payload)
+				want := rulesengine.BridgeCall(context.Background(), rulesengine.BridgeMethodCheckFlag, payload)
+				assert.JSONEq(t, string(want), string(got))
+
+				var resp struct {
+					Result *rulesengine.BridgeCheckFlagResponse `json:"result"`
+				}
+				require.NoError(t, json.Unmarshal(got, &resp))
+				native, _ := rulesengine.CheckFlag(context.Background(), req.Company, req.User, req.Flag, req.Options.CheckFlagOptions()...)
+				assert.Equal(t, native.Value, resp.Result.Result.Value)
+				assert.Equal(t, native.Reason, resp.Result.Result.Reason)
+				assert.Equal(t, native.RuleID, resp.Result.Result.RuleID)
+			})
+		}
+	})
+
+	t.Run("Bridge calls match native", func(t *testing.T) {
+		got := module.bridgeCall(rulesengine.BridgeMethodVersionKey, nil)
+		assert.JSONEq(t, string(rulesengine.BridgeCall(context.Background(), rulesengine.BridgeMethodVersionKey, nil)), string(got))
+
+		payload := []byte(`{"allocation": 70, "period": "current_week"}`)
+		got = module.bridgeCall(rulesengine.BridgeMethodNormalizeAllocation, payload)
+		assert.JSONEq(t, string(rulesengine.BridgeCall(context.Background(), rulesengine.BridgeMethodNormalizeAllocation, payload)), string(got))
+	})
+
+	t.Run("Malformed input returns a structured error", func(t *testing.T) {
+		var resp rulesengine.BridgeResponse
+		require.NoError(t, json.Unmarshal(module.evaluate([]byte(`{"flag":`)), &resp))
+
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rulesengine.BridgeErrorInvalidJSON, resp.Error.Code)
+	})
+
+	t.Run("Requests outside allocated buffers are rejected", func(t *testing.T) {
+		ptr, _ := module.write([]byte(`{}`))
+		defer module.call("free", ptr)
+
+		var resp rulesengine.BridgeResponse
+		require.NoError(t, json.Unmarshal(module.read(module.call("evaluate", ptr, 1<<20)[0]), &resp))
+
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, rulesengine.BridgeErrorInvalidJSON, resp.Error.Code)
+	})
+}